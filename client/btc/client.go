@@ -16,6 +16,9 @@ import (
 	"github.com/dev-warrior777/go-electrum-client/wallet/wltbtc"
 )
 
+// Virtual size of the mempool mined in each block
+const BLOCK_VSIZE = 1_000_000
+
 // BtcElectrumClient - implements ElectrumClient interface
 type BtcElectrumClient struct {
 	// Cancel is the cancel func for the goele context
@@ -31,6 +34,14 @@ type BtcElectrumClient struct {
 	// Forward tip change notify to external user if regustered
 	sendTipChangeNotify    chan int64
 	sendTipChangeNotifyMtx sync.RWMutex
+	// Receive reorg notify channel from electrumx
+	rcvReorgNotify <-chan *electrumx.ReorgEvent
+	// Confirmed txs waiting for our headers to reach their height before the
+	// merkle proof can be checked. txid => height
+	pendingProofs    map[string]int64
+	pendingProofsMtx sync.Mutex
+	// Fee levels for the wallet from the servers' view of the mempool
+	feeEstimator *client.ServerFeeEstimator
 }
 
 func NewBtcElectrumClient(cfg *client.ClientConfig) client.ElectrumClient {
@@ -41,7 +52,9 @@ func NewBtcElectrumClient(cfg *client.ClientConfig) client.ElectrumClient {
 		X:                   nil,
 		rcvTipChangeNotify:  nil,
 		sendTipChangeNotify: nil,
+		pendingProofs:       make(map[string]int64),
 	}
+	ec.feeEstimator = client.NewServerFeeEstimator(ec.GetX, BLOCK_VSIZE)
 	return &ec
 }
 
@@ -129,6 +142,11 @@ func (ec *BtcElectrumClient) Start(parentCtx context.Context) error {
 		return err
 	}
 	go ec.tipChange(goeleCtx)
+	ec.rcvReorgNotify, err = ec.X.GetReorgNotify()
+	if err != nil {
+		return err
+	}
+	go ec.reorg(goeleCtx)
 	return nil
 }
 
@@ -148,6 +166,7 @@ func (ec *BtcElectrumClient) CreateWallet(pw string) error {
 	}
 
 	walletCfg := ec.ClientConfig.MakeWalletConfig()
+	walletCfg.FeeEstimator = ec.feeEstimator
 
 	ec.Wallet, err = wltbtc.NewBtcElectrumWallet(walletCfg, pw)
 	if err != nil {
@@ -169,6 +188,7 @@ func (ec *BtcElectrumClient) RecreateWallet(ctx context.Context, pw, mnenomic st
 		return err
 	}
 	walletCfg := ec.ClientConfig.MakeWalletConfig()
+	walletCfg.FeeEstimator = ec.feeEstimator
 	ec.Wallet, err = wltbtc.RecreateElectrumWallet(walletCfg, pw, mnenomic)
 	if err != nil {
 		return err
@@ -193,6 +213,7 @@ func (ec *BtcElectrumClient) LoadWallet(pw string) error {
 		return err
 	}
 	walletCfg := ec.ClientConfig.MakeWalletConfig()
+	walletCfg.FeeEstimator = ec.feeEstimator
 	ec.Wallet, err = wltbtc.LoadBtcElectrumWallet(walletCfg, pw)
 	if err != nil {
 		return err
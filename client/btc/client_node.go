@@ -59,3 +59,47 @@ func (ec *BtcElectrumClient) GetAddressUnspent(ctx context.Context, addr string)
 	}
 	return node.GetListUnspent(ctx, scripthash)
 }
+
+// Return the confirmed and unconfirmed balances of any address.
+func (ec *BtcElectrumClient) GetAddressBalance(ctx context.Context, addr string) (*electrumx.BalanceResult, error) {
+	node := ec.GetX()
+	if node == nil {
+		return nil, ErrNoElectrumX
+	}
+	scripthash, err := addrToElectrumScripthash(addr, ec.GetConfig().Params)
+	if err != nil {
+		return nil, err
+	}
+	return node.GetBalance(ctx, scripthash)
+}
+
+// Return the unconfirmed transactions of any address.
+func (ec *BtcElectrumClient) GetAddressMempool(ctx context.Context, addr string) (electrumx.MempoolResult, error) {
+	node := ec.GetX()
+	if node == nil {
+		return nil, ErrNoElectrumX
+	}
+	scripthash, err := addrToElectrumScripthash(addr, ec.GetConfig().Params)
+	if err != nil {
+		return nil, err
+	}
+	return node.GetMempool(ctx, scripthash)
+}
+
+// Return the fee histogram of the server's mempool.
+func (ec *BtcElectrumClient) GetFeeHistogram(ctx context.Context) (electrumx.FeeHistogram, error) {
+	node := ec.GetX()
+	if node == nil {
+		return nil, ErrNoElectrumX
+	}
+	return node.GetFeeHistogram(ctx)
+}
+
+// Return the minimum fee rate in satoshis per kilobyte for a tx to be relayed.
+func (ec *BtcElectrumClient) RelayFee(ctx context.Context) (int64, error) {
+	node := ec.GetX()
+	if node == nil {
+		return 0, ErrNoElectrumX
+	}
+	return node.GetRelayFee(ctx)
+}
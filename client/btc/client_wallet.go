@@ -5,10 +5,15 @@ import (
 	"context"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/dev-warrior777/go-electrum-client/client"
+	"github.com/dev-warrior777/go-electrum-client/electrumx"
 	"github.com/dev-warrior777/go-electrum-client/wallet"
 )
 
@@ -28,42 +33,54 @@ func (ec *BtcElectrumClient) SyncWallet(ctx context.Context) error {
 	if w == nil {
 		return ErrNoWallet
 	}
+	node := ec.GetX()
+	if node == nil {
+		return ErrNoElectrumX
+	}
+	// - get all subscribed receive/change/watched addresses in wallet db
 	subscriptions, err := w.ListSubscriptions()
 	if err != nil {
 		return err
 	}
-	// - get all subscribed receive/change/watched addresses in wallet db
+	scripthashes := make([]string, 0, len(subscriptions))
 	for _, subscription := range subscriptions {
+		scripthashes = append(scripthashes, subscription.ElectrumScripthash)
+	}
 
-		// for each:
-		//   - subscribe for scripthash notifications from electrumX node
-		//   - on sub the return is hash of all address history known to server
-		//     i.e. the up to date history list of txid:height, if any
-		//   - for each tx insert or update the wallet db
-
-		status, err := ec.SubscribeAddressNotify(ctx, subscription)
-		if err != nil {
-			return err
+	// - subscribe for scripthash notifications from electrumX node in batches
+	// - on sub the return is hash of all address history known to server
+	//   i.e. the up to date history list of txid:height, if any
+	statuses, err := node.SubscribeScripthashNotifyBatch(ctx, scripthashes)
+	if err != nil {
+		return err
+	}
+	withHistory := make([]*wallet.Subscription, 0, len(subscriptions))
+	serverStatuses := make(map[string]string, len(subscriptions))
+	for i, status := range statuses {
+		if status.Err != nil {
+			return status.Err
 		}
-		if status == "" {
+		if status.Status == "" {
 			// fmt.Println("no history for this script address .. yet")
 			continue
 		}
-		// get address history to date for this address from ElectrumX
-		history, err := ec.GetAddressHistoryFromNode(ctx, subscription)
-		if err != nil {
-			return err
-		}
-		// ec.dumpHistory(subscription, history)
+		withHistory = append(withHistory, subscriptions[i])
+		serverStatuses[status.Scripthash] = status.Status
+	}
 
-		// update wallet txstore if needed
-		ec.addTxHistoryToWallet(ctx, history)
+	// - get address history to date for addresses with history whose status
+	//   has changed and for each tx insert or update the wallet db
+	err = ec.syncSubscriptionsHistory(ctx, withHistory, serverStatuses)
+	if err != nil {
+		return err
 	}
 	// start goroutine to listen for scripthash status change notifications arriving
 	err = ec.addressStatusNotify(ctx)
 	if err != nil {
 		return err
 	}
+	// start goroutine to retry broadcasts which failed with a network error
+	go ec.rebroadcastLoop(ctx)
 	return nil
 }
 
@@ -197,8 +214,15 @@ func (ec *BtcElectrumClient) RpcBroadcast(ctx context.Context, tx string) (strin
 // bitcoin network. It may also set up address status change notifications with
 // ElectrumX in the wallet db for addresses such as change address belonging to
 // the wallet.
+//
+// If the broadcast fails with a network error rather than being rejected by
+// the server the tx is kept in the wallet db and broadcast again until it is
+// seen or abandoned. The txid is returned with an error wrapping
+// client.ErrBroadcastQueued.
+//
+// A tx rejected by the server returns an *electrumx.BroadcastError which
+// matches the reason with errors.Is, e.g. electrumx.ErrTxMinRelayFee.
 func (ec *BtcElectrumClient) Broadcast(ctx context.Context, rawTx []byte) (string, error) {
-	params := ec.ClientConfig.Params
 	w := ec.GetWallet()
 	if w == nil {
 		return "", ErrNoWallet
@@ -214,9 +238,59 @@ func (ec *BtcElectrumClient) Broadcast(ctx context.Context, rawTx []byte) (strin
 	if err != nil {
 		return "", err
 	}
-	// Find any outputs that pay back to this wallet. In particular we almost
-	// always have a change scriptaddress to watch paying back to this	 wallet
-	// after it's containing tx is broadcasted to the network by ElectrumX
+	backToWallet, err := ec.outputsBackToWallet(tx)
+	if err != nil {
+		return "", err
+	}
+
+	// Send tx to ElectrumX for broadcasting to the bitcoin network
+	rawTxStr := hex.EncodeToString(rawTx)
+	txid, err := node.Broadcast(ctx, rawTxStr)
+	if electrumx.IsTxKnown(err) {
+		// a server already has the tx so it is broadcast
+		txid, err = tx.TxHash().String(), nil
+	}
+	if err != nil {
+		if electrumx.IsServerRejection(err) {
+			return "", err
+		}
+		// network error - keep the tx to broadcast again
+		txid = tx.TxHash().String()
+		now := time.Now()
+		qerr := w.AddPendingBroadcast(&wallet.PendingBroadcast{
+			Txid:        txid,
+			RawTx:       rawTx,
+			Created:     now,
+			Attempts:    1,
+			LastAttempt: now,
+			LastError:   err.Error(),
+		})
+		if qerr != nil {
+			return "", err
+		}
+		// the tx may have reached the server - if not the outputs are
+		// subscribed when it is broadcast again
+		if serr := ec.subscribeBackToWallet(ctx, tx, backToWallet); serr != nil {
+			fmt.Printf("cannot subscribe outputs of queued tx %s: %v\n", txid, serr)
+		}
+		return txid, fmt.Errorf("%w: %v", client.ErrBroadcastQueued, err)
+	}
+
+	err = ec.subscribeBackToWallet(ctx, tx, backToWallet)
+	if err != nil {
+		return "", err
+	}
+	return txid, nil
+}
+
+// outputsBackToWallet finds any outputs of tx that pay back to this wallet
+// keyed by output index.
+func (ec *BtcElectrumClient) outputsBackToWallet(tx *wire.MsgTx) (map[int][]byte, error) {
+	params := ec.ClientConfig.Params
+	w := ec.GetWallet()
+	// In particular we almost always have a change scriptaddress to watch
+	// paying back to this wallet after it's containing tx is broadcasted to
+	// the network by ElectrumX
 	ourAddresses := w.ListAddresses()
 	isOurs := func(address btcutil.Address) bool {
 		for _, ourAddress := range ourAddresses {
@@ -231,28 +305,26 @@ func (ec *BtcElectrumClient) Broadcast(ctx context.Context, rawTx []byte) (strin
 		pkScript := txOut.PkScript
 		_, addresses, _, err := txscript.ExtractPkScriptAddrs(pkScript, params)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		if len(addresses) != 1 {
-			return "", err
+			return nil, err
 		}
 		if isOurs(addresses[0]) {
 			backToWallet[idx] = pkScript
 		}
 	}
 	// fmt.Printf("found %d address(es) back to our wallet\n", len(backToWallet))
+	return backToWallet, nil
+}
 
-	// Send tx to ElectrumX for broadcasting to the bitcoin network
-	rawTxStr := hex.EncodeToString(rawTx)
-	txid, err := node.Broadcast(ctx, rawTxStr)
-	if err != nil {
-		return "", err
-	}
-
-	// Subscribe for address status notification from ElectrumX for addresses
-	// paying back to our wallet. This will also add the containing tx to the
-	// wallet txns db in response to the first status change notification of
-	// the subscribed address.
+// subscribeBackToWallet subscribes for address status notification from
+// ElectrumX for addresses paying back to our wallet. This will also add the
+// containing tx to the wallet txns db in response to the first status change
+// notification of the subscribed address.
+func (ec *BtcElectrumClient) subscribeBackToWallet(ctx context.Context, tx *wire.MsgTx, backToWallet map[int][]byte) error {
+	w := ec.GetWallet()
+	node := ec.GetX()
 	for idx := range tx.TxOut {
 		pkScript, ok := backToWallet[idx]
 		if !ok {
@@ -267,7 +339,7 @@ func (ec *BtcElectrumClient) Broadcast(ctx context.Context, rawTx []byte) (strin
 			Address:            addr,
 		}
 		// add to db
-		err = w.AddSubscription(&newSub)
+		err := w.AddSubscription(&newSub)
 		if err != nil {
 			// assert db store .. stop here before things get more messed up
 			panic(err)
@@ -277,14 +349,14 @@ func (ec *BtcElectrumClient) Broadcast(ctx context.Context, rawTx []byte) (strin
 		res, err := node.SubscribeScripthashNotify(ctx, scripthash)
 		if err != nil {
 			w.RemoveSubscription(newSub.PkScript)
-			return "", err
+			return err
 		}
 		if res == nil { // network error
 			w.RemoveSubscription(newSub.PkScript)
-			return "", errors.New("network: empty result")
+			return errors.New("network: empty result")
 		}
 	}
-	return txid, nil
+	return nil
 }
 
 // ListUnspent returns a list of all utxos in the wallet db.
@@ -432,6 +504,34 @@ func (ec *BtcElectrumClient) Balance() (int64, int64, int64, error) {
 	return w.Balance()
 }
 
+// ServerBalance returns the confirmed and unconfirmed balances the server has
+// for all the addresses subscribed in the wallet, including watched ones. It
+// can be used to reconcile the wallet balance with the server's view.
+func (ec *BtcElectrumClient) ServerBalance(ctx context.Context) (int64, int64, error) {
+	w := ec.GetWallet()
+	if w == nil {
+		return 0, 0, ErrNoWallet
+	}
+	node := ec.GetX()
+	if node == nil {
+		return 0, 0, ErrNoElectrumX
+	}
+	subscriptions, err := w.ListSubscriptions()
+	if err != nil {
+		return 0, 0, err
+	}
+	var confirmed, unconfirmed int64
+	for _, subscription := range subscriptions {
+		balance, err := node.GetBalance(ctx, subscription.ElectrumScripthash)
+		if err != nil {
+			return 0, 0, err
+		}
+		confirmed += balance.Confirmed
+		unconfirmed += balance.Unconfirmed
+	}
+	return confirmed, unconfirmed, nil
+}
+
 func (ec *BtcElectrumClient) FreezeUTXO(txid string, out uint32) error {
 	w := ec.GetWallet()
 	if w == nil {
@@ -457,16 +557,15 @@ func (ec *BtcElectrumClient) UnfreezeUTXO(txid string, out uint32) error {
 }
 
 func (ec *BtcElectrumClient) FeeRate(ctx context.Context, confTarget int64) (int64, error) {
-	// Maye we can use oracle like https://blockexplorer.one/bitcoin/mainnet (/testnet)
-	// https://rest.cryptoapis.io/v2/blockchain-data/bitcoin/testnet/mempool/fees
-	// I do not like this!
-	// node := ec.GetNode()
-	// if node != nil {
-	// 	feeRate, _ := node.EstimateFeeRate(ctx, confTarget)
-	// 	if feeRate != -1 {
-	// 		return feeRate, nil
-	// 	}
-	// }
+	// from the server's mempool and fee estimates
+	feePerByte, err := ec.feeEstimator.FeePerByteForTarget(ctx, confTarget)
+	if err == nil {
+		// no more than the wallet pays for its own txs
+		if w := ec.GetWallet(); w != nil && feePerByte > w.MaxFeePerByte() {
+			feePerByte = w.MaxFeePerByte()
+		}
+		return feePerByte * 1000, nil
+	}
 
 	// static
 	switch ec.ClientConfig.Params {
@@ -0,0 +1,132 @@
+package btc
+
+// Retry queue for broadcasts which failed with a network error.
+//
+// Broadcast keeps such txs in the wallet db. While the wallet is synced they
+// are broadcast again every REBROADCAST_INTERVAL until the tx is in the wallet
+// or known to the server, or until the tx is abandoned.
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+
+	"github.com/dev-warrior777/go-electrum-client/electrumx"
+	"github.com/dev-warrior777/go-electrum-client/wallet"
+)
+
+const REBROADCAST_INTERVAL = time.Minute
+
+// ListPendingBroadcasts returns the txs waiting to be broadcast again.
+func (ec *BtcElectrumClient) ListPendingBroadcasts() ([]*wallet.PendingBroadcast, error) {
+	w := ec.GetWallet()
+	if w == nil {
+		return nil, ErrNoWallet
+	}
+	return w.ListPendingBroadcasts()
+}
+
+// AbandonBroadcast stops broadcasting a pending tx again. The tx may still be
+// mined if it reached any server before.
+func (ec *BtcElectrumClient) AbandonBroadcast(txid string) error {
+	w := ec.GetWallet()
+	if w == nil {
+		return ErrNoWallet
+	}
+	return w.RemovePendingBroadcast(txid)
+}
+
+// rebroadcastLoop broadcasts pending txs again every REBROADCAST_INTERVAL -
+// run as goroutine
+func (ec *BtcElectrumClient) rebroadcastLoop(ctx context.Context) {
+	ticker := time.NewTicker(REBROADCAST_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ec.rebroadcastPending(ctx)
+		}
+	}
+}
+
+// rebroadcastPending makes one pass over the pending broadcasts.
+func (ec *BtcElectrumClient) rebroadcastPending(ctx context.Context) {
+	w := ec.GetWallet()
+	if w == nil {
+		return
+	}
+	pending, err := w.ListPendingBroadcasts()
+	if err != nil {
+		fmt.Printf("rebroadcast: %v\n", err)
+		return
+	}
+	for _, pb := range pending {
+		if ctx.Err() != nil {
+			return
+		}
+		err := ec.rebroadcast(ctx, pb)
+		if err != nil {
+			fmt.Printf("rebroadcast %s: %v\n", pb.Txid, err)
+		}
+	}
+}
+
+// rebroadcast broadcasts one pending tx again and removes it from the queue
+// once it is seen or the server says it already has it. A tx rejected for
+// another reason is kept until abandoned as it may be waiting on a parent
+// still in the queue.
+func (ec *BtcElectrumClient) rebroadcast(ctx context.Context, pb *wallet.PendingBroadcast) error {
+	w := ec.GetWallet()
+	node := ec.GetX()
+	if node == nil {
+		return ErrNoElectrumX
+	}
+	// already in the wallet history
+	if _, err := w.GetTransaction(pb.Txid); err == nil {
+		return w.RemovePendingBroadcast(pb.Txid)
+	}
+	tx, err := newWireTx(pb.RawTx, true)
+	if err != nil {
+		// cannot ever be broadcast
+		w.RemovePendingBroadcast(pb.Txid)
+		return err
+	}
+	// already known to the server
+	if _, err := node.GetRawTransaction(ctx, pb.Txid); err == nil {
+		return ec.broadcastDone(ctx, tx)
+	}
+	_, err = node.Broadcast(ctx, hex.EncodeToString(pb.RawTx))
+	if electrumx.IsTxKnown(err) {
+		err = nil
+	}
+	if err != nil {
+		pb.Attempts++
+		pb.LastAttempt = time.Now()
+		pb.LastError = err.Error()
+		if perr := w.AddPendingBroadcast(pb); perr != nil {
+			return fmt.Errorf("%v - cannot update queue: %w", err, perr)
+		}
+		return err
+	}
+	fmt.Printf("rebroadcast %s after %d attempt(s)\n", pb.Txid, pb.Attempts+1)
+	return ec.broadcastDone(ctx, tx)
+}
+
+// broadcastDone removes a tx the server now has from the queue and subscribes
+// to its outputs back to the wallet so that the tx is added to the wallet.
+func (ec *BtcElectrumClient) broadcastDone(ctx context.Context, tx *wire.MsgTx) error {
+	err := ec.GetWallet().RemovePendingBroadcast(tx.TxHash().String())
+	if err != nil {
+		return err
+	}
+	backToWallet, err := ec.outputsBackToWallet(tx)
+	if err != nil {
+		return err
+	}
+	return ec.subscribeBackToWallet(ctx, tx, backToWallet)
+}
@@ -9,6 +9,14 @@ import (
 	"github.com/dev-warrior777/go-electrum-client/wallet"
 )
 
+// rescanKey is a wallet key address to ask ElectrumX about
+type rescanKey struct {
+	keyIndex   int
+	address    string
+	pkScript   string
+	scripthash string
+}
+
 // RescanWallet asks ElectrumX for info for our wallet keys back to latest
 // checkpoint height.
 // We need to do this for a recreated wallet.
@@ -26,65 +34,89 @@ func (ec *BtcElectrumClient) RescanWallet(ctx context.Context) error {
 	highestKeyIndex := 100
 	historyHitIndex := 0
 
-	for keyIndex := 0; keyIndex <= highestKeyIndex; keyIndex++ {
-		// flip-flop internal/external to improve locality
-		for purpose := 0; purpose < 2; purpose++ {
-			keyPath := &wallet.KeyPath{
-				Purpose: wallet.KeyPurpose(purpose),
-				Index:   keyIndex,
-			}
-			address, err := w.GetAddress(keyPath)
-			if err != nil {
-				fmt.Printf("bad address for: %d:%d\n", keyIndex, purpose)
-				continue
-			}
-			scripthash, err := addressToElectrumScripthash(address)
-			if err != nil {
-				fmt.Printf("cannot make script hash for address: %s\n", address.String())
-				continue
+	// ask for the history of GAP_LIMIT key indexes at a time in one batch
+	for windowStart := 0; windowStart <= highestKeyIndex; windowStart += client.GAP_LIMIT {
+		windowEnd := windowStart + client.GAP_LIMIT - 1
+		if windowEnd > highestKeyIndex {
+			windowEnd = highestKeyIndex
+		}
+		keys := make([]*rescanKey, 0, 2*client.GAP_LIMIT)
+		for keyIndex := windowStart; keyIndex <= windowEnd; keyIndex++ {
+			// flip-flop internal/external to improve locality
+			for purpose := 0; purpose < 2; purpose++ {
+				keyPath := &wallet.KeyPath{
+					Purpose: wallet.KeyPurpose(purpose),
+					Index:   keyIndex,
+				}
+				address, err := w.GetAddress(keyPath)
+				if err != nil {
+					fmt.Printf("bad address for: %d:%d\n", keyIndex, purpose)
+					continue
+				}
+				scripthash, err := addressToElectrumScripthash(address)
+				if err != nil {
+					fmt.Printf("cannot make script hash for address: %s\n", address.String())
+					continue
+				}
+				pkScriptBytes, err := w.AddressToScript(address)
+				if err != nil {
+					fmt.Printf("cannot make pkScript for address: %s\n", address.String())
+					continue
+				}
+				// fmt.Printf("%s %s  Index:purpose %d:%d\n", address.String(), scripthash, keyIndex, purpose)
+				keys = append(keys, &rescanKey{
+					keyIndex:   keyIndex,
+					address:    address.String(),
+					pkScript:   hex.EncodeToString(pkScriptBytes),
+					scripthash: scripthash,
+				})
 			}
-			// fmt.Printf("%s %s  Index:purpose %d:%d\n", address.String(), scripthash, keyIndex, purpose)
+		}
+		if len(keys) == 0 {
+			continue
+		}
 
-			history, err := node.GetHistory(ctx, scripthash)
-			if err != nil {
-				fmt.Printf("error: %v - for scripthash %s\n", scripthash, err)
+		scripthashes := make([]string, 0, len(keys))
+		for _, key := range keys {
+			scripthashes = append(scripthashes, key.scripthash)
+		}
+		results, err := node.GetHistoryBatch(ctx, scripthashes)
+		if err != nil {
+			return err
+		}
+
+		for i, r := range results {
+			key := keys[i]
+			if r.Err != nil {
+				fmt.Printf("error: %v - for scripthash %s\n", r.Err, key.scripthash)
 				continue
 			}
-			if len(history) == 0 {
-				// fmt.Printf("No history for script hash from node: %s\n", scripthash)
+			if len(r.History) == 0 {
+				// fmt.Printf("No history for script hash from node: %s\n", key.scripthash)
 				continue
 			}
 			// got history - update the highest hit index
-			historyHitIndex = keyIndex
-			// for _, h := range history {
-			// 	fmt.Println(" Height:", h.Height)
-			// 	fmt.Println(" TxHash: ", h.TxHash)
-			// 	fmt.Println(" Fee: ", h.Fee)
-			// }
-			pkScriptBytes, err := w.AddressToScript(address)
-			if err != nil {
-				fmt.Printf("cannot make pkScript for address: %s\n", address.String())
-				continue
+			if key.keyIndex > historyHitIndex {
+				historyHitIndex = key.keyIndex
 			}
-			hex.EncodeToString(pkScriptBytes)
 			subscription := &wallet.Subscription{
-				PkScript:           hex.EncodeToString(pkScriptBytes),
-				ElectrumScripthash: scripthash,
-				Address:            address.String(),
+				PkScript:           key.pkScript,
+				ElectrumScripthash: key.scripthash,
+				Address:            key.address,
 			}
 			err = w.AddSubscription(subscription)
 			if err != nil {
-				fmt.Printf("cannot add subscritpion for address: %s\n", address.String())
+				fmt.Printf("cannot add subscritpion for address: %s\n", key.address)
 				// ec.dumpSubscription("failed to add", subscription)
 				continue
 			}
-			// fmt.Printf("Added subscritpion for address: %s to wallet subscriptions\n", address.String())
+			// fmt.Printf("Added subscritpion for address: %s to wallet subscriptions\n", key.address)
 		}
 
 		// if no more history hits for another GAP_LIMIT tries consider the job done.
-		if keyIndex > historyHitIndex+client.GAP_LIMIT {
+		if windowEnd > historyHitIndex+client.GAP_LIMIT {
 			// fmt.Printf("keyIndex: %d greater than highest history found index %d by GAP_LIMIT %d\n\n",
-			// 	keyIndex, historyHitIndex, client.GAP_LIMIT)
+			// 	windowEnd, historyHitIndex, client.GAP_LIMIT)
 			break
 		}
 	}
@@ -0,0 +1,149 @@
+package btc
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/dev-warrior777/go-electrum-client/client"
+	"github.com/dev-warrior777/go-electrum-client/electrumx"
+	"github.com/dev-warrior777/go-electrum-client/electrumx/electrumxtest"
+	"github.com/dev-warrior777/go-electrum-client/wallet"
+)
+
+// waitFor polls cond until it is true or fails the test after a while.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// TestSimulatedChain drives the client against a simulated regtest chain:
+// create wallet, receive, spend, confirm and reorg.
+func TestSimulatedChain(t *testing.T) {
+	sim := electrumxtest.NewSimulator(&electrumxtest.Options{TLS: true})
+	if err := sim.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sim.Close)
+	// deep enough for the client to rewind on a reorg
+	sim.Mine(10)
+
+	const pw = "abc"
+	cfg := client.NewDefaultConfig()
+	cfg.CoinType = wallet.Bitcoin
+	cfg.NetType = electrumx.Regtest
+	cfg.Params = &chaincfg.RegressionNetParams
+	cfg.DataDir = t.TempDir()
+	cfg.StoreEncSeed = true
+	cfg.Testing = true
+	cfg.TrustedPeer = &electrumx.NodeServerAddr{Net: "ssl", Addr: sim.Addr()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	ec := NewBtcElectrumClient(cfg)
+	if err := ec.CreateWallet(pw); err != nil {
+		t.Fatal(err)
+	}
+	if err := ec.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer ec.Stop()
+	if err := ec.SyncWallet(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if tip := ec.Tip(); tip != 10 {
+		t.Fatalf("synced to %d", tip)
+	}
+
+	// receive
+	addr, err := ec.UnusedAddress(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err := btcutil.DecodeAddress(addr, cfg.Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkScript, err := txscript.PayToAddrScript(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fundTx := sim.Fund(pkScript, 1e8)
+	waitFor(t, "unconfirmed balance", func() bool {
+		_, unconfirmed, _, _ := ec.Balance()
+		return unconfirmed == 1e8
+	})
+	sim.Mine(1)
+	waitFor(t, "confirmed balance", func() bool {
+		confirmed, _, _, _ := ec.Balance()
+		return confirmed == 1e8
+	})
+	// the server's history is stored for the local status
+	waitFor(t, "stored history", func() bool {
+		sub, err := ec.GetWallet().GetSubscription(hex.EncodeToString(pkScript))
+		return err == nil && len(sub.History) == 1 &&
+			sub.History[0].TxHash == fundTx.TxHash().String() && sub.History[0].Height == sim.Tip()
+	})
+
+	// spend
+	_, rawTxHex, txid, err := ec.Spend(pw, 30_000_000, ab, wallet.NORMAL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawTx, _ := hex.DecodeString(rawTxHex)
+	if _, err := ec.Broadcast(ctx, rawTx); err != nil {
+		t.Fatal(err)
+	}
+	if height, ok := sim.TxHeight(txid); !ok || height != 0 {
+		t.Fatalf("spend not in mempool: height %d known %v", height, ok)
+	}
+	// the same tx again is already broadcast
+	if again, err := ec.Broadcast(ctx, rawTx); err != nil || again != txid {
+		t.Fatalf("broadcast again got %s: %v", again, err)
+	}
+
+	// confirm
+	sim.Mine(1)
+	txHeight := func() int64 {
+		txn, err := ec.GetWallet().GetTransaction(txid)
+		if err != nil {
+			return -1
+		}
+		return txn.Height
+	}
+	waitFor(t, "spend confirmed", func() bool {
+		return txHeight() == sim.Tip()
+	})
+
+	// reorg the spend into a different block
+	sim.Mine(2)
+	if err := sim.Reorg(3, 4); err != nil {
+		t.Fatal(err)
+	}
+	sim.Mine(1)
+	height, _ := sim.TxHeight(txid)
+	if height != 12 {
+		t.Fatalf("spend reconfirmed at %d", height)
+	}
+	waitFor(t, "reorg", func() bool {
+		if ec.Tip() != sim.Tip() || txHeight() != height {
+			return false
+		}
+		hdr, err := ec.GetBlockHeader(sim.Tip())
+		return err == nil && hdr.Hash == sim.Chain().BlockHash(sim.Tip()).String()
+	})
+	confirmed, unconfirmed, _, err := ec.Balance()
+	if err != nil || unconfirmed != 0 || confirmed >= 70_000_000 || confirmed < 69_000_000 {
+		t.Fatalf("balance after reorg %d/%d: %v", confirmed, unconfirmed, err)
+	}
+}
@@ -168,6 +168,10 @@ func (ec *BtcElectrumClient) addressStatusNotify(ctx context.Context) error {
 					return
 				}
 
+				if status.Resubscribed && status.Scripthash == "" {
+					fmt.Println("addresses resubscribed on new leader")
+					continue
+				}
 				if status.Status == "" {
 					// fmt.Println("status.Status is null no history yet; ignoring...")
 					continue
@@ -181,6 +185,10 @@ func (ec *BtcElectrumClient) addressStatusNotify(ctx context.Context) error {
 				if sub == nil { // db assert
 					panic("no subscription for subscribed scripthash")
 				}
+				if localStatus(sub) == status.Status {
+					// fmt.Println("status unchanged; ignoring...")
+					continue
+				}
 
 				// get scripthash history
 				history, err := ec.GetAddressHistoryFromNode(ctx, sub)
@@ -188,9 +196,11 @@ func (ec *BtcElectrumClient) addressStatusNotify(ctx context.Context) error {
 					continue
 				}
 				// ec.dumpHistory(sub, history)
+				ec.checkServerStatus(ctx, status.Scripthash, status.Status, history)
 
 				// add/update wallet db tx store
 				ec.addTxHistoryToWallet(ctx, history)
+				ec.storeHistory(sub, history)
 			}
 		}
 	}()
@@ -294,8 +304,160 @@ func (ec *BtcElectrumClient) GetRawTransactionFromNode(ctx context.Context, txid
 	return msgTx, txTime, nil
 }
 
+// getRawTransactionsFromNode requests raw hex transactions from ElectrumX for
+// a list of txids in batches. A tx which does not hash to its txid is reported
+// and asked of the leader again. Txs the servers could not send or which do
+// not decode are missing from the returned map.
+func (ec *BtcElectrumClient) getRawTransactionsFromNode(ctx context.Context, txids []string) (map[string]*wire.MsgTx, error) {
+	node := ec.GetX()
+	if node == nil {
+		return nil, ErrNoElectrumX
+	}
+	results, err := node.GetRawTransactionBatch(ctx, txids)
+	if err != nil {
+		return nil, err
+	}
+	msgTxs := make(map[string]*wire.MsgTx, len(results))
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Printf("cannot get tx %s: %v\n", r.Txid, r.Err)
+			continue
+		}
+		b, err := hex.DecodeString(r.RawTx)
+		if err != nil {
+			continue
+		}
+		msgTx, err := newWireTx(b, true)
+		if err != nil {
+			continue
+		}
+		if msgTx.TxHash().String() != r.Txid {
+			node.ReportBadTx(r.Server, r.Txid)
+			msgTx, _, err = ec.GetRawTransactionFromNode(ctx, r.Txid)
+			if err != nil || msgTx.TxHash().String() != r.Txid {
+				fmt.Printf("cannot get tx %s: wrong tx sent\n", r.Txid)
+				continue
+			}
+		}
+		msgTxs[r.Txid] = msgTx
+	}
+	return msgTxs, nil
+}
+
+// localStatus is the electrum status of the history last stored for the
+// subscription.
+func localStatus(sub *wallet.Subscription) string {
+	history := make(electrumx.HistoryResult, 0, len(sub.History))
+	for _, h := range sub.History {
+		history = append(history, electrumx.History{TxHash: h.TxHash, Height: h.Height})
+	}
+	return electrumx.ScripthashStatus(history)
+}
+
+// storeHistory stores the history the server sent for the subscription's
+// scripthash in server order. It is not stored unless all its txs are in the
+// wallet so that a history whose txs we could not get is asked for again.
+func (ec *BtcElectrumClient) storeHistory(sub *wallet.Subscription, history electrumx.HistoryResult) {
+	w := ec.GetWallet()
+	if w == nil {
+		return
+	}
+	stored := make([]wallet.ScripthashHistory, 0, len(history))
+	for _, h := range history {
+		if has, _ := w.HasTransaction(h.TxHash); !has {
+			return
+		}
+		stored = append(stored, wallet.ScripthashHistory{TxHash: h.TxHash, Height: h.Height})
+	}
+	sub.History = stored
+	if err := w.AddSubscription(sub); err != nil {
+		fmt.Printf("cannot store history of %s: %v\n", sub.ElectrumScripthash, err)
+	}
+}
+
+// checkServerStatus verifies a status the server sent for scripthash against
+// the history it then sent. The history may have changed in between so on a
+// mismatch we ask for the current status before reporting the server.
+func (ec *BtcElectrumClient) checkServerStatus(ctx context.Context, scripthash, status string, history electrumx.HistoryResult) {
+	historyStatus := electrumx.ScripthashStatus(history)
+	if historyStatus == status {
+		return
+	}
+	node := ec.GetX()
+	if node == nil {
+		return
+	}
+	// subscribing again is harmless and returns the current status
+	res, err := node.SubscribeScripthashNotify(ctx, scripthash)
+	if err != nil || res == nil {
+		return
+	}
+	if res.Status == historyStatus {
+		return
+	}
+	node.ReportStatusMismatch(scripthash)
+}
+
+// syncSubscriptionsHistory gets the address history for subscriptions from
+// ElectrumX in batches and adds or updates the wallet transactions. If the
+// server statuses are given we only get history for subscriptions whose status
+// differs from the local status and check the statuses against the history.
+func (ec *BtcElectrumClient) syncSubscriptionsHistory(ctx context.Context, subscriptions []*wallet.Subscription, statuses map[string]string) error {
+	node := ec.GetX()
+	if node == nil {
+		return ErrNoElectrumX
+	}
+	scripthashes := make([]string, 0, len(subscriptions))
+	subs := make(map[string]*wallet.Subscription, len(subscriptions))
+	for _, sub := range subscriptions {
+		if status, ok := statuses[sub.ElectrumScripthash]; ok {
+			if localStatus(sub) == status {
+				continue
+			}
+		}
+		scripthashes = append(scripthashes, sub.ElectrumScripthash)
+		subs[sub.ElectrumScripthash] = sub
+	}
+	if len(scripthashes) == 0 {
+		return nil
+	}
+	results, err := node.GetHistoryBatch(ctx, scripthashes)
+	if err != nil {
+		return err
+	}
+	var history electrumx.HistoryResult
+	for _, r := range results {
+		if r.Err != nil {
+			return fmt.Errorf("history for scripthash %s: %w", r.Scripthash, r.Err)
+		}
+		if status, ok := statuses[r.Scripthash]; ok && electrumx.ScripthashStatus(r.History) != status {
+			// a big batch is spread over peers which may differ from the
+			// leader the status came from - check the leader's history
+			fmt.Printf("history of %s from %s does not match the status - asking the leader\n",
+				r.Scripthash, r.Server)
+			leaderHistory, err := node.GetHistory(ctx, r.Scripthash)
+			if err != nil {
+				return fmt.Errorf("history for scripthash %s: %w", r.Scripthash, err)
+			}
+			r.History = leaderHistory
+			ec.checkServerStatus(ctx, r.Scripthash, status, r.History)
+		}
+		history = append(history, r.History...)
+	}
+	ec.addTxHistoryToWallet(ctx, history)
+	for _, r := range results {
+		if sub, ok := subs[r.Scripthash]; ok {
+			ec.storeHistory(sub, r.History)
+		}
+	}
+	return nil
+}
+
 // addTxHistoryToWallet adds new transaction details for an ElectrumX history list
 func (ec *BtcElectrumClient) addTxHistoryToWallet(ctx context.Context, history electrumx.HistoryResult) {
+	// the txs we do not yet have confirmed in the wallet
+	heights := make(map[string]int64)
+	txids := make([]string, 0, len(history))
 	for _, h := range history {
 		// does wallet already has a confirmed transaction?
 		walletHasTx, txn := ec.GetWallet().HasTransaction(h.TxHash)
@@ -303,13 +465,30 @@ func (ec *BtcElectrumClient) addTxHistoryToWallet(ctx context.Context, history e
 			// fmt.Println("** already got confirmed tx", h.TxHash)
 			continue
 		}
+		if _, ok := heights[h.TxHash]; ok {
+			continue
+		}
+		heights[h.TxHash] = h.Height
+		txids = append(txids, h.TxHash)
+	}
+	if len(txids) == 0 {
+		return
+	}
+	msgTxs, err := ec.getRawTransactionsFromNode(ctx, txids)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	txtime := time.Now()
+	for _, txid := range txids {
 		// add or update the wallet transaction
-		msgTx, txtime, err := ec.GetRawTransactionFromNode(ctx, h.TxHash)
-		if err != nil {
+		msgTx, ok := msgTxs[txid]
+		if !ok {
 			continue
 		}
-		// fmt.Printf("adding/updating transaction txid: %s, height: %d, fee %d\n", h.TxHash, h.Height, h.Fee)
-		err = ec.GetWallet().AddTransaction(msgTx, h.Height, txtime)
+		// fmt.Printf("adding/updating transaction txid: %s, height: %d\n", txid, heights[txid])
+		height := ec.verifiedHeight(ctx, txid, heights[txid])
+		err = ec.GetWallet().AddTransaction(msgTx, height, txtime)
 		if err != nil {
 			fmt.Println(err)
 			continue
@@ -317,6 +496,98 @@ func (ec *BtcElectrumClient) addTxHistoryToWallet(ctx context.Context, history e
 	}
 }
 
+// rollbackWallet unconfirms wallet txs above the reorg fork height then gets
+// the address history for all subscriptions again. Txs still mined on the new
+// chain are confirmed again once their merkle proofs verify.
+func (ec *BtcElectrumClient) rollbackWallet(ctx context.Context, ev *electrumx.ReorgEvent) {
+	w := ec.GetWallet()
+	if w == nil {
+		return
+	}
+	fmt.Printf("reorg: fork height %d old tip %d - rolling back wallet\n", ev.ForkHeight, ev.OldTip)
+	ec.pendingProofsMtx.Lock()
+	for txid, height := range ec.pendingProofs {
+		if height > ev.ForkHeight {
+			delete(ec.pendingProofs, txid)
+		}
+	}
+	ec.pendingProofsMtx.Unlock()
+	err := w.RollbackToHeight(ev.ForkHeight)
+	if err != nil {
+		fmt.Printf("reorg: wallet rollback failed - %v\n", err)
+		return
+	}
+	subscriptions, err := w.ListSubscriptions()
+	if err != nil {
+		fmt.Printf("reorg: %v\n", err)
+		return
+	}
+	err = ec.syncSubscriptionsHistory(ctx, subscriptions, nil)
+	if err != nil {
+		fmt.Printf("reorg: %v\n", err)
+	}
+}
+
+// verifiedHeight checks the merkle proof for a tx the server says is mined at
+// height. The height is returned only if the proof checks out against our own
+// block headers, otherwise the tx is treated as unconfirmed (0). If we do not
+// have the header yet the proof is retried on a later tip change.
+func (ec *BtcElectrumClient) verifiedHeight(ctx context.Context, txid string, height int64) int64 {
+	if height <= 0 {
+		return height
+	}
+	err := ec.GetX().VerifyMerkleProof(ctx, txid, height)
+	switch {
+	case err == nil:
+		ec.pendingProofsMtx.Lock()
+		delete(ec.pendingProofs, txid)
+		ec.pendingProofsMtx.Unlock()
+		return height
+	case errors.Is(err, electrumx.ErrMerkleProofNoHeader):
+		ec.pendingProofsMtx.Lock()
+		ec.pendingProofs[txid] = height
+		ec.pendingProofsMtx.Unlock()
+	case errors.Is(err, electrumx.ErrMerkleProofFailed):
+		fmt.Printf("tx %s: %v\n", txid, err)
+		ec.GetWallet().MarkTxUnverified(txid, err)
+	default:
+		// no network or server error; try again on the next sync
+		fmt.Printf("tx %s: cannot verify merkle proof: %v\n", txid, err)
+	}
+	return 0
+}
+
+// verifyPendingProofs retries merkle proofs of txs that were waiting for our
+// headers to catch up with the height the server gave.
+func (ec *BtcElectrumClient) verifyPendingProofs(ctx context.Context, tip int64) {
+	if ec.GetWallet() == nil || ec.GetX() == nil {
+		return
+	}
+	ready := make(map[string]int64)
+	ec.pendingProofsMtx.Lock()
+	for txid, height := range ec.pendingProofs {
+		if height <= tip {
+			ready[txid] = height
+			delete(ec.pendingProofs, txid)
+		}
+	}
+	ec.pendingProofsMtx.Unlock()
+
+	for txid, height := range ready {
+		if ec.verifiedHeight(ctx, txid, height) <= 0 {
+			continue
+		}
+		msgTx, txtime, err := ec.GetRawTransactionFromNode(ctx, txid)
+		if err != nil {
+			continue
+		}
+		err = ec.GetWallet().AddTransaction(msgTx, height, txtime)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
 func (ec *BtcElectrumClient) pkScriptToAddressPubkeyHash(pkScript []byte) (btcutil.Address, string) {
 	pks, err := txscript.ParsePkScript(pkScript)
 	if err != nil {
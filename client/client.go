@@ -19,11 +19,16 @@ package client
 
 import (
 	"context"
+	"errors"
 
 	"github.com/dev-warrior777/go-electrum-client/electrumx"
 	"github.com/dev-warrior777/go-electrum-client/wallet"
 )
 
+// ErrBroadcastQueued is returned with the txid when a broadcast failed with a
+// network error and the tx was queued to be broadcast again.
+var ErrBroadcastQueued = errors.New("broadcast failed - queued for retry")
+
 type NodeType int
 
 const (
@@ -47,6 +52,10 @@ type ElectrumClient interface {
 	//
 	RegisterTipChangeNotify() (<-chan int64, error)
 	UnregisterTipChangeNotify()
+	GetConnectionStatusNotify() (<-chan *electrumx.ConnectionStatus, error)
+	NetworkStatus() (*electrumx.NetworkStatus, error)
+	GetNetworkEventNotify() (<-chan *electrumx.NetworkEvent, error)
+	TorStatus(ctx context.Context) (*electrumx.TorStatus, error)
 	//
 	CreateWallet(pw string) error
 	LoadWallet(pw string) error
@@ -75,9 +84,12 @@ type ElectrumClient interface {
 	GetWalletTx(txid string) (int, bool, []byte, error)
 	GetWalletSpents() ([]wallet.Stxo, error)
 	Balance() (int64, int64, int64, error)
+	ServerBalance(ctx context.Context) (int64, int64, error)
 
 	// adapt and pass thru to electrumx
 	Broadcast(ctx context.Context, rawTx []byte) (string, error)
+	ListPendingBroadcasts() ([]*wallet.PendingBroadcast, error)
+	AbandonBroadcast(txid string) error
 	FeeRate(ctx context.Context, confTarget int64) (int64, error)
 
 	//pass thru directly to electrumx
@@ -85,6 +97,10 @@ type ElectrumClient interface {
 	GetRawTransaction(ctx context.Context, txid string) ([]byte, error)
 	GetAddressHistory(ctx context.Context, addr string) (electrumx.HistoryResult, error)
 	GetAddressUnspent(ctx context.Context, addr string) (electrumx.ListUnspentResult, error)
+	GetAddressBalance(ctx context.Context, addr string) (*electrumx.BalanceResult, error)
+	GetAddressMempool(ctx context.Context, addr string) (electrumx.MempoolResult, error)
+	GetFeeHistogram(ctx context.Context) (electrumx.FeeHistogram, error)
+	RelayFee(ctx context.Context) (int64, error)
 
 	//coin specific extra for server protocol - use dummy method for non-implmenting coins.
 	// firo EXX addresses
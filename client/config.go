@@ -38,17 +38,74 @@ type ClientConfig struct {
 	// be set.
 	TrustedPeer *electrumx.NodeServerAddr
 
-	// A localhost socks5 proxy port can be set here and will be used as to proxy
-	// ElectrumX server onion connections.
+	// Optional sha256 fingerprint, hex, of the TrustedPeer's TLS certificate.
+	// If set the TrustedPeer must connect with ssl or wss and present this
+	// certificate. Otherwise the first certificate seen for each server is
+	// pinned in the data dir.
+	TrustedPeerCertFingerprint string
+
+	// Checkpoints to prove synced block headers against. If nil the coin's
+	// built in checkpoints for the net type are used.
+	Checkpoints []electrumx.Checkpoint
+
+	// A localhost tor socks5 proxy port, e.g. "9050". Onion ElectrumX servers
+	// are only used if set. Default is "".
 	//
-	// If not "" setting this enables goele to connect to a limited number of
-	// onion servers. Default is "".
-	//
-	// You should have already set up a localhost socks5 proxy and tor service.
-	//
-	// Note: This is tested on Linux and is still considered *Experimental*
+	// You should have already set up a tor service. If set and the proxy is
+	// not up the client fails to start rather than connect without tor.
 	ProxyPort string
 
+	// Which servers to use and which connections go through the proxy.
+	// Default electrumx.Clearnet connects directly to clearnet servers and
+	// to a few onion servers through the proxy. electrumx.PreferTor connects
+	// to all servers through the proxy, onion servers first, and
+	// electrumx.TorOnly connects only to onion servers. The TrustedPeer must
+	// be an onion server with TorOnly.
+	TorPolicy electrumx.TorPolicy
+
+	// Which connections through the proxy share a tor circuit. Default
+	// electrumx.IsolateConnection gives each connection its own.
+	TorIsolation electrumx.TorIsolation
+
+	// TorIsolation for some servers by address, overriding TorIsolation.
+	TorServerIsolation map[string]electrumx.TorIsolation
+
+	// Request categories, e.g. electrumx.Broadcasts, each sent on a new
+	// connection over its own tor circuit. Default 0 uses the server's
+	// connection for every request.
+	TorIsolateRequests electrumx.RequestCategory
+
+	// A localhost tor control port, e.g. "9051". If set the client checks
+	// tor has a circuit before connecting. Default "" does not check.
+	TorControlPort string
+
+	// Password for the tor control port if tor has a HashedControlPassword.
+	// Otherwise tor's cookie file is used if needed.
+	TorControlPassword string
+
+	// Max onion servers to connect to with the Clearnet policy. Default 0
+	// uses the coin's default.
+	MaxOnion int
+
+	// Quorum mode. If greater than 1 address history, utxos and the tip
+	// header are compared across up to this many ElectrumX servers and
+	// servers which disagree with the majority lose reputation. Default 0
+	// trusts the leader server.
+	Quorum int
+
+	// Broadcast txs through this many other ElectrumX servers as well as the
+	// leader for better propagation. Default 0 uses the leader only.
+	BroadcastPeers int
+
+	// Number of stored block headers checked back from the tip on startup.
+	// Bad headers are downloaded again. Default 0 checks the last 2016 and
+	// -1 checks all.
+	HeaderVerifyDepth int64
+
+	// Record every ElectrumX server session to a new file in this directory
+	// to replay later with an electrumx.Replayer. Default "" does not record.
+	RecordDir string
+
 	// Store the seed in encrypted storage - default false
 	StoreEncSeed bool
 
@@ -117,9 +174,22 @@ func (cc *ClientConfig) MakeElectrumXConfig() *electrumx.ElectrumXConfig {
 		Params:      cc.Params, // only genesis .. TODO: remove
 		DataDir:     cc.DataDir,
 		TrustedPeer: cc.TrustedPeer,
+		Checkpoints: cc.Checkpoints,
 		ProxyPort:   cc.ProxyPort,
+		Quorum:      cc.Quorum,
 		Testing:     cc.Testing,
 	}
+	ex.TrustedPeerCertFingerprint = cc.TrustedPeerCertFingerprint
+	ex.BroadcastPeers = cc.BroadcastPeers
+	ex.HeaderVerifyDepth = cc.HeaderVerifyDepth
+	ex.RecordDir = cc.RecordDir
+	ex.TorPolicy = cc.TorPolicy
+	ex.TorIsolation = cc.TorIsolation
+	ex.TorServerIsolation = cc.TorServerIsolation
+	ex.TorIsolateRequests = cc.TorIsolateRequests
+	ex.TorControlPort = cc.TorControlPort
+	ex.TorControlPassword = cc.TorControlPassword
+	ex.MaxOnion = cc.MaxOnion
 	return &ex
 }
 
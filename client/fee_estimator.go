@@ -0,0 +1,207 @@
+package client
+
+// Fee estimation from ElectrumX.
+//
+// ServerFeeEstimator implements wallet.FeeEstimator from the leader's view of
+// the network. For each fee level the fee rate needed to be mined within the
+// level's target number of blocks is read from the mempool fee histogram. If
+// the server has no histogram the daemon's estimatefee for the target is used
+// instead. Either way the fee is never below the server's relay fee. Fees for
+// all levels are fetched together and cached for a minute along with the
+// histogram and relay fee they came from. After a failed fetch the server is
+// not asked again for FEE_RETRY_TIME.
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/dev-warrior777/go-electrum-client/electrumx"
+	"github.com/dev-warrior777/go-electrum-client/wallet"
+)
+
+const (
+	// How long estimates are kept before asking the server again
+	FEE_CACHE_TIME = time.Minute
+	// How long to wait after a failed fetch before asking the server again
+	FEE_RETRY_TIME = 10 * time.Second
+	// Time limit to get fees from the server
+	FEE_ESTIMATE_TIMEOUT = 10 * time.Second
+)
+
+// Blocks to confirmation for each fee level
+var feeLevelTargets = map[wallet.FeeLevel]int64{
+	wallet.PRIORITY:       1,
+	wallet.NORMAL:         3,
+	wallet.ECONOMIC:       6,
+	wallet.FEE_BUMP:       1,
+	wallet.SUPER_ECONOMIC: 25,
+}
+
+var ErrNoFeeEstimate = errors.New("server cannot estimate fees")
+
+// ServerFeeEstimator estimates fees from the ElectrumX servers.
+type ServerFeeEstimator struct {
+	// getX returns the ElectrumX interface or nil if not yet started
+	getX func() electrumx.ElectrumX
+	// virtual size of the mempool mined in each block of the coin
+	blockVSize int64
+
+	fees        map[wallet.FeeLevel]int64 // satoshis per byte
+	histogram   electrumx.FeeHistogram
+	relayFee    int64 // satoshis per byte
+	lastUpdated time.Time
+	lastFailed  time.Time
+	lastErr     error
+	mtx         sync.Mutex
+}
+
+func NewServerFeeEstimator(getX func() electrumx.ElectrumX, blockVSize int64) *ServerFeeEstimator {
+	return &ServerFeeEstimator{
+		getX:       getX,
+		blockVSize: blockVSize,
+		fees:       make(map[wallet.FeeLevel]int64),
+	}
+}
+
+// EstimateFeePerByte implements wallet.FeeEstimator
+func (fe *ServerFeeEstimator) EstimateFeePerByte(feeLevel wallet.FeeLevel) (int64, error) {
+	fees, err := fe.currentFees()
+	if err != nil {
+		return 0, err
+	}
+	fee, ok := fees[feeLevel]
+	if !ok {
+		return fees[wallet.NORMAL], nil
+	}
+	return fee, nil
+}
+
+// currentFees returns the cached fees or fetches them. The lock is not held
+// while fetching so callers are not stuck behind a slow server.
+func (fe *ServerFeeEstimator) currentFees() (map[wallet.FeeLevel]int64, error) {
+	fe.mtx.Lock()
+	if time.Since(fe.lastUpdated) <= FEE_CACHE_TIME {
+		fees := fe.fees
+		fe.mtx.Unlock()
+		return fees, nil
+	}
+	if time.Since(fe.lastFailed) < FEE_RETRY_TIME {
+		err := fe.lastErr
+		fe.mtx.Unlock()
+		return nil, err
+	}
+	fe.mtx.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), FEE_ESTIMATE_TIMEOUT)
+	defer cancel()
+	fees, histogram, relayFee, err := fe.fetchFees(ctx)
+
+	fe.mtx.Lock()
+	defer fe.mtx.Unlock()
+	if err != nil {
+		if !errors.Is(err, ErrNoFeeEstimate) {
+			// not started is no reason to wait
+			fe.lastFailed = time.Now()
+			fe.lastErr = err
+		}
+		return nil, err
+	}
+	fe.fees = fees
+	fe.histogram = histogram
+	fe.relayFee = relayFee
+	fe.lastUpdated = time.Now()
+	return fees, nil
+}
+
+// FeePerByteForTarget estimates the fee per byte to be mined within
+// confTarget blocks from the cached histogram and relay fee. Without a
+// histogram the server's estimatefee for the target is asked.
+func (fe *ServerFeeEstimator) FeePerByteForTarget(ctx context.Context, confTarget int64) (int64, error) {
+	if _, err := fe.currentFees(); err != nil {
+		return 0, err
+	}
+	x := fe.getX()
+	if x == nil {
+		return 0, ErrNoFeeEstimate
+	}
+	fe.mtx.Lock()
+	histogram, relayFee := fe.histogram, fe.relayFee
+	fe.mtx.Unlock()
+	return estimateFeePerByte(ctx, x, histogram, relayFee, confTarget, fe.blockVSize)
+}
+
+// fetchFees gets fees for all levels and the histogram and relay fee they are
+// estimated from - not locked
+func (fe *ServerFeeEstimator) fetchFees(ctx context.Context) (map[wallet.FeeLevel]int64, electrumx.FeeHistogram, int64, error) {
+	x := fe.getX()
+	if x == nil {
+		return nil, nil, 0, ErrNoFeeEstimate
+	}
+	relayFee := relayFeePerByte(ctx, x)
+	histogram, _ := x.GetFeeHistogram(ctx)
+	fees := make(map[wallet.FeeLevel]int64, len(feeLevelTargets))
+	for level, target := range feeLevelTargets {
+		fee, err := estimateFeePerByte(ctx, x, histogram, relayFee, target, fe.blockVSize)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		fees[level] = fee
+	}
+	return fees, histogram, relayFee, nil
+}
+
+// relayFeePerByte is the server's relay fee per byte or 1 if unknown.
+func relayFeePerByte(ctx context.Context, x electrumx.ElectrumX) int64 {
+	relayFee, err := x.GetRelayFee(ctx)
+	if err != nil || relayFee <= 0 {
+		return 1
+	}
+	return ceilDiv(relayFee, 1000)
+}
+
+// estimateFeePerByte estimates from the histogram if there is one, else from
+// estimatefee. The fee is no less than relayFee.
+func estimateFeePerByte(
+	ctx context.Context,
+	x electrumx.ElectrumX,
+	histogram electrumx.FeeHistogram,
+	relayFee, confTarget, blockVSize int64) (int64, error) {
+
+	var fee int64
+	if len(histogram) > 0 {
+		fee = histogramFeePerByte(histogram, confTarget, blockVSize)
+	} else {
+		feeRate, err := x.EstimateFeeRate(ctx, confTarget)
+		if err != nil {
+			return 0, err
+		}
+		fee = ceilDiv(feeRate, 1000)
+	}
+	if fee < relayFee {
+		fee = relayFee
+	}
+	return fee, nil
+}
+
+// histogramFeePerByte returns the fee rate of the last tx which would fit in
+// the next confTarget blocks of blockVSize if miners take the highest fee
+// rates first. If the whole mempool fits it returns 0 and any fee above relay
+// fee will do.
+func histogramFeePerByte(histogram electrumx.FeeHistogram, confTarget, blockVSize int64) int64 {
+	space := confTarget * blockVSize
+	var vsize int64
+	for _, entry := range histogram {
+		vsize += entry.VSize
+		if vsize >= space {
+			return int64(math.Ceil(entry.FeeRate))
+		}
+	}
+	return 0
+}
+
+func ceilDiv(a, b int64) int64 {
+	return (a + b - 1) / b
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dev-warrior777/go-electrum-client/electrumx"
+	"github.com/dev-warrior777/go-electrum-client/wallet"
+)
+
+// feeX answers the fee queries only
+type feeX struct {
+	electrumx.ElectrumX
+	histogram electrumx.FeeHistogram
+	relayFee  int64 // sat/kB
+	feeRate   int64 // sat/kB
+	feeErr    error
+	calls     int
+}
+
+func (x *feeX) GetFeeHistogram(context.Context) (electrumx.FeeHistogram, error) {
+	x.calls++
+	if x.histogram == nil {
+		return nil, errors.New("no histogram")
+	}
+	return x.histogram, nil
+}
+
+func (x *feeX) GetRelayFee(context.Context) (int64, error) {
+	return x.relayFee, nil
+}
+
+func (x *feeX) EstimateFeeRate(context.Context, int64) (int64, error) {
+	return x.feeRate, x.feeErr
+}
+
+func TestHistogramFeePerByte(t *testing.T) {
+	histogram := electrumx.FeeHistogram{
+		{FeeRate: 50, VSize: 600_000},
+		{FeeRate: 20.2, VSize: 600_000},
+		{FeeRate: 10, VSize: 2_000_000},
+	}
+	tests := []struct {
+		target int64
+		want   int64
+	}{
+		{1, 21},
+		{2, 10},
+		{3, 10},
+		{4, 0},
+	}
+	for _, test := range tests {
+		if got := histogramFeePerByte(histogram, test.target, 1_000_000); got != test.want {
+			t.Errorf("target %d: got %d, want %d", test.target, got, test.want)
+		}
+	}
+}
+
+func TestServerFeeEstimator(t *testing.T) {
+	x := &feeX{
+		histogram: electrumx.FeeHistogram{
+			{FeeRate: 50, VSize: 1_000_000},
+			{FeeRate: 30, VSize: 2_000_000},
+			{FeeRate: 12, VSize: 3_000_000},
+		},
+		relayFee: 5000,
+	}
+	fe := NewServerFeeEstimator(func() electrumx.ElectrumX { return x }, 1_000_000)
+
+	want := map[wallet.FeeLevel]int64{
+		wallet.PRIORITY:       50,
+		wallet.NORMAL:         30,
+		wallet.ECONOMIC:       12,
+		wallet.FEE_BUMP:       50,
+		wallet.SUPER_ECONOMIC: 5, // mempool clears - relay fee
+	}
+	for level, fee := range want {
+		got, err := fe.EstimateFeePerByte(level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != fee {
+			t.Errorf("level %d: got %d, want %d", level, got, fee)
+		}
+	}
+	if x.calls != 1 {
+		t.Fatalf("fees fetched %d times, want cached", x.calls)
+	}
+
+	// any target from the cached histogram
+	got, err := fe.FeePerByteForTarget(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 30 {
+		t.Fatalf("got %d, want 30", got)
+	}
+	if x.calls != 1 {
+		t.Fatalf("fees fetched %d times, want cached", x.calls)
+	}
+
+	// no histogram - use estimatefee
+	x.histogram = nil
+	x.feeRate = 8500
+	noHistogram := NewServerFeeEstimator(func() electrumx.ElectrumX { return x }, 1_000_000)
+	got, err = noHistogram.FeePerByteForTarget(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 9 {
+		t.Fatalf("got %d, want 9", got)
+	}
+
+	// a bigger block takes more of the mempool
+	bigBlocks := NewServerFeeEstimator(func() electrumx.ElectrumX { return x }, 2_000_000)
+	x.histogram = electrumx.FeeHistogram{
+		{FeeRate: 50, VSize: 1_000_000},
+		{FeeRate: 30, VSize: 2_000_000},
+	}
+	if got, _ := bigBlocks.EstimateFeePerByte(wallet.PRIORITY); got != 30 {
+		t.Fatalf("got %d, want 30", got)
+	}
+
+	// a failing server is not asked again at once
+	x.histogram = nil
+	x.feeErr = errors.New("server busy")
+	x.calls = 0
+	failing := NewServerFeeEstimator(func() electrumx.ElectrumX { return x }, 1_000_000)
+	for i := 0; i < 3; i++ {
+		if _, err := failing.EstimateFeePerByte(wallet.NORMAL); err == nil {
+			t.Fatal("expected an error")
+		}
+	}
+	if x.calls != 1 {
+		t.Fatalf("fees fetched %d times after an error, want 1", x.calls)
+	}
+
+	// not started
+	fe = NewServerFeeEstimator(func() electrumx.ElectrumX { return nil }, 1_000_000)
+	if _, err := fe.EstimateFeePerByte(wallet.NORMAL); err == nil {
+		t.Fatal("expected an error with no ElectrumX")
+	}
+}
@@ -27,6 +27,8 @@ func (ec *FiroElectrumClient) tipChange(ctx context.Context) {
 			}
 			// update wallet's notion of the tip for confirmations
 			ec.updateWalletTip(tip)
+			// prove any confirmed txs now covered by our headers
+			ec.verifyPendingProofs(ctx, tip)
 			// user
 			ec.sendTipChangeNotifyMtx.RLock()
 			if ec.sendTipChangeNotify != nil {
@@ -37,6 +39,24 @@ func (ec *FiroElectrumClient) tipChange(ctx context.Context) {
 	}
 }
 
+// reorg receives notifications from network leader nodes when our headers
+// have been rewound. Wallet txs mined above the fork height go back to
+// unconfirmed and the history of all subscribed addresses is fetched again.
+// Run as a goroutine from client startup.
+func (ec *FiroElectrumClient) reorg(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-ec.rcvReorgNotify:
+			if !ok {
+				return
+			}
+			ec.rollbackWallet(ctx, ev)
+		}
+	}
+}
+
 // RegisterTipChangeNotify sends a new tip change channel back to an api user
 func (ec *FiroElectrumClient) RegisterTipChangeNotify() (<-chan int64, error) {
 	ec.sendTipChangeNotifyMtx.Lock()
@@ -49,6 +69,45 @@ func (ec *FiroElectrumClient) RegisterTipChangeNotify() (<-chan int64, error) {
 	return ec.sendTipChangeNotify, nil
 }
 
+// GetConnectionStatusNotify returns the channel on which changes in the
+// connection to ElectrumX are sent, such as losing the leader and reconnecting.
+func (ec *FiroElectrumClient) GetConnectionStatusNotify() (<-chan *electrumx.ConnectionStatus, error) {
+	node := ec.GetX()
+	if node == nil {
+		return nil, ErrNoElectrumX
+	}
+	return node.GetConnectionStatusNotify()
+}
+
+// NetworkStatus returns the current leader, peers and headers sync state.
+func (ec *FiroElectrumClient) NetworkStatus() (*electrumx.NetworkStatus, error) {
+	node := ec.GetX()
+	if node == nil {
+		return nil, ErrNoElectrumX
+	}
+	return node.NetworkStatus()
+}
+
+// TorStatus returns the bootstrap and circuit state of tor from its control
+// port. Errors if no TorControlPort is configured.
+func (ec *FiroElectrumClient) TorStatus(ctx context.Context) (*electrumx.TorStatus, error) {
+	node := ec.GetX()
+	if node == nil {
+		return nil, ErrNoElectrumX
+	}
+	return node.TorStatus(ctx)
+}
+
+// GetNetworkEventNotify returns the channel on which changes in the network
+// status are sent, such as peers connecting and the leader changing.
+func (ec *FiroElectrumClient) GetNetworkEventNotify() (<-chan *electrumx.NetworkEvent, error) {
+	node := ec.GetX()
+	if node == nil {
+		return nil, ErrNoElectrumX
+	}
+	return node.GetNetworkEventNotify()
+}
+
 // UnregisterTipChangeNotify closes the current tip change channel
 func (ec *FiroElectrumClient) UnregisterTipChangeNotify() {
 	ec.sendTipChangeNotifyMtx.Lock()
@@ -16,6 +16,10 @@ import (
 	"github.com/dev-warrior777/go-electrum-client/wallet/wltfiro"
 )
 
+// Size of the mempool mined in each block - firo blocks are up to 2MB and
+// without segwit vsize is size
+const BLOCK_VSIZE = 2_000_000
+
 // FiroElectrumClient - implements ElectrumClient interface
 type FiroElectrumClient struct {
 	// Cancel is the cancel func for the goele context
@@ -31,6 +35,14 @@ type FiroElectrumClient struct {
 	// Forward tip change notify to external user if regustered
 	sendTipChangeNotify    chan int64
 	sendTipChangeNotifyMtx sync.RWMutex
+	// Receive reorg notify channel from electrumx
+	rcvReorgNotify <-chan *electrumx.ReorgEvent
+	// Confirmed txs waiting for our headers to reach their height before the
+	// merkle proof can be checked. txid => height
+	pendingProofs    map[string]int64
+	pendingProofsMtx sync.Mutex
+	// Fee levels for the wallet from the servers' view of the mempool
+	feeEstimator *client.ServerFeeEstimator
 }
 
 func NewFiroElectrumClient(cfg *client.ClientConfig) client.ElectrumClient {
@@ -41,7 +53,9 @@ func NewFiroElectrumClient(cfg *client.ClientConfig) client.ElectrumClient {
 		X:                   nil,
 		rcvTipChangeNotify:  nil,
 		sendTipChangeNotify: nil,
+		pendingProofs:       make(map[string]int64),
 	}
+	ec.feeEstimator = client.NewServerFeeEstimator(ec.GetX, BLOCK_VSIZE)
 	return &ec
 }
 
@@ -129,6 +143,11 @@ func (ec *FiroElectrumClient) Start(parentCtx context.Context) error {
 		return err
 	}
 	go ec.tipChange(goeleCtx)
+	ec.rcvReorgNotify, err = ec.X.GetReorgNotify()
+	if err != nil {
+		return err
+	}
+	go ec.reorg(goeleCtx)
 	return nil
 }
 
@@ -148,6 +167,7 @@ func (ec *FiroElectrumClient) CreateWallet(pw string) error {
 	}
 
 	walletCfg := ec.ClientConfig.MakeWalletConfig()
+	walletCfg.FeeEstimator = ec.feeEstimator
 
 	ec.Wallet, err = wltfiro.NewFiroElectrumWallet(walletCfg, pw)
 	if err != nil {
@@ -169,6 +189,7 @@ func (ec *FiroElectrumClient) RecreateWallet(ctx context.Context, pw, mnenomic s
 		return err
 	}
 	walletCfg := ec.ClientConfig.MakeWalletConfig()
+	walletCfg.FeeEstimator = ec.feeEstimator
 	ec.Wallet, err = wltfiro.RecreateElectrumWallet(walletCfg, pw, mnenomic)
 	if err != nil {
 		return err
@@ -193,6 +214,7 @@ func (ec *FiroElectrumClient) LoadWallet(pw string) error {
 		return err
 	}
 	walletCfg := ec.ClientConfig.MakeWalletConfig()
+	walletCfg.FeeEstimator = ec.feeEstimator
 	ec.Wallet, err = wltfiro.LoadFiroElectrumWallet(walletCfg, pw)
 	if err != nil {
 		return err
@@ -0,0 +1,113 @@
+package electrumx
+
+// Broadcast rejection reasons.
+//
+// ElectrumX passes on the daemon's reason for rejecting a broadcast tx in the
+// error message, e.g. "the transaction was rejected by network rules.\n\nmin
+// relay fee not met, 100 < 141 (code 66)". The common bitcoind reasons are
+// parsed into the errors below so callers can decide to bump the fee, wait or
+// give up on a double spent tx without matching strings themselves.
+//
+//	if errors.Is(err, electrumx.ErrTxMinRelayFee) { ... }
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// an input is spent or not known to the daemon
+	ErrTxMissingInputs = errors.New("tx inputs missing or spent")
+	// the tx is already mined
+	ErrTxAlreadyInChain = errors.New("tx already in block chain")
+	// the daemon already has the tx in its mempool
+	ErrTxAlreadyInMempool = errors.New("tx already in mempool")
+	// fee too low to replace a mempool tx or for its priority
+	ErrTxInsufficientFee = errors.New("tx fee insufficient")
+	// fee below the relay or current mempool minimum
+	ErrTxMinRelayFee = errors.New("tx fee below minimum relay fee")
+	// locktime or sequence locks not yet satisfied
+	ErrTxNonFinal = errors.New("tx not final")
+	// an output is below the dust threshold
+	ErrTxDust = errors.New("tx output is dust")
+	// spends an input already spent by a mempool tx which does not signal
+	// replacement
+	ErrTxMempoolConflict = errors.New("tx conflicts with a mempool tx")
+	// too many unconfirmed ancestors or descendants
+	ErrTxTooLongMempoolChain = errors.New("tx mempool chain too long")
+	// rejected for any other reason
+	ErrTxRejected = errors.New("tx rejected")
+)
+
+// IsTxKnown returns true if err says the daemon already has the tx in its
+// mempool or in the block chain, in which case the broadcast has succeeded.
+func IsTxKnown(err error) bool {
+	return errors.Is(err, ErrTxAlreadyInMempool) || errors.Is(err, ErrTxAlreadyInChain)
+}
+
+// Substrings of the daemon's reject reason for each error. Checked in order
+// so more specific reasons come first.
+var broadcastReasons = []struct {
+	match  []string
+	reason error
+}{
+	{[]string{"txn-mempool-conflict"}, ErrTxMempoolConflict},
+	{[]string{"too-long-mempool-chain"}, ErrTxTooLongMempoolChain},
+	{[]string{"min relay fee not met", "mempool min fee not met"}, ErrTxMinRelayFee},
+	{[]string{"insufficient fee", "insufficient priority"}, ErrTxInsufficientFee},
+	{[]string{"missing-inputs", "missingorspent", "missing inputs"}, ErrTxMissingInputs},
+	{[]string{"already in block chain", "outputs already in utxo set", "txn-already-in-chain"}, ErrTxAlreadyInChain},
+	{[]string{"txn-already-in-mempool", "txn-already-known"}, ErrTxAlreadyInMempool},
+	{[]string{"non-final", "non-bip68-final"}, ErrTxNonFinal},
+	{[]string{"dust"}, ErrTxDust},
+}
+
+// BroadcastError is a broadcast rejected by the server. errors.Is matches
+// Reason and errors.As finds the server's *RPCError.
+type BroadcastError struct {
+	Reason error
+	RPC    *RPCError
+}
+
+func (e *BroadcastError) Error() string {
+	return e.Reason.Error() + ": " + e.RPC.Message
+}
+
+func (e *BroadcastError) Is(target error) bool {
+	return target == e.Reason
+}
+
+func (e *BroadcastError) Unwrap() error {
+	return e.RPC
+}
+
+// broadcastReason returns the error for the reject reason in msg.
+func broadcastReason(msg string) error {
+	msg = strings.ToLower(msg)
+	for _, r := range broadcastReasons {
+		for _, m := range r.match {
+			if strings.Contains(msg, m) {
+				return r.reason
+			}
+		}
+	}
+	return ErrTxRejected
+}
+
+// broadcastError makes a server rejection of a broadcast a *BroadcastError.
+// Other errors are returned unchanged.
+func broadcastError(err error) error {
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) {
+		return err
+	}
+	return &BroadcastError{
+		Reason: broadcastReason(rpcErr.Message),
+		RPC:    rpcErr,
+	}
+}
+
+// Reason returns the error for why this tx of the package was rejected.
+func (e BroadcastPackageError) Reason() error {
+	return broadcastReason(e.Error)
+}
@@ -0,0 +1,74 @@
+package electrumx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestBroadcastError(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want error
+	}{
+		{"the transaction was rejected by network rules.\n\nmin relay fee not met, 100 < 141 (code 66)\n[0200]", ErrTxMinRelayFee},
+		{"the transaction was rejected by network rules.\n\nmempool min fee not met, 150 < 300 (code 66)", ErrTxMinRelayFee},
+		{"insufficient fee, rejecting replacement 1a2b; new feerate 0.00001 <= old feerate 0.00002", ErrTxInsufficientFee},
+		{"bad-txns-inputs-missingorspent", ErrTxMissingInputs},
+		{"Missing inputs", ErrTxMissingInputs},
+		{"Transaction already in block chain", ErrTxAlreadyInChain},
+		{"Transaction outputs already in utxo set", ErrTxAlreadyInChain},
+		{"txn-already-in-mempool", ErrTxAlreadyInMempool},
+		{"non-final (code 64)", ErrTxNonFinal},
+		{"non-BIP68-final (code 64)", ErrTxNonFinal},
+		{"dust (code 64)", ErrTxDust},
+		{"txn-mempool-conflict (code 18)", ErrTxMempoolConflict},
+		{"too-long-mempool-chain, too many unconfirmed ancestors [limit: 25] (code 64)", ErrTxTooLongMempoolChain},
+		{"scriptpubkey (code 64)", ErrTxRejected},
+	}
+	for _, test := range tests {
+		rpcErr := &RPCError{Code: 1, Message: test.msg}
+		err := fmt.Errorf("request: %w", broadcastError(rpcErr))
+		if !errors.Is(err, test.want) {
+			t.Errorf("%q: got %v, want %v", test.msg, err, test.want)
+		}
+		var gotRPC *RPCError
+		if !errors.As(err, &gotRPC) || gotRPC != rpcErr {
+			t.Errorf("%q: RPCError not found", test.msg)
+		}
+		if !IsServerRejection(err) {
+			t.Errorf("%q: not a server rejection", test.msg)
+		}
+		known := test.want == ErrTxAlreadyInChain || test.want == ErrTxAlreadyInMempool
+		if IsTxKnown(err) != known {
+			t.Errorf("%q: IsTxKnown = %v", test.msg, !known)
+		}
+	}
+
+	// network errors are not rejections
+	if err := broadcastError(ErrNotConnected); err != ErrNotConnected {
+		t.Errorf("got %v, want ErrNotConnected", err)
+	}
+
+	pkgErr := BroadcastPackageError{Txid: "aa", Error: "txn-mempool-conflict"}
+	if pkgErr.Reason() != ErrTxMempoolConflict {
+		t.Errorf("package error reason %v", pkgErr.Reason())
+	}
+}
+
+func TestBroadcastErrorResponse(t *testing.T) {
+	// as sent by ElectrumX for a rejected blockchain.transaction.broadcast
+	line := `{"jsonrpc": "2.0", "error": {"code": 1, "message": "the transaction was rejected by network rules.\n\nmin relay fee not met, 100 < 141 (code 66)\n[0200000001]"}, "id": 7}`
+	var resp response
+	if err := json.Unmarshal([]byte(line), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error == nil || resp.Error.Code != 1 || resp.Error.Message == "" {
+		t.Fatalf("error %+v", resp.Error)
+	}
+	err := broadcastError(resp.Error)
+	if !errors.Is(err, ErrTxMinRelayFee) {
+		t.Fatalf("got %v, want %v", err, ErrTxMinRelayFee)
+	}
+}
@@ -0,0 +1,170 @@
+package electrumx
+
+// TLS certificate pinning.
+//
+// Most ElectrumX servers use self-signed certificates so we cannot verify
+// them against a CA. Instead we trust on first use: the sha256 fingerprint of
+// a server's certificate is pinned in 'server_certs.json' in the data dir the
+// first time we connect and any later connection presenting a different
+// certificate is refused. The TrustedPeer can be pinned explicitly in the
+// config. If a server legitimately changes its certificate remove its entry
+// from the file.
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const CertStoreFileName = "server_certs.json"
+
+// ErrCertMismatch is returned when a server's TLS certificate does not match
+// the pinned fingerprint.
+var ErrCertMismatch = errors.New("server certificate does not match pinned fingerprint")
+
+// ErrCertPinNoTLS is returned by Start when a TrustedPeerCertFingerprint is set
+// for a TrustedPeer which does not connect with TLS so cannot be pinned.
+var ErrCertPinNoTLS = errors.New("certificate fingerprint set for a server without TLS")
+
+type certPin struct {
+	Fingerprint string `json:"sha256"`
+	FirstSeen   int64  `json:"first_seen"`
+}
+
+// certStore holds the pinned certificate fingerprints keyed on server address.
+type certStore struct {
+	filePath string
+	pins     map[string]*certPin
+	loaded   bool
+	mtx      sync.Mutex
+}
+
+func newCertStore(dataDir string) *certStore {
+	return &certStore{
+		filePath: filepath.Join(dataDir, CertStoreFileName),
+		pins:     make(map[string]*certPin),
+	}
+}
+
+// load reads the pins file once - locked by caller
+func (cs *certStore) load() error {
+	if cs.loaded {
+		return nil
+	}
+	b, err := os.ReadFile(cs.filePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if len(b) > 0 {
+		err = json.Unmarshal(b, &cs.pins)
+		if err != nil {
+			return fmt.Errorf("corrupt %s: %w", CertStoreFileName, err)
+		}
+	}
+	cs.loaded = true
+	return nil
+}
+
+// save writes the pins file - locked by caller
+func (cs *certStore) save() error {
+	b, err := json.MarshalIndent(cs.pins, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := cs.filePath + ".tmp"
+	err = os.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, cs.filePath)
+}
+
+// normalizeFingerprint accepts a hex sha256 fingerprint in either case with
+// or without ':' separators.
+func normalizeFingerprint(fp string) string {
+	return strings.ToLower(strings.ReplaceAll(fp, ":", ""))
+}
+
+// CertFingerprint returns the sha256 fingerprint of a DER encoded certificate
+// as lower case hex.
+func CertFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// check checks the leaf certificate of a server at addr. With an explicit pin
+// the certificate must match it. Otherwise the first certificate seen for addr
+// is pinned and later ones must match.
+func (cs *certStore) check(addr, explicitPin string, rawCerts [][]byte) error {
+	if len(rawCerts) == 0 {
+		return errors.New("server sent no certificate")
+	}
+	fp := CertFingerprint(rawCerts[0])
+
+	if explicitPin != "" {
+		if fp != normalizeFingerprint(explicitPin) {
+			fmt.Printf("ALERT: server %s certificate %s does not match the configured pin\n", addr, fp)
+			return fmt.Errorf("%w: %s", ErrCertMismatch, addr)
+		}
+		return nil
+	}
+
+	cs.mtx.Lock()
+	defer cs.mtx.Unlock()
+	err := cs.load()
+	if err != nil {
+		return err
+	}
+	pin, ok := cs.pins[addr]
+	if !ok {
+		cs.pins[addr] = &certPin{Fingerprint: fp, FirstSeen: time.Now().Unix()}
+		fmt.Printf("pinned certificate %s for server %s\n", fp, addr)
+		return cs.save()
+	}
+	if pin.Fingerprint != fp {
+		fmt.Printf("ALERT: server %s certificate changed from %s to %s - refusing connection\n",
+			addr, pin.Fingerprint, fp)
+		return fmt.Errorf("%w: %s", ErrCertMismatch, addr)
+	}
+	return nil
+}
+
+// checkTrustedPeerPin refuses a TrustedPeerCertFingerprint which could never
+// be checked rather than connect to the TrustedPeer unpinned.
+func checkTrustedPeerPin(cfg *ElectrumXConfig) error {
+	if cfg.TrustedPeerCertFingerprint == "" || cfg.TrustedPeer == nil {
+		return nil
+	}
+	switch cfg.TrustedPeer.Network() {
+	case "ssl", "wss":
+		return nil
+	}
+	return fmt.Errorf("%w: TrustedPeer %s is %s", ErrCertPinNoTLS,
+		cfg.TrustedPeer, cfg.TrustedPeer.Network())
+}
+
+// pinCertificate makes a node's TLS connection check the server certificate
+// against the store. The TrustedPeer is checked against its configured pin if
+// there is one.
+func (net *Network) pinCertificate(node *Node, isTrusted bool) {
+	tlsConfig := node.connectOpts.TLSConfig
+	if tlsConfig == nil {
+		return
+	}
+	addr := node.serverAddr
+	explicitPin := ""
+	if isTrusted {
+		explicitPin = net.config.TrustedPeerCertFingerprint
+	}
+	tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		return net.certs.check(addr, explicitPin, rawCerts)
+	}
+}
@@ -0,0 +1,79 @@
+package electrumx
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCertStoreTOFU(t *testing.T) {
+	dir := t.TempDir()
+	certA := [][]byte{[]byte("certificate A")}
+	certB := [][]byte{[]byte("certificate B")}
+
+	cs := newCertStore(dir)
+	if err := cs.check("host:50002", "", certA); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := cs.check("host:50002", "", certA); err != nil {
+		t.Fatalf("same cert: %v", err)
+	}
+	// a different server may have a different cert
+	if err := cs.check("other:50002", "", certB); err != nil {
+		t.Fatalf("other server: %v", err)
+	}
+
+	// pins survive a restart
+	cs = newCertStore(dir)
+	if err := cs.check("host:50002", "", certB); !errors.Is(err, ErrCertMismatch) {
+		t.Fatalf("expected ErrCertMismatch got %v", err)
+	}
+	if err := cs.check("host:50002", "", nil); err == nil {
+		t.Fatal("expected an error for no certificate")
+	}
+}
+
+func TestCertStoreExplicitPin(t *testing.T) {
+	cs := newCertStore(t.TempDir())
+	cert := [][]byte{[]byte("trusted certificate")}
+	fp := CertFingerprint(cert[0])
+
+	// colon separated upper case as shown by openssl
+	var parts []string
+	for i := 0; i < len(fp); i += 2 {
+		parts = append(parts, strings.ToUpper(fp[i:i+2]))
+	}
+	pin := strings.Join(parts, ":")
+	if err := cs.check("trusted:50002", pin, cert); err != nil {
+		t.Fatal(err)
+	}
+	wrong := [][]byte{[]byte("mitm certificate")}
+	if err := cs.check("trusted:50002", pin, wrong); !errors.Is(err, ErrCertMismatch) {
+		t.Fatalf("expected ErrCertMismatch got %v", err)
+	}
+}
+
+func TestTrustedPeerPinNeedsTLS(t *testing.T) {
+	for _, proto := range []string{"tcp", "ws"} {
+		net := &Network{
+			config: &ElectrumXConfig{
+				DataDir:                    t.TempDir(),
+				TrustedPeer:                &NodeServerAddr{Net: proto, Addr: "trusted:50001"},
+				TrustedPeerCertFingerprint: "ab:cd",
+			},
+		}
+		if err := net.Start(context.Background()); !errors.Is(err, ErrCertPinNoTLS) {
+			t.Fatalf("%s: expected ErrCertPinNoTLS got %v", proto, err)
+		}
+	}
+	for _, proto := range []string{"ssl", "wss"} {
+		cfg := &ElectrumXConfig{
+			TrustedPeer:                &NodeServerAddr{Net: proto, Addr: "trusted:50002"},
+			TrustedPeerCertFingerprint: "ab:cd",
+		}
+		if err := checkTrustedPeerPin(cfg); err != nil {
+			t.Fatalf("%s: %v", proto, err)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package electrumx
+
+// Checkpointed header sync.
+//
+// We do not download the chain from genesis but from the coin's StartPoint.
+// Prev hash linkage and proof of work only tell us the headers from there on
+// form a chain, not that it is the right chain. A checkpoint is the merkle root
+// of all block hashes up to its height. When we ask for headers with a
+// cp_height ElectrumX also sends the merkle branch of the last header to that
+// root so the headers below it are proved by linkage.
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrCheckpointFailed is returned when a server's headers do not prove to our
+// checkpoint root.
+var ErrCheckpointFailed = errors.New("checkpoint proof failed")
+
+// sortCheckpoints returns a copy of checkpoints in height order
+func sortCheckpoints(checkpoints []Checkpoint) []Checkpoint {
+	sorted := make([]Checkpoint, len(checkpoints))
+	copy(sorted, checkpoints)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Height < sorted[j].Height })
+	return sorted
+}
+
+// ErrStartPointNotCheckpointed is returned by Start when checkpoints are
+// configured but none is at or above the StartPoint so the headers synced
+// from there could not be proved.
+var ErrStartPointNotCheckpointed = errors.New("start point is not covered by a checkpoint")
+
+// checkStartPoint checks that a checkpoint covers the StartPoint header. With
+// no checkpoints at all, as until the roots for a network are fetched, it
+// warns that synced headers are only proved by linkage and proof of work.
+func checkStartPoint(cfg *ElectrumXConfig) error {
+	for _, cp := range cfg.Checkpoints {
+		if cp.Height >= cfg.StartPoint {
+			return nil
+		}
+	}
+	if len(cfg.Checkpoints) > 0 {
+		return fmt.Errorf("%w: start point %d is above the last checkpoint",
+			ErrStartPointNotCheckpointed, cfg.StartPoint)
+	}
+	if cfg.NetType != Regtest {
+		fmt.Printf("ALERT: no checkpoint at or above start point %d for %s - headers are not proved to a checkpoint root\n",
+			cfg.StartPoint, cfg.NetType)
+	}
+	return nil
+}
+
+// nextCheckpoint returns the lowest checkpoint at or above height or nil if
+// there is none.
+func (h *headers) nextCheckpoint(height int64) *Checkpoint {
+	for i := range h.checkpoints {
+		if h.checkpoints[i].Height >= height {
+			return &h.checkpoints[i]
+		}
+	}
+	return nil
+}
+
+// verifyCheckpoint checks the merkle branch in a cp_height headers result for
+// the last header returned, hdr at height, against the checkpoint root.
+func verifyCheckpoint(cp *Checkpoint, hdr *BlockHeader, height int64, res *getBlockHeadersResult) error {
+	wantRoot, err := hexToWireHash(cp.Root)
+	if err != nil {
+		return fmt.Errorf("bad checkpoint root at height %d: %v", cp.Height, err)
+	}
+	root, err := merkleRootFromBranch(hdr.Hash.StringRev(), res.Branch, int(height))
+	if err != nil {
+		return fmt.Errorf("%w: height %d: %v", ErrCheckpointFailed, cp.Height, err)
+	}
+	if root != wantRoot {
+		return fmt.Errorf("%w: header %s at height %d does not prove to root at height %d",
+			ErrCheckpointFailed, hdr.Hash.StringRev(), height, cp.Height)
+	}
+	return nil
+}
+
+// checkpointedBlockHeaders gets a chunk of up to count headers from
+// startHeight. If there is a checkpoint at or above startHeight the chunk is
+// cut to end at the checkpoint and is proved against it. Returns the headers
+// and the count actually requested.
+func (n *Node) checkpointedBlockHeaders(nodeCtx context.Context, startHeight int64, count int) (*getBlockHeadersResult, int, error) {
+	h := n.networkHeaders
+	cp := h.nextCheckpoint(startHeight)
+	if cp == nil {
+		hdrsRes, err := n.blockHeaders(nodeCtx, startHeight, count)
+		return hdrsRes, count, err
+	}
+	if startHeight+int64(count)-1 > cp.Height {
+		count = int(cp.Height - startHeight + 1)
+	}
+	hdrsRes, err := n.blockHeadersCp(nodeCtx, startHeight, count, cp.Height)
+	if err != nil {
+		return nil, count, err
+	}
+	if hdrsRes.Count <= 0 {
+		return nil, count, fmt.Errorf("%w: no headers returned below checkpoint at height %d",
+			ErrCheckpointFailed, cp.Height)
+	}
+	b, err := hex.DecodeString(hdrsRes.HexConcat)
+	if err != nil {
+		return nil, count, err
+	}
+	if len(b) != hdrsRes.Count*h.headerSize {
+		return nil, count, fmt.Errorf("corrupted headers - length %d for %d headers",
+			len(b), hdrsRes.Count)
+	}
+	last := b[(hdrsRes.Count-1)*h.headerSize:]
+	lastHdr, err := h.headerDeserialzer.Deserialize(bytes.NewBuffer(last))
+	if err != nil {
+		return nil, count, err
+	}
+	lastHeight := startHeight + int64(hdrsRes.Count) - 1
+	err = verifyCheckpoint(cp, lastHdr, lastHeight, hdrsRes)
+	if err != nil {
+		n.session.bumpCostError()
+		return nil, count, err
+	}
+	fmt.Printf("headers %d to %d proved to checkpoint at height %d\n", startHeight, lastHeight, cp.Height)
+	return hdrsRes, count, nil
+}
+
+// verifyStoredCheckpoints proves the headers we already had in our headers
+// file against any checkpoints between the start point and height upTo.
+func (n *Node) verifyStoredCheckpoints(nodeCtx context.Context, upTo int64) error {
+	h := n.networkHeaders
+	for i := range h.checkpoints {
+		cp := &h.checkpoints[i]
+		if cp.Height < h.startPoint || cp.Height > upTo {
+			continue
+		}
+		hdrsRes, _, err := n.checkpointedBlockHeaders(nodeCtx, cp.Height, 1)
+		if err != nil {
+			return err
+		}
+		b, err := hex.DecodeString(hdrsRes.HexConcat)
+		if err != nil {
+			return err
+		}
+		cpHdr, err := h.headerDeserialzer.Deserialize(bytes.NewBuffer(b))
+		if err != nil {
+			return err
+		}
+		stored := h.getHeader(cp.Height)
+		if stored == nil || stored.Hash != cpHdr.Hash {
+			return fmt.Errorf("%w: stored header at height %d is not on the checkpointed chain",
+				ErrCheckpointFailed, cp.Height)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+//go:build live
+
+package electrumx
+
+import (
+	"context"
+	"crypto/tls"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestFetchCheckpointRoots prints the checkpoint roots for the built in
+// checkpoints of a coin. Ask a trusted ssl server:
+//
+//	GOELE_CP_SERVER=host:50002 GOELE_CP_HEIGHTS=823000 \
+//	  go test -tags live -run TestFetchCheckpointRoots -v ./electrumx
+func TestFetchCheckpointRoots(t *testing.T) {
+	addr := os.Getenv("GOELE_CP_SERVER")
+	heights := os.Getenv("GOELE_CP_HEIGHTS")
+	if addr == "" || heights == "" {
+		t.Skip("GOELE_CP_SERVER and GOELE_CP_HEIGHTS not set")
+	}
+	host := addr[:strings.LastIndex(addr, ":")]
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	opts := &connectOpts{TLSConfig: &tls.Config{InsecureSkipVerify: true, ServerName: host}}
+	sc, err := connectServer(ctx, cancel, addr, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqCtx, reqCancel := context.WithTimeout(ctx, 30*time.Second)
+	defer reqCancel()
+	if _, err := sc.serverVersion(reqCtx, "Electrum", PROTOCOL_MIN, PROTOCOL_MAX); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range strings.Split(heights, ",") {
+		height, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := sc.blockHeadersCp(reqCtx, height, 1, height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("{Height: %d, Root: %q},", height, res.Root)
+	}
+}
@@ -0,0 +1,85 @@
+package electrumx
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNextCheckpoint(t *testing.T) {
+	h := headers{
+		checkpoints: sortCheckpoints([]Checkpoint{
+			{Height: 3000}, {Height: 1000}, {Height: 2000},
+		}),
+	}
+	tests := []struct {
+		height int64
+		want   int64
+	}{
+		{0, 1000},
+		{1000, 1000},
+		{1001, 2000},
+		{2500, 3000},
+		{3001, -1},
+	}
+	for _, tc := range tests {
+		cp := h.nextCheckpoint(tc.height)
+		if tc.want < 0 {
+			if cp != nil {
+				t.Fatalf("height %d: expected no checkpoint got %d", tc.height, cp.Height)
+			}
+			continue
+		}
+		if cp == nil || cp.Height != tc.want {
+			t.Fatalf("height %d: expected checkpoint %d got %v", tc.height, tc.want, cp)
+		}
+	}
+}
+
+func TestVerifyCheckpoint(t *testing.T) {
+	// block hashes 0..cpHeight
+	const cpHeight = 12
+	blkHashes := mkTxids(cpHeight + 1)
+	root, _ := mkMerkleBranch(blkHashes, 0)
+	cp := &Checkpoint{Height: cpHeight, Root: root.StringRev()}
+
+	for _, height := range []int64{0, 5, cpHeight} {
+		_, branch := mkMerkleBranch(blkHashes, int(height))
+		hdr := &BlockHeader{Hash: WireHash(blkHashes[height])}
+		res := &getBlockHeadersResult{Branch: branch, Root: cp.Root}
+		if err := verifyCheckpoint(cp, hdr, height, res); err != nil {
+			t.Fatalf("height %d: %v", height, err)
+		}
+		// a header from another chain
+		other := &BlockHeader{Hash: WireHash(mkTxids(cpHeight + 2)[cpHeight+1])}
+		if err := verifyCheckpoint(cp, other, height, res); !errors.Is(err, ErrCheckpointFailed) {
+			t.Fatalf("height %d: expected ErrCheckpointFailed got %v", height, err)
+		}
+	}
+
+	// a single block checkpoint root is the block hash
+	genesis := &Checkpoint{Height: 0, Root: WireHash(blkHashes[0]).StringRev()}
+	hdr := &BlockHeader{Hash: WireHash(blkHashes[0])}
+	if err := verifyCheckpoint(genesis, hdr, 0, &getBlockHeadersResult{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckStartPoint(t *testing.T) {
+	cfg := &ElectrumXConfig{
+		NetType:     Mainnet,
+		StartPoint:  2016,
+		Checkpoints: []Checkpoint{{Height: 1000}, {Height: 2016}},
+	}
+	if err := checkStartPoint(cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.StartPoint = 2017
+	if err := checkStartPoint(cfg); !errors.Is(err, ErrStartPointNotCheckpointed) {
+		t.Fatalf("expected ErrStartPointNotCheckpointed got %v", err)
+	}
+	// no checkpoints only warns
+	cfg.Checkpoints = nil
+	if err := checkStartPoint(cfg); err != nil {
+		t.Fatal(err)
+	}
+}
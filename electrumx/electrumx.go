@@ -20,6 +20,8 @@ type Server struct {
 	connected       bool
 	softwareVersion string
 	protocolVersion string
+	protocol        ProtocolVersion
+	capabilities    Capabilities
 	nodeCancel      context.CancelCauseFunc
 }
 
@@ -85,10 +87,19 @@ func (wh *WireHash) String() string {
 }
 
 type BlockHeader struct {
-	Version int32
-	Hash    WireHash
-	Prev    WireHash
-	Merkle  WireHash
+	Version   int32
+	Hash      WireHash
+	Prev      WireHash
+	Merkle    WireHash
+	Timestamp int64 // unix seconds
+	Bits      uint32
+}
+
+// Checkpoint is a merkle root of all block hashes from genesis up to and
+// including Height. It is the 'root' ElectrumX returns for cp_height=Height.
+type Checkpoint struct {
+	Height int64
+	Root   string
 }
 
 type HeaderDeserializer interface {
@@ -102,6 +113,16 @@ type ClientBlockHeader struct {
 	Merkle string
 }
 
+// ReorgEvent is sent to the client when our stored headers are rewound because
+// the server's chain no longer connects to our tip.
+type ReorgEvent struct {
+	// Blocks above ForkHeight may no longer be on the best chain. Anything
+	// stored as mined above this height needs to be checked again.
+	ForkHeight int64
+	// Our tip before the rewind
+	OldTip int64
+}
+
 type ElectrumXConfig struct {
 	// Coin ticker to id the coin
 	// Filled in by each coin in ElectrumXInterface
@@ -116,10 +137,21 @@ type ElectrumXConfig struct {
 	// Filled in by each coin in ElectrumXInterface
 	HeaderDeserializer HeaderDeserializer
 
+	// Proof of work and difficulty rules for the coin's block headers. If nil
+	// only the previous block hash linkage is checked.
+	// Filled in by each coin in ElectrumXInterface
+	HeaderValidator HeaderValidator
+
 	// Checkpoints for each network: mainnet, testnet, regtest
 	// Filled in by each coin in ElectrumXInterface
 	StartPoint int64
 
+	// Known merkle roots of the block hashes up to some heights at or above
+	// StartPoint. Headers synced up to each checkpoint are proved against it
+	// with cp_height merkle proofs from the server.
+	// Filled in by each coin in ElectrumXInterface if not set by the caller.
+	Checkpoints []Checkpoint
+
 	// Genesis for each network: mainnet, testnet, regtest
 	// Filled in by each coin in ElectrumXInterface
 	Genesis string
@@ -128,6 +160,17 @@ type ElectrumXConfig struct {
 	// Filled in by each coin in ElectrumXInterface
 	MaxOnlinePeers int
 
+	// Number of servers asked for history, utxos and the tip header when
+	// checking servers against each other. 0 or 1 trusts the leader.
+	Quorum int
+
+	// Number of running peers a broadcast also goes to besides the leader.
+	BroadcastPeers int
+
+	// Number of stored headers checked back from the tip on startup. 0 is
+	// HEADER_VERIFY_DEPTH and less than 0 checks them all.
+	HeaderVerifyDepth int64
+
 	// Strategy flags for each network
 	// Filled in by each coin in ElectrumXInterface
 	Flags uint8
@@ -139,10 +182,37 @@ type ElectrumXConfig struct {
 	// for everything except for genesis block hash.
 	Params *chaincfg.Params
 
-	// A localhost socks5 proxy port. E.g.  9050
+	// A localhost tor socks5 proxy port. E.g.  9050
+	// Onion servers are only used if set. If set the proxy must be up when
+	// the network starts.
 	ProxyPort string
 
-	// MaxOnion is the max onion peers we want to start for a coin
+	// TorPolicy decides which servers are used and which connections go
+	// through the proxy. Clearnet, PreferTor or TorOnly.
+	TorPolicy TorPolicy
+
+	// TorIsolation decides which connections through the proxy share a tor
+	// circuit. The default gives each connection its own.
+	TorIsolation TorIsolation
+
+	// Optional TorIsolation for servers by address, overriding TorIsolation.
+	TorServerIsolation map[string]TorIsolation
+
+	// Categories of requests each sent on a new connection over its own tor
+	// circuit, for servers connected to through the proxy.
+	TorIsolateRequests RequestCategory
+
+	// Optional localhost tor control port, e.g. 9051. If set the network only
+	// starts once tor has a circuit.
+	TorControlPort string
+
+	// Password for the tor control port if tor has a HashedControlPassword.
+	// Otherwise the cookie file is used if tor needs one.
+	TorControlPassword string
+
+	// MaxOnion is the max onion peers we want to start for a coin with the
+	// Clearnet policy
+	// Filled in by each coin in ElectrumXInterface if not set by the caller.
 	MaxOnion int
 
 	// Location of the data directory
@@ -154,6 +224,19 @@ type ElectrumXConfig struct {
 	// For now it *must be set*
 	TrustedPeer *NodeServerAddr
 
+	// Optional sha256 fingerprint of the TrustedPeer's TLS certificate in hex.
+	// If set the TrustedPeer must present this certificate so it must connect
+	// with ssl or wss. Other servers are pinned on first use.
+	TrustedPeerCertFingerprint string
+
+	// Optional Transport to connect to servers with instead of tcp and TLS,
+	// e.g. a Replayer to replay recorded sessions.
+	Transport Transport
+
+	// If set every server session is recorded to a new file in this directory
+	// for replay with a Replayer.
+	RecordDir string
+
 	// If not testing do not overwrite existing wallet files
 	Testing bool
 }
@@ -172,16 +255,36 @@ type ElectrumX interface {
 	GetBlockHeader(height int64) (*ClientBlockHeader, error)
 	GetBlockHeaders(startHeight int64, blockCount int64) ([]*ClientBlockHeader, error)
 	GetTipChangeNotify() (<-chan int64, error)
+	GetReorgNotify() (<-chan *ReorgEvent, error)
+	GetConnectionStatusNotify() (<-chan *ConnectionStatus, error)
+	NetworkStatus() (*NetworkStatus, error)
+	GetNetworkEventNotify() (<-chan *NetworkEvent, error)
+	TorStatus(ctx context.Context) (*TorStatus, error)
 
 	SubscribeScripthashNotify(ctx context.Context, scripthash string) (*ScripthashStatusResult, error)
+	SubscribeScripthashNotifyBatch(ctx context.Context, scripthashes []string) ([]*ScripthashStatusBatchResult, error)
 	UnsubscribeScripthashNotify(ctx context.Context, scripthash string)
 	GetScripthashNotify() (<-chan *ScripthashStatusResult, error)
 
 	GetHistory(ctx context.Context, scripthash string) (HistoryResult, error)
+	GetHistoryBatch(ctx context.Context, scripthashes []string) ([]*HistoryBatchResult, error)
 	GetListUnspent(ctx context.Context, scripthash string) (ListUnspentResult, error)
+	GetListUnspentBatch(ctx context.Context, scripthashes []string) ([]*ListUnspentBatchResult, error)
+	GetMempool(ctx context.Context, scripthash string) (MempoolResult, error)
+	GetBalance(ctx context.Context, scripthash string) (*BalanceResult, error)
 	GetTransaction(ctx context.Context, txid string) (*GetTransactionResult, error)
 	GetRawTransaction(ctx context.Context, txid string) (string, error)
+	GetRawTransactionBatch(ctx context.Context, txids []string) ([]*RawTransactionBatchResult, error)
+	VerifyMerkleProof(ctx context.Context, txid string, height int64) error
+	ReportStatusMismatch(scripthash string)
+	ReportBadTx(server, txid string)
 	//
 	EstimateFeeRate(ctx context.Context, confTarget int64) (int64, error)
+	GetFeeHistogram(ctx context.Context) (FeeHistogram, error)
+	GetRelayFee(ctx context.Context) (int64, error)
 	Broadcast(ctx context.Context, rawTx string) (string, error)
+	BroadcastPackage(ctx context.Context, rawTxs []string) (*BroadcastPackageResult, error)
+	// Supports returns true if the leader's negotiated protocol version has
+	// the optional method.
+	Supports(method string) bool
 }
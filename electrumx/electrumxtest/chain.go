@@ -0,0 +1,239 @@
+package electrumxtest
+
+// The chain model served.
+//
+// A Chain holds raw block headers from genesis, the txids in each block for
+// merkle proofs, raw txs and the history and utxos of each scripthash. Tests
+// build it up and change it as they go; nothing here checks that it is a
+// valid chain. A reorg is a Rewind to the fork height followed by adding the
+// new branch's headers, with the moved history set again by the test.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// HistoryItem is one tx in a scripthash history. Height is 0 for a mempool tx
+// and -1 for a mempool tx with unconfirmed inputs.
+type HistoryItem struct {
+	TxHash string
+	Height int64
+	// satoshis; sent for mempool txs only
+	Fee int64
+}
+
+// Unspent is one utxo of a scripthash. Height is 0 if unconfirmed.
+type Unspent struct {
+	TxHash string
+	TxPos  int64
+	Height int64
+	Value  int64
+}
+
+// Chain is the programmable chain model a Server serves.
+type Chain struct {
+	mtx      sync.RWMutex
+	headers  [][]byte
+	hashFunc func(raw []byte) chainhash.Hash
+	blockTxs map[int64][]string
+	txs      map[string]string
+	history  map[string][]HistoryItem
+	unspent  map[string][]Unspent
+	// coin per kB; fee rate -1 if the daemon cannot estimate
+	relayFee  float64
+	feeRate   float64
+	histogram [][2]float64
+}
+
+// NewChain returns a chain of the genesis header only. Block hashes are the
+// double sha256 of the raw header as for bitcoin.
+func NewChain(genesis []byte) *Chain {
+	return &Chain{
+		headers:  [][]byte{genesis},
+		hashFunc: chainhash.DoubleHashH,
+		blockTxs: make(map[int64][]string),
+		txs:      make(map[string]string),
+		history:  make(map[string][]HistoryItem),
+		unspent:  make(map[string][]Unspent),
+		relayFee: 0.00001,
+		feeRate:  0.0002,
+	}
+}
+
+// SetHashFunc sets how the block hash is made from a raw header for coins
+// which do not use double sha256.
+func (c *Chain) SetHashFunc(hashFunc func(raw []byte) chainhash.Hash) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.hashFunc = hashFunc
+}
+
+// AddHeaders adds raw headers on top of the tip.
+func (c *Chain) AddHeaders(raws ...[]byte) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for _, raw := range raws {
+		c.headers = append(c.headers, append([]byte{}, raw...))
+	}
+}
+
+// Rewind drops the headers and block txs above height.
+func (c *Chain) Rewind(height int64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if height < 0 || height >= int64(len(c.headers)) {
+		return
+	}
+	c.headers = c.headers[:height+1]
+	for h := range c.blockTxs {
+		if h > height {
+			delete(c.blockTxs, h)
+		}
+	}
+}
+
+// Tip is the height of the last header.
+func (c *Chain) Tip() int64 {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return int64(len(c.headers)) - 1
+}
+
+// Header returns the raw header at height or nil if there is none.
+func (c *Chain) Header(height int64) []byte {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.header(height)
+}
+
+// header - not locked
+func (c *Chain) header(height int64) []byte {
+	if height < 0 || height >= int64(len(c.headers)) {
+		return nil
+	}
+	return c.headers[height]
+}
+
+// BlockHash returns the hash of the block at height.
+func (c *Chain) BlockHash(height int64) chainhash.Hash {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.hashFunc(c.header(height))
+}
+
+// SetBlockTxs sets the txids in block order of the block at height for
+// merkle proofs.
+func (c *Chain) SetBlockTxs(height int64, txids []string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.blockTxs[height] = append([]string{}, txids...)
+}
+
+// AddTx stores a raw tx as hex to serve by txid.
+func (c *Chain) AddTx(txid, rawTx string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.txs[txid] = rawTx
+}
+
+// SetHistory replaces the history of scripthash. Confirmed txs come first in
+// block order then mempool txs as ElectrumX sends them.
+func (c *Chain) SetHistory(scripthash string, history []HistoryItem) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.history[scripthash] = append([]HistoryItem{}, history...)
+}
+
+// AddHistory adds txs to the end of the history of scripthash.
+func (c *Chain) AddHistory(scripthash string, items ...HistoryItem) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.history[scripthash] = append(c.history[scripthash], items...)
+}
+
+// SetUnspent replaces the utxos of scripthash.
+func (c *Chain) SetUnspent(scripthash string, utxos []Unspent) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.unspent[scripthash] = append([]Unspent{}, utxos...)
+}
+
+// AddUnspent adds utxos to scripthash.
+func (c *Chain) AddUnspent(scripthash string, utxos ...Unspent) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.unspent[scripthash] = append(c.unspent[scripthash], utxos...)
+}
+
+// SetFees sets the relay fee and estimatefee result in coin per kB and the
+// mempool fee histogram of [fee rate, vsize] pairs from the highest fee rate.
+func (c *Chain) SetFees(relayFee, feeRate float64, histogram [][2]float64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.relayFee = relayFee
+	c.feeRate = feeRate
+	c.histogram = histogram
+}
+
+// Status is the electrum status of scripthash: the sha256 of the concatenated
+// "tx_hash:height:" strings as hex or "" for no history.
+func (c *Chain) Status(scripthash string) string {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.status(scripthash)
+}
+
+// status - not locked
+func (c *Chain) status(scripthash string) string {
+	history := c.history[scripthash]
+	if len(history) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	for _, h := range history {
+		sb.WriteString(h.TxHash)
+		sb.WriteByte(':')
+		sb.WriteString(strconv.FormatInt(h.Height, 10))
+		sb.WriteByte(':')
+	}
+	sum := sha256.Sum256([]byte(sb.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// blockHashes returns the block hashes from genesis up to height - not locked
+func (c *Chain) blockHashes(height int64) []chainhash.Hash {
+	hashes := make([]chainhash.Hash, 0, height+1)
+	for h := int64(0); h <= height; h++ {
+		hashes = append(hashes, c.hashFunc(c.headers[h]))
+	}
+	return hashes
+}
+
+// merkleBranch returns the electrum style merkle branch of the hash at pos
+// and the merkle root of hashes. An odd hash at any level is paired with
+// itself.
+func merkleBranch(hashes []chainhash.Hash, pos int) ([]chainhash.Hash, chainhash.Hash) {
+	var branch []chainhash.Hash
+	level := append([]chainhash.Hash{}, hashes...)
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		branch = append(branch, level[pos^1])
+		next := make([]chainhash.Hash, 0, len(level)/2)
+		for i := 0; i < len(level); i += 2 {
+			var buf [2 * chainhash.HashSize]byte
+			copy(buf[:chainhash.HashSize], level[i][:])
+			copy(buf[chainhash.HashSize:], level[i+1][:])
+			next = append(next, chainhash.DoubleHashH(buf[:]))
+		}
+		level = next
+		pos >>= 1
+	}
+	return branch, level[0]
+}
@@ -0,0 +1,71 @@
+package electrumxtest
+
+// Fault injection.
+//
+// A Fault set for a method applies to the next Count requests for it, or to
+// all of them until cleared if Count is 0. A fault delays the reply, then
+// either drops the connection or answers with an RPC error. A fault with only
+// a Delay is a slow reply. Corrupted headers are served wherever a header is
+// sent and break the prev block hash linkage.
+
+import "time"
+
+// Fault is what goes wrong with the requests for a method.
+type Fault struct {
+	Delay time.Duration
+	// close the connection instead of replying
+	Drop bool
+	// reply with this error instead of the result
+	Err *RPCError
+	// number of requests affected; 0 for all
+	Count int
+}
+
+// SetFault sets the fault for method.
+func (s *Server) SetFault(method string, fault Fault) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.faults[method] = &fault
+}
+
+// ClearFaults removes all faults and corrupted headers.
+func (s *Server) ClearFaults() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.faults = make(map[string]*Fault)
+	s.badHeaders = make(map[int64]bool)
+}
+
+// CorruptHeader serves a bad header at height until faults are cleared.
+func (s *Server) CorruptHeader(height int64) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.badHeaders[height] = true
+}
+
+// DropConnections closes all client connections now.
+func (s *Server) DropConnections() {
+	for _, c := range s.connList() {
+		c.close()
+	}
+}
+
+// takeFault counts a request for method and returns its fault if any, using
+// up one of the fault's Count.
+func (s *Server) takeFault(method string) *Fault {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.requests[method]++
+	fault, ok := s.faults[method]
+	if !ok {
+		return nil
+	}
+	if fault.Count > 0 {
+		fault.Count--
+		if fault.Count == 0 {
+			delete(s.faults, method)
+		}
+	}
+	f := *fault
+	return &f
+}
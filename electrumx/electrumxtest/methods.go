@@ -0,0 +1,460 @@
+package electrumxtest
+
+// Electrum protocol methods answered from the chain model.
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+type historyResult struct {
+	Height int64  `json:"height"`
+	TxHash string `json:"tx_hash"`
+	Fee    int64  `json:"fee,omitempty"`
+}
+
+type unspentResult struct {
+	Height int64  `json:"height"`
+	TxPos  int64  `json:"tx_pos"`
+	TxHash string `json:"tx_hash"`
+	Value  int64  `json:"value"`
+}
+
+type headersChunkResult struct {
+	Count   int      `json:"count"`
+	Hex     string   `json:"hex,omitempty"`
+	Headers []string `json:"headers,omitempty"`
+	Max     int      `json:"max"`
+	Branch  []string `json:"branch,omitempty"`
+	Root    string   `json:"root,omitempty"`
+}
+
+func badRequest(msg string) *RPCError {
+	return &RPCError{Code: BAD_REQUEST, Message: msg}
+}
+
+// params are the positional params of a request
+type params []json.RawMessage
+
+func (p params) int(i int) (int64, bool) {
+	if i >= len(p) {
+		return 0, false
+	}
+	var n int64
+	return n, json.Unmarshal(p[i], &n) == nil
+}
+
+func (p params) string(i int) (string, bool) {
+	if i >= len(p) {
+		return "", false
+	}
+	var s string
+	return s, json.Unmarshal(p[i], &s) == nil
+}
+
+func (p params) bool(i int) bool {
+	if i >= len(p) {
+		return false
+	}
+	var b bool
+	json.Unmarshal(p[i], &b)
+	return b
+}
+
+func (c *conn) dispatch(req *request) (any, *RPCError) {
+	var p params
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return nil, badRequest("params must be an array")
+		}
+	}
+	s := c.s
+	chain := s.chain
+
+	switch req.Method {
+	case "server.version":
+		var versions []string
+		if len(p) > 1 {
+			if err := json.Unmarshal(p[1], &versions); err != nil {
+				var v string
+				if json.Unmarshal(p[1], &v) == nil {
+					versions = []string{v, v}
+				}
+			}
+		}
+		if len(versions) != 2 {
+			versions = []string{PROTOCOL_MIN, PROTOCOL_MIN}
+		}
+		v, err := s.negotiate(versions[0], versions[1])
+		if err != nil {
+			return nil, badRequest(err.Error())
+		}
+		c.mtx.Lock()
+		c.protocol = v
+		c.mtx.Unlock()
+		return []string{s.opts.SoftwareVersion, versionString(v)}, nil
+
+	case "server.features":
+		genesis := s.opts.Genesis
+		if genesis == "" {
+			genesis = chain.BlockHash(0).String()
+		}
+		return map[string]any{
+			"genesis_hash":   genesis,
+			"hosts":          map[string]any{},
+			"protocol_min":   s.opts.ProtocolMin,
+			"protocol_max":   s.opts.ProtocolMax,
+			"pruning":        nil,
+			"server_version": s.opts.SoftwareVersion,
+			"hash_function":  "sha256",
+		}, nil
+
+	case "server.banner":
+		return "electrumxtest", nil
+
+	case "server.donation_address":
+		return "", nil
+
+	case "server.ping":
+		return nil, nil
+
+	case "server.peers.subscribe":
+		peers := make([][]any, 0, len(s.opts.Peers))
+		for _, peer := range s.opts.Peers {
+			peers = append(peers, []any{peer.Addr, peer.Host, peer.Features})
+		}
+		return peers, nil
+
+	case "blockchain.block.header":
+		height, ok := p.int(0)
+		if !ok {
+			return nil, badRequest("invalid height")
+		}
+		raw := s.servedHeader(height)
+		if raw == nil {
+			return nil, badRequest("height out of range")
+		}
+		return hex.EncodeToString(raw), nil
+
+	case "blockchain.block.headers":
+		return c.blockHeaders(p)
+
+	case "blockchain.headers.subscribe":
+		c.mtx.Lock()
+		c.headersSub = true
+		c.mtx.Unlock()
+		return s.tip(), nil
+
+	case "blockchain.scripthash.subscribe":
+		scripthash, ok := p.string(0)
+		if !ok {
+			return nil, badRequest("invalid scripthash")
+		}
+		c.mtx.Lock()
+		c.scripthashes[scripthash] = true
+		c.mtx.Unlock()
+		return nullable(chain.Status(scripthash)), nil
+
+	case "blockchain.scripthash.unsubscribe":
+		scripthash, ok := p.string(0)
+		if !ok {
+			return nil, badRequest("invalid scripthash")
+		}
+		c.mtx.Lock()
+		defer c.mtx.Unlock()
+		was := c.scripthashes[scripthash]
+		delete(c.scripthashes, scripthash)
+		return was, nil
+
+	case "blockchain.scripthash.get_history":
+		scripthash, ok := p.string(0)
+		if !ok {
+			return nil, badRequest("invalid scripthash")
+		}
+		return chain.historyResults(scripthash, false), nil
+
+	case "blockchain.scripthash.get_mempool":
+		scripthash, ok := p.string(0)
+		if !ok {
+			return nil, badRequest("invalid scripthash")
+		}
+		return chain.historyResults(scripthash, true), nil
+
+	case "blockchain.scripthash.listunspent":
+		scripthash, ok := p.string(0)
+		if !ok {
+			return nil, badRequest("invalid scripthash")
+		}
+		return chain.unspentResults(scripthash), nil
+
+	case "blockchain.scripthash.get_balance":
+		scripthash, ok := p.string(0)
+		if !ok {
+			return nil, badRequest("invalid scripthash")
+		}
+		var confirmed, unconfirmed int64
+		for _, u := range chain.unspentResults(scripthash) {
+			if u.Height > 0 {
+				confirmed += u.Value
+			} else {
+				unconfirmed += u.Value
+			}
+		}
+		return map[string]int64{"confirmed": confirmed, "unconfirmed": unconfirmed}, nil
+
+	case "blockchain.transaction.get":
+		txid, ok := p.string(0)
+		if !ok {
+			return nil, badRequest("invalid txid")
+		}
+		return chain.transaction(txid, p.bool(1))
+
+	case "blockchain.transaction.get_merkle":
+		txid, ok := p.string(0)
+		if !ok {
+			return nil, badRequest("invalid txid")
+		}
+		height, ok := p.int(1)
+		if !ok {
+			return nil, badRequest("invalid height")
+		}
+		return chain.merkle(txid, height)
+
+	case "blockchain.transaction.broadcast":
+		rawTx, ok := p.string(0)
+		if !ok {
+			return nil, badRequest("invalid raw tx")
+		}
+		txid, err := s.opts.Broadcast(rawTx)
+		if err != nil {
+			return nil, &RPCError{Code: DAEMON_ERROR, Message: err.Error()}
+		}
+		return txid, nil
+
+	case "blockchain.transaction.broadcast_package":
+		var rawTxs []string
+		if len(p) == 0 || json.Unmarshal(p[0], &rawTxs) != nil || len(rawTxs) == 0 {
+			return nil, badRequest("invalid raw txs")
+		}
+		return s.broadcastPackage(rawTxs, p.bool(1)), nil
+
+	case "blockchain.estimatefee":
+		chain.mtx.RLock()
+		defer chain.mtx.RUnlock()
+		return chain.feeRate, nil
+
+	case "blockchain.relayfee":
+		chain.mtx.RLock()
+		defer chain.mtx.RUnlock()
+		return chain.relayFee, nil
+
+	case "mempool.get_fee_histogram":
+		chain.mtx.RLock()
+		defer chain.mtx.RUnlock()
+		histogram := chain.histogram
+		if histogram == nil {
+			histogram = [][2]float64{}
+		}
+		return histogram, nil
+	}
+
+	return nil, &RPCError{Code: METHOD_UNKNOWN, Message: "unknown method " + req.Method}
+}
+
+// broadcastPackage answers blockchain.transaction.broadcast_package. Like
+// ElectrumX the non verbose result is {success, errors} while the verbose one
+// is bitcoind's submitpackage result, which has no success field.
+func (s *Server) broadcastPackage(rawTxs []string, verbose bool) any {
+	type txError struct {
+		Txid  string `json:"txid"`
+		Error string `json:"error"`
+	}
+	var txErrors []txError
+	txResults := make(map[string]any, len(rawTxs))
+	for _, rawTx := range rawTxs {
+		txid, err := s.opts.Broadcast(rawTx)
+		if err != nil {
+			// the default handler cannot know the txid of a tx it cannot decode
+			txErrors = append(txErrors, txError{Txid: txid, Error: err.Error()})
+			continue
+		}
+		txResults[txid] = map[string]string{"txid": txid}
+	}
+	if verbose {
+		msg := "success"
+		if len(txErrors) > 0 {
+			msg = "transaction failed"
+		}
+		return map[string]any{"package_msg": msg, "tx-results": txResults}
+	}
+	result := map[string]any{"success": len(txErrors) == 0}
+	if len(txErrors) > 0 {
+		result["errors"] = txErrors
+	}
+	return result
+}
+
+// blockHeaders answers blockchain.block.headers [start, count, cp_height].
+func (c *conn) blockHeaders(p params) (any, *RPCError) {
+	s := c.s
+	start, ok := p.int(0)
+	if !ok || start < 0 {
+		return nil, badRequest("invalid start height")
+	}
+	count, ok := p.int(1)
+	if !ok || count < 0 {
+		return nil, badRequest("invalid count")
+	}
+	if count > int64(s.opts.MaxChunk) {
+		count = int64(s.opts.MaxChunk)
+	}
+	tip := s.chain.Tip()
+	if start+count-1 > tip {
+		count = tip - start + 1
+	}
+	if count < 0 {
+		count = 0
+	}
+
+	res := &headersChunkResult{Count: int(count), Max: s.opts.MaxChunk}
+	raws := make([]string, 0, count)
+	for h := start; h < start+count; h++ {
+		raws = append(raws, hex.EncodeToString(s.servedHeader(h)))
+	}
+	c.mtx.Lock()
+	listHeaders := !versionLess(c.protocol, [3]int{1, 6, 0})
+	c.mtx.Unlock()
+	if listHeaders {
+		res.Headers = raws
+	} else {
+		res.Hex = strings.Join(raws, "")
+	}
+
+	// as ElectrumX a cp_height of 0 asks for no proof
+	cpHeight, ok := p.int(2)
+	if !ok || cpHeight == 0 {
+		return res, nil
+	}
+	last := start + count - 1
+	if count == 0 || last > cpHeight || cpHeight > tip {
+		return nil, badRequest("header range not below checkpoint height")
+	}
+	s.chain.mtx.RLock()
+	hashes := s.chain.blockHashes(cpHeight)
+	s.chain.mtx.RUnlock()
+	branch, root := merkleBranch(hashes, int(last))
+	res.Branch = hashStrings(branch)
+	res.Root = root.String()
+	return res, nil
+}
+
+func hashStrings(hashes []chainhash.Hash) []string {
+	strs := make([]string, len(hashes))
+	for i := range hashes {
+		strs[i] = hashes[i].String()
+	}
+	return strs
+}
+
+// historyResults is the history of scripthash or only its mempool txs.
+func (c *Chain) historyResults(scripthash string, mempool bool) []*historyResult {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	results := make([]*historyResult, 0)
+	for _, h := range c.history[scripthash] {
+		inMempool := h.Height <= 0
+		if mempool && !inMempool {
+			continue
+		}
+		r := &historyResult{Height: h.Height, TxHash: h.TxHash}
+		if inMempool {
+			r.Fee = h.Fee
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+func (c *Chain) unspentResults(scripthash string) []*unspentResult {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	results := make([]*unspentResult, 0)
+	for _, u := range c.unspent[scripthash] {
+		results = append(results, &unspentResult{
+			Height: u.Height,
+			TxPos:  u.TxPos,
+			TxHash: u.TxHash,
+			Value:  u.Value,
+		})
+	}
+	return results
+}
+
+// transaction is the raw tx as hex or a verbose result with the hex, txid and
+// the block it is in if known.
+func (c *Chain) transaction(txid string, verbose bool) (any, *RPCError) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	rawTx, ok := c.txs[txid]
+	if !ok {
+		return nil, &RPCError{Code: DAEMON_ERROR, Message: "No such mempool or blockchain transaction."}
+	}
+	if !verbose {
+		return rawTx, nil
+	}
+	result := map[string]any{
+		"txid": txid,
+		"hex":  rawTx,
+	}
+	if height, _, ok := c.blockOf(txid); ok {
+		tip := int64(len(c.headers)) - 1
+		result["blockhash"] = c.hashFunc(c.headers[height]).String()
+		result["confirmations"] = tip - height + 1
+	}
+	return result, nil
+}
+
+// blockOf finds the block height and position of txid - not locked
+func (c *Chain) blockOf(txid string) (int64, int, bool) {
+	for height, txids := range c.blockTxs {
+		for pos, id := range txids {
+			if id == txid {
+				return height, pos, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+func (c *Chain) merkle(txid string, height int64) (any, *RPCError) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	txids := c.blockTxs[height]
+	pos := -1
+	for i, id := range txids {
+		if id == txid {
+			pos = i
+			break
+		}
+	}
+	if pos < 0 {
+		return nil, badRequest("tx " + txid + " not in block at height")
+	}
+	hashes := make([]chainhash.Hash, len(txids))
+	for i, id := range txids {
+		hash, err := chainhash.NewHashFromStr(id)
+		if err != nil {
+			return nil, badRequest("bad txid in block: " + id)
+		}
+		hashes[i] = *hash
+	}
+	branch, _ := merkleBranch(hashes, pos)
+	return map[string]any{
+		"merkle":       hashStrings(branch),
+		"block_height": height,
+		"pos":          pos,
+	}, nil
+}
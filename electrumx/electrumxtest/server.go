@@ -0,0 +1,580 @@
+// Package electrumxtest provides an in-process ElectrumX server for tests.
+//
+// A Server speaks the newline delimited JSON-RPC of the Electrum protocol over
+// TCP or TLS, or one message per frame over WebSockets, on a localhost port. It serves headers, scripthash history and
+// utxos, raw txs, merkle proofs and fees from a Chain which the test programs,
+// and sends header and scripthash notifications when told to. Faults can be
+// injected per method: slow replies, RPC errors, dropped connections and
+// corrupted headers. So failover, reorg and sync can be tested with no network
+// or regtest harness.
+package electrumxtest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"golang.org/x/net/websocket"
+)
+
+const newline = byte('\n')
+
+// Defaults for Options
+const (
+	SOFTWARE_VERSION = "ElectrumX 1.16.0"
+	PROTOCOL_MIN     = "1.4"
+	PROTOCOL_MAX     = "1.4.2"
+	MAX_CHUNK        = 2016
+)
+
+// Peer is a server sent in answer to server.peers.subscribe.
+type Peer struct {
+	Addr     string
+	Host     string
+	Features []string // e.g. "v1.4.2", "s50002", "t50001"
+}
+
+// Options configure a Server. The zero value serves a bitcoin like chain over
+// TCP with the defaults above.
+type Options struct {
+	// serve TLS with a self signed certificate
+	TLS bool
+	// serve WebSockets, wss if TLS is also set
+	WebSocket bool
+	// genesis_hash in server.features; defaults to the chain's block 0 hash
+	Genesis         string
+	SoftwareVersion string
+	ProtocolMin     string
+	ProtocolMax     string
+	// most headers sent for one blockchain.block.headers request
+	MaxChunk int
+	Peers    []Peer
+	// Broadcast handles blockchain.transaction.broadcast and returns the
+	// txid or the reject reason. By default the tx is decoded as a bitcoin
+	// wire tx and added to the chain.
+	Broadcast func(rawTx string) (string, error)
+}
+
+// Server is an in-process ElectrumX server for tests.
+type Server struct {
+	chain    *Chain
+	opts     Options
+	listener net.Listener
+	wg       sync.WaitGroup
+	// the websocket server if serving WebSockets
+	httpServer *http.Server
+
+	mtx        sync.Mutex
+	closed     bool
+	conns      map[*conn]struct{}
+	faults     map[string]*Fault
+	badHeaders map[int64]bool
+	requests   map[string]int
+}
+
+// NewServer returns a server for chain. Start it to listen.
+func NewServer(chain *Chain, opts *Options) *Server {
+	s := &Server{
+		chain:      chain,
+		conns:      make(map[*conn]struct{}),
+		faults:     make(map[string]*Fault),
+		badHeaders: make(map[int64]bool),
+		requests:   make(map[string]int),
+	}
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.SoftwareVersion == "" {
+		s.opts.SoftwareVersion = SOFTWARE_VERSION
+	}
+	if s.opts.ProtocolMin == "" {
+		s.opts.ProtocolMin = PROTOCOL_MIN
+	}
+	if s.opts.ProtocolMax == "" {
+		s.opts.ProtocolMax = PROTOCOL_MAX
+	}
+	if s.opts.MaxChunk <= 0 {
+		s.opts.MaxChunk = MAX_CHUNK
+	}
+	if s.opts.Broadcast == nil {
+		s.opts.Broadcast = s.decodeBroadcast
+	}
+	return s
+}
+
+// Start listens on a random localhost port and serves connections until
+// Close.
+func (s *Server) Start() error {
+	var listener net.Listener
+	var err error
+	if s.opts.TLS {
+		var cert tls.Certificate
+		cert, err = selfSignedCert()
+		if err != nil {
+			return err
+		}
+		listener, err = tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		})
+	} else {
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	s.wg.Add(1)
+	if s.opts.WebSocket {
+		s.httpServer = &http.Server{
+			Handler: websocket.Server{Handler: s.serveWebSocket},
+		}
+		go func() {
+			defer s.wg.Done()
+			s.httpServer.Serve(listener)
+		}()
+		return nil
+	}
+	go s.accept()
+	return nil
+}
+
+// Addr is the host:port the server listens on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops listening and closes all connections.
+func (s *Server) Close() {
+	s.mtx.Lock()
+	if s.closed {
+		s.mtx.Unlock()
+		return
+	}
+	s.closed = true
+	for c := range s.conns {
+		c.close()
+	}
+	s.mtx.Unlock()
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+// Chain returns the chain served.
+func (s *Server) Chain() *Chain {
+	return s.chain
+}
+
+// NumConns is the number of open client connections.
+func (s *Server) NumConns() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return len(s.conns)
+}
+
+// Requests is the number of requests received for method.
+func (s *Server) Requests(method string) int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.requests[method]
+}
+
+// NotifyTip sends the chain tip to the connections subscribed to headers.
+func (s *Server) NotifyTip() {
+	tip := s.tip()
+	for _, c := range s.connList() {
+		if c.headersSubscribed() {
+			c.notify("blockchain.headers.subscribe", []any{tip})
+		}
+	}
+}
+
+// NotifyScripthash sends the status of scripthash to the connections
+// subscribed to it.
+func (s *Server) NotifyScripthash(scripthash string) {
+	status := s.chain.Status(scripthash)
+	for _, c := range s.connList() {
+		if c.scripthashSubscribed(scripthash) {
+			c.notify("blockchain.scripthash.subscribe", []any{scripthash, nullable(status)})
+		}
+	}
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		netConn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		c := s.newConn(netConn)
+		if c == nil {
+			return
+		}
+		go c.serve()
+	}
+}
+
+// newConn adds a client connection to serve. Returns nil if the server is
+// closed.
+func (s *Server) newConn(netConn net.Conn) *conn {
+	c := &conn{
+		s:            s,
+		netConn:      netConn,
+		scripthashes: make(map[string]bool),
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.closed {
+		netConn.Close()
+		return nil
+	}
+	s.conns[c] = struct{}{}
+	s.wg.Add(1)
+	return c
+}
+
+func (s *Server) connList() []*conn {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+func (s *Server) removeConn(c *conn) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	delete(s.conns, c)
+}
+
+// headersResult is the result of blockchain.headers.subscribe and its
+// notifications.
+type headersResult struct {
+	Height int64  `json:"height"`
+	Hex    string `json:"hex"`
+}
+
+func (s *Server) tip() *headersResult {
+	tip := s.chain.Tip()
+	return &headersResult{Height: tip, Hex: hex.EncodeToString(s.servedHeader(tip))}
+}
+
+// servedHeader is the header at height as served, corrupted if set up so.
+func (s *Server) servedHeader(height int64) []byte {
+	raw := s.chain.Header(height)
+	if raw == nil {
+		return nil
+	}
+	s.mtx.Lock()
+	bad := s.badHeaders[height]
+	s.mtx.Unlock()
+	if bad {
+		raw = append([]byte{}, raw...)
+		// break the prev block hash linkage
+		raw[4] ^= 0xff
+	}
+	return raw
+}
+
+// decodeBroadcast is the default broadcast handler.
+func (s *Server) decodeBroadcast(rawTx string) (string, error) {
+	b, err := hex.DecodeString(rawTx)
+	if err != nil {
+		return "", errors.New("TX decode failed")
+	}
+	var tx wire.MsgTx
+	if err := tx.Deserialize(bytes.NewReader(b)); err != nil {
+		return "", errors.New("TX decode failed")
+	}
+	txid := tx.TxHash().String()
+	s.chain.AddTx(txid, rawTx)
+	return txid, nil
+}
+
+// ----------------------------------------------------------------------------
+// Connections
+// ----------------------------------------------------------------------------
+
+// request and response are the JSON-RPC messages
+type request struct {
+	ID     uint64          `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type response struct {
+	Jsonrpc string    `json:"jsonrpc"`
+	ID      uint64    `json:"id"`
+	Result  any       `json:"result"`
+	Error   *RPCError `json:"error,omitempty"`
+}
+
+type notification struct {
+	Jsonrpc string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+// RPCError is a JSON-RPC error object sent to the client.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("code %d: %q", e.Code, e.Message)
+}
+
+// JSON-RPC error codes as sent by ElectrumX
+const (
+	BAD_REQUEST    = 1
+	DAEMON_ERROR   = 2
+	METHOD_UNKNOWN = -32601
+)
+
+// conn is one client connection.
+type conn struct {
+	s       *Server
+	netConn net.Conn
+
+	writeMtx sync.Mutex
+
+	mtx          sync.Mutex
+	protocol     [3]int
+	headersSub   bool
+	scripthashes map[string]bool
+}
+
+func (c *conn) close() {
+	c.netConn.Close()
+}
+
+// serve reads requests until the connection is closed. Each message is
+// handled in its own goroutine so that a slow reply does not hold up others.
+func (c *conn) serve() {
+	defer c.s.wg.Done()
+	defer c.s.removeConn(c)
+	defer c.close()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	reader := bufio.NewReader(c.netConn)
+	for {
+		msg, err := reader.ReadBytes(newline)
+		if err != nil {
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.handleMsg(msg)
+		}()
+	}
+}
+
+func (c *conn) handleMsg(msg []byte) {
+	if isBatch(msg) {
+		var reqs []*request
+		if err := json.Unmarshal(msg, &reqs); err != nil {
+			c.close()
+			return
+		}
+		resps := make([]*response, 0, len(reqs))
+		for _, req := range reqs {
+			resp, ok := c.handle(req)
+			if !ok {
+				c.close()
+				return
+			}
+			resps = append(resps, resp)
+		}
+		c.write(resps)
+		return
+	}
+	var req request
+	if err := json.Unmarshal(msg, &req); err != nil {
+		c.close()
+		return
+	}
+	resp, ok := c.handle(&req)
+	if !ok {
+		c.close()
+		return
+	}
+	c.write(resp)
+}
+
+// handle applies any fault for the method then answers the request. Returns
+// false if the connection is to be dropped.
+func (c *conn) handle(req *request) (*response, bool) {
+	fault := c.s.takeFault(req.Method)
+	if fault != nil {
+		if fault.Delay > 0 {
+			time.Sleep(fault.Delay)
+		}
+		if fault.Drop {
+			return nil, false
+		}
+		if fault.Err != nil {
+			return &response{Jsonrpc: "2.0", ID: req.ID, Error: fault.Err}, true
+		}
+	}
+	result, rpcErr := c.dispatch(req)
+	return &response{Jsonrpc: "2.0", ID: req.ID, Result: result, Error: rpcErr}, true
+}
+
+func (c *conn) write(msg any) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+	c.netConn.Write(append(b, newline))
+}
+
+func (c *conn) notify(method string, params any) {
+	c.write(&notification{Jsonrpc: "2.0", Method: method, Params: params})
+}
+
+func (c *conn) headersSubscribed() bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.headersSub
+}
+
+func (c *conn) scripthashSubscribed(scripthash string) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.scripthashes[scripthash]
+}
+
+// isBatch reports whether msg is a json array; a batch request.
+func isBatch(msg []byte) bool {
+	for _, b := range msg {
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '[':
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// nullable sends "" as json null
+func nullable(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// ----------------------------------------------------------------------------
+// Protocol versions
+// ----------------------------------------------------------------------------
+
+func parseVersion(s string) ([3]int, error) {
+	var v [3]int
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return v, fmt.Errorf("bad protocol version %q", s)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("bad protocol version %q", s)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+func versionLess(a, b [3]int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+func versionString(v [3]int) string {
+	if v[2] == 0 {
+		return fmt.Sprintf("%d.%d", v[0], v[1])
+	}
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
+
+// negotiate picks the highest protocol version both we and the client speak.
+func (s *Server) negotiate(clientMin, clientMax string) ([3]int, error) {
+	cMin, err := parseVersion(clientMin)
+	if err != nil {
+		return cMin, err
+	}
+	cMax, err := parseVersion(clientMax)
+	if err != nil {
+		return cMax, err
+	}
+	sMin, _ := parseVersion(s.opts.ProtocolMin)
+	sMax, _ := parseVersion(s.opts.ProtocolMax)
+	v := sMax
+	if versionLess(cMax, v) {
+		v = cMax
+	}
+	if versionLess(v, cMin) || versionLess(v, sMin) {
+		return v, fmt.Errorf("unsupported protocol version: %s", clientMax)
+	}
+	return v, nil
+}
+
+// ----------------------------------------------------------------------------
+// TLS
+// ----------------------------------------------------------------------------
+
+// selfSignedCert makes a certificate for localhost. Clients connect with
+// InsecureSkipVerify or pin it.
+func selfSignedCert() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "electrumxtest"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
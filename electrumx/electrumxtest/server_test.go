@@ -0,0 +1,254 @@
+package electrumxtest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// mkChain makes a chain of n linked headers from a genesis.
+func mkChain(t *testing.T, n int) *Chain {
+	var chain *Chain
+	var prev chainhash.Hash
+	for i := 0; i < n; i++ {
+		hdr := wire.BlockHeader{Version: 1, PrevBlock: prev, Nonce: uint32(i)}
+		var b bytes.Buffer
+		if err := hdr.Serialize(&b); err != nil {
+			t.Fatal(err)
+		}
+		if chain == nil {
+			chain = NewChain(b.Bytes())
+		} else {
+			chain.AddHeaders(b.Bytes())
+		}
+		prev = hdr.BlockHash()
+	}
+	return chain
+}
+
+// testClient sends requests one at a time and keeps notifications.
+type testClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+	id     uint64
+	ntfns  []*notification
+}
+
+type testResponse struct {
+	ID     uint64          `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+}
+
+func dial(t *testing.T, s *Server) *testClient {
+	var conn net.Conn
+	var err error
+	if s.opts.TLS {
+		conn, err = tls.Dial("tcp", s.Addr(), &tls.Config{InsecureSkipVerify: true})
+	} else {
+		conn, err = net.Dial("tcp", s.Addr())
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testClient{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// call sends a request and reads up to its response. Returns nil if the
+// connection was closed.
+func (c *testClient) call(method string, params ...any) *testResponse {
+	c.id++
+	if params == nil {
+		params = []any{}
+	}
+	b, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": c.id, "method": method, "params": params})
+	if _, err := c.conn.Write(append(b, newline)); err != nil {
+		return nil
+	}
+	for {
+		resp := c.read()
+		if resp == nil || resp.Method == "" {
+			return resp
+		}
+	}
+}
+
+// read reads the next message. Notifications are kept.
+func (c *testClient) read() *testResponse {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	msg, err := c.reader.ReadBytes(newline)
+	if err != nil {
+		return nil
+	}
+	var resp testResponse
+	if err := json.Unmarshal(msg, &resp); err != nil {
+		c.t.Fatal(err)
+	}
+	if resp.Method != "" {
+		c.ntfns = append(c.ntfns, &notification{Method: resp.Method, Params: resp.Params})
+	}
+	return &resp
+}
+
+func (c *testClient) result(method string, result any, params ...any) {
+	resp := c.call(method, params...)
+	if resp == nil {
+		c.t.Fatalf("%s: connection closed", method)
+	}
+	if resp.Error != nil {
+		c.t.Fatalf("%s: %v", method, resp.Error)
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		c.t.Fatalf("%s: %v", method, err)
+	}
+}
+
+func TestServerHeaders(t *testing.T) {
+	chain := mkChain(t, 30)
+	s := NewServer(chain, &Options{TLS: true, MaxChunk: 10})
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	c := dial(t, s)
+
+	var version []string
+	c.result("server.version", &version, "test", []string{"1.4", "1.6"})
+	if version[1] != "1.4.2" {
+		t.Fatalf("negotiated %s", version[1])
+	}
+	var feats map[string]any
+	c.result("server.features", &feats)
+	if feats["genesis_hash"] != chain.BlockHash(0).String() {
+		t.Fatalf("bad genesis %v", feats["genesis_hash"])
+	}
+
+	// chunk cut to max with a proof of its last header to cp_height 25
+	var res headersChunkResult
+	c.result("blockchain.block.headers", &res, 5, 100, 25)
+	if res.Count != 10 || len(res.Hex) != 10*80*2 {
+		t.Fatalf("got %d headers", res.Count)
+	}
+	hashes := chain.blockHashes(25)
+	_, root := merkleBranch(hashes, 14)
+	if res.Root != root.String() || len(res.Branch) != 5 {
+		t.Fatalf("bad proof root %s branch %d", res.Root, len(res.Branch))
+	}
+
+	// short chunk at the tip
+	c.result("blockchain.block.headers", &res, 25, 10)
+	if res.Count != 5 {
+		t.Fatalf("got %d headers at tip", res.Count)
+	}
+
+	// a corrupted header no longer links
+	s.CorruptHeader(29)
+	var tip headersResult
+	c.result("blockchain.headers.subscribe", &tip)
+	raw, _ := hex.DecodeString(tip.Hex)
+	if tip.Height != 29 || string(raw) == string(chain.Header(29)) {
+		t.Fatal("header not corrupted")
+	}
+	s.ClearFaults()
+
+	// tip notification after the chain grows
+	chain.AddHeaders(chain.Header(29))
+	s.NotifyTip()
+	if c.read() == nil || len(c.ntfns) != 1 || c.ntfns[0].Method != "blockchain.headers.subscribe" {
+		t.Fatal("no tip notification")
+	}
+}
+
+func TestServerScripthash(t *testing.T) {
+	chain := mkChain(t, 5)
+	s := NewServer(chain, nil)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	c := dial(t, s)
+
+	const sh = "aa"
+	var status *string
+	c.result("blockchain.scripthash.subscribe", &status, sh)
+	if status != nil {
+		t.Fatalf("status %s for no history", *status)
+	}
+	chain.SetHistory(sh, []HistoryItem{{TxHash: "01", Height: 3}, {TxHash: "02", Fee: 200}})
+	chain.SetUnspent(sh, []Unspent{{TxHash: "01", Height: 3, Value: 1000}, {TxHash: "02", Value: 500}})
+	s.NotifyScripthash(sh)
+	if c.read() == nil || len(c.ntfns) != 1 {
+		t.Fatal("no scripthash notification")
+	}
+	var params []string
+	json.Unmarshal(c.ntfns[0].Params.(json.RawMessage), &params)
+	if len(params) != 2 || params[1] != chain.Status(sh) {
+		t.Fatalf("bad notification %v", params)
+	}
+
+	var history []historyResult
+	c.result("blockchain.scripthash.get_history", &history, sh)
+	if len(history) != 2 || history[0].Fee != 0 || history[1].Fee != 200 {
+		t.Fatalf("bad history %v", history)
+	}
+	var mempool []historyResult
+	c.result("blockchain.scripthash.get_mempool", &mempool, sh)
+	if len(mempool) != 1 {
+		t.Fatalf("bad mempool %v", mempool)
+	}
+	var balance map[string]int64
+	c.result("blockchain.scripthash.get_balance", &balance, sh)
+	if balance["confirmed"] != 1000 || balance["unconfirmed"] != 500 {
+		t.Fatalf("bad balance %v", balance)
+	}
+}
+
+func TestServerFaults(t *testing.T) {
+	s := NewServer(mkChain(t, 5), nil)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	c := dial(t, s)
+
+	s.SetFault("server.ping", Fault{Err: &RPCError{Code: 5, Message: "busy"}, Count: 1})
+	resp := c.call("server.ping")
+	if resp.Error == nil || resp.Error.Message != "busy" {
+		t.Fatalf("expected busy error got %v", resp.Error)
+	}
+	if resp = c.call("server.ping"); resp.Error != nil {
+		t.Fatalf("fault not used up: %v", resp.Error)
+	}
+
+	s.SetFault("server.ping", Fault{Delay: 100 * time.Millisecond})
+	start := time.Now()
+	c.call("server.ping")
+	if time.Since(start) < 100*time.Millisecond {
+		t.Fatal("reply not delayed")
+	}
+
+	s.SetFault("server.ping", Fault{Drop: true})
+	if c.call("server.ping") != nil {
+		t.Fatal("connection not dropped")
+	}
+	if n := s.Requests("server.ping"); n != 4 {
+		t.Fatalf("counted %d pings", n)
+	}
+
+	resp = dial(t, s).call("no.such.method")
+	if resp.Error == nil || resp.Error.Code != METHOD_UNKNOWN {
+		t.Fatalf("expected unknown method got %v", resp.Error)
+	}
+}
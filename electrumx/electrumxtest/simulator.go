@@ -0,0 +1,443 @@
+package electrumxtest
+
+// A deterministic bitcoin regtest chain simulator.
+//
+// The Simulator is a Server whose chain model is driven by real blocks. It
+// mines blocks with valid regtest proof of work and merkle roots, keeps a
+// mempool and confirms the mempool in the next block mined. Txs broadcast by
+// a client have their inputs checked against the outputs the simulator knows,
+// but scripts and signatures are not checked. After every change the history
+// and utxos of each scripthash are rebuilt and the tip and changed statuses
+// are sent to subscribed clients.
+//
+// Block times step 10 minutes from the genesis time and nonces are ground
+// from 0 so the same calls always make the same chain.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Block reward paid to the coinbase script
+const BLOCK_REWARD = 50 * 1e8
+
+// Simulator is a regtest chain served over the Electrum protocol.
+type Simulator struct {
+	*Server
+	params *chaincfg.Params
+
+	mtx            sync.Mutex
+	blocks         []*wire.MsgBlock
+	mempool        []*wire.MsgTx
+	coinbaseScript []byte
+	// bumped on each reorg so the new branch's blocks differ from the old
+	branch uint32
+	// funding txs made so far
+	funded uint32
+	// outputs of confirmed and mempool txs and what spends them
+	outputs map[wire.OutPoint]*wire.TxOut
+	spentBy map[wire.OutPoint]chainhash.Hash
+	// last tip and statuses sent
+	tipHash  chainhash.Hash
+	statuses map[string]string
+}
+
+// NewSimulator returns a simulator with the regtest genesis block. Start it to
+// listen. opts.Broadcast is replaced by the simulator's mempool.
+func NewSimulator(opts *Options) *Simulator {
+	params := &chaincfg.RegressionNetParams
+	var genesis bytes.Buffer
+	params.GenesisBlock.Header.Serialize(&genesis)
+
+	sim := &Simulator{
+		params:         params,
+		blocks:         []*wire.MsgBlock{params.GenesisBlock},
+		coinbaseScript: []byte{txscript.OP_TRUE},
+		outputs:        make(map[wire.OutPoint]*wire.TxOut),
+		spentBy:        make(map[wire.OutPoint]chainhash.Hash),
+		statuses:       make(map[string]string),
+	}
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	o.Broadcast = sim.broadcast
+	sim.Server = NewServer(NewChain(genesis.Bytes()), &o)
+	sim.update()
+	return sim
+}
+
+// Scripthash is the electrum scripthash of pkScript.
+func Scripthash(pkScript []byte) string {
+	return chainhash.HashH(pkScript).String()
+}
+
+// SetCoinbaseScript sets the script paid by the coinbase of blocks mined from
+// now on. The default is OP_TRUE.
+func (sim *Simulator) SetCoinbaseScript(pkScript []byte) {
+	sim.mtx.Lock()
+	defer sim.mtx.Unlock()
+	sim.coinbaseScript = pkScript
+}
+
+// Tip is the height of the last block.
+func (sim *Simulator) Tip() int64 {
+	sim.mtx.Lock()
+	defer sim.mtx.Unlock()
+	return int64(len(sim.blocks)) - 1
+}
+
+// Mempool returns the txids in the mempool.
+func (sim *Simulator) Mempool() []string {
+	sim.mtx.Lock()
+	defer sim.mtx.Unlock()
+	txids := make([]string, 0, len(sim.mempool))
+	for _, tx := range sim.mempool {
+		txids = append(txids, tx.TxHash().String())
+	}
+	return txids
+}
+
+// TxHeight returns the height of the block txid is in, 0 if it is in the
+// mempool and false if it is not known.
+func (sim *Simulator) TxHeight(txid string) (int64, bool) {
+	hash, err := chainhash.NewHashFromStr(txid)
+	if err != nil {
+		return 0, false
+	}
+	sim.mtx.Lock()
+	defer sim.mtx.Unlock()
+	return sim.txHeight(*hash)
+}
+
+// Mine mines n blocks. The first takes all the mempool txs. Returns the new
+// block hashes.
+func (sim *Simulator) Mine(n int) []chainhash.Hash {
+	sim.mtx.Lock()
+	hashes := sim.mine(n)
+	sim.mtx.Unlock()
+	sim.update()
+	return hashes
+}
+
+// Fund sends value to pkScript in a new mempool tx. Its input spends an
+// output the simulator makes up so needs no block rewards to mature.
+func (sim *Simulator) Fund(pkScript []byte, value int64) *wire.MsgTx {
+	sim.mtx.Lock()
+	sim.funded++
+	var seed [4]byte
+	binary.LittleEndian.PutUint32(seed[:], sim.funded)
+	prevHash := chainhash.HashH(seed[:])
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevHash, 0), seed[:], nil))
+	tx.AddTxOut(wire.NewTxOut(value, pkScript))
+	sim.mempool = append(sim.mempool, tx)
+	sim.mtx.Unlock()
+	sim.update()
+	return tx
+}
+
+// Reorg replaces the last depth blocks with a new branch of n blocks. The
+// txs of the replaced blocks go back to the mempool and are confirmed again
+// in the new branch's first block unless dropped. n should be more than depth
+// for clients to switch to the new branch.
+//
+// A client cannot connect the new tip so rewinds its headers on the tip
+// notification and resyncs on the next one. Mine a block after the reorg to
+// let it catch up.
+func (sim *Simulator) Reorg(depth, n int, drop ...string) error {
+	sim.mtx.Lock()
+	if depth < 1 || depth >= len(sim.blocks) {
+		sim.mtx.Unlock()
+		return fmt.Errorf("cannot reorg %d blocks of %d", depth, len(sim.blocks))
+	}
+	dropped := make(map[string]bool, len(drop))
+	for _, txid := range drop {
+		dropped[txid] = true
+	}
+	fork := len(sim.blocks) - depth
+	var back []*wire.MsgTx
+	for _, block := range sim.blocks[fork:] {
+		for _, tx := range block.Transactions[1:] {
+			if !dropped[tx.TxHash().String()] {
+				back = append(back, tx)
+			}
+		}
+	}
+	var mempool []*wire.MsgTx
+	for _, tx := range sim.mempool {
+		if !dropped[tx.TxHash().String()] {
+			mempool = append(mempool, tx)
+		}
+	}
+	sim.mempool = append(back, mempool...)
+	sim.blocks = sim.blocks[:fork]
+	sim.chain.Rewind(int64(fork - 1))
+	sim.branch++
+	sim.mine(n)
+	sim.mtx.Unlock()
+	sim.update()
+	return nil
+}
+
+// mine - locked
+func (sim *Simulator) mine(n int) []chainhash.Hash {
+	hashes := make([]chainhash.Hash, 0, n)
+	for i := 0; i < n; i++ {
+		prev := sim.blocks[len(sim.blocks)-1]
+		height := int64(len(sim.blocks))
+		block := &wire.MsgBlock{
+			Transactions: append([]*wire.MsgTx{sim.coinbase(height)}, sim.mempool...),
+		}
+		sim.mempool = nil
+		txids := make([]chainhash.Hash, len(block.Transactions))
+		txidStrs := make([]string, len(block.Transactions))
+		for i, tx := range block.Transactions {
+			txids[i] = tx.TxHash()
+			txidStrs[i] = txids[i].String()
+		}
+		_, merkleRoot := merkleBranch(txids, 0)
+		block.Header = wire.BlockHeader{
+			Version:    0x20000000,
+			PrevBlock:  prev.BlockHash(),
+			MerkleRoot: merkleRoot,
+			Timestamp:  prev.Header.Timestamp.Add(10*time.Minute + time.Duration(sim.branch)*time.Second),
+			Bits:       sim.params.PowLimitBits,
+		}
+		target := blockchain.CompactToBig(block.Header.Bits)
+		for {
+			hash := block.Header.BlockHash()
+			if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+				break
+			}
+			block.Header.Nonce++
+		}
+		sim.blocks = append(sim.blocks, block)
+
+		var raw bytes.Buffer
+		block.Header.Serialize(&raw)
+		sim.chain.AddHeaders(raw.Bytes())
+		sim.chain.SetBlockTxs(height, txidStrs)
+		hashes = append(hashes, block.BlockHash())
+	}
+	return hashes
+}
+
+// coinbase for the block at height. The branch makes it differ from the
+// coinbase at the same height on a replaced branch.
+func (sim *Simulator) coinbase(height int64) *wire.MsgTx {
+	sigScript, _ := txscript.NewScriptBuilder().
+		AddInt64(height).AddInt64(int64(sim.branch)).Script()
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), sigScript, nil))
+	tx.AddTxOut(wire.NewTxOut(BLOCK_REWARD, sim.coinbaseScript))
+	return tx
+}
+
+// broadcast accepts a raw tx into the mempool. Reject reasons are as bitcoind
+// sends them.
+func (sim *Simulator) broadcast(rawTx string) (string, error) {
+	b, err := hex.DecodeString(rawTx)
+	if err != nil {
+		return "", errors.New("TX decode failed")
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	if err := tx.Deserialize(bytes.NewReader(b)); err != nil {
+		return "", errors.New("TX decode failed")
+	}
+	txid := tx.TxHash()
+
+	sim.mtx.Lock()
+	height, known := sim.txHeight(txid)
+	if known && height > 0 {
+		sim.mtx.Unlock()
+		return "", errors.New("Transaction outputs already in utxo set")
+	}
+	if known {
+		sim.mtx.Unlock()
+		return "", errors.New("txn-already-in-mempool")
+	}
+	var in, out int64
+	for _, txIn := range tx.TxIn {
+		prevOut, ok := sim.outputs[txIn.PreviousOutPoint]
+		if !ok {
+			sim.mtx.Unlock()
+			return "", errors.New("bad-txns-inputs-missingorspent")
+		}
+		if spender, spent := sim.spentBy[txIn.PreviousOutPoint]; spent {
+			sim.mtx.Unlock()
+			if height, _ := sim.txHeight(spender); height == 0 {
+				return "", errors.New("txn-mempool-conflict")
+			}
+			return "", errors.New("bad-txns-inputs-missingorspent")
+		}
+		in += prevOut.Value
+	}
+	for _, txOut := range tx.TxOut {
+		out += txOut.Value
+	}
+	if out > in {
+		sim.mtx.Unlock()
+		return "", errors.New("bad-txns-in-belowout")
+	}
+	sim.mempool = append(sim.mempool, tx)
+	sim.mtx.Unlock()
+	sim.update()
+	return txid.String(), nil
+}
+
+// txHeight - locked
+func (sim *Simulator) txHeight(txid chainhash.Hash) (int64, bool) {
+	for height, block := range sim.blocks {
+		for _, tx := range block.Transactions {
+			if tx.TxHash() == txid {
+				return int64(height), true
+			}
+		}
+	}
+	for _, tx := range sim.mempool {
+		if tx.TxHash() == txid {
+			return 0, true
+		}
+	}
+	return 0, false
+}
+
+// update rebuilds the chain model from the blocks and mempool then notifies
+// the tip and changed scripthash statuses.
+func (sim *Simulator) update() {
+	sim.mtx.Lock()
+	history := make(map[string][]HistoryItem)
+	unspent := make(map[string][]Unspent)
+	sim.outputs = make(map[wire.OutPoint]*wire.TxOut)
+	sim.spentBy = make(map[wire.OutPoint]chainhash.Hash)
+	funded := make(map[wire.OutPoint]bool)
+	inMempool := make(map[chainhash.Hash]bool)
+
+	// the made up outputs spent by funding txs
+	for i := uint32(1); i <= sim.funded; i++ {
+		var seed [4]byte
+		binary.LittleEndian.PutUint32(seed[:], i)
+		funded[wire.OutPoint{Hash: chainhash.HashH(seed[:]), Index: 0}] = true
+	}
+
+	addTx := func(tx *wire.MsgTx, height int64) {
+		txid := tx.TxHash()
+		var buf bytes.Buffer
+		tx.Serialize(&buf)
+		sim.chain.AddTx(txid.String(), hex.EncodeToString(buf.Bytes()))
+
+		scripthashes := make(map[string]bool)
+		var order []string
+		touch := func(pkScript []byte) {
+			sh := Scripthash(pkScript)
+			if !scripthashes[sh] {
+				scripthashes[sh] = true
+				order = append(order, sh)
+			}
+		}
+		var in, out int64
+		inputsKnown := true
+		for _, txIn := range tx.TxIn {
+			op := txIn.PreviousOutPoint
+			if prevOut, ok := sim.outputs[op]; ok {
+				touch(prevOut.PkScript)
+				in += prevOut.Value
+				if height == 0 && inMempool[op.Hash] {
+					height = -1
+				}
+			} else if !funded[op] {
+				inputsKnown = false
+			}
+			sim.spentBy[op] = txid
+		}
+		for i, txOut := range tx.TxOut {
+			touch(txOut.PkScript)
+			out += txOut.Value
+			sim.outputs[wire.OutPoint{Hash: txid, Index: uint32(i)}] = txOut
+		}
+		var fee int64
+		if height <= 0 && inputsKnown && !blockchain.IsCoinBaseTx(tx) {
+			fee = in - out
+		}
+		for _, sh := range order {
+			history[sh] = append(history[sh], HistoryItem{TxHash: txid.String(), Height: height, Fee: fee})
+		}
+	}
+	for height, block := range sim.blocks {
+		for _, tx := range block.Transactions {
+			addTx(tx, int64(height))
+		}
+	}
+	for _, tx := range sim.mempool {
+		addTx(tx, 0)
+		inMempool[tx.TxHash()] = true
+	}
+
+	// utxos in the order the outputs were made
+	addUnspent := func(tx *wire.MsgTx, height int64) {
+		txid := tx.TxHash()
+		for i, txOut := range tx.TxOut {
+			op := wire.OutPoint{Hash: txid, Index: uint32(i)}
+			if _, spent := sim.spentBy[op]; spent {
+				continue
+			}
+			sh := Scripthash(txOut.PkScript)
+			unspent[sh] = append(unspent[sh], Unspent{
+				TxHash: txid.String(),
+				TxPos:  int64(i),
+				Height: height,
+				Value:  txOut.Value,
+			})
+		}
+	}
+	for height, block := range sim.blocks {
+		for _, tx := range block.Transactions {
+			addUnspent(tx, int64(height))
+		}
+	}
+	for _, tx := range sim.mempool {
+		addUnspent(tx, 0)
+	}
+
+	var changed []string
+	for sh := range sim.statuses {
+		if _, ok := history[sh]; !ok {
+			sim.chain.SetHistory(sh, nil)
+			sim.chain.SetUnspent(sh, nil)
+			delete(sim.statuses, sh)
+			changed = append(changed, sh)
+		}
+	}
+	for sh, items := range history {
+		sim.chain.SetHistory(sh, items)
+		sim.chain.SetUnspent(sh, unspent[sh])
+		status := sim.chain.Status(sh)
+		if sim.statuses[sh] != status {
+			sim.statuses[sh] = status
+			changed = append(changed, sh)
+		}
+	}
+	tipHash := sim.blocks[len(sim.blocks)-1].BlockHash()
+	tipChanged := tipHash != sim.tipHash
+	sim.tipHash = tipHash
+	sim.mtx.Unlock()
+
+	if tipChanged {
+		sim.NotifyTip()
+	}
+	for _, sh := range changed {
+		sim.NotifyScripthash(sh)
+	}
+}
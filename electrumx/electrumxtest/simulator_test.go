@@ -0,0 +1,98 @@
+package electrumxtest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func rawTxHex(t *testing.T, tx *wire.MsgTx) string {
+	var b bytes.Buffer
+	if err := tx.Serialize(&b); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(b.Bytes())
+}
+
+func TestSimulator(t *testing.T) {
+	sim := NewSimulator(nil)
+	hashes := sim.Mine(3)
+	if sim.Tip() != 3 || sim.Chain().BlockHash(3) != hashes[2] {
+		t.Fatalf("mined to %d", sim.Tip())
+	}
+	for _, block := range sim.blocks[1:] {
+		hash := block.BlockHash()
+		target := blockchain.CompactToBig(block.Header.Bits)
+		if blockchain.HashToBig(&hash).Cmp(target) > 0 {
+			t.Fatal("bad proof of work")
+		}
+	}
+	// deterministic
+	if NewSimulator(nil).Mine(3)[2] != hashes[2] {
+		t.Fatal("chain differs")
+	}
+
+	pkScript := []byte{txscript.OP_TRUE, txscript.OP_TRUE}
+	sh := Scripthash(pkScript)
+	fund := sim.Fund(pkScript, 1000)
+	fundHash := fund.TxHash()
+
+	spend := wire.NewMsgTx(wire.TxVersion)
+	spend.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&fundHash, 0), nil, nil))
+	spend.AddTxOut(wire.NewTxOut(1100, pkScript))
+	if _, err := sim.broadcast(rawTxHex(t, spend)); err == nil || !strings.Contains(err.Error(), "belowout") {
+		t.Fatalf("expected in below out got %v", err)
+	}
+	spend.TxOut[0].Value = 900
+	txid, err := sim.broadcast(rawTxHex(t, spend))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sim.broadcast(rawTxHex(t, spend)); err == nil || err.Error() != "txn-already-in-mempool" {
+		t.Fatalf("expected already in mempool got %v", err)
+	}
+	double := spend.Copy()
+	double.TxOut[0].Value = 800
+	if _, err := sim.broadcast(rawTxHex(t, double)); err == nil || err.Error() != "txn-mempool-conflict" {
+		t.Fatalf("expected conflict got %v", err)
+	}
+	// spend of a mempool parent has height -1 and the fee
+	history := sim.Chain().historyResults(sh, true)
+	if len(history) != 2 || history[1].TxHash != txid || history[1].Height != -1 || history[1].Fee != 100 {
+		t.Fatalf("bad mempool history %v", history)
+	}
+
+	sim.Mine(1)
+	if height, _ := sim.TxHeight(txid); height != 4 || len(sim.Mempool()) != 0 {
+		t.Fatalf("spend mined at %d", height)
+	}
+	if _, err := sim.broadcast(rawTxHex(t, double)); err == nil || !strings.Contains(err.Error(), "missingorspent") {
+		t.Fatalf("expected missing or spent got %v", err)
+	}
+	if unspent := sim.Chain().unspentResults(sh); len(unspent) != 1 || unspent[0].Value != 900 {
+		t.Fatalf("bad unspent %v", unspent)
+	}
+
+	// the dropped spend is gone and its parent confirms in the new branch
+	old := sim.Chain().BlockHash(4)
+	if err := sim.Reorg(2, 3, txid); err != nil {
+		t.Fatal(err)
+	}
+	if sim.Tip() != 5 || sim.Chain().BlockHash(4) == old {
+		t.Fatalf("reorg to %d", sim.Tip())
+	}
+	if _, ok := sim.TxHeight(txid); ok {
+		t.Fatal("dropped tx still known")
+	}
+	if height, _ := sim.TxHeight(fundHash.String()); height != 3 {
+		t.Fatalf("funding tx at %d", height)
+	}
+	if unspent := sim.Chain().unspentResults(sh); len(unspent) != 1 || unspent[0].Value != 1000 {
+		t.Fatalf("bad unspent after reorg %v", unspent)
+	}
+}
@@ -0,0 +1,45 @@
+package electrumxtest
+
+import (
+	"bytes"
+
+	"golang.org/x/net/websocket"
+)
+
+// serveWebSocket serves a websocket client until it goes.
+func (s *Server) serveWebSocket(ws *websocket.Conn) {
+	ws.PayloadType = websocket.TextFrame
+	c := s.newConn(&wsConn{Conn: ws})
+	if c == nil {
+		return
+	}
+	c.serve()
+}
+
+// wsConn reads each websocket message as a line and writes each line as a
+// message so a websocket conn is served as a tcp one.
+type wsConn struct {
+	*websocket.Conn
+	rbuf []byte
+}
+
+func (c *wsConn) Read(b []byte) (int, error) {
+	if len(c.rbuf) == 0 {
+		var msg []byte
+		if err := websocket.Message.Receive(c.Conn, &msg); err != nil {
+			return 0, err
+		}
+		c.rbuf = append(bytes.TrimRight(msg, "\r\n"), newline)
+	}
+	n := copy(b, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	return n, nil
+}
+
+// Write is called with one whole message at a time.
+func (c *wsConn) Write(b []byte) (int, error) {
+	if err := websocket.Message.Send(c.Conn, string(bytes.TrimRight(b, "\n"))); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/dev-warrior777/go-electrum-client/electrumx"
 )
@@ -29,6 +30,23 @@ const (
 	BTC_STRATEGY_FLAGS_MAINNET   = electrumx.Default
 )
 
+// Built in checkpoints for each network. Each root is the merkle root of the
+// block hashes from genesis up to its height as given by a trusted node with
+// 'blockchain.block.header <height> <height>'. A root for one block is the
+// block hash so regtest can always check its genesis.
+//
+// Testnet and mainnet roots at or above the StartPoint are fetched from a
+// trusted server with the live TestFetchCheckpointRoots in package electrumx.
+// Start refuses a StartPoint above the last checkpoint and, while a network
+// has no checkpoints, warns that synced headers are not proved to a root.
+var (
+	BTC_CHECKPOINTS_REGTEST = []electrumx.Checkpoint{
+		{Height: 0, Root: BTC_GENESIS_REGTEST},
+	}
+	BTC_CHECKPOINTS_TESTNET = []electrumx.Checkpoint{}
+	BTC_CHECKPOINTS_MAINNET = []electrumx.Checkpoint{}
+)
+
 type headerDeserialzer struct{}
 
 func (d headerDeserialzer) Deserialize(r io.Reader) (*electrumx.BlockHeader, error) {
@@ -43,6 +61,8 @@ func (d headerDeserialzer) Deserialize(r io.Reader) (*electrumx.BlockHeader, err
 	blockHeader.Hash = electrumx.WireHash(chainHash)
 	blockHeader.Prev = electrumx.WireHash(wireHdr.PrevBlock)
 	blockHeader.Merkle = electrumx.WireHash(wireHdr.MerkleRoot)
+	blockHeader.Timestamp = wireHdr.Timestamp.Unix()
+	blockHeader.Bits = wireHdr.Bits
 	return blockHeader, nil
 }
 
@@ -54,24 +74,38 @@ type ElectrumXInterface struct {
 func NewElectrumXInterface(config *electrumx.ElectrumXConfig) (*ElectrumXInterface, error) {
 	config.Coin = BTC_COIN
 	config.BlockHeaderSize = BTC_HEADER_SIZE
-	config.MaxOnion = BTC_MAX_ONION
+	if config.MaxOnion == 0 {
+		config.MaxOnion = BTC_MAX_ONION
+	}
 
 	switch config.NetType {
 	case electrumx.Regtest:
 		config.Flags = BTC_STRATEGY_FLAGS_REGTEST
 		config.Genesis = BTC_GENESIS_REGTEST
 		config.StartPoint = BTC_STARTPOINT_REGTEST
+		if config.Checkpoints == nil {
+			config.Checkpoints = BTC_CHECKPOINTS_REGTEST
+		}
 		config.MaxOnlinePeers = BTC_MAX_ONLINE_PEERS_REGTEST
+		config.HeaderValidator = newHeaderValidator(&chaincfg.RegressionNetParams)
 	case electrumx.Testnet:
 		config.Flags = BTC_STRATEGY_FLAGS_TESTNET
 		config.Genesis = BTC_GENESIS_TESTNET
 		config.StartPoint = BTC_STARTPOINT_TESTNET
+		if config.Checkpoints == nil {
+			config.Checkpoints = BTC_CHECKPOINTS_TESTNET
+		}
 		config.MaxOnlinePeers = BTC_MAX_ONLINE_PEERS_TESTNET
+		config.HeaderValidator = newHeaderValidator(&chaincfg.TestNet3Params)
 	case electrumx.Mainnet:
 		config.Flags = BTC_STRATEGY_FLAGS_MAINNET
 		config.Genesis = BTC_GENESIS_MAINNET
 		config.StartPoint = BTC_STARTPOINT_MAINNET
+		if config.Checkpoints == nil {
+			config.Checkpoints = BTC_CHECKPOINTS_MAINNET
+		}
 		config.MaxOnlinePeers = BTC_MAX_ONLINE_PEERS_MAINNET
+		config.HeaderValidator = newHeaderValidator(&chaincfg.MainNetParams)
 	default:
 		return nil, fmt.Errorf("config error")
 	}
@@ -135,6 +169,41 @@ func (x *ElectrumXInterface) GetTipChangeNotify() (<-chan int64, error) {
 	return x.network.GetTipChangeNotify(), nil
 }
 
+func (x *ElectrumXInterface) GetReorgNotify() (<-chan *electrumx.ReorgEvent, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.GetReorgNotify(), nil
+}
+
+func (x *ElectrumXInterface) GetConnectionStatusNotify() (<-chan *electrumx.ConnectionStatus, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.GetConnectionStatusNotify(), nil
+}
+
+func (x *ElectrumXInterface) NetworkStatus() (*electrumx.NetworkStatus, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.NetworkStatus(), nil
+}
+
+func (x *ElectrumXInterface) TorStatus(ctx context.Context) (*electrumx.TorStatus, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.TorStatus(ctx)
+}
+
+func (x *ElectrumXInterface) GetNetworkEventNotify() (<-chan *electrumx.NetworkEvent, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.GetNetworkEventNotify(), nil
+}
+
 func (x *ElectrumXInterface) GetScripthashNotify() (<-chan *electrumx.ScripthashStatusResult, error) {
 	if x.network == nil {
 		return nil, ErrNoNetwork
@@ -149,6 +218,13 @@ func (x *ElectrumXInterface) SubscribeScripthashNotify(ctx context.Context, scri
 	return x.network.SubscribeScripthashNotify(ctx, scripthash)
 }
 
+func (x *ElectrumXInterface) SubscribeScripthashNotifyBatch(ctx context.Context, scripthashes []string) ([]*electrumx.ScripthashStatusBatchResult, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.SubscribeScripthashNotifyBatch(ctx, scripthashes)
+}
+
 func (x *ElectrumXInterface) UnsubscribeScripthashNotify(ctx context.Context, scripthash string) {
 	if x.network == nil {
 		return
@@ -163,6 +239,13 @@ func (x *ElectrumXInterface) GetHistory(ctx context.Context, scripthash string)
 	return x.network.GetHistory(ctx, scripthash)
 }
 
+func (x *ElectrumXInterface) GetHistoryBatch(ctx context.Context, scripthashes []string) ([]*electrumx.HistoryBatchResult, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.GetHistoryBatch(ctx, scripthashes)
+}
+
 func (x *ElectrumXInterface) GetListUnspent(ctx context.Context, scripthash string) (electrumx.ListUnspentResult, error) {
 	if x.network == nil {
 		return nil, ErrNoNetwork
@@ -170,6 +253,13 @@ func (x *ElectrumXInterface) GetListUnspent(ctx context.Context, scripthash stri
 	return x.network.GetListUnspent(ctx, scripthash)
 }
 
+func (x *ElectrumXInterface) GetListUnspentBatch(ctx context.Context, scripthashes []string) ([]*electrumx.ListUnspentBatchResult, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.GetListUnspentBatch(ctx, scripthashes)
+}
+
 func (x *ElectrumXInterface) GetTransaction(ctx context.Context, txid string) (*electrumx.GetTransactionResult, error) {
 	if x.network == nil {
 		return nil, ErrNoNetwork
@@ -184,6 +274,34 @@ func (x *ElectrumXInterface) GetRawTransaction(ctx context.Context, txid string)
 	return x.network.GetRawTransaction(ctx, txid)
 }
 
+func (x *ElectrumXInterface) GetRawTransactionBatch(ctx context.Context, txids []string) ([]*electrumx.RawTransactionBatchResult, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.GetRawTransactionBatch(ctx, txids)
+}
+
+func (x *ElectrumXInterface) VerifyMerkleProof(ctx context.Context, txid string, height int64) error {
+	if x.network == nil {
+		return ErrNoNetwork
+	}
+	return x.network.VerifyMerkleProof(ctx, txid, height)
+}
+
+func (x *ElectrumXInterface) ReportStatusMismatch(scripthash string) {
+	if x.network == nil {
+		return
+	}
+	x.network.ReportStatusMismatch(scripthash)
+}
+
+func (x *ElectrumXInterface) ReportBadTx(server, txid string) {
+	if x.network == nil {
+		return
+	}
+	x.network.ReportBadTx(server, txid)
+}
+
 func (x *ElectrumXInterface) Broadcast(ctx context.Context, rawTx string) (string, error) {
 	if x.network == nil {
 		return "", ErrNoNetwork
@@ -191,9 +309,51 @@ func (x *ElectrumXInterface) Broadcast(ctx context.Context, rawTx string) (strin
 	return x.network.Broadcast(ctx, rawTx)
 }
 
+func (x *ElectrumXInterface) BroadcastPackage(ctx context.Context, rawTxs []string) (*electrumx.BroadcastPackageResult, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.BroadcastPackage(ctx, rawTxs)
+}
+
+func (x *ElectrumXInterface) Supports(method string) bool {
+	if x.network == nil {
+		return false
+	}
+	return x.network.Supports(method)
+}
+
 func (x *ElectrumXInterface) EstimateFeeRate(ctx context.Context, confTarget int64) (int64, error) {
 	if x.network == nil {
 		return 0, ErrNoNetwork
 	}
 	return x.network.EstimateFeeRate(ctx, confTarget)
 }
+
+func (x *ElectrumXInterface) GetMempool(ctx context.Context, scripthash string) (electrumx.MempoolResult, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.GetMempool(ctx, scripthash)
+}
+
+func (x *ElectrumXInterface) GetBalance(ctx context.Context, scripthash string) (*electrumx.BalanceResult, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.GetBalance(ctx, scripthash)
+}
+
+func (x *ElectrumXInterface) GetFeeHistogram(ctx context.Context) (electrumx.FeeHistogram, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.GetFeeHistogram(ctx)
+}
+
+func (x *ElectrumXInterface) GetRelayFee(ctx context.Context) (int64, error) {
+	if x.network == nil {
+		return 0, ErrNoNetwork
+	}
+	return x.network.GetRelayFee(ctx)
+}
@@ -0,0 +1,129 @@
+package elxbtc
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/dev-warrior777/go-electrum-client/electrumx"
+)
+
+// headerValidator checks BTC block headers against the proof of work and the
+// 2016 block difficulty retarget rules of the chain params.
+type headerValidator struct {
+	params *chaincfg.Params
+}
+
+func newHeaderValidator(params *chaincfg.Params) *headerValidator {
+	return &headerValidator{params: params}
+}
+
+func (v *headerValidator) blocksPerRetarget() int64 {
+	return int64(v.params.TargetTimespan / v.params.TargetTimePerBlock)
+}
+
+func (v *headerValidator) ValidateHeader(hdr *electrumx.BlockHeader, height int64, chain electrumx.HeaderChain) error {
+	err := electrumx.CheckProofOfWork(hdr.Hash, hdr.Bits, v.params.PowLimit)
+	if err != nil {
+		return err
+	}
+	err = electrumx.CheckMedianTimePast(hdr, height, chain)
+	if err != nil {
+		return err
+	}
+	prev := chain.HeaderAt(height - 1)
+	if prev == nil {
+		// the checkpoint header
+		return nil
+	}
+	if height%v.blocksPerRetarget() != 0 {
+		return v.checkBitsUnchanged(hdr, height, prev, chain)
+	}
+	return v.checkRetarget(hdr, height, prev, chain)
+}
+
+// checkBitsUnchanged checks the bits inside a retarget period. On testnet a
+// block more than twice the target spacing after the previous block may be
+// mined at the minimum difficulty. Other blocks have the difficulty of the
+// last block in the period that was not a minimum difficulty block.
+func (v *headerValidator) checkBitsUnchanged(hdr *electrumx.BlockHeader, height int64, prev *electrumx.BlockHeader, chain electrumx.HeaderChain) error {
+	expected := prev.Bits
+	if v.params.ReduceMinDifficulty {
+		minDiffSpacing := int64(v.params.MinDiffReductionTime.Seconds())
+		if hdr.Timestamp > prev.Timestamp+minDiffSpacing {
+			expected = v.params.PowLimitBits
+		} else {
+			h := height - 1
+			last := prev
+			for h%v.blocksPerRetarget() != 0 && last.Bits == v.params.PowLimitBits {
+				h--
+				last = chain.HeaderAt(h)
+				if last == nil {
+					// walked back past our checkpoint
+					return nil
+				}
+			}
+			expected = last.Bits
+		}
+	}
+	if hdr.Bits != expected {
+		return fmt.Errorf("%w: bits %08x at height %d, expected %08x",
+			electrumx.ErrInvalidHeader, hdr.Bits, height, expected)
+	}
+	return nil
+}
+
+// checkRetarget checks the new bits at a retarget height. If the first header
+// of the previous period is below our checkpoint we cannot calculate the
+// timespan so only check the new target is within the allowed 4x adjustment.
+func (v *headerValidator) checkRetarget(hdr *electrumx.BlockHeader, height int64, prev *electrumx.BlockHeader, chain electrumx.HeaderChain) error {
+	if v.params.PoWNoRetargeting {
+		if hdr.Bits != prev.Bits {
+			return fmt.Errorf("%w: bits %08x at height %d, expected %08x",
+				electrumx.ErrInvalidHeader, hdr.Bits, height, prev.Bits)
+		}
+		return nil
+	}
+	targetTimespan := int64(v.params.TargetTimespan.Seconds())
+	minTimespan := targetTimespan / v.params.RetargetAdjustmentFactor
+	maxTimespan := targetTimespan * v.params.RetargetAdjustmentFactor
+
+	first := chain.HeaderAt(height - v.blocksPerRetarget())
+	if first == nil {
+		lowest := v.nextBits(prev.Bits, minTimespan, targetTimespan)
+		highest := v.nextBits(prev.Bits, maxTimespan, targetTimespan)
+		target := blockchain.CompactToBig(hdr.Bits)
+		if target.Cmp(blockchain.CompactToBig(lowest)) < 0 ||
+			target.Cmp(blockchain.CompactToBig(highest)) > 0 {
+			return fmt.Errorf("%w: retarget bits %08x at height %d out of range %08x - %08x",
+				electrumx.ErrInvalidHeader, hdr.Bits, height, lowest, highest)
+		}
+		return nil
+	}
+
+	actualTimespan := prev.Timestamp - first.Timestamp
+	if actualTimespan < minTimespan {
+		actualTimespan = minTimespan
+	} else if actualTimespan > maxTimespan {
+		actualTimespan = maxTimespan
+	}
+	expected := v.nextBits(prev.Bits, actualTimespan, targetTimespan)
+	if hdr.Bits != expected {
+		return fmt.Errorf("%w: retarget bits %08x at height %d, expected %08x",
+			electrumx.ErrInvalidHeader, hdr.Bits, height, expected)
+	}
+	return nil
+}
+
+// nextBits scales the old target by actual/target timespan, limited to the
+// pow limit.
+func (v *headerValidator) nextBits(oldBits uint32, actualTimespan, targetTimespan int64) uint32 {
+	newTarget := blockchain.CompactToBig(oldBits)
+	newTarget.Mul(newTarget, big.NewInt(actualTimespan))
+	newTarget.Div(newTarget, big.NewInt(targetTimespan))
+	if newTarget.Cmp(v.params.PowLimit) > 0 {
+		newTarget.Set(v.params.PowLimit)
+	}
+	return blockchain.BigToCompact(newTarget)
+}
@@ -0,0 +1,178 @@
+package elxbtc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/dev-warrior777/go-electrum-client/electrumx"
+)
+
+type testChain map[int64]*electrumx.BlockHeader
+
+func (c testChain) HeaderAt(height int64) *electrumx.BlockHeader {
+	return c[height]
+}
+
+func toBlockHeader(wireHdr *wire.BlockHeader) *electrumx.BlockHeader {
+	return &electrumx.BlockHeader{
+		Version:   wireHdr.Version,
+		Hash:      electrumx.WireHash(wireHdr.BlockHash()),
+		Prev:      electrumx.WireHash(wireHdr.PrevBlock),
+		Merkle:    electrumx.WireHash(wireHdr.MerkleRoot),
+		Timestamp: wireHdr.Timestamp.Unix(),
+		Bits:      wireHdr.Bits,
+	}
+}
+
+// mine a regtest header on top of prev
+func mineRegtest(prev *wire.BlockHeader, bits uint32) *wire.BlockHeader {
+	wireHdr := &wire.BlockHeader{
+		Version:   0x20000000,
+		PrevBlock: prev.BlockHash(),
+		Timestamp: prev.Timestamp.Add(time.Minute),
+		Bits:      bits,
+	}
+	target := blockchain.CompactToBig(bits)
+	for {
+		hash := wireHdr.BlockHash()
+		if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+			return wireHdr
+		}
+		wireHdr.Nonce++
+	}
+}
+
+func TestValidateMainnetGenesis(t *testing.T) {
+	v := newHeaderValidator(&chaincfg.MainNetParams)
+	genesis := chaincfg.MainNetParams.GenesisBlock.Header
+	err := v.ValidateHeader(toBlockHeader(&genesis), 0, testChain{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis.Nonce++
+	err = v.ValidateHeader(toBlockHeader(&genesis), 0, testChain{})
+	if !errors.Is(err, electrumx.ErrInvalidHeader) {
+		t.Fatalf("expected ErrInvalidHeader got %v", err)
+	}
+}
+
+func TestValidateRegtestChain(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	v := newHeaderValidator(params)
+	chain := testChain{}
+	prev := params.GenesisBlock.Header
+	chain[0] = toBlockHeader(&prev)
+	for height := int64(1); height <= 20; height++ {
+		wireHdr := mineRegtest(&prev, params.PowLimitBits)
+		hdr := toBlockHeader(wireHdr)
+		if err := v.ValidateHeader(hdr, height, chain); err != nil {
+			t.Fatalf("height %d: %v", height, err)
+		}
+		chain[height] = hdr
+		prev = *wireHdr
+	}
+
+	// difficulty easier than the pow limit
+	bad := toBlockHeader(mineRegtest(&prev, 0x2100ffff))
+	if err := v.ValidateHeader(bad, 21, chain); !errors.Is(err, electrumx.ErrInvalidHeader) {
+		t.Fatalf("expected ErrInvalidHeader got %v", err)
+	}
+
+	// timestamp not after median time past
+	old := mineRegtest(&prev, params.PowLimitBits)
+	old.Timestamp = time.Unix(chain[15].Timestamp, 0)
+	for {
+		hash := old.BlockHash()
+		if blockchain.HashToBig(&hash).Cmp(params.PowLimit) <= 0 {
+			break
+		}
+		old.Nonce++
+	}
+	if err := v.ValidateHeader(toBlockHeader(old), 21, chain); !errors.Is(err, electrumx.ErrInvalidHeader) {
+		t.Fatalf("expected ErrInvalidHeader got %v", err)
+	}
+}
+
+func TestRetarget(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	v := newHeaderValidator(params)
+	const bits = 0x17034219
+	interval := v.blocksPerRetarget()
+	height := 420 * interval
+	targetTimespan := int64(params.TargetTimespan.Seconds())
+
+	first := &electrumx.BlockHeader{Timestamp: 1_700_000_000, Bits: bits}
+	prev := &electrumx.BlockHeader{Timestamp: first.Timestamp + targetTimespan/2, Bits: bits}
+	chain := testChain{
+		height - interval: first,
+		height - 1:        prev,
+	}
+	// blocks came twice as fast so the target halves
+	expected := v.nextBits(bits, targetTimespan/2, targetTimespan)
+	target := blockchain.CompactToBig(bits)
+	halved := blockchain.CompactToBig(expected)
+	if halved.Cmp(target) >= 0 {
+		t.Fatal("expected a harder target")
+	}
+	err := v.checkRetarget(&electrumx.BlockHeader{Bits: expected}, height, prev, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.checkRetarget(&electrumx.BlockHeader{Bits: bits}, height, prev, chain)
+	if !errors.Is(err, electrumx.ErrInvalidHeader) {
+		t.Fatalf("expected ErrInvalidHeader got %v", err)
+	}
+
+	// first block of the period is below our checkpoint - bounds only
+	delete(chain, height-interval)
+	err = v.checkRetarget(&electrumx.BlockHeader{Bits: bits}, height, prev, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tooEasy := v.nextBits(bits, 5*targetTimespan, targetTimespan)
+	err = v.checkRetarget(&electrumx.BlockHeader{Bits: tooEasy}, height, prev, chain)
+	if !errors.Is(err, electrumx.ErrInvalidHeader) {
+		t.Fatalf("expected ErrInvalidHeader got %v", err)
+	}
+
+	// no retarget inside a period
+	err = v.checkBitsUnchanged(&electrumx.BlockHeader{Bits: expected}, height+1, prev, chain)
+	if !errors.Is(err, electrumx.ErrInvalidHeader) {
+		t.Fatalf("expected ErrInvalidHeader got %v", err)
+	}
+}
+
+func TestTestnetMinDifficulty(t *testing.T) {
+	params := &chaincfg.TestNet3Params
+	v := newHeaderValidator(params)
+	const bits = 0x1a0ffff0
+	interval := v.blocksPerRetarget()
+	height := 1300*interval + 10
+	spacing := int64(params.MinDiffReductionTime.Seconds())
+
+	chain := testChain{
+		height - 3: {Timestamp: 1_700_000_000, Bits: bits},
+		height - 2: {Timestamp: 1_700_000_000 + spacing + 1, Bits: params.PowLimitBits},
+		height - 1: {Timestamp: 1_700_000_000 + 2*spacing + 2, Bits: params.PowLimitBits},
+	}
+	prev := chain[height-1]
+
+	// slow block may be mined at minimum difficulty
+	hdr := &electrumx.BlockHeader{Timestamp: prev.Timestamp + spacing + 1, Bits: params.PowLimitBits}
+	if err := v.checkBitsUnchanged(hdr, height, prev, chain); err != nil {
+		t.Fatal(err)
+	}
+	// fast block reverts to the last real difficulty
+	hdr = &electrumx.BlockHeader{Timestamp: prev.Timestamp + 60, Bits: bits}
+	if err := v.checkBitsUnchanged(hdr, height, prev, chain); err != nil {
+		t.Fatal(err)
+	}
+	hdr.Bits = params.PowLimitBits
+	if err := v.checkBitsUnchanged(hdr, height, prev, chain); !errors.Is(err, electrumx.ErrInvalidHeader) {
+		t.Fatalf("expected ErrInvalidHeader got %v", err)
+	}
+}
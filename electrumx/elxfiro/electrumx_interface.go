@@ -39,6 +39,23 @@ const (
 	FIRO_STRATEGY_FLAGS_MAINNET   = electrumx.NoDeleteKnownPeers // 4 servers
 )
 
+// Built in checkpoints for each network. Each root is the merkle root of the
+// block hashes from genesis up to its height as given by a trusted node with
+// 'blockchain.block.header <height> <height>'. A root for one block is the
+// block hash so regtest can always check its genesis.
+//
+// Testnet and mainnet roots at or above the StartPoint are fetched from a
+// trusted server with the live TestFetchCheckpointRoots in package electrumx.
+// Start refuses a StartPoint above the last checkpoint and, while a network
+// has no checkpoints, warns that synced headers are not proved to a root.
+var (
+	FIRO_CHECKPOINTS_REGTEST = []electrumx.Checkpoint{
+		{Height: 0, Root: FIRO_GENESIS_REGTEST},
+	}
+	FIRO_CHECKPOINTS_TESTNET = []electrumx.Checkpoint{}
+	FIRO_CHECKPOINTS_MAINNET = []electrumx.Checkpoint{}
+)
+
 type headerDeserializer struct{}
 
 func (d headerDeserializer) Deserialize(r io.Reader) (*electrumx.BlockHeader, error) {
@@ -66,6 +83,8 @@ func (d headerDeserializer) Deserialize(r io.Reader) (*electrumx.BlockHeader, er
 	// blockHeader.Hash = electrumx.WireHash(chainHash)
 	blockHeader.Prev = electrumx.WireHash(wireHdr.PrevBlock)
 	blockHeader.Merkle = electrumx.WireHash(wireHdr.MerkleRoot)
+	blockHeader.Timestamp = wireHdr.Timestamp.Unix()
+	blockHeader.Bits = wireHdr.Bits
 	return blockHeader, nil
 }
 
@@ -83,6 +102,8 @@ func (d regtestHeaderDeserializer) Deserialize(r io.Reader) (*electrumx.BlockHea
 	blockHeader.Hash = electrumx.WireHash(chainHash)
 	blockHeader.Prev = electrumx.WireHash(wireHdr.PrevBlock)
 	blockHeader.Merkle = electrumx.WireHash(wireHdr.MerkleRoot)
+	blockHeader.Timestamp = wireHdr.Timestamp.Unix()
+	blockHeader.Bits = wireHdr.Bits
 	return blockHeader, nil
 }
 
@@ -93,7 +114,9 @@ type ElectrumXInterface struct {
 
 func NewElectrumXInterface(config *electrumx.ElectrumXConfig) (*ElectrumXInterface, error) {
 	config.Coin = FIRO_COIN
-	config.MaxOnion = FIRO_MAX_ONION
+	if config.MaxOnion == 0 {
+		config.MaxOnion = FIRO_MAX_ONION
+	}
 
 	switch config.NetType {
 	case electrumx.Regtest:
@@ -102,21 +125,36 @@ func NewElectrumXInterface(config *electrumx.ElectrumXConfig) (*ElectrumXInterfa
 		config.BlockHeaderSize = FIRO_HEADER_SIZE_REGTEST
 		config.Genesis = FIRO_GENESIS_REGTEST
 		config.StartPoint = FIRO_STARTPOINT_REGTEST
+		if config.Checkpoints == nil {
+			config.Checkpoints = FIRO_CHECKPOINTS_REGTEST
+		}
 		config.MaxOnlinePeers = FIRO_MAX_ONLINE_PEERS_REGTEST
+		// regtest work is worthless anyway
+		config.HeaderValidator = newHeaderValidator(firoRegtestPowLimit, true)
 	case electrumx.Testnet:
 		config.Flags = FIRO_STRATEGY_FLAGS_TESTNET
 		config.HeaderDeserializer = headerDeserializer{}
 		config.BlockHeaderSize = FIRO_HEADER_SIZE_FIROPOW
 		config.Genesis = FIRO_GENESIS_TESTNET
 		config.StartPoint = FIRO_STARTPOINT_TESTNET
+		if config.Checkpoints == nil {
+			config.Checkpoints = FIRO_CHECKPOINTS_TESTNET
+		}
 		config.MaxOnlinePeers = FIRO_MAX_ONLINE_PEERS_TESTNET
+		config.HeaderValidator = newHeaderValidator(firoPowLimit, false)
+		warnUnverifiedPow()
 	case electrumx.Mainnet:
 		config.Flags = FIRO_STRATEGY_FLAGS_TESTNET
 		config.HeaderDeserializer = headerDeserializer{}
 		config.BlockHeaderSize = FIRO_HEADER_SIZE_FIROPOW
 		config.Genesis = FIRO_GENESIS_MAINNET
 		config.StartPoint = FIRO_STARTPOINT_MAINNET
+		if config.Checkpoints == nil {
+			config.Checkpoints = FIRO_CHECKPOINTS_MAINNET
+		}
 		config.MaxOnlinePeers = FIRO_MAX_ONLINE_PEERS_MAINNET
+		config.HeaderValidator = newHeaderValidator(firoPowLimit, false)
+		warnUnverifiedPow()
 	default:
 		return nil, fmt.Errorf("config error")
 	}
@@ -179,6 +217,41 @@ func (x *ElectrumXInterface) GetTipChangeNotify() (<-chan int64, error) {
 	return x.network.GetTipChangeNotify(), nil
 }
 
+func (x *ElectrumXInterface) GetReorgNotify() (<-chan *electrumx.ReorgEvent, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.GetReorgNotify(), nil
+}
+
+func (x *ElectrumXInterface) GetConnectionStatusNotify() (<-chan *electrumx.ConnectionStatus, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.GetConnectionStatusNotify(), nil
+}
+
+func (x *ElectrumXInterface) NetworkStatus() (*electrumx.NetworkStatus, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.NetworkStatus(), nil
+}
+
+func (x *ElectrumXInterface) TorStatus(ctx context.Context) (*electrumx.TorStatus, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.TorStatus(ctx)
+}
+
+func (x *ElectrumXInterface) GetNetworkEventNotify() (<-chan *electrumx.NetworkEvent, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.GetNetworkEventNotify(), nil
+}
+
 func (x *ElectrumXInterface) GetScripthashNotify() (<-chan *electrumx.ScripthashStatusResult, error) {
 	if x.network == nil {
 		return nil, ErrNoNetwork
@@ -193,6 +266,13 @@ func (x *ElectrumXInterface) SubscribeScripthashNotify(ctx context.Context, scri
 	return x.network.SubscribeScripthashNotify(ctx, scripthash)
 }
 
+func (x *ElectrumXInterface) SubscribeScripthashNotifyBatch(ctx context.Context, scripthashes []string) ([]*electrumx.ScripthashStatusBatchResult, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.SubscribeScripthashNotifyBatch(ctx, scripthashes)
+}
+
 func (x *ElectrumXInterface) UnsubscribeScripthashNotify(ctx context.Context, scripthash string) {
 	if x.network == nil {
 		return
@@ -207,6 +287,13 @@ func (x *ElectrumXInterface) GetHistory(ctx context.Context, scripthash string)
 	return x.network.GetHistory(ctx, scripthash)
 }
 
+func (x *ElectrumXInterface) GetHistoryBatch(ctx context.Context, scripthashes []string) ([]*electrumx.HistoryBatchResult, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.GetHistoryBatch(ctx, scripthashes)
+}
+
 func (x *ElectrumXInterface) GetListUnspent(ctx context.Context, scripthash string) (electrumx.ListUnspentResult, error) {
 	if x.network == nil {
 		return nil, ErrNoNetwork
@@ -214,6 +301,13 @@ func (x *ElectrumXInterface) GetListUnspent(ctx context.Context, scripthash stri
 	return x.network.GetListUnspent(ctx, scripthash)
 }
 
+func (x *ElectrumXInterface) GetListUnspentBatch(ctx context.Context, scripthashes []string) ([]*electrumx.ListUnspentBatchResult, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.GetListUnspentBatch(ctx, scripthashes)
+}
+
 func (x *ElectrumXInterface) GetTransaction(ctx context.Context, txid string) (*electrumx.GetTransactionResult, error) {
 	if x.network == nil {
 		return nil, ErrNoNetwork
@@ -228,6 +322,34 @@ func (x *ElectrumXInterface) GetRawTransaction(ctx context.Context, txid string)
 	return x.network.GetRawTransaction(ctx, txid)
 }
 
+func (x *ElectrumXInterface) GetRawTransactionBatch(ctx context.Context, txids []string) ([]*electrumx.RawTransactionBatchResult, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.GetRawTransactionBatch(ctx, txids)
+}
+
+func (x *ElectrumXInterface) VerifyMerkleProof(ctx context.Context, txid string, height int64) error {
+	if x.network == nil {
+		return ErrNoNetwork
+	}
+	return x.network.VerifyMerkleProof(ctx, txid, height)
+}
+
+func (x *ElectrumXInterface) ReportStatusMismatch(scripthash string) {
+	if x.network == nil {
+		return
+	}
+	x.network.ReportStatusMismatch(scripthash)
+}
+
+func (x *ElectrumXInterface) ReportBadTx(server, txid string) {
+	if x.network == nil {
+		return
+	}
+	x.network.ReportBadTx(server, txid)
+}
+
 func (x *ElectrumXInterface) Broadcast(ctx context.Context, rawTx string) (string, error) {
 	if x.network == nil {
 		return "", ErrNoNetwork
@@ -235,9 +357,51 @@ func (x *ElectrumXInterface) Broadcast(ctx context.Context, rawTx string) (strin
 	return x.network.Broadcast(ctx, rawTx)
 }
 
+func (x *ElectrumXInterface) BroadcastPackage(ctx context.Context, rawTxs []string) (*electrumx.BroadcastPackageResult, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.BroadcastPackage(ctx, rawTxs)
+}
+
+func (x *ElectrumXInterface) Supports(method string) bool {
+	if x.network == nil {
+		return false
+	}
+	return x.network.Supports(method)
+}
+
 func (x *ElectrumXInterface) EstimateFeeRate(ctx context.Context, confTarget int64) (int64, error) {
 	if x.network == nil {
 		return 0, ErrNoNetwork
 	}
 	return x.network.EstimateFeeRate(ctx, confTarget)
 }
+
+func (x *ElectrumXInterface) GetMempool(ctx context.Context, scripthash string) (electrumx.MempoolResult, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.GetMempool(ctx, scripthash)
+}
+
+func (x *ElectrumXInterface) GetBalance(ctx context.Context, scripthash string) (*electrumx.BalanceResult, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.GetBalance(ctx, scripthash)
+}
+
+func (x *ElectrumXInterface) GetFeeHistogram(ctx context.Context) (electrumx.FeeHistogram, error) {
+	if x.network == nil {
+		return nil, ErrNoNetwork
+	}
+	return x.network.GetFeeHistogram(ctx)
+}
+
+func (x *ElectrumXInterface) GetRelayFee(ctx context.Context) (int64, error) {
+	if x.network == nil {
+		return 0, ErrNoNetwork
+	}
+	return x.network.GetRelayFee(ctx)
+}
@@ -0,0 +1,126 @@
+package elxfiro
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/dev-warrior777/go-electrum-client/electrumx"
+)
+
+const (
+	// FiroPoW target block spacing in seconds
+	FIRO_TARGET_SPACING = 300
+	// Number of blocks averaged by the LWMA retarget
+	FIRO_LWMA_WINDOW = 60
+)
+
+var (
+	// 00ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff
+	firoPowLimit = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 248), big.NewInt(1))
+	// 7fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff
+	firoRegtestPowLimit = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(1))
+)
+
+// headerValidator is the Firo rule hook for block headers.
+//
+// Firo's block hash is not its proof of work hash. The FiroPoW (ProgPow) hash
+// needs the epoch DAG so it cannot be checked here and the headers are checked
+// for difficulty only: nBits against the pow limit and the LWMA retarget of
+// the previous FIRO_LWMA_WINDOW headers, and the timestamp against median
+// time past.
+type headerValidator struct {
+	powLimit      *big.Int
+	noRetargeting bool
+}
+
+func newHeaderValidator(powLimit *big.Int, noRetargeting bool) *headerValidator {
+	return &headerValidator{
+		powLimit:      powLimit,
+		noRetargeting: noRetargeting,
+	}
+}
+
+// unverifiedPowWarning is printed once for the process
+var unverifiedPowWarning sync.Once
+
+func warnUnverifiedPow() {
+	unverifiedPowWarning.Do(func() {
+		fmt.Println("WARNING: FiroPoW hashes cannot be verified - block headers are checked for difficulty only")
+	})
+}
+
+func (v *headerValidator) ValidateHeader(hdr *electrumx.BlockHeader, height int64, chain electrumx.HeaderChain) error {
+	// a zero hash always meets the target so this checks the target only
+	err := electrumx.CheckProofOfWork(electrumx.WireHash{}, hdr.Bits, v.powLimit)
+	if err != nil {
+		return err
+	}
+	err = electrumx.CheckMedianTimePast(hdr, height, chain)
+	if err != nil {
+		return err
+	}
+	prev := chain.HeaderAt(height - 1)
+	if prev == nil {
+		// the checkpoint header
+		return nil
+	}
+	expected := prev.Bits
+	if !v.noRetargeting {
+		var ok bool
+		expected, ok = v.lwmaBits(height, chain)
+		if !ok {
+			// the window reaches below our checkpoint
+			return nil
+		}
+	}
+	if hdr.Bits != expected {
+		return fmt.Errorf("%w: bits %08x at height %d, expected %08x",
+			electrumx.ErrInvalidHeader, hdr.Bits, height, expected)
+	}
+	return nil
+}
+
+// lwmaBits is the linearly weighted moving average retarget for the header at
+// height. Recent solve times weigh more and each is limited to 6 times the
+// target spacing. Returns false if we do not have the whole window.
+func (v *headerValidator) lwmaBits(height int64, chain electrumx.HeaderChain) (uint32, bool) {
+	const T = FIRO_TARGET_SPACING
+	const N = FIRO_LWMA_WINDOW
+	const k = N * (N + 1) * T / 2
+
+	first := chain.HeaderAt(height - N - 1)
+	if first == nil {
+		return 0, false
+	}
+	previousTimestamp := first.Timestamp
+	var sumWeightedSolvetimes int64
+	avgTarget := new(big.Int)
+	for i := int64(1); i <= N; i++ {
+		block := chain.HeaderAt(height - N - 1 + i)
+		if block == nil {
+			return 0, false
+		}
+		// solve times are never negative
+		thisTimestamp := block.Timestamp
+		if thisTimestamp <= previousTimestamp {
+			thisTimestamp = previousTimestamp + 1
+		}
+		solvetime := thisTimestamp - previousTimestamp
+		if solvetime > 6*T {
+			solvetime = 6 * T
+		}
+		previousTimestamp = thisTimestamp
+		sumWeightedSolvetimes += solvetime * i
+		target := blockchain.CompactToBig(block.Bits)
+		target.Div(target, big.NewInt(N))
+		target.Div(target, big.NewInt(k))
+		avgTarget.Add(avgTarget, target)
+	}
+	nextTarget := avgTarget.Mul(avgTarget, big.NewInt(sumWeightedSolvetimes))
+	if nextTarget.Cmp(v.powLimit) > 0 {
+		nextTarget.Set(v.powLimit)
+	}
+	return blockchain.BigToCompact(nextTarget), true
+}
@@ -0,0 +1,100 @@
+package elxfiro
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/dev-warrior777/go-electrum-client/electrumx"
+)
+
+type testChain map[int64]*electrumx.BlockHeader
+
+func (c testChain) HeaderAt(height int64) *electrumx.BlockHeader {
+	return c[height]
+}
+
+const testBits = 0x1b0404cb
+
+// mkChain makes headers from height 1000 up to tip with spacing seconds
+// between them.
+func mkChain(tip int64, spacing int64) testChain {
+	chain := testChain{}
+	for h := int64(1000); h <= tip; h++ {
+		chain[h] = &electrumx.BlockHeader{
+			Timestamp: 1700000000 + (h-1000)*spacing,
+			Bits:      testBits,
+		}
+	}
+	return chain
+}
+
+func TestDifficultyOnly(t *testing.T) {
+	// the default validator syncs headers it cannot check the FiroPoW hash of
+	v := newHeaderValidator(firoPowLimit, false)
+	hdr := &electrumx.BlockHeader{Timestamp: 1700000000, Bits: testBits}
+	if err := v.ValidateHeader(hdr, 1000, testChain{}); err != nil {
+		t.Fatal(err)
+	}
+	// but not a target above the pow limit
+	hdr.Bits = 0x2100ffff
+	err := v.ValidateHeader(hdr, 1000, testChain{})
+	if !errors.Is(err, electrumx.ErrInvalidHeader) {
+		t.Fatalf("expected ErrInvalidHeader got %v", err)
+	}
+}
+
+func TestLWMARetarget(t *testing.T) {
+	v := newHeaderValidator(firoPowLimit, false)
+	tip := int64(1000 + FIRO_LWMA_WINDOW + 10)
+	height := tip + 1
+
+	steady := mkChain(tip, FIRO_TARGET_SPACING)
+	bits, ok := v.lwmaBits(height, steady)
+	if !ok {
+		t.Fatal("window not found")
+	}
+	next := &electrumx.BlockHeader{Timestamp: steady[tip].Timestamp + FIRO_TARGET_SPACING, Bits: bits}
+	if err := v.ValidateHeader(next, height, steady); err != nil {
+		t.Fatal(err)
+	}
+	// on target blocks keep the difficulty within rounding
+	drift := new(big.Int).Sub(blockchain.CompactToBig(testBits), blockchain.CompactToBig(bits))
+	if drift.Abs(drift).Cmp(new(big.Int).Rsh(blockchain.CompactToBig(testBits), 10)) > 0 {
+		t.Fatalf("steady bits %08x from %08x", bits, testBits)
+	}
+	next.Bits = testBits + 1
+	err := v.ValidateHeader(next, height, steady)
+	if !errors.Is(err, electrumx.ErrInvalidHeader) {
+		t.Fatalf("expected ErrInvalidHeader got %v", err)
+	}
+
+	// fast blocks make it harder, slow blocks easier
+	fast, _ := v.lwmaBits(height, mkChain(tip, FIRO_TARGET_SPACING/2))
+	slow, _ := v.lwmaBits(height, mkChain(tip, FIRO_TARGET_SPACING*2))
+	steadyTarget := blockchain.CompactToBig(bits)
+	if blockchain.CompactToBig(fast).Cmp(steadyTarget) >= 0 ||
+		blockchain.CompactToBig(slow).Cmp(steadyTarget) <= 0 {
+		t.Fatalf("fast %08x steady %08x slow %08x", fast, bits, slow)
+	}
+
+	// any bits within the pow limit while the window is below our checkpoint
+	short := mkChain(1000+FIRO_LWMA_WINDOW-1, FIRO_TARGET_SPACING)
+	hdr := &electrumx.BlockHeader{Timestamp: 1800000000, Bits: testBits + 1}
+	if err := v.ValidateHeader(hdr, 1000+FIRO_LWMA_WINDOW, short); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegtestNoRetarget(t *testing.T) {
+	v := newHeaderValidator(firoRegtestPowLimit, true)
+	chain := testChain{0: {Timestamp: 1700000000, Bits: 0x207fffff}}
+	if err := v.ValidateHeader(&electrumx.BlockHeader{Timestamp: 1700000060, Bits: 0x207fffff}, 1, chain); err != nil {
+		t.Fatal(err)
+	}
+	err := v.ValidateHeader(&electrumx.BlockHeader{Timestamp: 1700000060, Bits: 0x207ffffe}, 1, chain)
+	if !errors.Is(err, electrumx.ErrInvalidHeader) {
+		t.Fatalf("expected ErrInvalidHeader got %v", err)
+	}
+}
@@ -1,13 +1,13 @@
 package electrumx
 
 // This is the blockchain headers for a blockchain.
+//
+// Headers are stored on disk - see headers_store.go.
 
 import (
-	"bytes"
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"os"
 	"path/filepath"
 	"sync"
 	"sync/atomic"
@@ -45,19 +45,24 @@ func (wh WireHash) StringRev() string {
 type headers struct {
 	// blockchain header size - per coin.
 	headerSize int
-	// blockchain_headers file to persist headers we know in datadir
-	hdrFilePath string
+	// blockchain_headers file to persist headers we know in datadir, its
+	// index and a cache of recent headers
+	hdrStore *headerStore
 	// chain parameters for genesis.
 	// for each coin/nettype we use the most recent checkpoint (or a specific
 	// but arbitrary one) for the start of the block_headers file. For regtest
 	// that is block 0.
 	startPoint        int64
 	headerDeserialzer HeaderDeserializer
-	// decoded headers stored by height
-	hdrs        map[int64]*BlockHeader
-	blkHdrs     map[WireHash]int64
+	// proof of work rules for the coin - may be nil
+	headerValidator HeaderValidator
+	// known merkle roots of block hashes in height order
+	checkpoints []Checkpoint
+	// stored headers checked back from the tip on startup
+	verifyDepth int64
 	hdrsMtx     sync.RWMutex
 	tip         atomic.Int64
+	syncHeight  atomic.Int64 // headers stored while syncing
 	synced      bool
 	recovery    bool
 	recoveryTip int64
@@ -65,17 +70,21 @@ type headers struct {
 
 func newHeaders(cfg *ElectrumXConfig) *headers {
 	filePath := filepath.Join(cfg.DataDir, HEADER_FILE_NAME)
-	hdrsMapInitSize := 2 * ELECTRUM_MAGIC_NUMHDR //4032
-	hdrsMap := make(map[int64]*BlockHeader, hdrsMapInitSize)
-	bhdrsMap := make(map[WireHash]int64, hdrsMapInitSize)
+	indexPath := filepath.Join(cfg.DataDir, HEADER_INDEX_FILE_NAME)
+	sumsPath := filepath.Join(cfg.DataDir, HEADER_SUMS_FILE_NAME)
 	headerDeserialzer := cfg.HeaderDeserializer
+	verifyDepth := cfg.HeaderVerifyDepth
+	if verifyDepth == 0 {
+		verifyDepth = HEADER_VERIFY_DEPTH
+	}
 	hdrs := headers{
 		headerSize:        cfg.BlockHeaderSize,
-		hdrFilePath:       filePath,
+		hdrStore:          newHeaderStore(filePath, indexPath, sumsPath, cfg.BlockHeaderSize, cfg.StartPoint, headerDeserialzer),
 		startPoint:        cfg.StartPoint,
 		headerDeserialzer: headerDeserialzer,
-		hdrs:              hdrsMap,
-		blkHdrs:           bhdrsMap,
+		headerValidator:   cfg.HeaderValidator,
+		checkpoints:       sortCheckpoints(cfg.Checkpoints),
+		verifyDepth:       verifyDepth,
 		synced:            false,
 		recovery:          false,
 		recoveryTip:       0,
@@ -103,37 +112,34 @@ func (h *headers) decTip(delta int64) {
 // Headers file
 // ----------------------------------------------------------------------------
 
-// Get the 'blockchain_headers' file size. Error is returned unexamined as
-// we assume the file exists and ENOENT will not be valid.
-func (h *headers) statFileSize() (int64, error) {
-	fi, err := os.Stat(h.hdrFilePath)
-	if err != nil {
-		return 0, err
-	}
-	return fi.Size(), nil
+// openHeadersFile opens the 'blockchain_headers' file and its index. Returns
+// the number of headers stored.
+func (h *headers) openHeadersFile() (int64, error) {
+	h.hdrsMtx.Lock()
+	defer h.hdrsMtx.Unlock()
+	return h.hdrStore.open()
+}
+
+// closeHeadersFile closes the 'blockchain_headers' file and its index.
+func (h *headers) closeHeadersFile() {
+	h.hdrsMtx.Lock()
+	defer h.hdrsMtx.Unlock()
+	h.hdrStore.close()
 }
 
 // appendHeadersFile appends headers from server 'blockchain.block.header(s)' calls
 // to 'blockchain_headers' file. Also appends headers received from the
 // 'blockchain.headers.subscribe' events. Returns the number of headers written.
+// The tip is not changed.
 func (h *headers) appendHeadersFile(rawHdrs []byte) (int64, error) {
-	numBytes := len(rawHdrs)
-	numHdrs, err := h.bytesToNumHdrs(int64(numBytes))
-	if err != nil {
-		return 0, err
-	}
-	hdrFile, err := os.OpenFile(h.hdrFilePath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0664)
-	if err != nil {
-		return 0, err
-	}
-	defer hdrFile.Close()
-	_, err = hdrFile.Write(rawHdrs)
-	if err != nil {
-		return 0, err
-	}
-	return numHdrs, nil
+	h.hdrsMtx.Lock()
+	defer h.hdrsMtx.Unlock()
+	return h.hdrStore.append(rawHdrs)
 }
 
+// truncateHeadersFile removes numHeaders from the end of the
+// 'blockchain_headers' file. Returns the number of headers left. The tip is
+// not changed.
 func (h *headers) truncateHeadersFile(numHeaders int64) (int64, error) {
 	if !h.synced {
 		return 0, errors.New("still syncing")
@@ -141,84 +147,44 @@ func (h *headers) truncateHeadersFile(numHeaders int64) (int64, error) {
 	if numHeaders <= 0 {
 		return 0, errors.New("numHeaders <= 0")
 	}
-	size, err := h.statFileSize()
-	if err != nil {
-		return 0, err
-	}
-	headerSize := int64(h.headerSize)
-	if size%headerSize != 0 {
-		return 0, errors.New("headers file corrupt - size not a multiple of h.headerSize")
-	}
-	newByteLen := size - (numHeaders * headerSize)
-	if newByteLen < 0 {
-		newByteLen = 0
-	}
-	err = os.Truncate(h.hdrFilePath, newByteLen)
-	if err != nil {
-		return 0, err
-	}
-	newSize, err := h.statFileSize()
-	if err != nil {
-		return 0, err
-	}
-	newNumHeaders, _ := h.bytesToNumHdrs(newSize)
-	return newNumHeaders, nil
-}
-
-func (h *headers) readAllBytesFromFile() ([]byte, error) {
-	hdrFile, err := os.OpenFile(h.hdrFilePath, os.O_CREATE|os.O_RDWR, 0664)
-	if err != nil {
-		return nil, err
-	}
-	defer hdrFile.Close()
-	fsize, err := h.statFileSize()
-	if err != nil {
-		return nil, err
-	}
-	b := make([]byte, fsize)
-	hdrFile.Seek(0, 0)
-	n, err := hdrFile.Read(b)
-	if err != nil {
-		return nil, err
-	}
-	if n != int(fsize) {
-		return nil, errors.New("read less than file size")
-	}
-	return b, nil
+	h.hdrsMtx.Lock()
+	defer h.hdrsMtx.Unlock()
+	return h.hdrStore.truncate(numHeaders)
 }
 
 // ----------------------------------------------------------------------------
-// Maps
+// Stored headers
 // ----------------------------------------------------------------------------
 
-// Store blockHeaders starting at startHeight in the 'hdrs' map
-func (h *headers) store(b []byte, startHeight int64) error {
-	numHdrs, err := h.bytesToNumHdrs(int64(len(b)))
-	if err != nil {
-		return err
+// header returns the stored header at height or nil. The caller must hold
+// hdrsMtx.
+func (h *headers) header(height int64) *BlockHeader {
+	if height < h.startPoint || height > h.getTip() {
+		return nil
 	}
-	rdr := bytes.NewBuffer(b)
-	h.hdrsMtx.Lock()
-	defer h.hdrsMtx.Unlock()
-	var i int64
-	for i = 0; i < numHdrs; i++ {
-		blkHdr, err := h.headerDeserialzer.Deserialize(rdr)
-		if err != nil {
-			return err
-		}
-		at := startHeight + i
-		h.hdrs[at] = blkHdr
-		blkHash := blkHdr.Hash
-		h.blkHdrs[blkHash] = at
+	hdr, err := h.hdrStore.header(height)
+	if err != nil {
+		return nil
 	}
-	return nil
+	return hdr
 }
 
-func (h *headers) removeOneHdrFromTip() {
-	h.hdrsMtx.Lock()
-	defer h.hdrsMtx.Unlock()
-	delete(h.hdrs, h.getTip())
-	h.decTip(1)
+// getHeader returns the stored header at height or nil.
+func (h *headers) getHeader(height int64) *BlockHeader {
+	h.hdrsMtx.RLock()
+	defer h.hdrsMtx.RUnlock()
+	return h.header(height)
+}
+
+// getHeightForBlockHash looks up the height of a stored block hash.
+func (h *headers) getHeightForBlockHash(blkHash WireHash) (int64, bool) {
+	h.hdrsMtx.RLock()
+	defer h.hdrsMtx.RUnlock()
+	height, ok := h.hdrStore.heightOf(blkHash)
+	if !ok || height > h.getTip() {
+		return 0, false
+	}
+	return height, true
 }
 
 // getClientTip returns the stored block headers last tip height or .
@@ -238,57 +204,117 @@ func (h *headers) getClientSynced() bool {
 	return h.synced
 }
 
-// // reverse lookup
-// func (n *Node) getHeaderForBlockHash(blkHash *WireHash) *BlockHeader {
-// 	h := n.networkHeaders
-// 	height := h.blkHdrs[*blkHash]
-// 	return h.hdrs[height]
-// }
-
 func (h *headers) getTipHash() WireHash {
-	hdr := h.hdrs[h.getTip()]
+	hdr := h.getHeader(h.getTip())
+	if hdr == nil {
+		return WireHash{}
+	}
 	return hdr.Hash
 }
 
+// getMerkleRoot returns the merkle root of the stored header at height. The
+// bool is false if we have no header stored for that height.
+func (h *headers) getMerkleRoot(height int64) (WireHash, bool) {
+	h.hdrsMtx.RLock()
+	defer h.hdrsMtx.RUnlock()
+	hdr := h.header(height)
+	if hdr == nil {
+		return WireHash{}, false
+	}
+	return hdr.Merkle, true
+}
+
 func (h *headers) checkCanConnect(incomingHdr *BlockHeader) bool {
 	ourTipHash := h.getTipHash()
 	return ourTipHash == incomingHdr.Prev
 }
 
-// storeOneHdr stores one block header at h.tip+1 and updates h.tip
+// HeaderAt implements HeaderChain for the coin's HeaderValidator. The caller
+// must hold hdrsMtx.
+func (h *headers) HeaderAt(height int64) *BlockHeader {
+	return h.header(height)
+}
+
+// validateHeader checks the proof of work and difficulty rules for a header
+// at height. The caller must hold hdrsMtx.
+func (h *headers) validateHeader(hdr *BlockHeader, height int64) error {
+	if h.headerValidator == nil {
+		return nil
+	}
+	return h.headerValidator.ValidateHeader(hdr, height, h)
+}
+
+// checkCanStore validates an incoming header that connects to our tip
+func (h *headers) checkCanStore(incomingHdr *BlockHeader) error {
+	h.hdrsMtx.RLock()
+	defer h.hdrsMtx.RUnlock()
+	return h.validateHeader(incomingHdr, h.getTip()+1)
+}
+
+// storeOneHdr stores one raw block header at h.tip+1 and updates h.tip
 // the header is assumed to be valid and can connect
-func (h *headers) storeOneHdr(blkHdr *BlockHeader) {
+func (h *headers) storeOneHdr(rawHdr []byte) error {
 	h.hdrsMtx.Lock()
 	defer h.hdrsMtx.Unlock()
-	at := h.getTip() + 1
-	// at := h.tip + 1
-	h.hdrs[at] = blkHdr
-	blkHash := blkHdr.Hash
-	h.blkHdrs[blkHash] = at
+	_, err := h.hdrStore.append(rawHdr)
+	if err != nil {
+		return err
+	}
 	h.incTip(1)
+	// checked before it was stored
+	return h.hdrStore.setVerified(h.getTip())
 }
 
-// Verify headers prev hash back from tip. If 'all' is true 'depth' is ignored
-// and the whole chain is verified
+// Verify headers prev hash and proof of work back from tip. If 'all' is true
+// 'depth' is ignored and the whole chain is verified. The verified height is
+// recorded so that next time only headers above it need verifying.
 func (h *headers) verifyFromTip(depth int64, all bool) error {
 	h.hdrsMtx.RLock()
 	defer h.hdrsMtx.RUnlock()
 	downTo := h.getTip() - depth
-	if downTo < 0 || all {
+	if downTo < h.startPoint || all {
 		downTo = h.startPoint
+		// the checkpoint header has no previous header but has a proof of work
+		startHdr := h.header(downTo)
+		if startHdr == nil {
+			return fmt.Errorf("verify failed: height %d: %w", downTo, ErrHeaderNotStored)
+		}
+		err := h.validateHeader(startHdr, downTo)
+		if err != nil {
+			return fmt.Errorf("verify failed: height %d: %w", downTo, err)
+		}
 	}
 	var height int64
 	for height = h.getTip(); height > downTo; height-- {
-		thisHdr := h.hdrs[height]
-		prevHdr := h.hdrs[height-1]
+		thisHdr := h.header(height)
+		prevHdr := h.header(height - 1)
+		if thisHdr == nil || prevHdr == nil {
+			return fmt.Errorf("verify failed: height %d: %w", height, ErrHeaderNotStored)
+		}
 		prevHdrBlkHash := prevHdr.Hash
 		if prevHdrBlkHash != thisHdr.Prev {
 			return fmt.Errorf("verify failed: height %d", height)
 		}
+		err := h.validateHeader(thisHdr, height)
+		if err != nil {
+			return fmt.Errorf("verify failed: height %d: %w", height, err)
+		}
 		// fmt.Printf("verified header at height %d has blockhash %s\n",
 		// 	height-1, prevHdrBlkHash.StringRev())
 	}
-	return nil
+	return h.hdrStore.setVerified(h.getTip())
+}
+
+// verifyUnverified verifies the headers added since the chain was last
+// verified.
+func (h *headers) verifyUnverified() error {
+	h.hdrsMtx.RLock()
+	verified := h.hdrStore.verified()
+	h.hdrsMtx.RUnlock()
+	if verified < h.startPoint {
+		return h.verifyAll()
+	}
+	return h.verifyFromTip(h.getTip()-verified, false)
 }
 
 func (h *headers) verifyAll() error {
@@ -320,7 +346,7 @@ func (h *headers) bytesToNumHdrs(numBytes int64) (int64, error) {
 func (h *headers) getBlockHeader(height int64) (*ClientBlockHeader, error) {
 	h.hdrsMtx.RLock()
 	defer h.hdrsMtx.RUnlock()
-	blkHdr := h.hdrs[height]
+	blkHdr := h.header(height)
 	if blkHdr == nil {
 		return nil, fmt.Errorf("no block header stored for height %d", height)
 	}
@@ -353,7 +379,10 @@ func (h *headers) getBlockHeaders(startHeight, count int64) ([]*ClientBlockHeade
 	}
 	var hdrs = make([]*ClientBlockHeader, 0, 3)
 	for i := startHeight; i < blkEndRange; i++ {
-		blkHdr := h.hdrs[i]
+		blkHdr := h.header(i)
+		if blkHdr == nil {
+			return nil, fmt.Errorf("no block header stored for height %d", i)
+		}
 		hdr := &ClientBlockHeader{
 			Hash:   blkHdr.Hash.StringRev(),
 			Prev:   blkHdr.Prev.StringRev(),
@@ -368,21 +397,17 @@ func (h *headers) getBlockHeaders(startHeight, count int64) ([]*ClientBlockHeade
 // test
 // ----------------------------------------------------------------------------
 
-// Use *only* in headers_test.go
-func (h *headers) ClearMaps() {
-	h.hdrs = nil
-	h.blkHdrs = nil
-	h.hdrs = make(map[int64]*BlockHeader, 10)
-	h.blkHdrs = make(map[WireHash]int64, 10)
-}
-
 // dump the top 'depth' hash - prev hashes
 func (h *headers) dbgDumpTipHashes(depth int64) {
 	tip := h.getTip()
 	fmt.Printf("--- Dump of the top %d stored headers ---\n", depth)
 	for i := tip; i > tip-depth; i-- {
-		hash := h.hdrs[i].Hash.StringRev()
-		prev := h.hdrs[i].Prev.StringRev()
+		hdr := h.getHeader(i)
+		if hdr == nil {
+			break
+		}
+		hash := hdr.Hash.StringRev()
+		prev := hdr.Prev.StringRev()
 		fmt.Printf("height: %d hash: %s prev: %s\n", i, hash, prev)
 	}
 }
@@ -391,7 +416,10 @@ func (h *headers) dbgDumpTipHashes(depth int64) {
 func (h *headers) dumpAt(height int64) {
 	h.hdrsMtx.Lock()
 	defer h.hdrsMtx.Unlock()
-	hdr := h.hdrs[height]
+	hdr := h.header(height)
+	if hdr == nil {
+		return
+	}
 	fmt.Println("Hash:          ", hdr.Hash.StringRev(), "Height: ", height)
 	fmt.Println("--------------------------")
 	fmt.Println("Previous Hash: ", hdr.Prev.StringRev())
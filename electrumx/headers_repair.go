@@ -0,0 +1,208 @@
+package electrumx
+
+// Headers file integrity.
+//
+// If we die mid-append the headers file can end in a partial header and a
+// disk error can corrupt a header anywhere. When the file is opened any
+// partial trailing header is cut off. Each complete chunk of
+// ELECTRUM_MAGIC_NUMHDR headers has a crc32 kept in 'blockchain_headers_sums'.
+// Before syncing, the chunk checksums and the header chain linkage and proof
+// of work are checked back from the file tip for HeaderVerifyDepth headers.
+// Anything from the first bad header up is dropped and downloaded again from
+// the server rather than failing startup.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+)
+
+const (
+	// The chunk checksums live beside the headers file
+	HEADER_SUMS_FILE_NAME = "blockchain_headers_sums"
+	// Default headers checked back from the tip on startup
+	HEADER_VERIFY_DEPTH = ELECTRUM_MAGIC_NUMHDR
+	// Bytes per chunk checksum
+	sumSize = 4
+)
+
+// ----------------------------------------------------------------------------
+// Chunk checksums
+// ----------------------------------------------------------------------------
+
+// openSums opens the checksums file and brings it up to date with the
+// numHeaders in the headers file.
+func (s *headerStore) openSums(numHeaders int64) error {
+	sums, err := os.OpenFile(s.sumsPath, os.O_CREATE|os.O_RDWR, 0664)
+	if err != nil {
+		return err
+	}
+	s.sums = sums
+	fi, err := sums.Stat()
+	if err != nil {
+		return err
+	}
+	have := fi.Size() / sumSize
+	chunks := numHeaders / ELECTRUM_MAGIC_NUMHDR
+	if have > chunks || fi.Size()%sumSize != 0 {
+		// ahead of the headers file or partly written
+		if have > chunks {
+			have = chunks
+		}
+		err = sums.Truncate(have * sumSize)
+		if err != nil {
+			return err
+		}
+	}
+	if have < chunks {
+		fmt.Printf("computing header checksums for chunks %d to %d\n", have, chunks-1)
+	}
+	return s.updateSums(have, chunks)
+}
+
+// chunkSum returns the checksum of the headers in the file for chunk.
+func (s *headerStore) chunkSum(chunk int64) (uint32, error) {
+	b := make([]byte, ELECTRUM_MAGIC_NUMHDR*s.headerSize)
+	_, err := s.file.ReadAt(b, chunk*int64(len(b)))
+	if err != nil {
+		return 0, err
+	}
+	return crc32.ChecksumIEEE(b), nil
+}
+
+// updateSums writes checksums for the chunks [from, to).
+func (s *headerStore) updateSums(from, to int64) error {
+	for chunk := from; chunk < to; chunk++ {
+		sum, err := s.chunkSum(chunk)
+		if err != nil {
+			return err
+		}
+		b := make([]byte, sumSize)
+		binary.BigEndian.PutUint32(b, sum)
+		_, err = s.sums.WriteAt(b, chunk*sumSize)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// truncateSums keeps the checksums of the complete chunks in numHeaders.
+func (s *headerStore) truncateSums(numHeaders int64) error {
+	return s.sums.Truncate(numHeaders / ELECTRUM_MAGIC_NUMHDR * sumSize)
+}
+
+// checkSums checks the chunks holding height from and above. Returns the
+// first height of the first bad chunk or -1 if all are good.
+func (s *headerStore) checkSums(from int64) (int64, error) {
+	numHeaders, err := s.numHeaders()
+	if err != nil {
+		return -1, err
+	}
+	chunks := numHeaders / ELECTRUM_MAGIC_NUMHDR
+	for chunk := (from - s.startPoint) / ELECTRUM_MAGIC_NUMHDR; chunk < chunks; chunk++ {
+		b := make([]byte, sumSize)
+		_, err := s.sums.ReadAt(b, chunk*sumSize)
+		if err != nil {
+			return -1, err
+		}
+		sum, err := s.chunkSum(chunk)
+		if err != nil {
+			return -1, err
+		}
+		if sum != binary.BigEndian.Uint32(b) {
+			return s.startPoint + chunk*ELECTRUM_MAGIC_NUMHDR, nil
+		}
+	}
+	return -1, nil
+}
+
+// cutPartial cuts off any partial header at the end of the headers file.
+func (s *headerStore) cutPartial(file *os.File) error {
+	fi, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	partial := fi.Size() % int64(s.headerSize)
+	if partial == 0 {
+		return nil
+	}
+	fmt.Printf("headers file ends in a partial header - removing %d bytes\n", partial)
+	return file.Truncate(fi.Size() - partial)
+}
+
+// ----------------------------------------------------------------------------
+// Repair
+// ----------------------------------------------------------------------------
+
+// firstBadHeader returns the lowest height in [from, to] whose header does not
+// link to the one below or fails its proof of work, or -1 if all are good.
+// When a header does not link the one below may be the bad one. The caller
+// must hold hdrsMtx and the tip must be at or above to.
+func (h *headers) firstBadHeader(from, to int64) int64 {
+	for height := from; height <= to; height++ {
+		hdr := h.header(height)
+		if hdr == nil {
+			return height
+		}
+		if height > h.startPoint {
+			prev := h.header(height - 1)
+			if prev == nil || prev.Hash != hdr.Prev {
+				return height - 1
+			}
+		}
+		if err := h.validateHeader(hdr, height); err != nil {
+			return height
+		}
+	}
+	return -1
+}
+
+// checkHeadersFile checks the checksums and the chain of the last depth
+// stored headers, all of them if depth < 0. Headers from the first bad one up
+// are removed to be downloaded again. Returns the number of good headers and
+// sets the tip to the last of them.
+func (h *headers) checkHeadersFile(depth int64) (int64, error) {
+	h.hdrsMtx.Lock()
+	defer h.hdrsMtx.Unlock()
+	s := h.hdrStore
+	numHeaders, err := s.numHeaders()
+	if err != nil {
+		return 0, err
+	}
+	fileTip := h.startPoint + numHeaders - 1
+	h.setTip(fileTip)
+	if numHeaders == 0 {
+		return 0, nil
+	}
+	from := fileTip - depth + 1
+	if depth < 0 || from < h.startPoint {
+		from = h.startPoint
+	}
+
+	bad, err := s.checkSums(from)
+	if err != nil {
+		return 0, err
+	}
+	to := fileTip
+	if bad >= 0 {
+		fmt.Printf("headers checksum failed for the chunk from height %d\n", bad)
+		to = bad - 1
+	}
+	if badLink := h.firstBadHeader(from, to); badLink >= 0 {
+		fmt.Printf("stored header at height %d does not verify\n", badLink)
+		bad = badLink
+	}
+	if bad < 0 {
+		return numHeaders, nil
+	}
+
+	fmt.Printf("removing %d stored headers from height %d to download again\n", fileTip-bad+1, bad)
+	left, err := s.truncate(fileTip - bad + 1)
+	if err != nil {
+		return 0, fmt.Errorf("cannot repair headers file: %w", err)
+	}
+	h.setTip(h.startPoint + left - 1)
+	return left, nil
+}
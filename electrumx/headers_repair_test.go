@@ -0,0 +1,124 @@
+package electrumx
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// mkTestChain makes n linked raw headers with no proof of work.
+func mkTestChain(t *testing.T, n int) []byte {
+	var b bytes.Buffer
+	var prev chainhash.Hash
+	for i := 0; i < n; i++ {
+		hdr := wire.BlockHeader{Version: 1, PrevBlock: prev, Nonce: uint32(i)}
+		if err := hdr.Serialize(&b); err != nil {
+			t.Fatal(err)
+		}
+		prev = hdr.BlockHash()
+	}
+	return b.Bytes()
+}
+
+// reopenTestHeaders closes h, changes its headers file with change and opens
+// it again.
+func reopenTestHeaders(t *testing.T, h *headers, change func(f *os.File)) {
+	h.closeHeadersFile()
+	f, err := os.OpenFile(h.hdrStore.filePath, os.O_RDWR, 0664)
+	if err != nil {
+		t.Fatal(err)
+	}
+	change(f)
+	f.Close()
+	if _, err := h.openHeadersFile(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckHeadersFilePartial(t *testing.T) {
+	h := newTestHeaders(t, 0)
+	if _, err := h.appendHeadersFile(mkTestChain(t, 10)); err != nil {
+		t.Fatal(err)
+	}
+	// died mid-append
+	reopenTestHeaders(t, h, func(f *os.File) {
+		f.WriteAt(make([]byte, 30), 10*BTC_HEADER_SIZE)
+	})
+	n, err := h.checkHeadersFile(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 || h.getTip() != 9 {
+		t.Fatalf("got %d headers tip %d, want 10 tip 9", n, h.getTip())
+	}
+}
+
+func TestCheckHeadersFileBadLink(t *testing.T) {
+	h := newTestHeaders(t, 0)
+	chain := mkTestChain(t, 50)
+	if _, err := h.appendHeadersFile(chain); err != nil {
+		t.Fatal(err)
+	}
+	// corrupt the merkle root of header 20 so 21 does not link to it
+	reopenTestHeaders(t, h, func(f *os.File) {
+		f.WriteAt([]byte{0xff}, 20*BTC_HEADER_SIZE+40)
+	})
+	// not checked at this depth
+	n, err := h.checkHeadersFile(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 50 {
+		t.Fatalf("got %d headers, want 50", n)
+	}
+	n, err = h.checkHeadersFile(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 20 || h.getTip() != 19 {
+		t.Fatalf("got %d headers tip %d, want 20 tip 19", n, h.getTip())
+	}
+	// the bad range can be downloaded again
+	if _, err := h.appendHeadersFile(chain[20*BTC_HEADER_SIZE:]); err != nil {
+		t.Fatal(err)
+	}
+	h.setTip(49)
+	if err := h.verifyAll(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckHeadersFileChecksum(t *testing.T) {
+	h := newTestHeaders(t, 0)
+	if _, err := h.appendHeadersFile(mkTestChain(t, ELECTRUM_MAGIC_NUMHDR+10)); err != nil {
+		t.Fatal(err)
+	}
+	sums, err := os.ReadFile(h.hdrStore.sumsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sums) != sumSize {
+		t.Fatalf("%d bytes of checksums for one chunk", len(sums))
+	}
+	// corrupt a header in the first chunk below the linkage check
+	reopenTestHeaders(t, h, func(f *os.File) {
+		f.WriteAt([]byte{0xff}, 100*BTC_HEADER_SIZE+40)
+	})
+	n, err := h.checkHeadersFile(20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("got %d headers, want the bad chunk and above removed", n)
+	}
+	sums, err = os.ReadFile(h.hdrStore.sumsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sums) != 0 {
+		t.Fatalf("%d bytes of checksums left", len(sums))
+	}
+}
@@ -0,0 +1,482 @@
+package electrumx
+
+// Disk backed block headers store.
+//
+// Headers are kept only in the 'blockchain_headers' file, one after another
+// from the start point, so the header at a height is read by its offset. The
+// most recently used decoded headers are kept in a bounded LRU cache which is
+// big enough for the difficulty rules to look back over a retarget period.
+//
+// A bolt db next to the headers file indexes block hash to height. It also
+// records how far the file has been indexed and how far the chain has been
+// verified so that on startup only headers added since need to be indexed or
+// verified. Memory use and startup time do not grow with the chain length.
+// Checksums of the file are kept too - see headers_repair.go.
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// The hash to height index lives beside the headers file
+	HEADER_INDEX_FILE_NAME = "blockchain_headers_index"
+	// Decoded headers kept in memory - two retarget periods
+	HEADER_CACHE_SIZE = 2 * ELECTRUM_MAGIC_NUMHDR
+)
+
+var (
+	hashesBkt = []byte("hashes")
+	metaBkt   = []byte("meta")
+
+	// meta keys
+	startKey    = []byte("start")    // start point of the indexed file
+	indexedKey  = []byte("indexed")  // height of the last indexed header
+	verifiedKey = []byte("verified") // height of the last verified header
+)
+
+var ErrHeaderNotStored = errors.New("no block header stored")
+
+var errHeadersStoreClosed = errors.New("headers store not open")
+
+// headerCache is an LRU cache of decoded headers by height.
+type headerCache struct {
+	mtx   sync.Mutex
+	size  int
+	items map[int64]*list.Element
+	order *list.List // most recently used first
+}
+
+type cachedHeader struct {
+	height int64
+	hdr    *BlockHeader
+}
+
+func newHeaderCache(size int) *headerCache {
+	return &headerCache{
+		size:  size,
+		items: make(map[int64]*list.Element, size),
+		order: list.New(),
+	}
+}
+
+func (c *headerCache) get(height int64) (*BlockHeader, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	el, ok := c.items[height]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*cachedHeader).hdr, true
+}
+
+func (c *headerCache) add(height int64, hdr *BlockHeader) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if el, ok := c.items[height]; ok {
+		el.Value.(*cachedHeader).hdr = hdr
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[height] = c.order.PushFront(&cachedHeader{height: height, hdr: hdr})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cachedHeader).height)
+	}
+}
+
+// removeFrom removes the headers at height and above.
+func (c *headerCache) removeFrom(height int64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for h, el := range c.items {
+		if h >= height {
+			c.order.Remove(el)
+			delete(c.items, h)
+		}
+	}
+}
+
+func (c *headerCache) len() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.order.Len()
+}
+
+// headerStore is the headers file, its index and the cache. Writes must be
+// serialized by the caller - headers.hdrsMtx.
+type headerStore struct {
+	filePath     string
+	indexPath    string
+	sumsPath     string
+	headerSize   int
+	startPoint   int64
+	deserializer HeaderDeserializer
+
+	file  *os.File
+	index *bolt.DB
+	sums  *os.File
+	cache *headerCache
+}
+
+func newHeaderStore(filePath, indexPath, sumsPath string, headerSize int, startPoint int64, deserializer HeaderDeserializer) *headerStore {
+	return &headerStore{
+		filePath:     filePath,
+		indexPath:    indexPath,
+		sumsPath:     sumsPath,
+		headerSize:   headerSize,
+		startPoint:   startPoint,
+		deserializer: deserializer,
+		cache:        newHeaderCache(HEADER_CACHE_SIZE),
+	}
+}
+
+func heightKey(height int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(height))
+	return b
+}
+
+func keyHeight(b []byte) int64 {
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+// open opens the headers file, the index and the checksums and brings the
+// index and checksums up to date with the file. Any partial header at the end
+// of the file is removed. Returns the number of headers stored. Does nothing
+// more if already open.
+func (s *headerStore) open() (int64, error) {
+	if s.file != nil {
+		return s.numHeaders()
+	}
+	file, err := os.OpenFile(s.filePath, os.O_CREATE|os.O_RDWR, 0664)
+	if err != nil {
+		return 0, err
+	}
+	err = s.cutPartial(file)
+	if err != nil {
+		file.Close()
+		return 0, err
+	}
+	numHeaders, err := s.fileHeaders(file)
+	if err != nil {
+		file.Close()
+		return 0, err
+	}
+	options := *bolt.DefaultOptions
+	options.Timeout = 5 * time.Second
+	index, err := bolt.Open(s.indexPath, 0600, &options)
+	if err != nil {
+		file.Close()
+		return 0, fmt.Errorf("cannot open headers index: %w", err)
+	}
+	s.file = file
+	s.index = index
+	err = s.reindex(numHeaders)
+	if err == nil {
+		err = s.openSums(numHeaders)
+	}
+	if err != nil {
+		s.close()
+		return 0, err
+	}
+	return numHeaders, nil
+}
+
+func (s *headerStore) close() {
+	if s.sums != nil {
+		s.sums.Close()
+		s.sums = nil
+	}
+	if s.index != nil {
+		s.index.Close()
+		s.index = nil
+	}
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	s.cache.removeFrom(s.startPoint)
+}
+
+func (s *headerStore) fileHeaders(file *os.File) (int64, error) {
+	fi, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := fi.Size()
+	if size%int64(s.headerSize) != 0 {
+		return 0, errors.New("headers file corrupt - size not a multiple of header size")
+	}
+	return size / int64(s.headerSize), nil
+}
+
+// numHeaders returns the number of headers in the file.
+func (s *headerStore) numHeaders() (int64, error) {
+	if s.file == nil {
+		return 0, errHeadersStoreClosed
+	}
+	return s.fileHeaders(s.file)
+}
+
+// reindex indexes the headers in the file which are not yet indexed. If the
+// index is ahead of the file or for another start point it is rebuilt.
+func (s *headerStore) reindex(numHeaders int64) error {
+	fileTip := s.startPoint + numHeaders - 1
+	indexed := s.startPoint - 1
+	err := s.index.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(metaBkt)
+		if meta != nil {
+			start := meta.Get(startKey)
+			last := meta.Get(indexedKey)
+			if start != nil && last != nil && keyHeight(start) == s.startPoint &&
+				keyHeight(last) <= fileTip {
+				indexed = keyHeight(last)
+				return nil
+			}
+		}
+		// missing or not for this file
+		for _, bkt := range [][]byte{hashesBkt, metaBkt} {
+			if tx.Bucket(bkt) != nil {
+				if err := tx.DeleteBucket(bkt); err != nil {
+					return err
+				}
+			}
+		}
+		if _, err := tx.CreateBucket(hashesBkt); err != nil {
+			return err
+		}
+		meta, err := tx.CreateBucket(metaBkt)
+		if err != nil {
+			return err
+		}
+		if err := meta.Put(startKey, heightKey(s.startPoint)); err != nil {
+			return err
+		}
+		return meta.Put(indexedKey, heightKey(indexed))
+	})
+	if err != nil {
+		return err
+	}
+	if indexed < fileTip {
+		fmt.Printf("indexing headers %d to %d\n", indexed+1, fileTip)
+	}
+	for from := indexed + 1; from <= fileTip; from += ELECTRUM_MAGIC_NUMHDR {
+		count := fileTip - from + 1
+		if count > ELECTRUM_MAGIC_NUMHDR {
+			count = ELECTRUM_MAGIC_NUMHDR
+		}
+		b := make([]byte, count*int64(s.headerSize))
+		_, err := s.file.ReadAt(b, s.offset(from))
+		if err != nil {
+			return err
+		}
+		hdrs, err := s.decode(b)
+		if err != nil {
+			return err
+		}
+		err = s.indexHeaders(hdrs, from)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *headerStore) offset(height int64) int64 {
+	return (height - s.startPoint) * int64(s.headerSize)
+}
+
+func (s *headerStore) decode(b []byte) ([]*BlockHeader, error) {
+	if len(b)%s.headerSize != 0 {
+		return nil, errors.New("invalid bytes length - not a multiple of header size")
+	}
+	rdr := bytes.NewBuffer(b)
+	hdrs := make([]*BlockHeader, 0, len(b)/s.headerSize)
+	for rdr.Len() > 0 {
+		hdr, err := s.deserializer.Deserialize(rdr)
+		if err != nil {
+			return nil, err
+		}
+		hdrs = append(hdrs, hdr)
+	}
+	return hdrs, nil
+}
+
+// indexHeaders indexes hdrs from height from in one db transaction.
+func (s *headerStore) indexHeaders(hdrs []*BlockHeader, from int64) error {
+	return s.index.Update(func(tx *bolt.Tx) error {
+		hashes := tx.Bucket(hashesBkt)
+		for i, hdr := range hdrs {
+			hash := hdr.Hash
+			if err := hashes.Put(hash[:], heightKey(from+int64(i))); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(metaBkt).Put(indexedKey, heightKey(from+int64(len(hdrs))-1))
+	})
+}
+
+// append appends raw headers to the file then indexes and caches them.
+// Returns the number of headers appended.
+func (s *headerStore) append(rawHdrs []byte) (int64, error) {
+	numHeaders, err := s.numHeaders()
+	if err != nil {
+		return 0, err
+	}
+	hdrs, err := s.decode(rawHdrs)
+	if err != nil {
+		return 0, err
+	}
+	from := s.startPoint + numHeaders
+	_, err = s.file.WriteAt(rawHdrs, s.offset(from))
+	if err != nil {
+		return 0, err
+	}
+	err = s.indexHeaders(hdrs, from)
+	if err != nil {
+		return 0, err
+	}
+	err = s.updateSums(numHeaders/ELECTRUM_MAGIC_NUMHDR, (numHeaders+int64(len(hdrs)))/ELECTRUM_MAGIC_NUMHDR)
+	if err != nil {
+		return 0, err
+	}
+	for i, hdr := range hdrs {
+		s.cache.add(from+int64(i), hdr)
+	}
+	return int64(len(hdrs)), nil
+}
+
+// truncate removes numHeaders headers from the end of the file and the
+// index. Returns the number of headers left.
+func (s *headerStore) truncate(numHeaders int64) (int64, error) {
+	have, err := s.numHeaders()
+	if err != nil {
+		return 0, err
+	}
+	left := have - numHeaders
+	if left < 0 {
+		left = 0
+	}
+	from := s.startPoint + left
+	tip := s.startPoint + have - 1
+	err = s.index.Update(func(tx *bolt.Tx) error {
+		hashes := tx.Bucket(hashesBkt)
+		for height := from; height <= tip; height++ {
+			hdr, err := s.header(height)
+			if err != nil {
+				return err
+			}
+			hash := hdr.Hash
+			if err := hashes.Delete(hash[:]); err != nil {
+				return err
+			}
+		}
+		meta := tx.Bucket(metaBkt)
+		if err := meta.Put(indexedKey, heightKey(from-1)); err != nil {
+			return err
+		}
+		verified := meta.Get(verifiedKey)
+		if verified != nil && keyHeight(verified) >= from {
+			return meta.Put(verifiedKey, heightKey(from-1))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	err = s.file.Truncate(s.offset(from))
+	if err != nil {
+		return 0, err
+	}
+	err = s.truncateSums(left)
+	if err != nil {
+		return 0, err
+	}
+	s.cache.removeFrom(from)
+	return s.numHeaders()
+}
+
+// readRaw reads the raw header at height from the file.
+func (s *headerStore) readRaw(height int64) ([]byte, error) {
+	if s.file == nil || height < s.startPoint {
+		return nil, ErrHeaderNotStored
+	}
+	b := make([]byte, s.headerSize)
+	_, err := s.file.ReadAt(b, s.offset(height))
+	if err != nil {
+		return nil, ErrHeaderNotStored
+	}
+	return b, nil
+}
+
+// header returns the decoded header at height from the cache or the file.
+func (s *headerStore) header(height int64) (*BlockHeader, error) {
+	if hdr, ok := s.cache.get(height); ok {
+		return hdr, nil
+	}
+	b, err := s.readRaw(height)
+	if err != nil {
+		return nil, err
+	}
+	hdr, err := s.deserializer.Deserialize(bytes.NewBuffer(b))
+	if err != nil {
+		return nil, err
+	}
+	s.cache.add(height, hdr)
+	return hdr, nil
+}
+
+// heightOf looks up the height of a stored block hash in the index.
+func (s *headerStore) heightOf(hash WireHash) (int64, bool) {
+	if s.index == nil {
+		return 0, false
+	}
+	var height int64
+	found := false
+	s.index.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(hashesBkt).Get(hash[:])
+		if v != nil {
+			height = keyHeight(v)
+			found = true
+		}
+		return nil
+	})
+	return height, found
+}
+
+// verified returns the height up to which the stored chain was verified or
+// startPoint-1 if none was.
+func (s *headerStore) verified() int64 {
+	verified := s.startPoint - 1
+	if s.index == nil {
+		return verified
+	}
+	s.index.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(metaBkt).Get(verifiedKey)
+		if v != nil {
+			verified = keyHeight(v)
+		}
+		return nil
+	})
+	return verified
+}
+
+func (s *headerStore) setVerified(height int64) error {
+	if s.index == nil {
+		return errHeadersStoreClosed
+	}
+	return s.index.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(metaBkt).Put(verifiedKey, heightKey(height))
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 
@@ -86,29 +87,37 @@ func (d headerDeserialzer) Deserialize(r io.Reader) (*BlockHeader, error) {
 	blockHeader.Hash = WireHash(chainHash)
 	blockHeader.Prev = WireHash(wireHdr.PrevBlock)
 	blockHeader.Merkle = WireHash(wireHdr.MerkleRoot)
+	blockHeader.Timestamp = wireHdr.Timestamp.Unix()
+	blockHeader.Bits = wireHdr.Bits
 	return blockHeader, nil
 }
 
 var btcDeserializer = &headerDeserialzer{}
 
-func TestAppendHeaders(t *testing.T) {
-	f, err := os.CreateTemp("/tmp", "cli_")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer f.Close()
-	defer os.RemoveAll(f.Name())
-
-	h := headers{
+// newTestHeaders makes headers stored in a temp dir from startPoint.
+func newTestHeaders(t *testing.T, startPoint int64) *headers {
+	dir := t.TempDir()
+	h := &headers{
 		headerSize:        BTC_HEADER_SIZE,
 		headerDeserialzer: btcDeserializer,
-		hdrFilePath:       f.Name(),
-		startPoint:        0, // regtest
-		hdrs:              make(map[int64]*BlockHeader),
-		blkHdrs:           make(map[WireHash]int64),
-		synced:            false,
-	}
-	h.setTip(0)
+		hdrStore: newHeaderStore(
+			filepath.Join(dir, HEADER_FILE_NAME),
+			filepath.Join(dir, HEADER_INDEX_FILE_NAME),
+			filepath.Join(dir, HEADER_SUMS_FILE_NAME),
+			BTC_HEADER_SIZE, startPoint, btcDeserializer),
+		startPoint: startPoint,
+		synced:     false,
+	}
+	if _, err := h.openHeadersFile(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.closeHeadersFile)
+	h.setTip(startPoint - 1)
+	return h
+}
+
+func TestAppendHeaders(t *testing.T) {
+	h := newTestHeaders(t, 0) // regtest
 
 	numHdrs, err := h.appendHeadersFile(hdrFileReg)
 	if err != nil {
@@ -116,31 +125,16 @@ func TestAppendHeaders(t *testing.T) {
 	}
 	fmt.Println(numHdrs, " headers stored")
 
-	fsize, err := h.statFileSize()
+	fileHdrs, err := h.hdrStore.numHeaders()
 	if err != nil {
-		fmt.Println(err.Error())
 		log.Fatal(err)
 	}
-
-	if numHdrs != fsize/int64(h.headerSize) {
+	if numHdrs != fileHdrs || numHdrs != int64(len(hdrFileReg)/h.headerSize) {
 		log.Fatal("total headers wrong")
 	}
 
-	// 'finished' appending - now grab the bytes back
-	maybeTip := numHdrs - 1
-
-	// read back bytes from file
-	b, err := h.readAllBytesFromFile()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	// store all bytes into the map
-	err = h.store(b, 0)
-	if err != nil {
-		log.Fatal(err)
-	}
-	h.setTip(maybeTip)
+	// 'finished' appending
+	h.setTip(numHdrs - 1)
 
 	// verify chain
 	fmt.Println("verifying back from tip at height", h.getTip())
@@ -148,43 +142,22 @@ func TestAppendHeaders(t *testing.T) {
 	if err != nil {
 		log.Fatal(err)
 	}
+	if h.hdrStore.verified() != h.getTip() {
+		t.Fatalf("verified height %d, want %d", h.hdrStore.verified(), h.getTip())
+	}
 	h.synced = true
 }
 
 func TestTruncateHeadersFile(t *testing.T) {
-	f, err := os.CreateTemp("/tmp", "cli_")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer f.Close()
-	defer os.RemoveAll(f.Name())
-
-	h := headers{
-		headerSize:        BTC_HEADER_SIZE,
-		headerDeserialzer: btcDeserializer,
-		hdrFilePath:       f.Name(),
-		startPoint:        0, // regtest
-		hdrs:              make(map[int64]*BlockHeader),
-		blkHdrs:           make(map[WireHash]int64),
-		synced:            false,
-	}
-	h.setTip(0)
+	h := newTestHeaders(t, 0) // regtest
 
 	numHdrs, err := h.appendHeadersFile(hdrFileReg)
 	if err != nil {
 		log.Fatal(err)
 	}
 	fmt.Println(numHdrs, " headers stored")
-
-	fsize, err := h.statFileSize()
-	if err != nil {
-		fmt.Println(err.Error())
-		log.Fatal(err)
-	}
-
-	if numHdrs != fsize/int64(h.headerSize) {
-		log.Fatal("total headers wrong")
-	}
+	h.setTip(numHdrs - 1)
+	tipHash := h.getTipHash()
 
 	_, err = h.truncateHeadersFile(1)
 	if err == nil {
@@ -202,6 +175,9 @@ func TestTruncateHeadersFile(t *testing.T) {
 	if newNumHeaders != numHdrs-1 {
 		log.Fatalf("invaid number of headers returned %d", newNumHeaders)
 	}
+	if _, ok := h.hdrStore.heightOf(tipHash); ok {
+		t.Fatal("truncated header still indexed")
+	}
 	newNumHeaders, err = h.truncateHeadersFile(5)
 	if err != nil {
 		log.Fatal(err)
@@ -270,70 +246,43 @@ var hdr3 = []byte{
 	0xd0, 0x45, 0x26, 0x4c, 0x42, 0x78, 0x33, 0x65, 0xff, 0xff, 0x7f, 0x20, 0x00, 0x00, 0x00, 0x00,
 }
 
-func TestStore(t *testing.T) {
-	h := headers{
-		headerSize:        BTC_HEADER_SIZE,
-		headerDeserialzer: btcDeserializer,
-		hdrFilePath:       "<no file>",
-		startPoint:        0, // regtest
-		hdrs:              make(map[int64]*BlockHeader),
-		blkHdrs:           make(map[WireHash]int64),
-		synced:            false,
-	}
-	h.setTip(0)
+func TestAppendHeadersLength(t *testing.T) {
+	h := newTestHeaders(t, 0) // regtest
 
-	err := h.store(hdr, 0)
-	if err != nil {
+	n, err := h.appendHeadersFile(hdr)
+	if err != nil || n != 1 {
 		log.Fatal(err)
 	}
-	h.ClearMaps()
-	err = h.store(hdr3, 0)
-	if err != nil {
+	n, err = h.appendHeadersFile(hdr3)
+	if err != nil || n != 3 {
 		log.Fatal(err)
 	}
-	h.ClearMaps()
-	err = h.store(hdr3, 100)
-	if err != nil {
-		log.Fatal(err)
-	}
-	h.ClearMaps()
-	err = h.store(hdr, 0)
-	if err != nil {
-		log.Fatal("error expected")
-	}
-	h.ClearMaps()
-	err = h.store(hdr3, 0)
-	if err != nil {
-		log.Fatal(err)
-	}
-	// extra bytes are ignored
-	h.ClearMaps()
-	err = h.store(hdrBadLenMore, 0)
+	// extra bytes are not ignored
+	_, err = h.appendHeadersFile(hdrBadLenMore)
 	if err == nil {
 		log.Fatal("error expected")
 	}
 	// less than expected size is not ignored
-	h.ClearMaps()
-	err = h.store(hdrBadLenLess, 0)
+	_, err = h.appendHeadersFile(hdrBadLenLess)
 	if err == nil {
 		log.Fatal("error expected")
 	}
+	// nothing written for the bad ones
+	numHdrs, err := h.hdrStore.numHeaders()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if numHdrs != 4 {
+		t.Fatalf("%d headers stored, want 4", numHdrs)
+	}
+	h.setTip(numHdrs - 1)
 	h.dumpAll()
 }
 
 func TestStoreHashes(t *testing.T) {
-	h := headers{
-		headerSize:        BTC_HEADER_SIZE,
-		headerDeserialzer: btcDeserializer,
-		hdrFilePath:       "<no file>",
-		startPoint:        0, // regtest
-		hdrs:              make(map[int64]*BlockHeader),
-		blkHdrs:           make(map[WireHash]int64),
-		synced:            false,
-	}
-	h.setTip(0)
+	h := newTestHeaders(t, 0) // regtest
 
-	err := h.store(hdrFileReg, 0)
+	_, err := h.appendHeadersFile(hdrFileReg)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -346,19 +295,98 @@ func TestStoreHashes(t *testing.T) {
 	h.setTip(numHeaders - 1)
 	var i int64
 	for i = 0; i <= h.getTip(); i++ {
-		hdr := h.hdrs[i]
+		hdr := h.getHeader(i)
 		if hdr == nil {
-			log.Fatalf("nil header returned from map at %d", i)
+			log.Fatalf("nil header returned from store at %d", i)
 		}
 		blkHash := hdr.Hash
-		height := h.blkHdrs[blkHash]
-		if i != height {
+		height, ok := h.getHeightForBlockHash(blkHash)
+		if !ok || i != height {
 			t.Errorf("height mismatch: wanted %d got %d", i, height)
 		}
 	}
+	if h.getHeader(h.getTip()+1) != nil {
+		t.Fatal("expected no header above the tip")
+	}
 	h.dumpAll()
 }
 
+func TestHeadersReopen(t *testing.T) {
+	h := newTestHeaders(t, 0) // regtest
+	_, err := h.appendHeadersFile(hdrFileReg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	numHdrs := int64(len(hdrFileReg) / BTC_HEADER_SIZE)
+	h.setTip(numHdrs - 1)
+	if err := h.verifyAll(); err != nil {
+		t.Fatal(err)
+	}
+	tipHash := h.getTipHash()
+	h.closeHeadersFile()
+
+	// the index and verified height survive
+	reopened, err := h.openHeadersFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened != numHdrs {
+		t.Fatalf("reopened with %d headers, want %d", reopened, numHdrs)
+	}
+	if height, ok := h.getHeightForBlockHash(tipHash); !ok || height != numHdrs-1 {
+		t.Fatalf("tip hash indexed at %d %v", height, ok)
+	}
+	if h.hdrStore.verified() != numHdrs-1 {
+		t.Fatalf("verified height %d", h.hdrStore.verified())
+	}
+	if err := h.verifyUnverified(); err != nil {
+		t.Fatal(err)
+	}
+	h.closeHeadersFile()
+
+	// a lost index is rebuilt from the file
+	if err := os.Remove(h.hdrStore.indexPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.openHeadersFile(); err != nil {
+		t.Fatal(err)
+	}
+	if height, ok := h.getHeightForBlockHash(tipHash); !ok || height != numHdrs-1 {
+		t.Fatalf("tip hash indexed at %d %v after rebuild", height, ok)
+	}
+	if h.hdrStore.verified() != -1 {
+		t.Fatalf("verified height %d after rebuild", h.hdrStore.verified())
+	}
+	if err := h.verifyUnverified(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHeaderCache(t *testing.T) {
+	c := newHeaderCache(3)
+	for i := int64(0); i < 3; i++ {
+		c.add(i, &BlockHeader{Version: int32(i)})
+	}
+	// 0 is most recently used so 1 is evicted
+	if _, ok := c.get(0); !ok {
+		t.Fatal("expected 0 cached")
+	}
+	c.add(3, &BlockHeader{Version: 3})
+	if _, ok := c.get(1); ok {
+		t.Fatal("expected 1 evicted")
+	}
+	if c.len() != 3 {
+		t.Fatalf("cache holds %d", c.len())
+	}
+	c.removeFrom(2)
+	if _, ok := c.get(2); ok {
+		t.Fatal("expected 2 removed")
+	}
+	if _, ok := c.get(0); !ok || c.len() != 1 {
+		t.Fatal("expected only 0 left")
+	}
+}
+
 var hdrSerialized = []byte{
 	0x00, 0x00, 0x00, 0x20, 0x06, 0x22, 0x6e, 0x46, 0x11, 0x1a, 0x0b, 0x59, 0xca, 0xaf, 0x12, 0x60,
 	0x43, 0xeb, 0x5b, 0xbf, 0x28, 0xc3, 0x4f, 0x3a, 0x5e, 0x33, 0x2a, 0x1f, 0xc7, 0xb2, 0xb7, 0x3c,
@@ -368,16 +396,7 @@ var hdrSerialized = []byte{
 }
 
 func TestDeserializeHeader(t *testing.T) {
-	h := headers{
-		headerSize:        BTC_HEADER_SIZE,
-		headerDeserialzer: btcDeserializer,
-		hdrFilePath:       "<no file>",
-		startPoint:        0, // regtest
-		hdrs:              make(map[int64]*BlockHeader),
-		blkHdrs:           make(map[WireHash]int64),
-		synced:            false,
-	}
-	h.tip.Store(0)
+	h := newTestHeaders(t, 0) // regtest
 
 	r := bytes.NewBuffer(hdrSerialized)
 	blkHdr, err := h.headerDeserialzer.Deserialize(r)
@@ -385,7 +404,13 @@ func TestDeserializeHeader(t *testing.T) {
 		log.Fatal(err)
 	}
 	h.tip.Store(-1)
-	h.storeOneHdr(blkHdr) // {tip++}
+	err = h.storeOneHdr(hdrSerialized) // {tip++}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if h.getTip() != 0 || h.getTipHash() != blkHdr.Hash {
+		t.Fatal("stored header not at tip")
+	}
 	h.dumpAll()
 }
 
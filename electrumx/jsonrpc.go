@@ -30,8 +30,8 @@ type RPCError struct {
 // unsupported" for some requests on both mainnet and testnet.
 func (e *RPCError) UnmarshalJSON(b []byte) error {
 	type maybeRPCErr struct {
-		I int
-		S string
+		I int    `json:"code"`
+		S string `json:"message"`
 	}
 	var good maybeRPCErr
 	err := json.Unmarshal(b, &good)
@@ -95,3 +95,34 @@ func prepareRequest(id uint64, method string, args any) ([]byte, error) {
 	}
 	return json.Marshal(req)
 }
+
+// Max calls in one JSON-RPC batch request. Larger batches are split up so that
+// one response is not too big for ElectrumX's max_send or our session cost.
+const maxBatchSize = 50
+
+// batchCall is one call of a JSON-RPC batch request. After the batch request
+// returns err holds any error for this call only and result is filled in if
+// there is no error.
+type batchCall struct {
+	method string
+	args   any
+	result any
+	err    error
+}
+
+// prepareBatchRequest marshals calls with ids into a JSON-RPC batch; a json
+// array of requests.
+func prepareBatchRequest(ids []uint64, calls []*batchCall) ([]byte, error) {
+	if len(ids) != len(calls) {
+		return nil, errors.New("batch ids and calls length mismatch")
+	}
+	reqs := make([]json.RawMessage, 0, len(calls))
+	for i, call := range calls {
+		req, err := prepareRequest(ids[i], call.method, call.args)
+		if err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, req)
+	}
+	return json.Marshal(reqs)
+}
@@ -0,0 +1,91 @@
+package electrumx
+
+// SPV merkle proof verification of wallet transactions.
+//
+// An ElectrumX server tells us the height at which a transaction was mined but
+// we cannot take its word for it. For each confirmed transaction we ask for the
+// merkle branch with 'blockchain.transaction.get_merkle' and hash our way up
+// from the txid to a merkle root. The root must equal the merkle root of the
+// block header at that height in our own verified headers store.
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// ErrMerkleProofFailed is returned when a server's merkle branch for a tx does
+// not hash to the merkle root stored in our block header at that height.
+var ErrMerkleProofFailed = errors.New("merkle proof failed")
+
+// ErrMerkleProofNoHeader is returned when we do not (yet) have a block header
+// at the height claimed for a tx. The caller may try again on the next tip
+// change.
+var ErrMerkleProofNoHeader = errors.New("no block header stored for merkle proof height")
+
+// hexToWireHash decodes a hex txid or merkle branch hash as displayed (byte
+// reversed) into internal byte order.
+func hexToWireHash(hexHash string) (WireHash, error) {
+	var wh WireHash
+	b, err := hex.DecodeString(hexHash)
+	if err != nil {
+		return wh, err
+	}
+	if len(b) != HashSize {
+		return wh, fmt.Errorf("invalid hash length %d", len(b))
+	}
+	copy(wh[:], b)
+	return reverseHash(wh), nil
+}
+
+// merkleRootFromBranch calculates the merkle root from a txid, the merkle branch
+// and the tx position in the block. Per electrum; at each level if the bit for
+// that level is set in pos the branch hash is on the left.
+func merkleRootFromBranch(txid string, branch []string, pos int) (WireHash, error) {
+	h, err := hexToWireHash(txid)
+	if err != nil {
+		return WireHash{}, err
+	}
+	if pos < 0 || pos>>len(branch) != 0 {
+		return WireHash{}, fmt.Errorf("tx position %d too large for branch length %d", pos, len(branch))
+	}
+	var buf [2 * HashSize]byte
+	for i, item := range branch {
+		itemHash, err := hexToWireHash(item)
+		if err != nil {
+			return WireHash{}, err
+		}
+		if (pos>>i)&1 == 1 {
+			copy(buf[:HashSize], itemHash[:])
+			copy(buf[HashSize:], h[:])
+		} else {
+			copy(buf[:HashSize], h[:])
+			copy(buf[HashSize:], itemHash[:])
+		}
+		h = WireHash(chainhash.DoubleHashH(buf[:]))
+	}
+	return h, nil
+}
+
+// verifyMerkle checks a server merkle result for txid claimed to be mined at
+// height against the merkle root of our stored header at that height.
+func (h *headers) verifyMerkle(txid string, height int64, res *GetMerkleResult) error {
+	if res.BlockHeight != height {
+		return fmt.Errorf("%w: server returned proof for height %d, wanted %d",
+			ErrMerkleProofFailed, res.BlockHeight, height)
+	}
+	merkleRoot, ok := h.getMerkleRoot(height)
+	if !ok {
+		return ErrMerkleProofNoHeader
+	}
+	calculated, err := merkleRootFromBranch(txid, res.Merkle, res.Pos)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMerkleProofFailed, err)
+	}
+	if calculated != merkleRoot {
+		return fmt.Errorf("%w: tx %s at height %d", ErrMerkleProofFailed, txid, height)
+	}
+	return nil
+}
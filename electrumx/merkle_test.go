@@ -0,0 +1,116 @@
+package electrumx
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// build a bitcoin merkle tree from txids (internal byte order) and return the
+// root plus the electrum style branch for the tx at pos.
+func mkMerkleBranch(txids []chainhash.Hash, pos int) (WireHash, []string) {
+	var branch []string
+	level := append([]chainhash.Hash{}, txids...)
+	idx := pos
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		branch = append(branch, level[idx^1].String())
+		next := make([]chainhash.Hash, 0, len(level)/2)
+		for i := 0; i < len(level); i += 2 {
+			var buf [2 * HashSize]byte
+			copy(buf[:HashSize], level[i][:])
+			copy(buf[HashSize:], level[i+1][:])
+			next = append(next, chainhash.DoubleHashH(buf[:]))
+		}
+		level = next
+		idx >>= 1
+	}
+	return WireHash(level[0]), branch
+}
+
+func mkTxids(n int) []chainhash.Hash {
+	txids := make([]chainhash.Hash, n)
+	for i := range txids {
+		txids[i] = chainhash.DoubleHashH([]byte{byte(i), 0xee})
+	}
+	return txids
+}
+
+func TestMerkleRootFromBranch(t *testing.T) {
+	for _, numTxs := range []int{1, 2, 3, 5, 8, 11} {
+		txids := mkTxids(numTxs)
+		for pos := 0; pos < numTxs; pos++ {
+			root, branch := mkMerkleBranch(txids, pos)
+			got, err := merkleRootFromBranch(txids[pos].String(), branch, pos)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != root {
+				t.Fatalf("bad root for %d txs at pos %d", numTxs, pos)
+			}
+			// wrong position must not verify unless the sibling is a duplicate
+			if pos^1 < numTxs {
+				bad, _ := merkleRootFromBranch(txids[pos].String(), branch, pos^1)
+				if bad == root {
+					t.Fatalf("wrong position verified for %d txs at pos %d", numTxs, pos)
+				}
+			}
+		}
+	}
+	// position does not fit in the branch
+	txids := mkTxids(4)
+	_, branch := mkMerkleBranch(txids, 0)
+	_, err := merkleRootFromBranch(txids[0].String(), branch, 4)
+	if err == nil {
+		t.Fatal("expected error for position past the branch")
+	}
+	_, err = merkleRootFromBranch("zz", branch, 0)
+	if err == nil {
+		t.Fatal("expected error for bad txid hex")
+	}
+}
+
+func TestHeadersVerifyMerkle(t *testing.T) {
+	txids := mkTxids(7)
+	root, branch := mkMerkleBranch(txids, 5)
+
+	h := newTestHeaders(t, 100)
+	var b bytes.Buffer
+	wireHdr := wire.BlockHeader{MerkleRoot: chainhash.Hash(root)}
+	if err := wireHdr.Serialize(&b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.appendHeadersFile(b.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	h.setTip(100)
+
+	txid := txids[5].String()
+	res := &GetMerkleResult{Merkle: branch, BlockHeight: 100, Pos: 5}
+	if err := h.verifyMerkle(txid, 100, res); err != nil {
+		t.Fatal(err)
+	}
+
+	// server claims another height
+	res.BlockHeight = 99
+	if err := h.verifyMerkle(txid, 100, res); !errors.Is(err, ErrMerkleProofFailed) {
+		t.Fatalf("expected ErrMerkleProofFailed got %v", err)
+	}
+
+	// wrong tx for the branch
+	res.BlockHeight = 100
+	if err := h.verifyMerkle(txids[4].String(), 100, res); !errors.Is(err, ErrMerkleProofFailed) {
+		t.Fatalf("expected ErrMerkleProofFailed got %v", err)
+	}
+
+	// above our tip
+	res.BlockHeight = 101
+	if err := h.verifyMerkle(txid, 101, res); !errors.Is(err, ErrMerkleProofNoHeader) {
+		t.Fatalf("expected ErrMerkleProofNoHeader got %v", err)
+	}
+}
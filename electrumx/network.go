@@ -43,6 +43,9 @@ var errServerCanceled = errors.New("Server Canceled")
 // misbehaving node server was the cancel cause
 var errNodeMisbehavingCanceled = errors.New("Server Misbehaving Canceled")
 
+// session cost near the server's limit was the cancel cause
+var errSessionCostCanceled = errors.New("Session Cost Canceled")
+
 var errNoNetwork = errors.New("network not started")
 var errNoLeader = errors.New("no leader node is assigned - try again in 10 seconds")
 
@@ -56,6 +59,9 @@ type peerNode struct {
 	node       *Node
 	nodeCtx    context.Context
 	nodeCancel context.CancelCauseFunc
+	// for the server's reputation
+	started         time.Time
+	sessionRecorded bool
 }
 
 func newPeerNodeWithId(
@@ -75,6 +81,7 @@ func newPeerNodeWithId(
 		node:       node,
 		nodeCtx:    nodeCtx,
 		nodeCancel: nodeCancel,
+		started:    time.Now(),
 	}
 	atomic.AddUint32(&peerId, 1)
 	return pn
@@ -89,12 +96,27 @@ type Network struct {
 	peersMtx        sync.RWMutex
 	knownServers    []*serverAddr
 	knownServersMtx sync.Mutex
-	proxyAddr       string // socks5
-	onlineOnions    int
-	headers         *headers
+	// reputation changes not yet saved to the servers file
+	knownServersDirty bool
+	proxyAddr         string // socks5
+	headers           *headers
+	certs             *certStore
 	// static channels to client for the lifetime of the main goele context
 	clientTipChangeNotify  chan int64
 	clientScripthashNotify chan *ScripthashStatusResult
+	clientReorgNotify      chan *ReorgEvent
+	// scripthash notifications from the leader node before forwarding
+	nodeScripthashNotify chan *ScripthashStatusResult
+	// subscribed scripthashes => last known status
+	subscriptions    map[string]string
+	subscriptionsMtx sync.Mutex
+	// leader connection state changes to client
+	clientConnectionStatus chan *ConnectionStatus
+	// wakes the reconnection supervisor
+	reconnectTrigger chan struct{}
+	// network status changes to client
+	clientNetworkEvents chan *NetworkEvent
+	lastStatus          *NetworkStatus
 }
 
 func NewNetwork(config *ElectrumXConfig) *Network {
@@ -110,10 +132,16 @@ func NewNetwork(config *ElectrumXConfig) *Network {
 		peers:                  make([]*peerNode, 0, 10),
 		knownServers:           make([]*serverAddr, 0, 30),
 		proxyAddr:              proxyAddr,
-		onlineOnions:           0,
 		headers:                h,
+		certs:                  newCertStore(config.DataDir),
 		clientTipChangeNotify:  make(chan int64), // unbuffered
 		clientScripthashNotify: make(chan *ScripthashStatusResult),
+		clientReorgNotify:      make(chan *ReorgEvent),
+		nodeScripthashNotify:   make(chan *ScripthashStatusResult),
+		subscriptions:          make(map[string]string),
+		clientConnectionStatus: make(chan *ConnectionStatus, 16),
+		reconnectTrigger:       make(chan struct{}, 1),
+		clientNetworkEvents:    make(chan *NetworkEvent, 16),
 	}
 	return network
 }
@@ -130,6 +158,18 @@ func (net *Network) GetScripthashNotify() <-chan *ScripthashStatusResult {
 	return net.clientScripthashNotify
 }
 
+// GetReorgNotify returns a channel to client to receive reorg notifications
+// when the current leader node rewinds our headers
+func (net *Network) GetReorgNotify() <-chan *ReorgEvent {
+	return net.clientReorgNotify
+}
+
+// GetConnectionStatusNotify returns a channel to client to receive changes in
+// the connection to a leader node. Statuses are dropped if not read.
+func (net *Network) GetConnectionStatusNotify() <-chan *ConnectionStatus {
+	return net.clientConnectionStatus
+}
+
 func (net *Network) Start(ctx context.Context) error {
 	_, err := net.loadKnownServers()
 	if err != nil {
@@ -139,17 +179,31 @@ func (net *Network) Start(ctx context.Context) error {
 		// TODO: start a stored server if no trusted peer
 		return errors.New("a trusted peer is required in config")
 	}
+	err = checkTrustedPeerPin(net.config)
+	if err != nil {
+		return err
+	}
+	err = checkStartPoint(net.config)
+	if err != nil {
+		return err
+	}
 	serverAddress := net.config.TrustedPeer
 	net.startMtx.Lock()
 	defer net.startMtx.Unlock()
 	if net.started {
 		return errors.New("network already started")
 	}
+	err = net.checkTor(ctx)
+	if err != nil {
+		return err
+	}
 	return net.start(ctx, serverAddress)
 }
 
 // start starts the network with one leader peer - locked under startMtx
 func (net *Network) start(ctx context.Context, startServer *NodeServerAddr) error {
+	// pass leader scripthash notifications on to the client
+	go net.forwardScripthashNotify(ctx)
 	// start from our trusted node as leader
 	err := net.startNewPeer(ctx, startServer, true, true)
 	if err != nil {
@@ -157,6 +211,9 @@ func (net *Network) start(ctx context.Context, startServer *NodeServerAddr) erro
 	}
 	// leader up and headers synced
 	net.started = true
+	net.sendConnectionStatus(&ConnectionStatus{State: ConnectionUp, Server: startServer.String()})
+	// reconnect to the trusted peer if all else fails
+	go net.reconnectSupervisor(ctx)
 	// ask leader for it's own current known peers
 	net.getServerPeers(ctx)
 	// bootstrap peers loop with leader's connection
@@ -171,9 +228,9 @@ func (net *Network) startNewPeer(
 	isLeader,
 	isTrusted bool) error {
 
-	proxy := ""
-	if netAddr.IsOnion() {
-		proxy = net.proxyAddr
+	proxy, err := net.proxyFor(netAddr)
+	if err != nil {
+		return err
 	}
 
 	node, err := newNode(
@@ -182,10 +239,20 @@ func (net *Network) startNewPeer(
 		isLeader,
 		net.headers,
 		net.clientTipChangeNotify,
-		net.clientScripthashNotify)
+		net.nodeScripthashNotify,
+		net.clientReorgNotify)
 	if err != nil {
 		return err
 	}
+	net.pinCertificate(node, isTrusted)
+	if net.config.Transport != nil {
+		node.connectOpts.Transport = net.config.Transport
+	}
+	node.connectOpts.RecordDir = net.config.RecordDir
+	if proxy != "" {
+		node.connectOpts.TorIsolation = net.isolationFor(netAddr)
+		node.isolateRequests = net.config.TorIsolateRequests
+	}
 	network := net.config.Coin
 	nettype := net.config.NetType
 	genesis := net.config.Genesis
@@ -197,6 +264,7 @@ func (net *Network) startNewPeer(
 		nodeCancel(errNetworkCanceled)
 		return err
 	}
+	net.recordConnect(netAddr.String())
 	// node is up, add to peerNodes if not leader
 	peer := newPeerNodeWithId(isLeader, isTrusted, netAddr, node, nodeCtx, nodeCancel)
 	if isLeader {
@@ -259,11 +327,19 @@ func (net *Network) peersMonitor(ctx context.Context) {
 			for _, peer := range net.peers {
 				peer.nodeCancel(errNetworkCanceled)
 			}
+			net.headers.closeHeadersFile()
+			net.saveKnownServers()
 			return
 		case <-t.C:
+			net.rotateCostlyNodes()
 			net.checkLeader(ctx)
 			net.reapDeadPeers()
 			net.startNewPeerMaybe(ctx)
+			if net.quorumEnabled() {
+				net.checkTipQuorum(ctx)
+			}
+			net.publishStatusEvents()
+			net.saveKnownServers()
 		}
 	}
 }
@@ -279,8 +355,23 @@ func (net *Network) checkLeader(ctx context.Context) {
 			return
 		}
 	}
+	// the old leader's subscriptions died with it
+	defer func() {
+		newLeader := net.getLeader()
+		if newLeader != nil && newLeader != leader {
+			go net.resubscribe(ctx, newLeader)
+		}
+	}()
 
 	// we need a new leader
+	if leader != nil && !leader.sessionRecorded {
+		net.sendConnectionStatus(&ConnectionStatus{
+			State:  ConnectionDown,
+			Server: leader.netAddr.String(),
+			Err:    context.Cause(leader.nodeCtx),
+		})
+		net.recordSession(leader)
+	}
 
 	// any running peers we can promote?
 	numPeers := net.getNumPeers()
@@ -297,11 +388,17 @@ func (net *Network) checkLeader(ctx context.Context) {
 			}
 			net.leader = peer
 			fmt.Printf("promoted and started new leader %s\n", peer.netAddr)
+			net.sendConnectionStatus(&ConnectionStatus{State: ConnectionUp, Server: peer.netAddr.String()})
 			return
 		}
 	}
 	// no available running peers so make new leader
 	net.startNewLeader(ctx)
+	newLeader := net.getLeader()
+	if newLeader == nil || newLeader.nodeCtx.Err() != nil {
+		// no known server either - keep trying the trusted peer
+		net.needReconnect()
+	}
 }
 
 func (net *Network) reapDeadPeers() {
@@ -315,6 +412,7 @@ func (net *Network) reapDeadPeers() {
 		}
 	}
 	for _, peer := range peersToRemove {
+		net.recordSession(peer)
 		net.removePeer(peer)
 	}
 }
@@ -334,11 +432,11 @@ func (net *Network) startNewPeerMaybe(ctx context.Context) {
 	if len(available) == 0 {
 		return
 	}
-	// start one new peer .. from the pseudo-randomized list
+	// start one new peer .. from the reputation weighted list
 	addr := toNetAddr(available[0])
 	err := net.startNewPeer(ctx, addr, false, false) // dialerCtx time limited to 10s
 	if err != nil {
-		net.removeServer(available[0])
+		net.recordConnectFailure(available[0], err)
 	}
 	net.shufflePeers()
 	fmt.Printf("online peers: %d\n\n", net.getNumPeers())
@@ -355,12 +453,17 @@ func toNetAddr(saddr *serverAddr) *NodeServerAddr {
 // build a pseudo randomized list of known servers that have not yet been started
 func (net *Network) availableServers(forLeader bool) []*serverAddr {
 	var available = make([]*serverAddr, 0)
-	servers := net.knownServers
+	now := time.Now()
+	net.knownServersMtx.Lock()
+	servers := make([]*serverAddr, len(net.knownServers))
+	copy(servers, net.knownServers)
+	net.knownServersMtx.Unlock()
 	for _, server := range servers {
-		if server.IsOnion {
-			if forLeader || net.proxyAddr == "" {
-				continue
-			}
+		if server.isBanned(now) {
+			continue
+		}
+		if !net.usableServer(server, forLeader) {
+			continue
 		}
 		matchedAnyNetAddr := false
 		for _, peer := range net.peers {
@@ -377,10 +480,12 @@ func (net *Network) availableServers(forLeader bool) []*serverAddr {
 			available = append(available, server)
 		}
 	}
-	// pseudo randomize the list order
-	shuffleAvailableKnownServers(available)
-
-	return available
+	// randomize the list order weighted by reputation
+	ordered := weightedOrder(available)
+	if net.config.TorPolicy == PreferTor {
+		ordered = onionsFirst(ordered)
+	}
+	return ordered
 }
 
 func (net *Network) startNewLeader(ctx context.Context) {
@@ -392,15 +497,15 @@ func (net *Network) startNewLeader(ctx context.Context) {
 	if len(available) == 0 {
 		return
 	}
-	// TODO: filter servers again by reputation, capabilities and banlist
-
 	// start one node up as new leader
 	addr := toNetAddr(available[0])
 	err := net.startNewPeer(ctx, addr, true, false) // dialerCtx time limited to 10s
 	if err != nil {
-		net.removeServer(available[0])
+		net.recordConnectFailure(available[0], err)
+		return
 	}
 	fmt.Printf("started new leader %s\n", addr.String())
+	net.sendConnectionStatus(&ConnectionStatus{State: ConnectionUp, Server: addr.String()})
 }
 
 func (net *Network) shufflePeers() {
@@ -410,13 +515,6 @@ func (net *Network) shufflePeers() {
 	}
 }
 
-func shuffleAvailableKnownServers(available []*serverAddr) {
-	numServers := len(available)
-	if numServers > 1 {
-		rand.ShuffleSlice(available)
-	}
-}
-
 //-----------------------------------------------------------------------------
 // API Local headers
 //-----------------------------------------------------------------------------
@@ -463,7 +561,34 @@ func (net *Network) SubscribeScripthashNotify(ctx context.Context, scripthash st
 	if leader == nil {
 		return nil, errNoLeader
 	}
-	return leader.node.subscribeScripthashNotify(ctx, scripthash)
+	res, err := leader.node.subscribeScripthashNotify(ctx, scripthash)
+	if err != nil {
+		return nil, err
+	}
+	net.trackSubscription(scripthash, res.Status)
+	return res, nil
+}
+
+func (net *Network) SubscribeScripthashNotifyBatch(ctx context.Context, scripthashes []string) ([]*ScripthashStatusBatchResult, error) {
+	if !net.started {
+		return nil, errNoNetwork
+	}
+	net.peersMtx.Lock()
+	defer net.peersMtx.Unlock()
+	leader := net.getLeader()
+	if leader == nil {
+		return nil, errNoLeader
+	}
+	results, err := leader.node.subscribeScripthashNotifyBatch(ctx, scripthashes)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		if r.Err == nil {
+			net.trackSubscription(r.Scripthash, r.Status)
+		}
+	}
+	return results, nil
 }
 
 func (net *Network) UnsubscribeScripthashNotify(ctx context.Context, scripthash string) {
@@ -476,6 +601,7 @@ func (net *Network) UnsubscribeScripthashNotify(ctx context.Context, scripthash
 	if leader == nil {
 		return
 	}
+	net.untrackSubscription(scripthash)
 	leader.node.unsubscribeScripthashNotify(ctx, scripthash)
 }
 
@@ -483,6 +609,9 @@ func (net *Network) GetHistory(ctx context.Context, scripthash string) (HistoryR
 	if !net.started {
 		return nil, errNoNetwork
 	}
+	if net.quorumEnabled() {
+		return net.quorumGetHistory(ctx, scripthash)
+	}
 	net.peersMtx.Lock()
 	defer net.peersMtx.Unlock()
 	leader := net.getLeader()
@@ -492,10 +621,35 @@ func (net *Network) GetHistory(ctx context.Context, scripthash string) (HistoryR
 	return leader.node.getHistory(ctx, scripthash)
 }
 
+func (net *Network) GetHistoryBatch(ctx context.Context, scripthashes []string) ([]*HistoryBatchResult, error) {
+	if !net.started {
+		return nil, errNoNetwork
+	}
+	if net.quorumEnabled() {
+		return net.quorumGetHistoryBatch(ctx, scripthashes)
+	}
+	results := make([]*HistoryBatchResult, len(scripthashes))
+	err := net.spreadBatch(len(scripthashes), func(node *Node, start, end int) error {
+		chunk, err := node.getHistoryBatch(ctx, scripthashes[start:end])
+		if err != nil {
+			return err
+		}
+		copy(results[start:end], chunk)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
 func (net *Network) GetListUnspent(ctx context.Context, scripthash string) (ListUnspentResult, error) {
 	if !net.started {
 		return nil, errNoNetwork
 	}
+	if net.quorumEnabled() {
+		return net.quorumGetListUnspent(ctx, scripthash)
+	}
 	net.peersMtx.Lock()
 	defer net.peersMtx.Unlock()
 	leader := net.getLeader()
@@ -505,6 +659,28 @@ func (net *Network) GetListUnspent(ctx context.Context, scripthash string) (List
 	return leader.node.getListUnspent(ctx, scripthash)
 }
 
+func (net *Network) GetListUnspentBatch(ctx context.Context, scripthashes []string) ([]*ListUnspentBatchResult, error) {
+	if !net.started {
+		return nil, errNoNetwork
+	}
+	if net.quorumEnabled() {
+		return net.quorumGetListUnspentBatch(ctx, scripthashes)
+	}
+	results := make([]*ListUnspentBatchResult, len(scripthashes))
+	err := net.spreadBatch(len(scripthashes), func(node *Node, start, end int) error {
+		chunk, err := node.getListUnspentBatch(ctx, scripthashes[start:end])
+		if err != nil {
+			return err
+		}
+		copy(results[start:end], chunk)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
 func (net *Network) GetTransaction(ctx context.Context, txid string) (*GetTransactionResult, error) {
 	if !net.started {
 		return nil, errNoNetwork
@@ -531,6 +707,103 @@ func (net *Network) GetRawTransaction(ctx context.Context, txid string) (string,
 	return leader.node.getRawTransaction(ctx, txid)
 }
 
+func (net *Network) GetRawTransactionBatch(ctx context.Context, txids []string) ([]*RawTransactionBatchResult, error) {
+	if !net.started {
+		return nil, errNoNetwork
+	}
+	if net.quorumEnabled() {
+		return net.quorumGetRawTransactionBatch(ctx, txids)
+	}
+	results := make([]*RawTransactionBatchResult, len(txids))
+	err := net.spreadBatch(len(txids), func(node *Node, start, end int) error {
+		chunk, err := node.getRawTransactionBatch(ctx, txids[start:end])
+		if err != nil {
+			return err
+		}
+		copy(results[start:end], chunk)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// VerifyMerkleProof gets the merkle branch for a tx from the leader and checks
+// it against our stored header at height. A server that sends a proof that
+// does not verify is considered misbehaving and is cancelled so that we fail
+// over to another server.
+func (net *Network) VerifyMerkleProof(ctx context.Context, txid string, height int64) error {
+	if !net.started {
+		return errNoNetwork
+	}
+	if height <= 0 {
+		return errors.New("cannot verify an unconfirmed tx")
+	}
+	if height > net.headers.getTip() {
+		return ErrMerkleProofNoHeader
+	}
+	net.peersMtx.Lock()
+	defer net.peersMtx.Unlock()
+	leader := net.getLeader()
+	if leader == nil {
+		return errNoLeader
+	}
+	res, err := leader.node.getMerkle(ctx, txid, height)
+	if err != nil {
+		return err
+	}
+	err = net.headers.verifyMerkle(txid, height, res)
+	if errors.Is(err, ErrMerkleProofFailed) {
+		fmt.Printf("leader %s sent a bad merkle proof - %v\n", leader.netAddr, err)
+		leader.node.session.bumpCostError()
+		leader.nodeCancel(errNodeMisbehavingCanceled)
+	}
+	return err
+}
+
+// ReportStatusMismatch flags the leader for sending a scripthash status that
+// does not match the history it sent. A leader that does it too often is
+// canceled as misbehaving and another server takes over.
+func (net *Network) ReportStatusMismatch(scripthash string) {
+	if !net.started {
+		return
+	}
+	net.peersMtx.Lock()
+	defer net.peersMtx.Unlock()
+	leader := net.getLeader()
+	if leader == nil {
+		return
+	}
+	if leader.node.flagStatusMismatch(scripthash) {
+		leader.node.session.bumpCostError()
+		leader.nodeCancel(errNodeMisbehavingCanceled)
+	}
+}
+
+// ReportBadTx flags the server which sent a raw tx that does not hash to the
+// txid asked for. The server is canceled as misbehaving.
+func (net *Network) ReportBadTx(server, txid string) {
+	if !net.started {
+		return
+	}
+	net.peersMtx.Lock()
+	defer net.peersMtx.Unlock()
+	// the first leader is not one of the peers
+	peers := net.peers
+	if leader := net.getLeader(); leader != nil {
+		peers = append([]*peerNode{leader}, peers...)
+	}
+	for _, peer := range peers {
+		if peer.node.serverAddr != server || peer.nodeCtx.Err() != nil {
+			continue
+		}
+		fmt.Printf("server %s sent a tx which is not %s\n", server, txid)
+		peer.node.session.bumpCostError()
+		peer.nodeCancel(errNodeMisbehavingCanceled)
+	}
+}
+
 func (net *Network) Broadcast(ctx context.Context, rawTx string) (string, error) {
 	if !net.started {
 		return "", errNoNetwork
@@ -541,9 +814,40 @@ func (net *Network) Broadcast(ctx context.Context, rawTx string) (string, error)
 	if leader == nil {
 		return "", errNoLeader
 	}
+	if net.config.BroadcastPeers > 0 {
+		return net.fanoutBroadcast(ctx, leader, rawTx)
+	}
 	return leader.node.broadcast(ctx, rawTx)
 }
 
+func (net *Network) BroadcastPackage(ctx context.Context, rawTxs []string) (*BroadcastPackageResult, error) {
+	if !net.started {
+		return nil, errNoNetwork
+	}
+	net.peersMtx.Lock()
+	defer net.peersMtx.Unlock()
+	leader := net.getLeader()
+	if leader == nil {
+		return nil, errNoLeader
+	}
+	return leader.node.broadcastPackage(ctx, rawTxs)
+}
+
+// Supports returns true if the leader's server supports the optional method
+// at its negotiated protocol version.
+func (net *Network) Supports(method string) bool {
+	if !net.started {
+		return false
+	}
+	net.peersMtx.Lock()
+	defer net.peersMtx.Unlock()
+	leader := net.getLeader()
+	if leader == nil {
+		return false
+	}
+	return leader.node.Supports(method)
+}
+
 func (net *Network) EstimateFeeRate(ctx context.Context, confTarget int64) (int64, error) {
 	if !net.started {
 		return 0, errNoNetwork
@@ -556,3 +860,55 @@ func (net *Network) EstimateFeeRate(ctx context.Context, confTarget int64) (int6
 	}
 	return leader.node.estimateFeeRate(ctx, confTarget)
 }
+
+func (net *Network) GetMempool(ctx context.Context, scripthash string) (MempoolResult, error) {
+	if !net.started {
+		return nil, errNoNetwork
+	}
+	net.peersMtx.Lock()
+	defer net.peersMtx.Unlock()
+	leader := net.getLeader()
+	if leader == nil {
+		return nil, errNoLeader
+	}
+	return leader.node.getMempool(ctx, scripthash)
+}
+
+func (net *Network) GetBalance(ctx context.Context, scripthash string) (*BalanceResult, error) {
+	if !net.started {
+		return nil, errNoNetwork
+	}
+	net.peersMtx.Lock()
+	defer net.peersMtx.Unlock()
+	leader := net.getLeader()
+	if leader == nil {
+		return nil, errNoLeader
+	}
+	return leader.node.getBalance(ctx, scripthash)
+}
+
+func (net *Network) GetFeeHistogram(ctx context.Context) (FeeHistogram, error) {
+	if !net.started {
+		return nil, errNoNetwork
+	}
+	net.peersMtx.Lock()
+	defer net.peersMtx.Unlock()
+	leader := net.getLeader()
+	if leader == nil {
+		return nil, errNoLeader
+	}
+	return leader.node.getFeeHistogram(ctx)
+}
+
+func (net *Network) GetRelayFee(ctx context.Context) (int64, error) {
+	if !net.started {
+		return 0, errNoNetwork
+	}
+	net.peersMtx.Lock()
+	defer net.peersMtx.Unlock()
+	leader := net.getLeader()
+	if leader == nil {
+		return 0, errNoLeader
+	}
+	return leader.node.relayFee(ctx)
+}
@@ -0,0 +1,74 @@
+package electrumx
+
+// Broadcast fan-out.
+//
+// With ElectrumXConfig.BroadcastPeers set a tx is broadcast through the leader
+// and up to that many other running peers at once so that it reaches more of
+// the coin network and is not lost if the leader drops mid-broadcast. The tx
+// is broadcast if any server accepted it or already has it, so a stale or
+// lagging leader's rejection only wins when no one did.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// IsServerRejection returns true if err is an error returned by a server, as
+// for a tx it will not accept, rather than a network or connection error.
+func IsServerRejection(err error) bool {
+	var rpcErr *RPCError
+	return errors.As(err, &rpcErr)
+}
+
+// broadcastPeers returns the leader and up to BroadcastPeers other running
+// peers - not locked
+func (net *Network) broadcastPeers(leader *peerNode) []*peerNode {
+	peers := []*peerNode{leader}
+	net.shufflePeers()
+	for _, peer := range net.peers {
+		if len(peers) > net.config.BroadcastPeers {
+			break
+		}
+		if peer == leader || peer.nodeCtx.Err() != nil || !peer.node.server.connected {
+			continue
+		}
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+// fanoutBroadcast broadcasts through the leader and other peers - not locked
+func (net *Network) fanoutBroadcast(ctx context.Context, leader *peerNode, rawTx string) (string, error) {
+	peers := net.broadcastPeers(leader)
+	txids := make([]string, len(peers))
+	errs := make([]error, len(peers))
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		wg.Add(1)
+		go func(i int, peer *peerNode) {
+			defer wg.Done()
+			txids[i], errs[i] = peer.node.broadcast(ctx, rawTx)
+		}(i, peer)
+	}
+	wg.Wait()
+
+	// peers[0] is the leader
+	for i := 1; i < len(peers); i++ {
+		if errs[i] != nil {
+			fmt.Printf("broadcast via %s failed: %v\n", peers[i].netAddr, errs[i])
+		}
+	}
+	for i := range peers {
+		if errs[i] == nil {
+			return txids[i], nil
+		}
+	}
+	for i := range peers {
+		if IsTxKnown(errs[i]) {
+			return "", errs[i]
+		}
+	}
+	return "", errs[0]
+}
@@ -0,0 +1,187 @@
+package electrumx
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dev-warrior777/go-electrum-client/electrumx/electrumxtest"
+)
+
+// mkBroadcastPeer makes a connected peer whose server answers every request
+// with result, or with the error reject if result is empty.
+func mkBroadcastPeer(t *testing.T, addr string, leader bool, result, reject string) *peerNode {
+	return mkScriptedPeer(t, addr, leader, func(req *request) string {
+		if result == "" {
+			return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"error":{"code":1,"message":"%s"}}`, req.ID, reject)
+		}
+		return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":"%s"}`, req.ID, result)
+	})
+}
+
+// mkScriptedPeer makes a connected peer whose server sends the response
+// answer returns for each request.
+func mkScriptedPeer(t *testing.T, addr string, leader bool, answer func(req *request) string) *peerNode {
+	client, server := net.Pipe()
+	t.Cleanup(func() { server.Close() })
+	go func() {
+		reader := bufio.NewReader(server)
+		for {
+			msg, err := reader.ReadBytes(newline)
+			if err != nil {
+				return
+			}
+			var req request
+			if err := json.Unmarshal(msg, &req); err != nil {
+				t.Errorf("server: bad request: %v", err)
+				return
+			}
+			if _, err := server.Write(append([]byte(answer(&req)), newline)); err != nil {
+				return
+			}
+		}
+	}()
+
+	peer := mkQuorumPeer(addr, leader)
+	t.Cleanup(func() { peer.nodeCancel(nil) })
+	sc := &serverConn{
+		conn:         client,
+		nodeCancel:   peer.nodeCancel,
+		done:         make(chan struct{}),
+		debug:        func(string, ...any) {},
+		respHandlers: make(map[uint64]chan *response),
+
+		scripthashNotify: make(chan *ScripthashStatusResult, 1),
+		headersNotify:    make(chan *headersNotifyResult, 1),
+	}
+	go sc.listen(peer.nodeCtx)
+	peer.node.server = &Server{conn: sc, connected: true}
+	return peer
+}
+
+func TestFanoutBroadcast(t *testing.T) {
+	ctx := context.Background()
+	const (
+		missing = "bad-txns-inputs-missingorspent"
+		known   = "txn-already-in-mempool"
+	)
+
+	// the leader dropped - a peer's txid is returned
+	leader := mkBroadcastPeer(t, "1.1.1.1:50001", true, "aa", "")
+	leader.node.server.connected = false
+	peer2 := mkBroadcastPeer(t, "2.2.2.2:50001", false, "aa", "")
+	peer3 := mkBroadcastPeer(t, "3.3.3.3:50001", false, "", missing)
+	net := &Network{
+		config: &ElectrumXConfig{BroadcastPeers: 2},
+		leader: leader,
+		peers:  []*peerNode{leader, peer2, peer3},
+	}
+	txid, err := net.fanoutBroadcast(ctx, leader, "00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txid != "aa" {
+		t.Fatalf("got txid %q, want aa", txid)
+	}
+
+	// the leader rejected the tx but a peer accepted it - the peer's txid is
+	// returned
+	leader = mkBroadcastPeer(t, "1.1.1.1:50001", true, "", missing)
+	net.leader = leader
+	net.peers = []*peerNode{leader, peer2, peer3}
+	txid, err = net.fanoutBroadcast(ctx, leader, "00")
+	if err != nil || txid != "aa" {
+		t.Fatalf("got txid %q, %v, want aa", txid, err)
+	}
+
+	// the leader rejected the tx and a peer already has it - the tx is known
+	peer4 := mkBroadcastPeer(t, "4.4.4.4:50001", false, "", known)
+	net.peers = []*peerNode{leader, peer3, peer4}
+	_, err = net.fanoutBroadcast(ctx, leader, "00")
+	if !IsTxKnown(err) {
+		t.Fatalf("expected the tx known, got %v", err)
+	}
+
+	// everyone rejected the tx - the leader's rejection is returned
+	net.peers = []*peerNode{leader, peer3}
+	_, err = net.fanoutBroadcast(ctx, leader, "00")
+	if !IsServerRejection(err) || !errors.Is(err, ErrTxMissingInputs) {
+		t.Fatalf("expected a server rejection, got %v", err)
+	}
+
+	// no one could take it - the leader's error is returned
+	leader = mkBroadcastPeer(t, "1.1.1.1:50001", true, "aa", "")
+	leader.node.server.connected = false
+	peer2.node.server.connected = false
+	net.leader = leader
+	net.peers = []*peerNode{leader, peer2}
+	_, err = net.fanoutBroadcast(ctx, leader, "00")
+	if err != ErrNotConnected {
+		t.Fatalf("expected ErrNotConnected, got %v", err)
+	}
+}
+
+func TestBroadcastPeers(t *testing.T) {
+	leader := mkQuorumPeer("1.1.1.1:50001", true)
+	net := &Network{
+		config: &ElectrumXConfig{BroadcastPeers: 1},
+		leader: leader,
+		peers:  []*peerNode{leader},
+	}
+	for i := 2; i <= 4; i++ {
+		p := mkQuorumPeer(fmt.Sprintf("%d.%d.%d.%d:50001", i, i, i, i), false)
+		p.node.server = &Server{connected: true}
+		net.peers = append(net.peers, p)
+	}
+	peers := net.broadcastPeers(leader)
+	if len(peers) != 2 {
+		t.Fatalf("got %d broadcast peers, want 2", len(peers))
+	}
+	if peers[0] != leader {
+		t.Fatal("expected the leader first")
+	}
+}
+
+func TestBroadcastPackageFakeServer(t *testing.T) {
+	s := mkFakeServerOpts(t, 10, &electrumxtest.Options{
+		TLS:         true,
+		ProtocolMax: "1.6",
+		Broadcast: func(rawTx string) (string, error) {
+			if rawTx == "bad" {
+				return "", errors.New("bad-txns-inputs-missingorspent")
+			}
+			return rawTx + "id", nil
+		},
+	})
+	net := mkFakeNetwork(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	if err := net.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !net.Supports(METHOD_BROADCAST_PACKAGE) {
+		t.Fatal("protocol 1.6 server does not support broadcast_package")
+	}
+
+	res, err := net.BroadcastPackage(ctx, []string{"parent", "child"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Success || len(res.Errors) != 0 {
+		t.Fatalf("package not accepted: %+v", res)
+	}
+
+	res, err = net.BroadcastPackage(ctx, []string{"parent", "bad"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Success || len(res.Errors) != 1 ||
+		!errors.Is(res.Errors[0].Reason(), ErrTxMissingInputs) {
+		t.Fatalf("package not rejected: %+v", res)
+	}
+}
@@ -0,0 +1,130 @@
+package electrumx
+
+// Session cost management across nodes.
+//
+// Public servers charge each session a cost for the work done for it and slow
+// down then disconnect sessions over their limits. Each node estimates its own
+// session cost - see node_session.go. Here we spread bulk batch work such as
+// wallet rescans over the running nodes, cheapest first, and rotate out nodes
+// which get near the hard limit before the server drops them.
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// bulkPeers returns the running nodes that can take bulk work ordered by
+// their session cost, cheapest first - not locked
+func (net *Network) bulkPeers() []*peerNode {
+	peers := make([]*peerNode, 0, len(net.peers)+1)
+	leader := net.getLeader()
+	if leader != nil && leader.nodeCtx.Err() == nil && leader.node.session != nil {
+		peers = append(peers, leader)
+	}
+	for _, peer := range net.peers {
+		if peer == leader || peer.nodeCtx.Err() != nil || !peer.node.server.connected {
+			continue
+		}
+		if peer.node.session == nil || peer.node.session.getCost() >= COST_SOFT_LIMIT {
+			// keep busy peers for failover
+			continue
+		}
+		peers = append(peers, peer)
+	}
+	sort.SliceStable(peers, func(i, j int) bool {
+		return peers[i].node.session.getCost() < peers[j].node.session.getCost()
+	})
+	return peers
+}
+
+// spreadBatch splits n items into chunks of maxBatchSize and hands them out to
+// the bulk peers in turn. call is made for the items [start, end) on a node.
+// A chunk which fails on a peer other than the leader is tried again on the
+// leader. The peers are locked only to choose them, not for the calls.
+func (net *Network) spreadBatch(n int, call func(node *Node, start, end int) error) error {
+	net.peersMtx.Lock()
+	leader := net.getLeader()
+	if leader == nil {
+		net.peersMtx.Unlock()
+		return errNoLeader
+	}
+	peers := net.bulkPeers()
+	net.peersMtx.Unlock()
+	if len(peers) <= 1 || n <= maxBatchSize {
+		return call(leader.node, 0, n)
+	}
+
+	var wg sync.WaitGroup
+	var errMtx sync.Mutex
+	var firstErr error
+	for i := 0; i*maxBatchSize < n; i++ {
+		start := i * maxBatchSize
+		end := start + maxBatchSize
+		if end > n {
+			end = n
+		}
+		peer := peers[i%len(peers)]
+		wg.Add(1)
+		go func(peer *peerNode, start, end int) {
+			defer wg.Done()
+			err := call(peer.node, start, end)
+			if err != nil && peer != leader {
+				err = call(leader.node, start, end)
+			}
+			if err != nil {
+				errMtx.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMtx.Unlock()
+			}
+		}(peer, start, end)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// rotateCostlyNodes cancels nodes whose session cost reached COST_ROTATE_LIMIT
+// so that new ones with fresh sessions take over. The leader is only rotated
+// if another running peer can be promoted.
+func (net *Network) rotateCostlyNodes() {
+	net.peersMtx.Lock()
+	defer net.peersMtx.Unlock()
+
+	costly := func(peer *peerNode) bool {
+		return peer.nodeCtx.Err() == nil && peer.node.session != nil &&
+			peer.node.session.getCost() >= COST_ROTATE_LIMIT
+	}
+
+	leader := net.getLeader()
+	for _, peer := range net.peers {
+		if peer == leader || !costly(peer) {
+			continue
+		}
+		net.rotate(peer)
+	}
+	if leader == nil || !costly(leader) {
+		return
+	}
+	for _, peer := range net.peers {
+		if peer != leader && peer.nodeCtx.Err() == nil {
+			net.rotate(leader)
+			return
+		}
+	}
+}
+
+// rotate cancels a node and rests its server - not locked
+func (net *Network) rotate(peer *peerNode) {
+	fmt.Printf("rotating node %s - session cost %.0f\n", peer.netAddr, peer.node.session.getCost())
+	peer.nodeCancel(errSessionCostCanceled)
+	until := time.Now().Add(COST_REST_PERIOD).Unix()
+	net.updateServer(peer.netAddr.String(), func(s *serverAddr) {
+		// not a ban, the ban backoff is unchanged
+		if s.stats().BannedUntil < until {
+			s.stats().BannedUntil = until
+		}
+	})
+}
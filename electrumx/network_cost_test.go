@@ -0,0 +1,114 @@
+package electrumx
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestRotateCostlyNodes(t *testing.T) {
+	net := &Network{
+		config: &ElectrumXConfig{DataDir: t.TempDir()},
+		knownServers: []*serverAddr{
+			{Net: "tcp", Address: "1.1.1.1:50001"},
+			{Net: "tcp", Address: "2.2.2.2:50001"},
+		},
+	}
+	if err := net.writeServerAddrFile(net.knownServers); err != nil {
+		t.Fatal(err)
+	}
+	leader := mkQuorumPeer("1.1.1.1:50001", true)
+	net.leader = leader
+	leader.node.session.bumpCost(COST_ROTATE_LIMIT)
+
+	// the only node is kept
+	net.rotateCostlyNodes()
+	if leader.nodeCtx.Err() != nil {
+		t.Fatal("rotated the only node")
+	}
+
+	peer := mkQuorumPeer("2.2.2.2:50001", false)
+	net.peers = []*peerNode{peer}
+	net.rotateCostlyNodes()
+	if !errors.Is(context.Cause(leader.nodeCtx), errSessionCostCanceled) {
+		t.Fatalf("leader cancel cause %v", context.Cause(leader.nodeCtx))
+	}
+	if peer.nodeCtx.Err() != nil {
+		t.Fatal("rotated a cheap peer")
+	}
+	rested := net.knownServers[0]
+	if !rested.isBanned(leader.started) || rested.Stats.Bans != 0 {
+		t.Fatalf("server not rested: %+v", rested.Stats)
+	}
+}
+
+func TestBulkPeers(t *testing.T) {
+	net := &Network{}
+	leader := mkQuorumPeer("1.1.1.1:50001", true)
+	cheap := mkQuorumPeer("2.2.2.2:50001", false)
+	busy := mkQuorumPeer("3.3.3.3:50001", false)
+	dead := mkQuorumPeer("4.4.4.4:50001", false)
+	for _, p := range []*peerNode{cheap, busy, dead} {
+		p.node.server = &Server{connected: true}
+	}
+	leader.node.session.bumpCost(100)
+	busy.node.session.bumpCost(COST_SOFT_LIMIT)
+	dead.nodeCancel(errServerCanceled)
+	net.leader = leader
+	net.peers = []*peerNode{busy, dead, cheap}
+
+	peers := net.bulkPeers()
+	if len(peers) != 2 || peers[0] != cheap || peers[1] != leader {
+		t.Fatalf("wrong bulk peers %v", peers)
+	}
+}
+
+func TestSpreadBatchUnlocked(t *testing.T) {
+	net := &Network{}
+	leader := mkQuorumPeer("1.1.1.1:50001", true)
+	peer := mkQuorumPeer("2.2.2.2:50001", false)
+	peer.node.server = &Server{connected: true}
+	net.leader = leader
+	net.peers = []*peerNode{peer}
+
+	var mtx sync.Mutex
+	calls := make(map[*Node]int)
+	err := net.spreadBatch(2*maxBatchSize, func(node *Node, start, end int) error {
+		// other requests can use the peers meanwhile
+		if !net.peersMtx.TryLock() {
+			return errors.New("peers locked during the call")
+		}
+		net.peersMtx.Unlock()
+		mtx.Lock()
+		calls[node]++
+		mtx.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls[leader.node] != 1 || calls[peer.node] != 1 {
+		t.Fatalf("calls %v", calls)
+	}
+}
+
+func TestReportBadTx(t *testing.T) {
+	net := &Network{started: true}
+	leader := mkQuorumPeer("1.1.1.1:50001", true)
+	peer := mkQuorumPeer("2.2.2.2:50001", false)
+	net.leader = leader
+	net.peers = []*peerNode{peer}
+
+	net.ReportBadTx("2.2.2.2:50001", "aa")
+	if !errors.Is(context.Cause(peer.nodeCtx), errNodeMisbehavingCanceled) {
+		t.Fatalf("peer cancel cause %v", context.Cause(peer.nodeCtx))
+	}
+	if leader.nodeCtx.Err() != nil {
+		t.Fatal("canceled the leader")
+	}
+	net.ReportBadTx("1.1.1.1:50001", "bb")
+	if !errors.Is(context.Cause(leader.nodeCtx), errNodeMisbehavingCanceled) {
+		t.Fatalf("leader cancel cause %v", context.Cause(leader.nodeCtx))
+	}
+}
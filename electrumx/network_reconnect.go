@@ -0,0 +1,168 @@
+package electrumx
+
+// Reconnection to the trusted peer.
+//
+// When the leader goes down checkLeader promotes a running peer or starts a
+// new leader from the known servers. On a network with no other servers, such
+// as regtest or with MaxOnlinePeers at 0, neither is possible so the
+// reconnection supervisor takes over. It tries the TrustedPeer again with an
+// exponential backoff and jitter until it is back. Starting it as leader
+// resyncs our headers from where we were and the subscriptions are restored
+// on it. Connection state changes are sent to the client on a status channel.
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/decred/dcrd/crypto/rand"
+)
+
+// Reconnection backoff: RECONNECT_BASE doubled for each failed attempt up to
+// RECONNECT_MAX with up to half of it taken off at random.
+const (
+	RECONNECT_BASE = 2 * time.Second
+	RECONNECT_MAX  = 5 * time.Minute
+)
+
+type ConnectionState int
+
+const (
+	ConnectionUp ConnectionState = iota
+	ConnectionDown
+	ConnectionReconnecting
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case ConnectionUp:
+		return "up"
+	case ConnectionDown:
+		return "down"
+	case ConnectionReconnecting:
+		return "reconnecting"
+	default:
+		return "unknown"
+	}
+}
+
+// ConnectionStatus is sent to the client when the network's connection to
+// a leader changes.
+type ConnectionStatus struct {
+	State ConnectionState
+	// the leader or the server we are trying to reconnect to
+	Server string
+	// reconnect attempts so far
+	Attempt int
+	// why we are down or the last attempt failed
+	Err error
+}
+
+// sendConnectionStatus sends status to the client if it is listening. Status
+// is dropped rather than block the network.
+func (net *Network) sendConnectionStatus(status *ConnectionStatus) {
+	select {
+	case net.clientConnectionStatus <- status:
+	default:
+	}
+}
+
+// reconnectBackoff is the wait before attempt number attempt, from 1.
+func reconnectBackoff(attempt int) time.Duration {
+	d := RECONNECT_BASE
+	for i := 1; i < attempt && d < RECONNECT_MAX; i++ {
+		d *= 2
+	}
+	if d > RECONNECT_MAX {
+		d = RECONNECT_MAX
+	}
+	half := int64(d / 2)
+	return time.Duration(half + rand.Int64N(half+1))
+}
+
+// needReconnect wakes the supervisor if it is not already reconnecting.
+func (net *Network) needReconnect() {
+	select {
+	case net.reconnectTrigger <- struct{}{}:
+	default:
+	}
+}
+
+// reconnectSupervisor reconnects to the trusted peer when woken - run as
+// goroutine
+func (net *Network) reconnectSupervisor(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-net.reconnectTrigger:
+			net.reconnect(ctx)
+		}
+	}
+}
+
+// reconnect tries the trusted peer until there is a running leader again.
+func (net *Network) reconnect(ctx context.Context) {
+	trusted := net.config.TrustedPeer
+	for attempt := 1; ; attempt++ {
+		if net.leaderRunning() {
+			return
+		}
+		wait := reconnectBackoff(attempt)
+		fmt.Printf("reconnecting to %s in %v - attempt %d\n", trusted, wait, attempt)
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		net.sendConnectionStatus(&ConnectionStatus{
+			State:   ConnectionReconnecting,
+			Server:  trusted.String(),
+			Attempt: attempt,
+		})
+		done, err := net.reconnectTrusted(ctx)
+		if done {
+			return
+		}
+		fmt.Printf("reconnect to %s failed: %v\n", trusted, err)
+		net.sendConnectionStatus(&ConnectionStatus{
+			State:   ConnectionDown,
+			Server:  trusted.String(),
+			Attempt: attempt,
+			Err:     err,
+		})
+	}
+}
+
+func (net *Network) leaderRunning() bool {
+	net.peersMtx.RLock()
+	defer net.peersMtx.RUnlock()
+	leader := net.getLeader()
+	return leader != nil && leader.nodeCtx.Err() == nil
+}
+
+// reconnectTrusted starts the trusted peer as leader unless a leader has come
+// up meanwhile. Returns true when there is a running leader.
+func (net *Network) reconnectTrusted(ctx context.Context) (bool, error) {
+	net.peersMtx.Lock()
+	defer net.peersMtx.Unlock()
+
+	leader := net.getLeader()
+	if leader != nil && leader.nodeCtx.Err() == nil {
+		return true, nil
+	}
+	err := net.startNewPeer(ctx, net.config.TrustedPeer, true, true)
+	if err != nil {
+		return false, err
+	}
+	newLeader := net.getLeader()
+	fmt.Printf("reconnected to trusted peer %s\n", newLeader.netAddr)
+	net.sendConnectionStatus(&ConnectionStatus{
+		State:  ConnectionUp,
+		Server: newLeader.netAddr.String(),
+	})
+	go net.resubscribe(ctx, newLeader)
+	return true, nil
+}
@@ -0,0 +1,56 @@
+package electrumx
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReconnectBackoff(t *testing.T) {
+	for attempt := 1; attempt < 20; attempt++ {
+		full := RECONNECT_BASE << (attempt - 1)
+		if attempt > 10 || full > RECONNECT_MAX {
+			full = RECONNECT_MAX
+		}
+		for i := 0; i < 10; i++ {
+			d := reconnectBackoff(attempt)
+			if d < full/2 || d > full {
+				t.Fatalf("attempt %d: backoff %v outside %v - %v", attempt, d, full/2, full)
+			}
+		}
+	}
+}
+
+func TestReconnectTrusted(t *testing.T) {
+	net := &Network{
+		config: &ElectrumXConfig{
+			DataDir:     t.TempDir(),
+			TrustedPeer: &NodeServerAddr{Net: "tcp", Addr: "127.0.0.1:1"},
+		},
+		clientConnectionStatus: make(chan *ConnectionStatus, 1),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// nothing listening
+	done, err := net.reconnectTrusted(ctx)
+	if done || err == nil {
+		t.Fatal("expected reconnect to fail")
+	}
+
+	// a leader came up meanwhile
+	net.leader = mkQuorumPeer("1.1.1.1:50001", true)
+	done, err = net.reconnectTrusted(ctx)
+	if !done || err != nil {
+		t.Fatalf("expected a running leader: %v", err)
+	}
+	net.reconnect(ctx) // returns at once
+
+	// statuses never block the network
+	net.sendConnectionStatus(&ConnectionStatus{State: ConnectionDown})
+	net.sendConnectionStatus(&ConnectionStatus{State: ConnectionUp})
+	status := <-net.clientConnectionStatus
+	if status.State != ConnectionDown {
+		t.Fatalf("got status %v", status.State)
+	}
+}
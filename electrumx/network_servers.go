@@ -23,7 +23,9 @@ type serverAddr struct {
 	IsOnion bool   `json:"is_onion"`
 	Version string `json:"version"`
 	Caps    string `json:"caps"` // comma separated string eg. "cannot_lead,no_blks,..."
-	Rep     int    `json:"rep"`  // reputation score - not fully implemented as yet
+	Rep     int    `json:"rep"`  // reputation score - see reputation.go
+	// how the server behaved over all our sessions with it
+	Stats *serverStats `json:"stats,omitempty"`
 }
 
 // Incoming list from server_connection.go - constructed using reflection
@@ -103,10 +105,14 @@ func makeIncomingServerAddrs(in []*peersResult) []*serverAddr {
 
 		var isTcp bool
 		var isSsl bool
+		var isWs bool
+		var isWss bool
 
 		var version string
 		var tcpPort string
 		var sslPort string
+		var wsPort string
+		var wssPort string
 		feats := pres.Feats
 		for _, feat := range feats {
 			switch []rune(feat)[0] {
@@ -118,6 +124,19 @@ func makeIncomingServerAddrs(in []*peersResult) []*serverAddr {
 			case 's':
 				sslPort = feat[1:]
 				isSsl = true
+			case 'w':
+				// 'w' or 'ws' for websocket and 'wss' for secure websocket
+				switch {
+				case strings.HasPrefix(feat, "wss"):
+					wssPort = feat[3:]
+					isWss = true
+				case strings.HasPrefix(feat, "ws"):
+					wsPort = feat[2:]
+					isWs = true
+				default:
+					wsPort = feat[1:]
+					isWs = true
+				}
 			}
 		}
 		if isTcp {
@@ -148,6 +167,34 @@ func makeIncomingServerAddrs(in []*peersResult) []*serverAddr {
 			}
 			servers = append(servers, saddr)
 		}
+		if isWs {
+			if len(wsPort) == 0 {
+				wsPort = "51003" // default if no explicit port after 'w'
+			}
+			saddr := &serverAddr{
+				Net:     "ws",
+				Address: net.JoinHostPort(pres.Addr, wsPort),
+				Host:    pres.Host,
+				IsOnion: isOnion,
+				Version: version,
+				Caps:    "",
+			}
+			servers = append(servers, saddr)
+		}
+		if isWss {
+			if len(wssPort) == 0 {
+				wssPort = "51004" // default if no explicit port after 'wss'
+			}
+			saddr := &serverAddr{
+				Net:     "wss",
+				Address: net.JoinHostPort(pres.Addr, wssPort),
+				Host:    pres.Host,
+				IsOnion: isOnion,
+				Version: version,
+				Caps:    "",
+			}
+			servers = append(servers, saddr)
+		}
 		goodAddresses++
 	}
 	return servers
@@ -205,6 +252,7 @@ func (net *Network) updateStoredServers(servers []*serverAddr) error {
 		}
 	}
 	stored = append(stored, tmpAdd...)
+	net.mergeKnownReputations(stored)
 	err = net.writeServerAddrFile(stored)
 	if err != nil {
 		return err
@@ -244,6 +292,7 @@ func (net *Network) removeServer(server *serverAddr) error {
 		}
 		lessStored = append(lessStored, got)
 	}
+	net.mergeKnownReputations(lessStored)
 
 	return net.writeServerAddrFile(lessStored)
 }
@@ -0,0 +1,229 @@
+package electrumx
+
+// Network status for the client.
+//
+// NetworkStatus is a snapshot of the leader, the running peers and our
+// headers for a UI or monitoring to show connection health. Each peers
+// monitor tick the snapshot is compared with the one before and any changes
+// are sent to the client as events.
+
+import (
+	"time"
+)
+
+// PeerStatus is the state of one running node.
+type PeerStatus struct {
+	Address         string
+	Leader          bool
+	Trusted         bool
+	Onion           bool
+	Connected       bool
+	SoftwareVersion string
+	ProtocolVersion string
+	// average request round trip this session
+	Latency time.Duration
+	// our estimate of the session cost the server charges us
+	SessionCost float32
+	Uptime      time.Duration
+}
+
+// HeaderStatus is the state of our block headers.
+type HeaderStatus struct {
+	// our tip as reported to the client
+	Tip int64
+	// headers stored so far while syncing - the tip once synced
+	SyncHeight int64
+	StartPoint int64
+	Synced     bool
+	// rewound after a reorg and waiting to catch up
+	Recovery    bool
+	RecoveryTip int64
+}
+
+// NetworkStatus is a snapshot of the network's connection health.
+type NetworkStatus struct {
+	Started bool
+	// nil if there is no running leader
+	Leader *PeerStatus
+	// running peers other than the leader
+	Peers   []*PeerStatus
+	Headers HeaderStatus
+}
+
+type NetworkEventKind int
+
+const (
+	PeerConnected NetworkEventKind = iota
+	PeerDisconnected
+	LeaderChanged
+	HeadersSynced
+	RecoveryStarted
+	RecoveryEnded
+)
+
+func (k NetworkEventKind) String() string {
+	switch k {
+	case PeerConnected:
+		return "peer connected"
+	case PeerDisconnected:
+		return "peer disconnected"
+	case LeaderChanged:
+		return "leader changed"
+	case HeadersSynced:
+		return "headers synced"
+	case RecoveryStarted:
+		return "recovery started"
+	case RecoveryEnded:
+		return "recovery ended"
+	default:
+		return "unknown"
+	}
+}
+
+// NetworkEvent is a change in the network status sent to the client.
+type NetworkEvent struct {
+	Kind NetworkEventKind
+	// the server the event is about if any
+	Server string
+	// the status after the change
+	Status *NetworkStatus
+}
+
+func peerStatus(peer *peerNode, now time.Time) *PeerStatus {
+	ps := &PeerStatus{
+		Address: peer.netAddr.String(),
+		Leader:  peer.node.leader,
+		Trusted: peer.isTrusted,
+		Onion:   peer.netAddr.IsOnion(),
+		Uptime:  now.Sub(peer.started),
+	}
+	if peer.node.server != nil {
+		ps.Connected = peer.node.server.connected
+		ps.SoftwareVersion = peer.node.server.softwareVersion
+		ps.ProtocolVersion = peer.node.server.protocolVersion
+		if peer.node.server.conn != nil {
+			_, _, _, ps.Latency = peer.node.server.conn.stats.snapshot()
+		}
+	}
+	if peer.node.session != nil {
+		ps.SessionCost = peer.node.session.getCost()
+	}
+	return ps
+}
+
+func (h *headers) status() HeaderStatus {
+	hs := HeaderStatus{
+		Tip:         h.getClientTip(),
+		SyncHeight:  h.syncHeight.Load(),
+		StartPoint:  h.startPoint,
+		Synced:      h.synced,
+		Recovery:    h.recovery,
+		RecoveryTip: h.recoveryTip,
+	}
+	if hs.Synced {
+		hs.SyncHeight = h.getTip()
+	}
+	return hs
+}
+
+// NetworkStatus returns a snapshot of the leader, running peers and headers.
+func (net *Network) NetworkStatus() *NetworkStatus {
+	net.peersMtx.RLock()
+	defer net.peersMtx.RUnlock()
+	return net.status()
+}
+
+// status - not locked
+func (net *Network) status() *NetworkStatus {
+	now := time.Now()
+	status := &NetworkStatus{
+		Started: net.started,
+		Peers:   make([]*PeerStatus, 0, len(net.peers)),
+	}
+	leader := net.getLeader()
+	if leader != nil && leader.nodeCtx.Err() == nil {
+		status.Leader = peerStatus(leader, now)
+	}
+	for _, peer := range net.peers {
+		if peer == leader || peer.nodeCtx.Err() != nil {
+			continue
+		}
+		status.Peers = append(status.Peers, peerStatus(peer, now))
+	}
+	if net.headers != nil {
+		status.Headers = net.headers.status()
+	}
+	return status
+}
+
+// GetNetworkEventNotify returns a channel to client to receive changes in the
+// network status. Events are dropped if not read.
+func (net *Network) GetNetworkEventNotify() <-chan *NetworkEvent {
+	return net.clientNetworkEvents
+}
+
+// statusEvents returns the events for the changes from before to after.
+func statusEvents(before, after *NetworkStatus) []*NetworkEvent {
+	var events []*NetworkEvent
+	add := func(kind NetworkEventKind, server string) {
+		events = append(events, &NetworkEvent{Kind: kind, Server: server, Status: after})
+	}
+	running := func(s *NetworkStatus) map[string]bool {
+		addrs := make(map[string]bool)
+		if s.Leader != nil {
+			addrs[s.Leader.Address] = true
+		}
+		for _, p := range s.Peers {
+			addrs[p.Address] = true
+		}
+		return addrs
+	}
+	was, is := running(before), running(after)
+	for addr := range is {
+		if !was[addr] {
+			add(PeerConnected, addr)
+		}
+	}
+	for addr := range was {
+		if !is[addr] {
+			add(PeerDisconnected, addr)
+		}
+	}
+	var leaderBefore, leaderAfter string
+	if before.Leader != nil {
+		leaderBefore = before.Leader.Address
+	}
+	if after.Leader != nil {
+		leaderAfter = after.Leader.Address
+	}
+	if leaderBefore != leaderAfter {
+		add(LeaderChanged, leaderAfter)
+	}
+	if !before.Headers.Synced && after.Headers.Synced {
+		add(HeadersSynced, "")
+	}
+	if !before.Headers.Recovery && after.Headers.Recovery {
+		add(RecoveryStarted, "")
+	}
+	if before.Headers.Recovery && !after.Headers.Recovery {
+		add(RecoveryEnded, "")
+	}
+	return events
+}
+
+// publishStatusEvents sends the client events for changes in the network
+// status since the last call - run from the peers monitor only
+func (net *Network) publishStatusEvents() {
+	status := net.NetworkStatus()
+	before := net.lastStatus
+	net.lastStatus = status
+	if before == nil {
+		before = &NetworkStatus{}
+	}
+	for _, ev := range statusEvents(before, status) {
+		select {
+		case net.clientNetworkEvents <- ev:
+		default:
+		}
+	}
+}
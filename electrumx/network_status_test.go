@@ -0,0 +1,69 @@
+package electrumx
+
+import (
+	"testing"
+)
+
+func TestNetworkStatus(t *testing.T) {
+	net := &Network{started: true}
+	leader := mkQuorumPeer("1.1.1.1:50001", true)
+	leader.node.server = &Server{connected: true, softwareVersion: "ElectrumX 1.16.0", protocolVersion: "1.4"}
+	leader.node.session.bumpCost(500)
+	peer := mkQuorumPeer("2.2.2.2:50001", false)
+	dead := mkQuorumPeer("3.3.3.3:50001", false)
+	dead.nodeCancel(errServerCanceled)
+	net.leader = leader
+	net.peers = []*peerNode{peer, dead}
+
+	status := net.NetworkStatus()
+	if !status.Started || status.Leader == nil {
+		t.Fatal("expected a started network with a leader")
+	}
+	if status.Leader.Address != "1.1.1.1:50001" || !status.Leader.Leader || !status.Leader.Connected {
+		t.Fatalf("wrong leader status %+v", status.Leader)
+	}
+	if status.Leader.SoftwareVersion != "ElectrumX 1.16.0" || status.Leader.SessionCost != 500 {
+		t.Fatalf("wrong leader status %+v", status.Leader)
+	}
+	if len(status.Peers) != 1 || status.Peers[0].Address != "2.2.2.2:50001" {
+		t.Fatalf("wrong peers %v", status.Peers)
+	}
+}
+
+func TestStatusEvents(t *testing.T) {
+	before := &NetworkStatus{
+		Leader: &PeerStatus{Address: "a"},
+		Peers:  []*PeerStatus{{Address: "b"}},
+	}
+	after := &NetworkStatus{
+		Leader:  &PeerStatus{Address: "b"},
+		Peers:   []*PeerStatus{{Address: "c"}},
+		Headers: HeaderStatus{Synced: true, Recovery: true},
+	}
+	events := statusEvents(before, after)
+	got := make(map[NetworkEventKind]string)
+	for _, ev := range events {
+		if ev.Status != after {
+			t.Fatal("event without the new status")
+		}
+		got[ev.Kind] = ev.Server
+	}
+	want := map[NetworkEventKind]string{
+		PeerConnected:    "c",
+		PeerDisconnected: "a",
+		LeaderChanged:    "b",
+		HeadersSynced:    "",
+		RecoveryStarted:  "",
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(events), len(want))
+	}
+	for kind, server := range want {
+		if s, ok := got[kind]; !ok || s != server {
+			t.Fatalf("%v: got %q, want %q", kind, s, server)
+		}
+	}
+	if len(statusEvents(after, after)) != 0 {
+		t.Fatal("events without changes")
+	}
+}
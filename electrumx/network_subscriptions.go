@@ -0,0 +1,117 @@
+package electrumx
+
+// Scripthash subscriptions across leader failover.
+//
+// Subscriptions belong to a server connection. When a new leader takes over
+// the old server's subscriptions are gone so the network keeps the subscribed
+// scripthashes with their last known status and resubscribes them on the new
+// leader. Any status which changed while we had no leader is sent on to the
+// client as a normal notification so it can backfill the history.
+
+import (
+	"context"
+	"fmt"
+)
+
+// trackSubscription records a subscribed scripthash and its status.
+func (net *Network) trackSubscription(scripthash, status string) {
+	net.subscriptionsMtx.Lock()
+	defer net.subscriptionsMtx.Unlock()
+	net.subscriptions[scripthash] = status
+}
+
+// untrackSubscription forgets an unsubscribed scripthash.
+func (net *Network) untrackSubscription(scripthash string) {
+	net.subscriptionsMtx.Lock()
+	defer net.subscriptionsMtx.Unlock()
+	delete(net.subscriptions, scripthash)
+}
+
+// updateSubscription updates the status of a tracked scripthash. Returns false
+// if the scripthash is not tracked.
+func (net *Network) updateSubscription(scripthash, status string) bool {
+	net.subscriptionsMtx.Lock()
+	defer net.subscriptionsMtx.Unlock()
+	if _, ok := net.subscriptions[scripthash]; !ok {
+		return false
+	}
+	net.subscriptions[scripthash] = status
+	return true
+}
+
+// sendScripthashNotify sends one notification to the client.
+func (net *Network) sendScripthashNotify(ctx context.Context, ntfn *ScripthashStatusResult) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case net.clientScripthashNotify <- ntfn:
+		return true
+	}
+}
+
+// forwardScripthashNotify passes the notifications from whichever node is
+// leader to the client, keeping the tracked statuses up to date - goroutine
+func (net *Network) forwardScripthashNotify(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ntfn := <-net.nodeScripthashNotify:
+			if ntfn == nil {
+				continue
+			}
+			if !net.updateSubscription(ntfn.Scripthash, ntfn.Status) {
+				// unsubscribed but the server does not support unsubscribe
+				continue
+			}
+			if !net.sendScripthashNotify(ctx, ntfn) {
+				return
+			}
+		}
+	}
+}
+
+// resubscribe subscribes all tracked scripthashes on a new leader. Statuses
+// which changed since the old leader are sent to the client followed by an
+// event with Resubscribed set and no Scripthash - goroutine
+func (net *Network) resubscribe(ctx context.Context, leader *peerNode) {
+	net.subscriptionsMtx.Lock()
+	scripthashes := make([]string, 0, len(net.subscriptions))
+	for scripthash := range net.subscriptions {
+		scripthashes = append(scripthashes, scripthash)
+	}
+	net.subscriptionsMtx.Unlock()
+
+	if len(scripthashes) > 0 {
+		results, err := leader.node.subscribeScripthashNotifyBatch(leader.nodeCtx, scripthashes)
+		if err != nil {
+			fmt.Printf("resubscribe on new leader %s - %v\n", leader.netAddr, err)
+			return
+		}
+		for _, r := range results {
+			if r.Err != nil {
+				fmt.Printf("resubscribe %s on new leader %s - %v\n", r.Scripthash, leader.netAddr, r.Err)
+				continue
+			}
+			net.subscriptionsMtx.Lock()
+			oldStatus, ok := net.subscriptions[r.Scripthash]
+			if ok {
+				net.subscriptions[r.Scripthash] = r.Status
+			}
+			net.subscriptionsMtx.Unlock()
+			if !ok || oldStatus == r.Status {
+				continue
+			}
+			ntfn := &ScripthashStatusResult{
+				Scripthash:   r.Scripthash,
+				Status:       r.Status,
+				Resubscribed: true,
+			}
+			if !net.sendScripthashNotify(ctx, ntfn) {
+				return
+			}
+		}
+	}
+	fmt.Printf("resubscribed %d scripthashes on new leader %s\n", len(scripthashes), leader.netAddr)
+	net.sendScripthashNotify(ctx, &ScripthashStatusResult{Resubscribed: true})
+}
@@ -0,0 +1,43 @@
+package electrumx
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestForwardScripthashNotify(t *testing.T) {
+	net := &Network{
+		clientScripthashNotify: make(chan *ScripthashStatusResult),
+		nodeScripthashNotify:   make(chan *ScripthashStatusResult),
+		subscriptions:          make(map[string]string),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go net.forwardScripthashNotify(ctx)
+
+	net.trackSubscription("sh1", "")
+	net.trackSubscription("sh2", "s2")
+	net.untrackSubscription("sh2")
+
+	// unsubscribed scripthash is dropped
+	net.nodeScripthashNotify <- &ScripthashStatusResult{Scripthash: "sh2", Status: "s2b"}
+	net.nodeScripthashNotify <- &ScripthashStatusResult{Scripthash: "sh1", Status: "s1"}
+
+	select {
+	case ntfn := <-net.clientScripthashNotify:
+		if ntfn.Scripthash != "sh1" || ntfn.Status != "s1" {
+			t.Fatalf("unexpected notification %+v", ntfn)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no notification forwarded")
+	}
+	net.subscriptionsMtx.Lock()
+	defer net.subscriptionsMtx.Unlock()
+	if net.subscriptions["sh1"] != "s1" {
+		t.Fatalf("tracked status not updated: %q", net.subscriptions["sh1"])
+	}
+	if _, ok := net.subscriptions["sh2"]; ok {
+		t.Fatal("unsubscribed scripthash still tracked")
+	}
+}
@@ -0,0 +1,255 @@
+package electrumx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/dev-warrior777/go-electrum-client/electrumx/electrumxtest"
+)
+
+// mkFakeServer serves a chain of n test headers over TLS.
+func mkFakeServer(t *testing.T, n int) *electrumxtest.Server {
+	return mkFakeServerOpts(t, n, &electrumxtest.Options{TLS: true})
+}
+
+func mkFakeServerOpts(t *testing.T, n int, opts *electrumxtest.Options) *electrumxtest.Server {
+	b := mkTestChain(t, n)
+	chain := electrumxtest.NewChain(b[:BTC_HEADER_SIZE])
+	for i := 1; i < n; i++ {
+		chain.AddHeaders(b[i*BTC_HEADER_SIZE : (i+1)*BTC_HEADER_SIZE])
+	}
+	s := electrumxtest.NewServer(chain, opts)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func mkFakeNetwork(t *testing.T, s *electrumxtest.Server) *Network {
+	genesis := s.Chain().BlockHash(0).String()
+	return NewNetwork(&ElectrumXConfig{
+		Coin:               "btc",
+		BlockHeaderSize:    BTC_HEADER_SIZE,
+		HeaderDeserializer: btcDeserializer,
+		Checkpoints:        []Checkpoint{{Height: 0, Root: genesis}},
+		Genesis:            genesis,
+		Flags:              NoDeleteKnownPeers,
+		NetType:            Regtest,
+		DataDir:            t.TempDir(),
+		TrustedPeer:        &NodeServerAddr{Net: "ssl", Addr: s.Addr()},
+	})
+}
+
+func TestNetworkFakeServer(t *testing.T) {
+	s := mkFakeServer(t, 50)
+	net := mkFakeNetwork(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	if err := net.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	tip, err := net.Tip()
+	if err != nil || tip != 49 {
+		t.Fatalf("synced to %d: %v", tip, err)
+	}
+
+	// new block
+	chain := s.Chain()
+	next := mkTestChain(t, 51)[50*BTC_HEADER_SIZE:]
+	chain.AddHeaders(next)
+	s.NotifyTip()
+	select {
+	case tip = <-net.GetTipChangeNotify():
+		if tip != 50 {
+			t.Fatalf("tip change to %d", tip)
+		}
+	case <-ctx.Done():
+		t.Fatal("no tip change")
+	}
+
+	// scripthash notifications and history
+	const sh = "0123"
+	if _, err := net.SubscribeScripthashNotify(ctx, sh); err != nil {
+		t.Fatal(err)
+	}
+	chain.SetHistory(sh, []electrumxtest.HistoryItem{{TxHash: "ab", Height: 50}})
+	s.NotifyScripthash(sh)
+	select {
+	case status := <-net.GetScripthashNotify():
+		if status.Status != chain.Status(sh) {
+			t.Fatalf("status %s", status.Status)
+		}
+	case <-ctx.Done():
+		t.Fatal("no scripthash notification")
+	}
+	history, err := net.GetHistory(ctx, sh)
+	if err != nil || len(history) != 1 || ScripthashStatus(history) != chain.Status(sh) {
+		t.Fatalf("history %v: %v", history, err)
+	}
+	batch, err := net.GetHistoryBatch(ctx, []string{sh})
+	if err != nil || len(batch) != 1 || batch[0].Server != s.Addr() {
+		t.Fatalf("history batch %v: %v", batch, err)
+	}
+
+	// server errors reach the caller
+	s.SetFault("blockchain.scripthash.get_history", electrumxtest.Fault{
+		Err:   &electrumxtest.RPCError{Code: 2, Message: "daemon error"},
+		Count: 1,
+	})
+	_, err = net.GetHistory(ctx, sh)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Message != "daemon error" {
+		t.Fatalf("expected daemon error got %v", err)
+	}
+}
+
+// waitFor polls cond until it is true or ctx is done.
+func waitFor(ctx context.Context, cond func() bool) bool {
+	for !cond() {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	return true
+}
+
+// nextConnectionStatus returns the next connection status or fails the test.
+func nextConnectionStatus(ctx context.Context, t *testing.T, net *Network) *ConnectionStatus {
+	t.Helper()
+	select {
+	case status := <-net.GetConnectionStatusNotify():
+		return status
+	case <-ctx.Done():
+		t.Fatal("no connection status")
+	}
+	return nil
+}
+
+func TestNetworkFailover(t *testing.T) {
+	trusted := mkFakeServer(t, 50)
+	other := mkFakeServer(t, 50)
+	net := mkFakeNetwork(t, trusted)
+	net.config.MaxOnlinePeers = 1
+	err := net.writeServerAddrFile([]*serverAddr{{Net: "ssl", Address: other.Addr()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := net.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status := nextConnectionStatus(ctx, t, net); status.State != ConnectionUp || status.Server != trusted.Addr() {
+		t.Fatalf("first status %+v", status)
+	}
+	const sh = "0123"
+	if _, err := net.SubscribeScripthashNotify(ctx, sh); err != nil {
+		t.Fatal(err)
+	}
+
+	// the monitor starts a peer on the other server
+	numPeers := func() int {
+		net.peersMtx.Lock()
+		defer net.peersMtx.Unlock()
+		return net.getNumPeers()
+	}
+	if !waitFor(ctx, func() bool { return numPeers() == 1 }) {
+		t.Fatal("no peer started")
+	}
+
+	// the leader goes away
+	trusted.Close()
+	if status := nextConnectionStatus(ctx, t, net); status.State != ConnectionDown || status.Server != trusted.Addr() {
+		t.Fatalf("expected the leader down got %+v", status)
+	}
+	if status := nextConnectionStatus(ctx, t, net); status.State != ConnectionUp || status.Server != other.Addr() {
+		t.Fatalf("expected the peer promoted got %+v", status)
+	}
+
+	// subscriptions follow the new leader
+	if !waitFor(ctx, func() bool { return other.Requests("blockchain.scripthash.subscribe") > 0 }) {
+		t.Fatal("not resubscribed on the new leader")
+	}
+	other.Chain().SetHistory(sh, []electrumxtest.HistoryItem{{TxHash: "ab", Height: 49}})
+	other.NotifyScripthash(sh)
+	select {
+	case status := <-net.GetScripthashNotify():
+		if status.Scripthash == "" {
+			// the resubscribed event
+			status = <-net.GetScripthashNotify()
+		}
+		if status.Status != other.Chain().Status(sh) {
+			t.Fatalf("status %s", status.Status)
+		}
+	case <-ctx.Done():
+		t.Fatal("no scripthash notification from the new leader")
+	}
+	tip, err := net.Tip()
+	if err != nil || tip != 49 {
+		t.Fatalf("tip %d: %v", tip, err)
+	}
+}
+
+func TestNetworkReorg(t *testing.T) {
+	s := mkFakeServer(t, 50)
+	net := mkFakeNetwork(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	if err := net.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// the server reorgs to a longer chain forking above 46
+	const forkPoint = 46
+	chain := s.Chain()
+	chain.Rewind(forkPoint)
+	prev := chain.BlockHash(forkPoint)
+	for height := int64(forkPoint + 1); height <= 50; height++ {
+		hdr := wire.BlockHeader{Version: 1, PrevBlock: prev, Nonce: uint32(1000 + height)}
+		var b bytes.Buffer
+		if err := hdr.Serialize(&b); err != nil {
+			t.Fatal(err)
+		}
+		chain.AddHeaders(b.Bytes())
+		prev = hdr.BlockHash()
+	}
+
+	// our tip 49 does not connect to the new 50 so we rewind
+	s.NotifyTip()
+	select {
+	case ev := <-net.GetReorgNotify():
+		if ev.OldTip != 49 || ev.ForkHeight != 49-REWIND {
+			t.Fatalf("reorg event %+v", ev)
+		}
+		if ev.ForkHeight > forkPoint {
+			t.Fatal("rewound too little")
+		}
+	case <-ctx.Done():
+		t.Fatal("no reorg event")
+	}
+
+	// and sync the new chain on the next notification
+	s.NotifyTip()
+	select {
+	case tip := <-net.GetTipChangeNotify():
+		if tip != 50 {
+			t.Fatalf("tip change to %d", tip)
+		}
+	case <-ctx.Done():
+		t.Fatal("no tip change after the reorg")
+	}
+	hdr, err := net.BlockHeader(50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Hash != chain.BlockHash(50).String() {
+		t.Fatalf("header 50 %s is not on the new chain %s", hdr.Hash, chain.BlockHash(50))
+	}
+}
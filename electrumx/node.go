@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sync"
 )
 
 var ErrNotConnected = errors.New("node not connected")
@@ -20,7 +21,13 @@ type Node struct {
 	networkHeaders         *headers
 	clientTipChangeNotify  chan int64
 	clientScriptHashNotify chan *ScripthashStatusResult
+	clientReorgNotify      chan *ReorgEvent
 	session                *session
+	// requests each sent on a new connection over its own tor circuit
+	isolateRequests RequestCategory
+	// scripthash statuses from the server which did not match its history
+	statusMismatches    int
+	statusMismatchesMtx sync.Mutex
 }
 
 func newNode(
@@ -29,7 +36,8 @@ func newNode(
 	isLeader bool,
 	networkHeaders *headers,
 	clientTipChangeNotify chan int64,
-	clientScriptHashNotify chan *ScripthashStatusResult) (*Node, error) {
+	clientScriptHashNotify chan *ScripthashStatusResult,
+	clientReorgNotify chan *ReorgEvent) (*Node, error) {
 
 	netProto := netAddr.Network()
 	addr := netAddr.String()
@@ -39,7 +47,7 @@ func newNode(
 	}
 	var tlsConfig *tls.Config
 	switch netProto {
-	case "ssl":
+	case "ssl", "wss":
 		rootCAs, _ := x509.SystemCertPool()
 		tlsConfig = &tls.Config{
 			InsecureSkipVerify: true,
@@ -47,7 +55,7 @@ func newNode(
 			MinVersion:         tls.VersionTLS12, // works ok
 			ServerName:         host,
 		}
-	case "tcp":
+	case "tcp", "ws":
 		tlsConfig = nil
 	default:
 		return nil, fmt.Errorf("unknown protocol: %s", netProto)
@@ -56,6 +64,7 @@ func newNode(
 	connectOpts := &connectOpts{
 		TLSConfig: tlsConfig,
 		TorProxy:  proxyAddr,
+		WebSocket: netProto == "ws" || netProto == "wss",
 	}
 
 	n := &Node{
@@ -67,6 +76,7 @@ func newNode(
 		networkHeaders:         networkHeaders,
 		clientTipChangeNotify:  clientTipChangeNotify,
 		clientScriptHashNotify: clientScriptHashNotify,
+		clientReorgNotify:      clientReorgNotify,
 		session:                nil,
 	}
 	return n, nil
@@ -78,8 +88,15 @@ func (n *Node) start(nodeCtx context.Context, nodeCancel context.CancelCauseFunc
 	if err != nil {
 		return err
 	}
+	// start a new session for this node to monitor resource use
+	n.session = newSession()
+	sc.session = n.session
 
-	version, err := sc.serverVersion(nodeCtx, "Electrum", "1.4")
+	version, err := sc.serverVersion(nodeCtx, "Electrum", PROTOCOL_MIN, PROTOCOL_MAX)
+	if err != nil {
+		return err
+	}
+	protocol, err := negotiatedVersion(version[1])
 	if err != nil {
 		return err
 	}
@@ -101,9 +118,9 @@ func (n *Node) start(nodeCtx context.Context, nodeCancel context.CancelCauseFunc
 	n.server.nodeCancel = nodeCancel
 	n.server.softwareVersion = version[0]
 	n.server.protocolVersion = version[1]
+	n.server.protocol = protocol
+	n.server.capabilities = capabilitiesFor(protocol)
 
-	// start a new session for this node to monitor resource use
-	n.session = newSession()
 	n.session.start(nodeCtx)
 
 	// Node is up and ready - if not leader then we exit here
@@ -154,6 +171,47 @@ func (n *Node) promoteToLeader(nodeCtx context.Context) error {
 	return nil
 }
 
+// Capabilities returns the optional methods supported by the node's server at
+// the negotiated protocol version.
+func (n *Node) Capabilities() Capabilities {
+	return n.server.capabilities
+}
+
+// Supports returns true if the node's server supports method at the
+// negotiated protocol version.
+func (n *Node) Supports(method string) bool {
+	return n.server.capabilities.Supports(method)
+}
+
+// connFor is the connection for a request in category. Requests in the
+// isolated categories get a new connection to the server over a new tor
+// circuit which is closed by done.
+func (n *Node) connFor(nodeCtx context.Context, category RequestCategory) (*serverConn, func(), error) {
+	if n.isolateRequests&category == 0 {
+		return n.server.conn, func() {}, nil
+	}
+	ctx, cancel := context.WithCancelCause(nodeCtx)
+	opts := *n.connectOpts
+	opts.TorIsolation = IsolateConnection
+	sc, err := connectServer(ctx, cancel, n.serverAddr, &opts)
+	if err != nil {
+		cancel(errNetworkCanceled)
+		return nil, nil, err
+	}
+	done := func() {
+		cancel(errNetworkCanceled)
+		<-sc.Done()
+	}
+	// same protocol as the node's session
+	proto := n.server.protocolVersion
+	_, err = sc.serverVersion(ctx, "Electrum", proto, proto)
+	if err != nil {
+		done()
+		return nil, nil, err
+	}
+	return sc, done, nil
+}
+
 //-----------------------------------------------------------------------------
 // Server API
 //-----------------------------------------------------------------------------
@@ -194,10 +252,22 @@ func (n *Node) subscribeScripthashNotify(nodeCtx context.Context, scripthash str
 	return n.server.conn.SubscribeScripthash(nodeCtx, scripthash)
 }
 
+func (n *Node) subscribeScripthashNotifyBatch(nodeCtx context.Context, scripthashes []string) ([]*ScripthashStatusBatchResult, error) {
+	if !n.server.connected {
+		return nil, ErrNotConnected
+	}
+	return n.server.conn.SubscribeScripthashBatch(nodeCtx, scripthashes)
+}
+
 func (n *Node) unsubscribeScripthashNotify(nodeCtx context.Context, scripthash string) {
 	if !n.server.connected {
 		return
 	}
+	if !n.Supports(METHOD_SCRIPTHASH_UNSUBSCRIBE) {
+		// the server keeps notifying until the session ends; the client
+		// ignores notifications for scripthashes it no longer watches
+		return
+	}
 	n.server.conn.UnsubscribeScripthash(nodeCtx, scripthash)
 }
 
@@ -227,6 +297,20 @@ func (n *Node) blockHeaders(nodeCtx context.Context, startHeight int64, blockCou
 	return gbh_res, err
 }
 
+func (n *Node) blockHeadersCp(nodeCtx context.Context, startHeight int64, blockCount int, cpHeight int64) (*getBlockHeadersResult, error) {
+	if !n.server.connected {
+		return nil, ErrNotConnected
+	}
+	gbh_res, err := n.server.conn.blockHeadersCp(nodeCtx, startHeight, blockCount, cpHeight)
+	if err == nil {
+		n.session.bumpCostString(gbh_res.HexConcat)
+		n.session.bumpCostStruct(gbh_res.Branch)
+	} else {
+		n.session.bumpCostError()
+	}
+	return gbh_res, err
+}
+
 func (n *Node) getHistory(nodeCtx context.Context, scripthash string) (HistoryResult, error) {
 	if !n.server.connected {
 		return nil, ErrNotConnected
@@ -254,11 +338,55 @@ func (n *Node) getListUnspent(nodeCtx context.Context, scripthash string) (ListU
 	return lu_res, err
 }
 
+func (n *Node) getHistoryBatch(nodeCtx context.Context, scripthashes []string) ([]*HistoryBatchResult, error) {
+	if !n.server.connected {
+		return nil, ErrNotConnected
+	}
+	ghb_res, err := n.server.conn.GetHistoryBatch(nodeCtx, scripthashes)
+	if err != nil {
+		n.session.bumpCostError()
+		return nil, err
+	}
+	for _, r := range ghb_res {
+		r.Server = n.serverAddr
+		if r.Err == nil {
+			n.session.bumpCostStruct(r.History)
+		} else {
+			n.session.bumpCostError()
+		}
+	}
+	return ghb_res, nil
+}
+
+func (n *Node) getListUnspentBatch(nodeCtx context.Context, scripthashes []string) ([]*ListUnspentBatchResult, error) {
+	if !n.server.connected {
+		return nil, ErrNotConnected
+	}
+	lub_res, err := n.server.conn.GetListUnspentBatch(nodeCtx, scripthashes)
+	if err != nil {
+		n.session.bumpCostError()
+		return nil, err
+	}
+	for _, r := range lub_res {
+		if r.Err == nil {
+			n.session.bumpCostStruct(r.Unspent)
+		} else {
+			n.session.bumpCostError()
+		}
+	}
+	return lub_res, nil
+}
+
 func (n *Node) getTransaction(nodeCtx context.Context, txid string) (*GetTransactionResult, error) {
 	if !n.server.connected {
 		return nil, ErrNotConnected
 	}
-	gtx_res, err := n.server.conn.getTransaction(nodeCtx, txid)
+	sc, done, err := n.connFor(nodeCtx, TxFetches)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	gtx_res, err := sc.getTransaction(nodeCtx, txid)
 	if err == nil {
 		n.session.bumpCostString(txid)
 		n.session.bumpCostStruct(gtx_res)
@@ -272,7 +400,12 @@ func (n *Node) getRawTransaction(nodeCtx context.Context, txid string) (string,
 	if !n.server.connected {
 		return "", ErrNotConnected
 	}
-	grt_res, err := n.server.conn.getRawTransaction(nodeCtx, txid)
+	sc, done, err := n.connFor(nodeCtx, TxFetches)
+	if err != nil {
+		return "", err
+	}
+	defer done()
+	grt_res, err := sc.getRawTransaction(nodeCtx, txid)
 	if err == nil {
 		n.session.bumpCostString(txid)
 		n.session.bumpCostString(grt_res)
@@ -282,11 +415,61 @@ func (n *Node) getRawTransaction(nodeCtx context.Context, txid string) (string,
 	return grt_res, err
 }
 
+func (n *Node) getRawTransactionBatch(nodeCtx context.Context, txids []string) ([]*RawTransactionBatchResult, error) {
+	if !n.server.connected {
+		return nil, ErrNotConnected
+	}
+	sc, done, err := n.connFor(nodeCtx, TxFetches)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	grtb_res, err := sc.getRawTransactionBatch(nodeCtx, txids)
+	if err != nil {
+		n.session.bumpCostError()
+		return nil, err
+	}
+	for _, r := range grtb_res {
+		r.Server = n.serverAddr
+		if r.Err == nil {
+			n.session.bumpCostString(r.Txid)
+			n.session.bumpCostString(r.RawTx)
+		} else {
+			n.session.bumpCostError()
+		}
+	}
+	return grtb_res, nil
+}
+
+func (n *Node) getMerkle(nodeCtx context.Context, txid string, height int64) (*GetMerkleResult, error) {
+	if !n.server.connected {
+		return nil, ErrNotConnected
+	}
+	sc, done, err := n.connFor(nodeCtx, TxFetches)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	gm_res, err := sc.getMerkle(nodeCtx, txid, height)
+	if err == nil {
+		n.session.bumpCostString(txid)
+		n.session.bumpCostStruct(gm_res)
+	} else {
+		n.session.bumpCostError()
+	}
+	return gm_res, err
+}
+
 func (n *Node) broadcast(nodeCtx context.Context, rawTx string) (string, error) {
 	if !n.server.connected {
 		return "", ErrNotConnected
 	}
-	txid, err := n.server.conn.Broadcast(nodeCtx, rawTx)
+	sc, done, err := n.connFor(nodeCtx, Broadcasts)
+	if err != nil {
+		return "", err
+	}
+	defer done()
+	txid, err := sc.Broadcast(nodeCtx, rawTx)
 	if err == nil {
 		n.session.bumpCostString(rawTx)
 		n.session.bumpCostString(txid)
@@ -296,6 +479,29 @@ func (n *Node) broadcast(nodeCtx context.Context, rawTx string) (string, error)
 	return txid, err
 }
 
+func (n *Node) broadcastPackage(nodeCtx context.Context, rawTxs []string) (*BroadcastPackageResult, error) {
+	if !n.server.connected {
+		return nil, ErrNotConnected
+	}
+	if !n.Supports(METHOD_BROADCAST_PACKAGE) {
+		return nil, ErrNotSupported
+	}
+	sc, done, err := n.connFor(nodeCtx, Broadcasts)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	bp_res, err := sc.BroadcastPackage(nodeCtx, rawTxs)
+	if err == nil {
+		for _, rawTx := range rawTxs {
+			n.session.bumpCostString(rawTx)
+		}
+	} else {
+		n.session.bumpCostError()
+	}
+	return bp_res, err
+}
+
 func (n *Node) estimateFeeRate(nodeCtx context.Context, confTarget int64) (int64, error) {
 	if !n.server.connected {
 		return 0, ErrNotConnected
@@ -308,3 +514,57 @@ func (n *Node) estimateFeeRate(nodeCtx context.Context, confTarget int64) (int64
 	}
 	return ef_res, err
 }
+
+func (n *Node) getMempool(nodeCtx context.Context, scripthash string) (MempoolResult, error) {
+	if !n.server.connected {
+		return nil, ErrNotConnected
+	}
+	gm_res, err := n.server.conn.GetMempool(nodeCtx, scripthash)
+	if err == nil {
+		n.session.bumpCostString(scripthash)
+		n.session.bumpCostStruct(gm_res)
+	} else {
+		n.session.bumpCostError()
+	}
+	return gm_res, err
+}
+
+func (n *Node) getBalance(nodeCtx context.Context, scripthash string) (*BalanceResult, error) {
+	if !n.server.connected {
+		return nil, ErrNotConnected
+	}
+	gb_res, err := n.server.conn.GetBalance(nodeCtx, scripthash)
+	if err == nil {
+		n.session.bumpCostString(scripthash)
+		n.session.bumpCostBytes(16) // 2* int64
+	} else {
+		n.session.bumpCostError()
+	}
+	return gb_res, err
+}
+
+func (n *Node) getFeeHistogram(nodeCtx context.Context) (FeeHistogram, error) {
+	if !n.server.connected {
+		return nil, ErrNotConnected
+	}
+	fh_res, err := n.server.conn.GetFeeHistogram(nodeCtx)
+	if err == nil {
+		n.session.bumpCostStruct(fh_res)
+	} else {
+		n.session.bumpCostError()
+	}
+	return fh_res, err
+}
+
+func (n *Node) relayFee(nodeCtx context.Context) (int64, error) {
+	if !n.server.connected {
+		return 0, ErrNotConnected
+	}
+	rf_res, err := n.server.conn.RelayFee(nodeCtx)
+	if err == nil {
+		n.session.bumpCostBytes(8)
+	} else {
+		n.session.bumpCostError()
+	}
+	return rf_res, err
+}
@@ -20,30 +20,32 @@ func (n *Node) syncHeaders(nodeCtx context.Context) error {
 	return nil
 }
 
-// syncNetworkHeaders reads blockchain_headers file, then gets any missing block
-// from end of file to current tip from server. The current set of headers is
-// also stored in headers map and the chain verified by checking previous block
-// hashes backwards from local Tip.
+// syncNetworkHeaders opens blockchain_headers file, then gets any missing block
+// from end of file to current tip from server. The headers added since the
+// chain was last verified are then verified by checking previous block hashes
+// backwards from local Tip.
 func (n *Node) syncNetworkHeaders(nodeCtx context.Context) error {
 	h := n.networkHeaders
 
 	// we start from a recent height for testnet/mainnet
 	startPointHeight := h.startPoint
 
-	// 1. Read last stored blockchain_headers file for this network
+	// 1. Open last stored blockchain_headers file for this network
 
-	b, err := h.readAllBytesFromFile()
+	_, err := h.openHeadersFile()
 	if err != nil {
 		return err
 	}
-	lenb := int64(len(b))
-	fmt.Println("read:", lenb, " bytes from header file")
-	numHeaders, err := h.bytesToNumHdrs(lenb)
+	// check the last stored headers and drop any bad ones to download again
+	numHeaders, err := h.checkHeadersFile(h.verifyDepth)
 	if err != nil {
 		return err
 	}
+	fmt.Println("read:", numHeaders, " headers from header file")
 
 	var maybeTip int64 = startPointHeight + numHeaders - 1
+	var fileTip = maybeTip
+	h.syncHeight.Store(maybeTip)
 
 	// 2. Gather new block headers we did not have in file up to current tip
 
@@ -54,7 +56,8 @@ func (n *Node) syncNetworkHeaders(nodeCtx context.Context) error {
 	var doneGathering = false
 	var startHeight = startPointHeight + numHeaders
 
-	hdrsRes, err := n.blockHeaders(nodeCtx, startHeight, blockCount)
+	// chunks are cut short to end at any checkpoint and proved against it
+	hdrsRes, reqCount, err := n.checkpointedBlockHeaders(nodeCtx, startHeight, blockCount)
 	if err != nil {
 		return err
 	}
@@ -72,17 +75,18 @@ func (n *Node) syncNetworkHeaders(nodeCtx context.Context) error {
 			log.Fatal(err)
 		}
 		maybeTip += int64(count)
+		h.syncHeight.Store(maybeTip)
 
 		fmt.Println(" appended: ", nh, " headers at ", startHeight, " maybeTip ", maybeTip)
 	}
 
-	if count < blockCount {
+	if count < reqCount {
 		doneGathering = true
 	}
 
 	for !doneGathering {
 
-		startHeight += int64(blockCount)
+		startHeight += int64(count)
 
 		select {
 
@@ -91,7 +95,7 @@ func (n *Node) syncNetworkHeaders(nodeCtx context.Context) error {
 			return nil
 
 		case <-time.After(time.Second):
-			hdrsRes, err := n.blockHeaders(nodeCtx, startHeight, blockCount)
+			hdrsRes, reqCount, err := n.checkpointedBlockHeaders(nodeCtx, startHeight, blockCount)
 			if err != nil {
 				return err
 			}
@@ -107,36 +111,32 @@ func (n *Node) syncNetworkHeaders(nodeCtx context.Context) error {
 					return err
 				}
 				maybeTip += int64(count)
+				h.syncHeight.Store(maybeTip)
 
 				fmt.Println(" Appended: ", nh, " headers at ", startHeight, " maybeTip ", maybeTip)
 			}
 
-			if count < blockCount {
+			if count < reqCount {
 				doneGathering = true
 			}
 		}
 	}
 
-	// 3. Read up to date blockchain_headers file
-	b2, err := h.readAllBytesFromFile()
-	if err != nil {
-		return err
-	}
+	h.setTip(maybeTip)
 
-	// 4. Store all headers in the hdrs map
-	err = h.store(b2, startPointHeight)
+	// 3. Verify headers stored since last verified
+	fmt.Printf("starting verify at height %d\n", h.getTip())
+	err = h.verifyUnverified()
 	if err != nil {
 		return err
 	}
-	h.setTip(maybeTip)
+	fmt.Println("header chain verified")
 
-	// 5. Verify headers in headers map
-	fmt.Printf("starting verify at height %d\n", h.getTip())
-	err = h.verifyAll()
+	// 4. Prove headers we had already stored against any checkpoints
+	err = n.verifyStoredCheckpoints(nodeCtx, fileTip)
 	if err != nil {
 		return err
 	}
-	fmt.Println("header chain verified")
 
 	h.synced = true
 	fmt.Println("headers synced up to tip ", h.getTip())
@@ -288,7 +288,7 @@ func (n *Node) updateFromChunk(nodeCtx context.Context, from, to int64) int64 {
 	h := n.networkHeaders
 	var headersConnected int64 = 0
 	reqCount := int(to - from + 1)
-	hdrsRes, err := n.blockHeaders(nodeCtx, from, reqCount)
+	hdrsRes, reqCount, err := n.checkpointedBlockHeaders(nodeCtx, from, reqCount)
 	if err != nil {
 		return 0
 	}
@@ -335,19 +335,35 @@ func (n *Node) connectTip(serverHeader string) bool {
 			" -- our current tip hash:    %s\n",
 			incomingHdr.Hash.StringRev(), incomingHdr.Prev.StringRev(), h.getTipHash().StringRev())
 		h.dbgDumpTipHashes(3)
+		n.session.bumpCostError()
 		// fork maybe?
-		n.reorgRecovery()
+		oldTip := h.getTip()
+		err = n.reorgRecovery()
+		if err != nil {
+			fmt.Println(err)
+			// This condition triggers node/server change
+			n.server.nodeCancel(errNodeMisbehavingCanceled)
+			return false
+		}
 		fmt.Printf("*** removed %d stored headers from tip -  new tip is %d ***\n",
-			REWIND, n.networkHeaders.getTip())
+			REWIND, h.getTip())
+		n.reorgNotify(&ReorgEvent{ForkHeight: h.getTip(), OldTip: oldTip})
+		return false
+	}
+	// check proof of work
+	err = h.checkCanStore(incomingHdr)
+	if err != nil {
+		fmt.Printf("connectTip - %v\n", err)
 		n.session.bumpCostError()
+		// This condition triggers node/server change
+		n.server.nodeCancel(errNodeMisbehavingCanceled)
 		return false
 	}
 	// connect
-	_, err = h.appendHeadersFile(incomingHdrBytes)
+	err = h.storeOneHdr(incomingHdrBytes) // (sets tip++)
 	if err != nil {
 		return false
 	}
-	h.storeOneHdr(incomingHdr) // (sets tip++)
 	h.recovery = false
 	return true
 }
@@ -357,32 +373,40 @@ func (n *Node) connectTip(serverHeader string) bool {
 // or block headers we ask for on that notification.
 //
 // So this is not a question of looking on other peers' chains for chains with more
-// proof of work .. ElectrumX does that!
+// proof of work .. ElectrumX does that! We do check each header we connect meets
+// its own proof of work and difficulty rules.
 //
-// When we cannot connect a block header we wind back our tip, hdrs map + truncate
+// When we cannot connect a block header we wind back our tip + truncate
 // blockchain_headers file by REWIND block headers so that next time a notification
 // comes in we ask for the last REWIND blocks. If still unconnectable on the next
-// headers notification we wind back again until startPoint where we panic.
-func (n *Node) reorgRecovery() {
+// headers notification we wind back again until startPoint where we return an
+// error and the caller fails over to another server.
+func (n *Node) reorgRecovery() error {
 	h := n.networkHeaders
 	tip := h.getTip()
 	if tip < h.startPoint+REWIND {
-		// consider failover after n tries
-		panic("reorgRecovery: tip <= startPoint+REWIND - cannot recover further")
+		return fmt.Errorf("reorgRecovery: tip %d < startPoint+REWIND - cannot recover further", tip)
 	}
-	// truncate and remove from map atomically
+	// truncate file, index and cache
 	newNumHeaders, err := h.truncateHeadersFile(REWIND)
 	if err != nil {
-		errMsg := fmt.Sprintf("reorgRecovery: truncateHeadersFile returned: %v", err)
-		panic(errMsg)
+		return fmt.Errorf("reorgRecovery: truncateHeadersFile returned: %w", err)
 	}
 	fmt.Printf("truncateHeadersFile: new num headers is %d\n", newNumHeaders)
-	for i := 0; i < REWIND; i++ {
-		h.removeOneHdrFromTip() // (sets tip--)
-	}
+	h.setTip(h.startPoint + newNumHeaders - 1)
 
 	h.recoveryTip = tip // what we  send back to users in getTip() during recovery
 	h.recovery = true
+	return nil
+}
+
+// reorgNotify tells the client that stored heights above the fork height may
+// be wrong
+func (n *Node) reorgNotify(ev *ReorgEvent) {
+	select {
+	case n.clientReorgNotify <- ev:
+	case <-n.server.conn.Done():
+	}
 }
 
 // ----------------------------------------------------------------------------
@@ -51,7 +51,12 @@ import (
 // can have some warning and terminate this session and start a new node with a
 // new connection/session.
 //
-// This is just a naive PoC that will have to be better implemented.
+// We act on the estimate in three ways:
+//   - Above COST_SOFT_LIMIT each request is paced with a delay growing up to
+//     COST_SLEEP at COST_HARD_LIMIT, as the server would delay us anyway.
+//   - Bulk batch requests go to the running node with the lowest cost.
+//   - A node whose cost reaches COST_ROTATE_LIMIT is canceled before the server
+//     disconnects us and its server rests for COST_REST_PERIOD.
 
 const (
 	COST_SOFT_LIMIT    = 2000.00
@@ -60,6 +65,12 @@ const (
 	COST_DECAY_PER_SEC = (COST_HARD_LIMIT / 3600.00)
 	// Adjust frequency of cost reductions
 	TuningFactor = 10
+	// Max delay before a request as the cost nears the hard limit
+	COST_SLEEP = 2 * time.Second
+	// Rotate the node at this cost
+	COST_ROTATE_LIMIT = 0.8 * COST_HARD_LIMIT
+	// Time a rotated server is not used again
+	COST_REST_PERIOD = 30 * time.Minute
 )
 
 type session struct {
@@ -82,7 +93,7 @@ func (s *session) runCostDecayLoop(nodeCtx context.Context) {
 	for {
 		select {
 		case <-nodeCtx.Done():
-			fmt.Printf("final session cost %f\n", s.cost)
+			fmt.Printf("final session cost %f\n", s.getCost())
 			return
 		case <-t.C:
 			// TuningFactor times slower to give back credits for less frequent
@@ -100,6 +111,45 @@ func (s *session) reduceCost() {
 	s.costMtx.Lock()
 	defer s.costMtx.Unlock()
 	s.cost -= COST_DECAY_PER_SEC
+	if s.cost < 0 {
+		s.cost = 0
+	}
+}
+
+func (s *session) getCost() float32 {
+	s.costMtx.Lock()
+	defer s.costMtx.Unlock()
+	return s.cost
+}
+
+// delay is the pacing delay for the next request. Zero below the soft limit
+// then rising linearly to COST_SLEEP at the hard limit.
+func (s *session) delay() time.Duration {
+	cost := s.getCost()
+	if cost <= COST_SOFT_LIMIT {
+		return 0
+	}
+	if cost >= COST_HARD_LIMIT {
+		return COST_SLEEP
+	}
+	frac := (cost - COST_SOFT_LIMIT) / (COST_HARD_LIMIT - COST_SOFT_LIMIT)
+	return time.Duration(frac * float32(COST_SLEEP))
+}
+
+// pace waits before a request if the session cost is above the soft limit.
+func (s *session) pace(nodeCtx context.Context) error {
+	d := s.delay()
+	if d == 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-nodeCtx.Done():
+		return nodeCtx.Err()
+	case <-t.C:
+		return nil
+	}
 }
 
 func (s *session) bumpCost(incurred float32) {
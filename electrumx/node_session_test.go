@@ -0,0 +1,37 @@
+package electrumx
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionDelay(t *testing.T) {
+	tests := []struct {
+		cost float32
+		want time.Duration
+	}{
+		{0, 0},
+		{COST_SOFT_LIMIT, 0},
+		{(COST_SOFT_LIMIT + COST_HARD_LIMIT) / 2, COST_SLEEP / 2},
+		{COST_HARD_LIMIT, COST_SLEEP},
+		{2 * COST_HARD_LIMIT, COST_SLEEP},
+	}
+	for _, test := range tests {
+		s := newSession()
+		s.cost = test.cost
+		got := s.delay()
+		diff := got - test.want
+		if diff < -time.Millisecond || diff > time.Millisecond {
+			t.Errorf("cost %.0f: delay %v, want %v", test.cost, got, test.want)
+		}
+	}
+}
+
+func TestSessionReduceCost(t *testing.T) {
+	s := newSession()
+	s.bumpCost(1)
+	s.reduceCost()
+	if s.getCost() != 0 {
+		t.Fatalf("cost %f, want 0", s.getCost())
+	}
+}
@@ -0,0 +1,81 @@
+package electrumx
+
+// Proof of work and difficulty validation of block headers.
+//
+// Linking each header to the previous block hash only proves the headers form
+// a chain, not that anyone did the work to build it. Each coin supplies a
+// HeaderValidator in ElectrumXConfig which checks a header meets the target
+// encoded in its nBits and that nBits obeys the coin's retarget rules. Then a
+// malicious server cannot feed us a cheap fake chain built on our StartPoint.
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// ErrInvalidHeader is returned when a block header fails the coin's proof of
+// work or difficulty rules.
+var ErrInvalidHeader = errors.New("invalid block header")
+
+// Number of previous headers used to calculate the median time past.
+const MEDIAN_TIME_BLOCKS = 11
+
+// HeaderChain gives a HeaderValidator read access to the stored headers below
+// the header being validated.
+type HeaderChain interface {
+	// HeaderAt returns the stored header at height or nil if we do not have
+	// it; for example if the height is below our StartPoint.
+	HeaderAt(height int64) *BlockHeader
+}
+
+// HeaderValidator is the per coin hook for proof of work and difficulty rules.
+type HeaderValidator interface {
+	// ValidateHeader checks hdr which is to be stored at height. The header
+	// at height-1, if any, has already been validated. Returns an error which
+	// wraps ErrInvalidHeader if the header breaks the rules.
+	ValidateHeader(hdr *BlockHeader, height int64, chain HeaderChain) error
+}
+
+// CheckProofOfWork checks that the target encoded in bits is within powLimit
+// and that the block hash does not exceed the target.
+func CheckProofOfWork(hash WireHash, bits uint32, powLimit *big.Int) error {
+	target := blockchain.CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return fmt.Errorf("%w: target from bits %08x is not positive", ErrInvalidHeader, bits)
+	}
+	if powLimit != nil && target.Cmp(powLimit) > 0 {
+		return fmt.Errorf("%w: target from bits %08x is above the pow limit", ErrInvalidHeader, bits)
+	}
+	chHash := chainhash.Hash(hash)
+	if blockchain.HashToBig(&chHash).Cmp(target) > 0 {
+		return fmt.Errorf("%w: hash %s is above target from bits %08x",
+			ErrInvalidHeader, hash.StringRev(), bits)
+	}
+	return nil
+}
+
+// CheckMedianTimePast checks that the header timestamp is after the median
+// timestamp of the previous MEDIAN_TIME_BLOCKS headers. The check is skipped
+// if we do not have all of those headers stored.
+func CheckMedianTimePast(hdr *BlockHeader, height int64, chain HeaderChain) error {
+	timestamps := make([]int64, 0, MEDIAN_TIME_BLOCKS)
+	for i := int64(1); i <= MEDIAN_TIME_BLOCKS; i++ {
+		prev := chain.HeaderAt(height - i)
+		if prev == nil {
+			return nil
+		}
+		timestamps = append(timestamps, prev.Timestamp)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	median := timestamps[MEDIAN_TIME_BLOCKS/2]
+	if hdr.Timestamp <= median {
+		return fmt.Errorf("%w: timestamp %d at height %d is not after median time past %d",
+			ErrInvalidHeader, hdr.Timestamp, height, median)
+	}
+	return nil
+}
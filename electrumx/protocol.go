@@ -0,0 +1,122 @@
+package electrumx
+
+// Electrum protocol version negotiation.
+//
+// We send server.version with the range of protocol versions we speak and the
+// server picks the highest it also speaks. The negotiated version decides
+// which methods we may call on that server and how some results look, so each
+// node keeps the capabilities of its server.
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The range of Electrum protocol versions we speak.
+const (
+	PROTOCOL_MIN = "1.4"
+	PROTOCOL_MAX = "1.6"
+)
+
+// Protocol methods which not every server we may negotiate with supports.
+const (
+	// from protocol 1.4.2
+	METHOD_SCRIPTHASH_UNSUBSCRIBE = "blockchain.scripthash.unsubscribe"
+	// from protocol 1.6
+	METHOD_BROADCAST_PACKAGE = "blockchain.transaction.broadcast_package"
+)
+
+// ErrNotSupported is returned when the server's negotiated protocol version
+// does not support the method called.
+var ErrNotSupported = errors.New("method not supported by server protocol version")
+
+// ProtocolVersion is an Electrum protocol version such as 1.4.2
+type ProtocolVersion struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+func parseProtocolVersion(s string) (ProtocolVersion, error) {
+	var v ProtocolVersion
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return v, fmt.Errorf("bad protocol version %q", s)
+	}
+	nums := make([]int, 3)
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("bad protocol version %q", s)
+		}
+		nums[i] = n
+	}
+	v.Major, v.Minor, v.Patch = nums[0], nums[1], nums[2]
+	return v, nil
+}
+
+// mustParseProtocolVersion is for our own version constants only
+func mustParseProtocolVersion(s string) ProtocolVersion {
+	v, err := parseProtocolVersion(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Less returns true if v is an older protocol version than other.
+func (v ProtocolVersion) Less(other ProtocolVersion) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	return v.Patch < other.Patch
+}
+
+func (v ProtocolVersion) String() string {
+	if v.Patch == 0 {
+		return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+	}
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Capabilities is the set of optional protocol methods a server supports at
+// its negotiated protocol version.
+type Capabilities map[string]bool
+
+// Supports returns true if method is supported.
+func (c Capabilities) Supports(method string) bool {
+	return c[method]
+}
+
+// capabilitiesFor returns the optional methods for protocol version v.
+func capabilitiesFor(v ProtocolVersion) Capabilities {
+	caps := make(Capabilities)
+	if !v.Less(ProtocolVersion{1, 4, 2}) {
+		caps[METHOD_SCRIPTHASH_UNSUBSCRIBE] = true
+	}
+	if !v.Less(ProtocolVersion{1, 6, 0}) {
+		caps[METHOD_BROADCAST_PACKAGE] = true
+	}
+	return caps
+}
+
+// negotiatedVersion checks the version chosen by the server is within the
+// range we asked for.
+func negotiatedVersion(s string) (ProtocolVersion, error) {
+	v, err := parseProtocolVersion(s)
+	if err != nil {
+		return v, err
+	}
+	min := mustParseProtocolVersion(PROTOCOL_MIN)
+	max := mustParseProtocolVersion(PROTOCOL_MAX)
+	if v.Less(min) || max.Less(v) {
+		return v, fmt.Errorf("server negotiated protocol version %s outside %s - %s",
+			v, PROTOCOL_MIN, PROTOCOL_MAX)
+	}
+	return v, nil
+}
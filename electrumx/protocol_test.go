@@ -0,0 +1,52 @@
+package electrumx
+
+import "testing"
+
+func TestNegotiatedVersion(t *testing.T) {
+	tests := []struct {
+		version     string
+		wantErr     bool
+		unsubscribe bool
+		pkg         bool
+	}{
+		{"1.4", false, false, false},
+		{"1.4.2", false, true, false},
+		{"1.5", false, true, false},
+		{"1.6", false, true, true},
+		{"1.3", true, false, false},
+		{"1.7", true, false, false},
+		{"1.x", true, false, false},
+	}
+	for _, test := range tests {
+		v, err := negotiatedVersion(test.version)
+		if (err != nil) != test.wantErr {
+			t.Fatalf("%s: unexpected error result %v", test.version, err)
+		}
+		if err != nil {
+			continue
+		}
+		if v.String() != test.version {
+			t.Fatalf("%s: round trip got %s", test.version, v)
+		}
+		caps := capabilitiesFor(v)
+		if caps.Supports(METHOD_SCRIPTHASH_UNSUBSCRIBE) != test.unsubscribe {
+			t.Fatalf("%s: wrong unsubscribe capability", test.version)
+		}
+		if caps.Supports(METHOD_BROADCAST_PACKAGE) != test.pkg {
+			t.Fatalf("%s: wrong broadcast_package capability", test.version)
+		}
+	}
+}
+
+func TestConcatHeaders(t *testing.T) {
+	res := &getBlockHeadersResult{Count: 2, Headers: []string{"aabb", "ccdd"}}
+	res.concatHeaders()
+	if res.HexConcat != "aabbccdd" {
+		t.Fatalf("got %s", res.HexConcat)
+	}
+	res = &getBlockHeadersResult{Count: 1, HexConcat: "aabb"}
+	res.concatHeaders()
+	if res.HexConcat != "aabb" {
+		t.Fatalf("got %s", res.HexConcat)
+	}
+}
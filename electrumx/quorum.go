@@ -0,0 +1,402 @@
+package electrumx
+
+// Quorum mode.
+//
+// Normally every query goes to the leader so one lying leader can hide an
+// incoming payment from us or invent one. With ElectrumXConfig.Quorum set to
+// N > 1, history and utxo queries (also batched) and raw tx batch queries are
+// asked of the leader and up to N-1 other running peers and the answers
+// compared. The header at our tip is likewise compared on each peers monitor
+// tick. Servers which disagree
+// with the majority lose reputation and a leader which disagrees is canceled
+// so that another server takes over. A tie, as between two servers, goes to
+// the trusted peer and otherwise to the leader.
+//
+// Only confirmed entries are voted on. Servers see mempool txs at different
+// times so the unconfirmed entries are those of a server in the majority.
+// Until enough peers are online to vote the leader is trusted as before.
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/decred/dcrd/crypto/rand"
+)
+
+// ErrNoQuorum is returned in quorum mode when no answer is given by a
+// majority of the servers asked.
+var ErrNoQuorum = errors.New("servers do not agree")
+
+// Reputation lost by a server for disagreeing with the majority
+const REP_QUORUM_MISMATCH = -10
+
+func (net *Network) quorumEnabled() bool {
+	return net.config.Quorum > 1
+}
+
+// quorumPeers returns the leader and up to Quorum-1 other running peers. They
+// are a snapshot so the peers can be asked without holding peersMtx.
+func (net *Network) quorumPeers() []*peerNode {
+	net.peersMtx.Lock()
+	defer net.peersMtx.Unlock()
+
+	peers := make([]*peerNode, 0, net.config.Quorum)
+	leader := net.getLeader()
+	if leader != nil && leader.nodeCtx.Err() == nil {
+		peers = append(peers, leader)
+	}
+	others := make([]*peerNode, len(net.peers))
+	copy(others, net.peers)
+	rand.ShuffleSlice(others)
+	for _, peer := range others {
+		if len(peers) >= net.config.Quorum {
+			break
+		}
+		if peer == leader || peer.nodeCtx.Err() != nil || !peer.node.server.connected {
+			continue
+		}
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+// quorumVote is one server's answer. Answers with the same key agree.
+type quorumVote struct {
+	peer   *peerNode
+	key    string
+	result any
+}
+
+// tally finds the key a strict majority of votes agree on and the peers which
+// disagree with it. Without a majority a tie is broken by the trusted peer.
+// Failing that the leader breaks it but the others are not proven wrong so
+// there are no dissenters.
+func tally(votes []*quorumVote) (*quorumVote, []*peerNode, bool) {
+	counts := make(map[string]int)
+	most := 0
+	for _, v := range votes {
+		counts[v.key]++
+		if counts[v.key] > most {
+			most = counts[v.key]
+		}
+	}
+	var winner *quorumVote
+	for _, v := range votes {
+		if counts[v.key]*2 > len(votes) {
+			winner = v
+			break
+		}
+	}
+	if winner == nil {
+		var leaderVote *quorumVote
+		for _, v := range votes {
+			if counts[v.key] != most {
+				continue
+			}
+			if v.peer.isTrusted {
+				winner = v
+				break
+			}
+			if v.peer.node.leader {
+				leaderVote = v
+			}
+		}
+		if winner == nil {
+			if leaderVote == nil {
+				return nil, nil, false
+			}
+			return leaderVote, nil, true
+		}
+	}
+	// prefer the leader's answer if it is in the majority
+	for _, v := range votes {
+		if v.key == winner.key && v.peer.node.leader {
+			winner = v
+			break
+		}
+	}
+	var dissenters []*peerNode
+	for _, v := range votes {
+		if v.key != winner.key {
+			dissenters = append(dissenters, v.peer)
+		}
+	}
+	return winner, dissenters, true
+}
+
+// askQuorum asks each of peers concurrently. ask returns a peer's vote key
+// and result. Peers which error do not vote.
+func askQuorum(peers []*peerNode, ask func(p *peerNode) (string, any, error)) []*quorumVote {
+	var wg sync.WaitGroup
+	votes := make([]*quorumVote, len(peers))
+	for i, peer := range peers {
+		wg.Add(1)
+		go func(i int, peer *peerNode) {
+			defer wg.Done()
+			key, result, err := ask(peer)
+			if err != nil {
+				return
+			}
+			votes[i] = &quorumVote{peer: peer, key: key, result: result}
+		}(i, peer)
+	}
+	wg.Wait()
+	cast := make([]*quorumVote, 0, len(votes))
+	for _, v := range votes {
+		if v != nil {
+			cast = append(cast, v)
+		}
+	}
+	return cast
+}
+
+// decideQuorum tallies votes, penalizes dissenters and returns the winning
+// result
+func (net *Network) decideQuorum(votes []*quorumVote, what string) (any, error) {
+	if len(votes) == 0 {
+		return nil, errNoLeader
+	}
+	if len(votes) == 1 {
+		// nobody to compare with yet
+		return votes[0].result, nil
+	}
+	winner, dissenters, ok := tally(votes)
+	if !ok {
+		fmt.Printf("quorum: %d servers do not agree on %s\n", len(votes), what)
+		return nil, ErrNoQuorum
+	}
+	net.penalize(dissenters, what)
+	return winner.result, nil
+}
+
+// penalize lowers the reputation of servers which disagreed with the majority
+// and cancels the leader if it was one of them
+func (net *Network) penalize(dissenters []*peerNode, what string) {
+	if len(dissenters) == 0 {
+		return
+	}
+	net.peersMtx.Lock()
+	defer net.peersMtx.Unlock()
+	for _, peer := range dissenters {
+		fmt.Printf("quorum: server %s disagrees with the majority on %s\n", peer.netAddr, what)
+		net.adjustRep(peer.netAddr.String(), REP_QUORUM_MISMATCH)
+		peer.node.session.bumpCostError()
+		if peer.node.leader {
+			peer.nodeCancel(errNodeMisbehavingCanceled)
+		}
+	}
+}
+
+// confirmedHistoryKey is the status of the confirmed part of a history.
+func confirmedHistoryKey(history HistoryResult) string {
+	confirmed := make(HistoryResult, 0, len(history))
+	for _, h := range history {
+		if h.Height > 0 {
+			confirmed = append(confirmed, h)
+		}
+	}
+	return ScripthashStatus(confirmed)
+}
+
+// confirmedUnspentKey is a canonical string of the confirmed utxos.
+func confirmedUnspentKey(unspent ListUnspentResult) string {
+	utxos := make([]string, 0, len(unspent))
+	for _, u := range unspent {
+		if u.Height <= 0 {
+			continue
+		}
+		utxos = append(utxos, u.TxHash+":"+strconv.FormatInt(u.TxPos, 10)+":"+
+			strconv.FormatInt(u.Value, 10)+":"+strconv.FormatInt(u.Height, 10))
+	}
+	sort.Strings(utxos)
+	return strings.Join(utxos, ",")
+}
+
+// quorumGetHistory asks the quorum peers for the history of scripthash
+func (net *Network) quorumGetHistory(ctx context.Context, scripthash string) (HistoryResult, error) {
+	votes := askQuorum(net.quorumPeers(), func(p *peerNode) (string, any, error) {
+		history, err := p.node.getHistory(ctx, scripthash)
+		if err != nil {
+			return "", nil, err
+		}
+		return confirmedHistoryKey(history), history, nil
+	})
+	result, err := net.decideQuorum(votes, "history of "+scripthash)
+	if err != nil {
+		return nil, err
+	}
+	return result.(HistoryResult), nil
+}
+
+// quorumGetListUnspent asks the quorum peers for the utxos of scripthash
+func (net *Network) quorumGetListUnspent(ctx context.Context, scripthash string) (ListUnspentResult, error) {
+	votes := askQuorum(net.quorumPeers(), func(p *peerNode) (string, any, error) {
+		unspent, err := p.node.getListUnspent(ctx, scripthash)
+		if err != nil {
+			return "", nil, err
+		}
+		return confirmedUnspentKey(unspent), unspent, nil
+	})
+	result, err := net.decideQuorum(votes, "utxos of "+scripthash)
+	if err != nil {
+		return nil, err
+	}
+	return result.(ListUnspentResult), nil
+}
+
+// checkTipQuorum compares the hash of the header at our tip, which came from
+// the leader, with the header other peers have at that height. Peers which
+// are behind us do not vote.
+func (net *Network) checkTipQuorum(ctx context.Context) {
+	h := net.headers
+	if !h.synced {
+		return
+	}
+	tip := h.getTip()
+	ourHdr := h.getHeader(tip)
+	if ourHdr == nil {
+		return
+	}
+	ourHash := ourHdr.Hash.StringRev()
+
+	votes := askQuorum(net.quorumPeers(), func(p *peerNode) (string, any, error) {
+		if p.node.leader {
+			return ourHash, nil, nil
+		}
+		res, err := p.node.blockHeaders(ctx, tip, 1)
+		if err != nil {
+			return "", nil, err
+		}
+		if res.Count != 1 {
+			return "", nil, errors.New("peer behind our tip")
+		}
+		b, err := hex.DecodeString(res.HexConcat)
+		if err != nil {
+			return "", nil, err
+		}
+		hdr, err := h.headerDeserialzer.Deserialize(bytes.NewBuffer(b))
+		if err != nil {
+			return "", nil, err
+		}
+		return hdr.Hash.StringRev(), nil, nil
+	})
+	net.decideQuorum(votes, fmt.Sprintf("block header at tip %d", tip))
+}
+
+// quorumGetHistoryBatch votes on each scripthash history of a batch
+func (net *Network) quorumGetHistoryBatch(ctx context.Context, scripthashes []string) ([]*HistoryBatchResult, error) {
+	batches := askQuorum(net.quorumPeers(), func(p *peerNode) (string, any, error) {
+		results, err := p.node.getHistoryBatch(ctx, scripthashes)
+		if err != nil {
+			return "", nil, err
+		}
+		return "", results, nil
+	})
+	if len(batches) == 0 {
+		return nil, errNoLeader
+	}
+	results := make([]*HistoryBatchResult, len(scripthashes))
+	for i, scripthash := range scripthashes {
+		votes := make([]*quorumVote, 0, len(batches))
+		for _, batch := range batches {
+			r := batch.result.([]*HistoryBatchResult)[i]
+			if r.Err != nil {
+				continue
+			}
+			votes = append(votes, &quorumVote{peer: batch.peer, key: confirmedHistoryKey(r.History), result: r})
+		}
+		if len(votes) == 0 {
+			// nobody answered - pass on an error
+			results[i] = batches[0].result.([]*HistoryBatchResult)[i]
+			continue
+		}
+		result, err := net.decideQuorum(votes, "history of "+scripthash)
+		if err != nil {
+			results[i] = &HistoryBatchResult{Scripthash: scripthash, Err: err}
+			continue
+		}
+		results[i] = result.(*HistoryBatchResult)
+	}
+	return results, nil
+}
+
+// quorumGetListUnspentBatch votes on each scripthash's utxos of a batch
+func (net *Network) quorumGetListUnspentBatch(ctx context.Context, scripthashes []string) ([]*ListUnspentBatchResult, error) {
+	batches := askQuorum(net.quorumPeers(), func(p *peerNode) (string, any, error) {
+		results, err := p.node.getListUnspentBatch(ctx, scripthashes)
+		if err != nil {
+			return "", nil, err
+		}
+		return "", results, nil
+	})
+	if len(batches) == 0 {
+		return nil, errNoLeader
+	}
+	results := make([]*ListUnspentBatchResult, len(scripthashes))
+	for i, scripthash := range scripthashes {
+		votes := make([]*quorumVote, 0, len(batches))
+		for _, batch := range batches {
+			r := batch.result.([]*ListUnspentBatchResult)[i]
+			if r.Err != nil {
+				continue
+			}
+			votes = append(votes, &quorumVote{peer: batch.peer, key: confirmedUnspentKey(r.Unspent), result: r})
+		}
+		if len(votes) == 0 {
+			// nobody answered - pass on an error
+			results[i] = batches[0].result.([]*ListUnspentBatchResult)[i]
+			continue
+		}
+		result, err := net.decideQuorum(votes, "utxos of "+scripthash)
+		if err != nil {
+			results[i] = &ListUnspentBatchResult{Scripthash: scripthash, Err: err}
+			continue
+		}
+		results[i] = result.(*ListUnspentBatchResult)
+	}
+	return results, nil
+}
+
+// quorumGetRawTransactionBatch votes on each raw tx of a batch
+func (net *Network) quorumGetRawTransactionBatch(ctx context.Context, txids []string) ([]*RawTransactionBatchResult, error) {
+	batches := askQuorum(net.quorumPeers(), func(p *peerNode) (string, any, error) {
+		results, err := p.node.getRawTransactionBatch(ctx, txids)
+		if err != nil {
+			return "", nil, err
+		}
+		return "", results, nil
+	})
+	if len(batches) == 0 {
+		return nil, errNoLeader
+	}
+	results := make([]*RawTransactionBatchResult, len(txids))
+	for i, txid := range txids {
+		votes := make([]*quorumVote, 0, len(batches))
+		for _, batch := range batches {
+			r := batch.result.([]*RawTransactionBatchResult)[i]
+			if r.Err != nil {
+				continue
+			}
+			votes = append(votes, &quorumVote{peer: batch.peer, key: strings.ToLower(r.RawTx), result: r})
+		}
+		if len(votes) == 0 {
+			// nobody answered - pass on an error
+			results[i] = batches[0].result.([]*RawTransactionBatchResult)[i]
+			continue
+		}
+		result, err := net.decideQuorum(votes, "raw tx "+txid)
+		if err != nil {
+			results[i] = &RawTransactionBatchResult{Txid: txid, Err: err}
+			continue
+		}
+		results[i] = result.(*RawTransactionBatchResult)
+	}
+	return results, nil
+}
@@ -0,0 +1,200 @@
+package electrumx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func mkQuorumPeer(addr string, leader bool) *peerNode {
+	nodeCtx, nodeCancel := context.WithCancelCause(context.Background())
+	node := &Node{serverAddr: addr, leader: leader, session: newSession()}
+	netAddr := &NodeServerAddr{Net: "tcp", Addr: addr}
+	return newPeerNodeWithId(leader, false, netAddr, node, nodeCtx, nodeCancel)
+}
+
+func TestQuorumHistory(t *testing.T) {
+	net := &Network{
+		config: &ElectrumXConfig{DataDir: t.TempDir(), Quorum: 3},
+		knownServers: []*serverAddr{
+			{Net: "tcp", Address: "1.1.1.1:50001"},
+			{Net: "tcp", Address: "2.2.2.2:50001"},
+			{Net: "tcp", Address: "3.3.3.3:50001"},
+		},
+	}
+	if err := net.writeServerAddrFile(net.knownServers); err != nil {
+		t.Fatal(err)
+	}
+	leader := mkQuorumPeer("1.1.1.1:50001", true)
+	peer2 := mkQuorumPeer("2.2.2.2:50001", false)
+	peer3 := mkQuorumPeer("3.3.3.3:50001", false)
+
+	payment := HistoryResult{{Height: 100, TxHash: "aa"}}
+	mempool := HistoryResult{{Height: 100, TxHash: "aa"}, {Height: 0, TxHash: "bb"}}
+
+	// mempool differences are not disagreements
+	if confirmedHistoryKey(payment) != confirmedHistoryKey(mempool) {
+		t.Fatal("expected the same key without mempool entries")
+	}
+
+	// the leader hides a payment from us
+	votes := []*quorumVote{
+		{peer: leader, key: confirmedHistoryKey(nil), result: HistoryResult{}},
+		{peer: peer2, key: confirmedHistoryKey(payment), result: payment},
+		{peer: peer3, key: confirmedHistoryKey(mempool), result: mempool},
+	}
+	result, err := net.decideQuorum(votes, "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.(HistoryResult)) == 0 {
+		t.Fatal("the leader hid the payment")
+	}
+	if !errors.Is(context.Cause(leader.nodeCtx), errNodeMisbehavingCanceled) {
+		t.Fatal("expected the leader to be canceled")
+	}
+	if peer2.nodeCtx.Err() != nil || peer3.nodeCtx.Err() != nil {
+		t.Fatal("expected the honest peers to keep running")
+	}
+	if err := net.saveKnownServers(); err != nil {
+		t.Fatal(err)
+	}
+	stored, _, err := net.readServerAddrFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range stored {
+		want := 0
+		if s.Address == "1.1.1.1:50001" {
+			want = REP_QUORUM_MISMATCH
+		}
+		if s.Rep != want {
+			t.Fatalf("server %s rep %d want %d", s.Address, s.Rep, want)
+		}
+	}
+
+	// no majority
+	votes = []*quorumVote{
+		{peer: peer2, key: "a", result: payment},
+		{peer: peer3, key: "b", result: HistoryResult{}},
+	}
+	if _, err = net.decideQuorum(votes, "history"); !errors.Is(err, ErrNoQuorum) {
+		t.Fatalf("expected ErrNoQuorum got %v", err)
+	}
+}
+
+func TestQuorumTie(t *testing.T) {
+	net := &Network{
+		config: &ElectrumXConfig{DataDir: t.TempDir(), Quorum: 2},
+		knownServers: []*serverAddr{
+			{Net: "tcp", Address: "1.1.1.1:50001"},
+			{Net: "tcp", Address: "2.2.2.2:50001"},
+		},
+	}
+	if err := net.writeServerAddrFile(net.knownServers); err != nil {
+		t.Fatal(err)
+	}
+	leader := mkQuorumPeer("1.1.1.1:50001", true)
+	peer := mkQuorumPeer("2.2.2.2:50001", false)
+	payment := HistoryResult{{Height: 100, TxHash: "aa"}}
+
+	// the leader breaks a tie but the peer is not proven wrong
+	votes := []*quorumVote{
+		{peer: leader, key: confirmedHistoryKey(nil), result: HistoryResult{}},
+		{peer: peer, key: confirmedHistoryKey(payment), result: payment},
+	}
+	result, err := net.decideQuorum(votes, "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.(HistoryResult)) != 0 {
+		t.Fatal("expected the leader's answer")
+	}
+	if peer.nodeCtx.Err() != nil || leader.nodeCtx.Err() != nil {
+		t.Fatal("expected no server to be canceled on a tie")
+	}
+
+	// the trusted peer wins a tie against the leader
+	peer.isTrusted = true
+	result, err = net.decideQuorum(votes, "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.(HistoryResult)) != 1 {
+		t.Fatal("expected the trusted peer's answer")
+	}
+	if !errors.Is(context.Cause(leader.nodeCtx), errNodeMisbehavingCanceled) {
+		t.Fatal("expected the leader to be canceled")
+	}
+}
+
+func TestConfirmedUnspentKey(t *testing.T) {
+	a := ListUnspentResult{
+		{Height: 10, TxPos: 1, TxHash: "aa", Value: 5},
+		{Height: 11, TxPos: 0, TxHash: "bb", Value: 6},
+		{Height: 0, TxPos: 0, TxHash: "cc", Value: 7},
+	}
+	b := ListUnspentResult{a[1], a[0]}
+	if confirmedUnspentKey(a) != confirmedUnspentKey(b) {
+		t.Fatal("expected order and mempool utxos not to matter")
+	}
+	b[0].Value++
+	if confirmedUnspentKey(a) == confirmedUnspentKey(b) {
+		t.Fatal("expected a different key for a different value")
+	}
+}
+
+func TestQuorumPeers(t *testing.T) {
+	leader := mkQuorumPeer("1.1.1.1:50001", true)
+	net := &Network{
+		config: &ElectrumXConfig{Quorum: 3},
+		leader: leader,
+	}
+	for i := 2; i <= 6; i++ {
+		p := mkQuorumPeer(fmt.Sprintf("%d.%d.%d.%d:50001", i, i, i, i), false)
+		p.node.server = &Server{connected: true}
+		net.peers = append(net.peers, p)
+	}
+	order := make([]*peerNode, len(net.peers))
+	copy(order, net.peers)
+
+	peers := net.quorumPeers()
+	if len(peers) != 3 || peers[0] != leader {
+		t.Fatalf("got %d quorum peers, want the leader and 2 others", len(peers))
+	}
+	for i := range order {
+		if net.peers[i] != order[i] {
+			t.Fatal("quorumPeers reordered the network's peers")
+		}
+	}
+
+}
+
+func TestQuorumUnlocked(t *testing.T) {
+	net := &Network{
+		config:  &ElectrumXConfig{DataDir: t.TempDir(), Quorum: 3},
+		started: true,
+	}
+	// each server checks the peers can be asked without holding peersMtx
+	answer := func(req *request) string {
+		if !net.peersMtx.TryLock() {
+			t.Errorf("peersMtx held while asking for %s", req.Method)
+		} else {
+			net.peersMtx.Unlock()
+		}
+		return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":[{"height":100,"tx_hash":"aa"}]}`, req.ID)
+	}
+	net.leader = mkScriptedPeer(t, "1.1.1.1:50001", true, answer)
+	for i := 2; i <= 3; i++ {
+		addr := fmt.Sprintf("%d.%d.%d.%d:50001", i, i, i, i)
+		net.peers = append(net.peers, mkScriptedPeer(t, addr, false, answer))
+	}
+	history, err := net.GetHistory(context.Background(), "0123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].TxHash != "aa" {
+		t.Fatalf("history %v", history)
+	}
+}
@@ -0,0 +1,346 @@
+package electrumx
+
+// Server reputation.
+//
+// Each known server keeps stats of how it behaved over all our sessions with
+// it and a reputation score, Rep, built from them. Both are kept in memory
+// and saved to 'network_servers.json' on the peers monitor tick. New leaders
+// and peers are chosen at random weighted by score and latency. Servers which
+// misbehave or cannot be reached are banned for a while; each ban in a row
+// doubles the time.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/decred/dcrd/crypto/rand"
+)
+
+// Reputation score range. New servers start at 0.
+const (
+	REP_MIN = -100
+	REP_MAX = 100
+	// a server at or below this score is banned
+	REP_BAN_THRESHOLD = -50
+)
+
+// Reputation score changes
+const (
+	REP_CONNECT           = 2
+	REP_CONNECT_FAILURE   = -5
+	REP_TIMEOUT           = -3
+	REP_RPC_ERROR         = -1
+	REP_MISBEHAVING       = -25
+	REP_UPTIME_PER_PERIOD = 1
+)
+
+// A session connected at least this long earns REP_UPTIME_PER_PERIOD for each
+// period and clears the server's ban backoff.
+const UPTIME_PERIOD = 10 * time.Minute
+
+// Ban backoff: BAN_BASE doubled for each ban in a row, up to BAN_MAX.
+const (
+	BAN_BASE = 5 * time.Minute
+	BAN_MAX  = 24 * time.Hour
+	// With the Default strategy a server banned this many times in a row is
+	// removed from the known servers.
+	MAX_BANS = 8
+)
+
+// serverStats is how a server behaved over all our sessions with it.
+type serverStats struct {
+	Connects        int   `json:"connects"`
+	ConnectFailures int   `json:"connect_failures"`
+	Timeouts        int   `json:"timeouts"`
+	RPCErrors       int   `json:"rpc_errors"`
+	Misbehaving     int   `json:"misbehaving"`
+	LatencyMs       int64 `json:"latency_ms"`  // moving average of request round trips
+	UptimeSecs      int64 `json:"uptime_secs"` // total connected time
+	Bans            int   `json:"bans"`        // bans in a row for the backoff
+	BannedUntil     int64 `json:"banned_until,omitempty"`
+}
+
+// connStats counts one connection's requests for the server's reputation.
+type connStats struct {
+	mtx          sync.Mutex
+	requests     int
+	rpcErrors    int
+	timeouts     int
+	latencyTotal time.Duration
+}
+
+// record records the outcome of a request which took latency.
+func (s *connStats) record(latency time.Duration, err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var rpcErr *RPCError
+	switch {
+	case err == nil:
+	case errors.As(err, &rpcErr):
+		s.rpcErrors++
+	case isTimeout(err):
+		s.timeouts++
+		return
+	default:
+		// canceled, connection closed
+		return
+	}
+	s.requests++
+	s.latencyTotal += latency
+}
+
+// recordTimeout records a read timeout on the connection.
+func (s *connStats) recordTimeout() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.timeouts++
+}
+
+func (s *connStats) snapshot() (requests, rpcErrors, timeouts int, latency time.Duration) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.requests > 0 {
+		latency = s.latencyTotal / time.Duration(s.requests)
+	}
+	return s.requests, s.rpcErrors, s.timeouts, latency
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// addRep adds delta to the server's score within the score range.
+func (s *serverAddr) addRep(delta int) {
+	s.Rep += delta
+	if s.Rep > REP_MAX {
+		s.Rep = REP_MAX
+	} else if s.Rep < REP_MIN {
+		s.Rep = REP_MIN
+	}
+}
+
+func (s *serverAddr) stats() *serverStats {
+	if s.Stats == nil {
+		s.Stats = &serverStats{}
+	}
+	return s.Stats
+}
+
+// ban bans the server for the next backoff period.
+func (s *serverAddr) ban(now time.Time) {
+	st := s.stats()
+	st.Bans++
+	d := BAN_BASE
+	for i := 1; i < st.Bans && d < BAN_MAX; i++ {
+		d *= 2
+	}
+	if d > BAN_MAX {
+		d = BAN_MAX
+	}
+	st.BannedUntil = now.Add(d).Unix()
+	fmt.Printf("banned server %s for %v\n", s.Address, d)
+}
+
+func (s *serverAddr) isBanned(now time.Time) bool {
+	return s.Stats != nil && s.Stats.BannedUntil > now.Unix()
+}
+
+// weight is the chance of choosing the server relative to others. Higher
+// scores and lower latency weigh more.
+func (s *serverAddr) weight() int64 {
+	w := int64(s.Rep - REP_MIN + 1)
+	if s.Stats != nil && s.Stats.LatencyMs > 0 {
+		// halve the weight for each 500ms
+		w = w * 500 / (500 + s.Stats.LatencyMs)
+	}
+	if w < 1 {
+		w = 1
+	}
+	return w
+}
+
+// weightedOrder returns servers in a random order where servers of higher
+// weight tend to come first.
+func weightedOrder(servers []*serverAddr) []*serverAddr {
+	left := make([]*serverAddr, len(servers))
+	copy(left, servers)
+	ordered := make([]*serverAddr, 0, len(servers))
+	for len(left) > 0 {
+		var total int64
+		for _, s := range left {
+			total += s.weight()
+		}
+		pick := rand.Int64N(total)
+		i := 0
+		for ; i < len(left)-1; i++ {
+			pick -= left[i].weight()
+			if pick < 0 {
+				break
+			}
+		}
+		ordered = append(ordered, left[i])
+		left = append(left[:i], left[i+1:]...)
+	}
+	return ordered
+}
+
+// updateServer applies update to a known server in memory. The change is
+// saved to the stored servers file by saveKnownServers. Returns false if the
+// server is not known.
+func (net *Network) updateServer(address string, update func(s *serverAddr)) bool {
+	net.knownServersMtx.Lock()
+	defer net.knownServersMtx.Unlock()
+
+	found := false
+	for _, known := range net.knownServers {
+		if known.Address == address {
+			update(known)
+			found = true
+		}
+	}
+	if found {
+		net.knownServersDirty = true
+	}
+	return found
+}
+
+// saveKnownServers writes any reputation changes of the known servers to the
+// stored servers file. Called on each peers monitor tick and at shutdown.
+func (net *Network) saveKnownServers() error {
+	net.knownServersMtx.Lock()
+	defer net.knownServersMtx.Unlock()
+
+	if !net.knownServersDirty {
+		return nil
+	}
+	stored, numRead, err := net.readServerAddrFile()
+	if err != nil {
+		fmt.Printf("saveKnownServers: %v\n", err)
+		return err
+	}
+	if numRead == 0 {
+		return nil
+	}
+	net.mergeKnownReputations(stored)
+	err = net.writeServerAddrFile(stored)
+	if err != nil {
+		fmt.Printf("saveKnownServers: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// mergeKnownReputations copies the reputation of known servers to stored
+// servers and clears the dirty flag - not locked
+func (net *Network) mergeKnownReputations(stored []*serverAddr) {
+	for _, got := range stored {
+		for _, known := range net.knownServers {
+			if known.Address != got.Address {
+				continue
+			}
+			got.Rep = known.Rep
+			if known.Stats != nil {
+				st := *known.Stats
+				got.Stats = &st
+			}
+		}
+	}
+	net.knownServersDirty = false
+}
+
+// adjustRep changes the reputation score of a known server by delta.
+func (net *Network) adjustRep(address string, delta int) {
+	net.updateServer(address, func(s *serverAddr) {
+		s.addRep(delta)
+		if s.Rep <= REP_BAN_THRESHOLD && !s.isBanned(time.Now()) {
+			s.ban(time.Now())
+		}
+	})
+}
+
+// recordConnectFailure bans a server we could not start a node for. A server
+// whose certificate changed counts as misbehaving. With the Default strategy a
+// server which keeps failing is removed.
+func (net *Network) recordConnectFailure(server *serverAddr, err error) {
+	remove := false
+	now := time.Now()
+	net.updateServer(server.Address, func(s *serverAddr) {
+		s.stats().ConnectFailures++
+		s.addRep(REP_CONNECT_FAILURE)
+		if errors.Is(err, ErrCertMismatch) {
+			s.stats().Misbehaving++
+			s.addRep(REP_MISBEHAVING)
+		}
+		s.ban(now)
+		remove = s.stats().Bans >= MAX_BANS
+	})
+	if remove {
+		net.removeServer(server)
+	}
+}
+
+// recordConnect records a node started for a server.
+func (net *Network) recordConnect(address string) {
+	net.updateServer(address, func(s *serverAddr) {
+		s.stats().Connects++
+		s.addRep(REP_CONNECT)
+	})
+}
+
+// recordSession folds the stats of a finished node session into its server's
+// reputation. Called once when a dead peer or leader is dropped.
+func (net *Network) recordSession(peer *peerNode) {
+	if peer.sessionRecorded {
+		return
+	}
+	peer.sessionRecorded = true
+
+	now := time.Now()
+	uptime := now.Sub(peer.started)
+	misbehaving := errors.Is(context.Cause(peer.nodeCtx), errNodeMisbehavingCanceled)
+	var requests, rpcErrors, timeouts int
+	var latency time.Duration
+	if peer.node.server.conn != nil {
+		requests, rpcErrors, timeouts, latency = peer.node.server.conn.stats.snapshot()
+	}
+
+	net.updateServer(peer.netAddr.String(), func(s *serverAddr) {
+		st := s.stats()
+		st.UptimeSecs += int64(uptime.Seconds())
+		st.RPCErrors += rpcErrors
+		st.Timeouts += timeouts
+		if requests > 0 {
+			ms := latency.Milliseconds()
+			if st.LatencyMs == 0 {
+				st.LatencyMs = ms
+			} else {
+				st.LatencyMs = (3*st.LatencyMs + ms) / 4
+			}
+		}
+		s.addRep(rpcErrors*REP_RPC_ERROR + timeouts*REP_TIMEOUT)
+		periods := int(uptime / UPTIME_PERIOD)
+		s.addRep(periods * REP_UPTIME_PER_PERIOD)
+		if misbehaving {
+			st.Misbehaving++
+			s.addRep(REP_MISBEHAVING)
+			s.ban(now)
+			return
+		}
+		if s.Rep <= REP_BAN_THRESHOLD {
+			s.ban(now)
+			return
+		}
+		if periods > 0 {
+			// a good long session - forget past bans
+			st.Bans = 0
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package electrumx
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBanBackoff(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	s := &serverAddr{Address: "1.1.1.1:50001"}
+	want := BAN_BASE
+	for i := 0; i < 12; i++ {
+		s.ban(now)
+		got := time.Unix(s.Stats.BannedUntil, 0).Sub(now)
+		if got != want {
+			t.Fatalf("ban %d: got %v want %v", i+1, got, want)
+		}
+		want *= 2
+		if want > BAN_MAX {
+			want = BAN_MAX
+		}
+	}
+	if !s.isBanned(now) {
+		t.Fatal("expected banned")
+	}
+	if s.isBanned(now.Add(BAN_MAX + time.Second)) {
+		t.Fatal("expected ban to expire")
+	}
+}
+
+func TestWeightedOrder(t *testing.T) {
+	good := &serverAddr{Address: "good", Rep: REP_MAX, Stats: &serverStats{LatencyMs: 50}}
+	bad := &serverAddr{Address: "bad", Rep: REP_MIN + 1, Stats: &serverStats{LatencyMs: 2000}}
+	goodFirst := 0
+	for i := 0; i < 1000; i++ {
+		ordered := weightedOrder([]*serverAddr{bad, good})
+		if len(ordered) != 2 {
+			t.Fatalf("got %d servers", len(ordered))
+		}
+		if ordered[0] == good {
+			goodFirst++
+		}
+	}
+	if goodFirst < 900 {
+		t.Fatalf("good server first only %d times in 1000", goodFirst)
+	}
+}
+
+func TestRecordSession(t *testing.T) {
+	net := &Network{
+		config: &ElectrumXConfig{DataDir: t.TempDir()},
+		knownServers: []*serverAddr{
+			{Net: "tcp", Address: "1.1.1.1:50001"},
+		},
+	}
+	if err := net.writeServerAddrFile(net.knownServers); err != nil {
+		t.Fatal(err)
+	}
+	peer := mkQuorumPeer("1.1.1.1:50001", false)
+	peer.started = time.Now().Add(-2 * UPTIME_PERIOD)
+	peer.node.server = &Server{conn: &serverConn{}}
+	peer.node.server.conn.stats.record(100*time.Millisecond, nil)
+	peer.node.server.conn.stats.record(300*time.Millisecond, &RPCError{Code: 1})
+	peer.node.server.conn.stats.record(0, context.DeadlineExceeded)
+	peer.nodeCancel(errNodeMisbehavingCanceled)
+
+	net.recordSession(peer)
+	net.recordSession(peer) // only once
+
+	if err := net.saveKnownServers(); err != nil {
+		t.Fatal(err)
+	}
+	stored, _, err := net.readServerAddrFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := stored[0]
+	st := s.Stats
+	if st.RPCErrors != 1 || st.Timeouts != 1 || st.Misbehaving != 1 || st.Bans != 1 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+	if st.LatencyMs != 200 {
+		t.Fatalf("latency %d want 200", st.LatencyMs)
+	}
+	wantRep := REP_RPC_ERROR + REP_TIMEOUT + 2*REP_UPTIME_PER_PERIOD + REP_MISBEHAVING
+	if s.Rep != wantRep {
+		t.Fatalf("rep %d want %d", s.Rep, wantRep)
+	}
+	if !s.isBanned(time.Now()) {
+		t.Fatal("expected misbehaving server banned")
+	}
+	if len(net.availableServers(false)) != 0 {
+		t.Fatal("expected banned server not available")
+	}
+}
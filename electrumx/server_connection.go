@@ -11,11 +11,10 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
-
-	"github.com/decred/go-socks/socks"
 )
 
 // Thanks to Chappjc for the original source code.
@@ -61,6 +60,12 @@ type serverConn struct {
 	// closed in the 'listen' below.
 	headersNotify    chan *headersNotifyResult
 	headersNotifyMtx sync.Mutex
+
+	// request outcomes for the server's reputation
+	stats connStats
+
+	// the node's session cost estimate for pacing requests - set after connect
+	session *session
 }
 
 func (sc *serverConn) nextID() uint64 {
@@ -93,11 +98,20 @@ func (sc *serverConn) listen(nodeCtx context.Context) {
 		if err != nil {
 			if nodeCtx.Err() == nil { // unexpected
 				sc.debug("ReadBytes: %v - conn closed\n", err)
+				if isTimeout(err) {
+					sc.stats.recordTimeout()
+				}
 			}
 			sc.nodeCancel(errServerCanceled)
 			return
 		}
 
+		// Batch responses
+		if isBatch(msg) {
+			sc.batchResponses(msg)
+			continue
+		}
+
 		var jsonResp response
 		err = json.Unmarshal(msg, &jsonResp)
 		if err != nil {
@@ -138,6 +152,40 @@ func (sc *serverConn) listen(nodeCtx context.Context) {
 	}
 }
 
+// isBatch reports whether msg is a json array; a batch response.
+func isBatch(msg []byte) bool {
+	for _, b := range msg {
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '[':
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// batchResponses forwards each response of a batch to its requestor. Called
+// from the listen thread.
+func (sc *serverConn) batchResponses(msg []byte) {
+	var jsonResps []*response
+	err := json.Unmarshal(msg, &jsonResps)
+	if err != nil {
+		sc.debug("batch response Unmarshal error: %v", err)
+		return
+	}
+	for _, jsonResp := range jsonResps {
+		c := sc.responseChan(jsonResp.ID)
+		if c == nil {
+			sc.debug("Received batch response for unknown request ID %d", jsonResp.ID)
+			continue
+		}
+		c <- jsonResp // buffered and single use => cannot block
+	}
+}
+
 // keepAlive pushes the stream read deadline further into the future every 10s
 // then pings the server.
 func (sc *serverConn) keepAlive(nodeCtx context.Context) {
@@ -166,50 +214,41 @@ func (sc *serverConn) keepAlive(nodeCtx context.Context) {
 type connectOpts struct {
 	TLSConfig *tls.Config
 	TorProxy  string
+	// which connections share a tor circuit
+	TorIsolation TorIsolation
+	// ws or wss server
+	WebSocket bool
+	// Transport to connect with instead of a tcp stream - optional
+	Transport Transport
+	// Directory to record the session to - optional
+	RecordDir string
 }
 
 // connectServer connects to the electrumx server at the given address. To close
 // the connection and shutdown serverConn cancel the context then wait on the
 // channel from Done() to ensure a clean shutdown (connection closed and
 // all incoming responses handled).
-// There is no automatic reconnection functionality, as the caller should handle
-// dropped connections by cycling to a different server.
+// There is no automatic reconnection functionality here, the Network handles
+// dropped connections by cycling to a different server or reconnecting to the
+// trusted peer.
 func connectServer(
 	nodeCtx context.Context,
 	nodeCancel context.CancelCauseFunc,
 	addr string,
 	opts *connectOpts) (*serverConn, error) {
 
-	var dial func(nodeCtx context.Context, network, addr string) (net.Conn, error)
-	var dialCtx context.Context
-	var dialCancel context.CancelFunc
-
-	if opts.TorProxy != "" {
-		proxy := &socks.Proxy{
-			Addr:         opts.TorProxy,
-			TorIsolation: true,
-		}
-		dial = proxy.DialContext
-		dialCtx, dialCancel = context.WithTimeout(nodeCtx, 20*time.Second)
-		defer dialCancel()
-	} else {
-		dial = new(net.Dialer).DialContext
-		dialCtx, dialCancel = context.WithTimeout(nodeCtx, 5*time.Second)
-		defer dialCancel()
-	}
-
-	conn, err := dial(dialCtx, "tcp", addr)
+	conn, err := opts.transport().Dial(nodeCtx, addr)
 	if err != nil {
 		return nil, err
 	}
 
-	if opts.TLSConfig != nil {
-		conn = tls.Client(conn, opts.TLSConfig)
-		err = conn.(*tls.Conn).HandshakeContext(nodeCtx)
+	if opts.RecordDir != "" {
+		recorder, err := recordConn(conn, opts.RecordDir, addr)
 		if err != nil {
 			conn.Close()
 			return nil, err
 		}
+		conn = recorder
 	}
 
 	sc := &serverConn{
@@ -252,6 +291,14 @@ func (sc *serverConn) send(msg []byte) error {
 	return err
 }
 
+// pace delays a request as the session cost nears the server's limits.
+func (sc *serverConn) pace(nodeCtx context.Context) error {
+	if sc.session == nil {
+		return nil
+	}
+	return sc.session.pace(nodeCtx)
+}
+
 func (sc *serverConn) registerRequest(id uint64) chan *response {
 	c := make(chan *response, 1)
 	sc.respHandlersMtx.Lock()
@@ -352,8 +399,13 @@ func (sc *serverConn) request(nodeCtx context.Context, method string, args any,
 	}
 	reqMsg = append(reqMsg, newline)
 
+	if err = sc.pace(nodeCtx); err != nil {
+		return err
+	}
+
 	c := sc.registerRequest(id)
 
+	start := time.Now()
 	if err = sc.send(reqMsg); err != nil {
 		sc.nodeCancel(errServerCanceled)
 		return err
@@ -362,6 +414,7 @@ func (sc *serverConn) request(nodeCtx context.Context, method string, args any,
 	var resp *response
 	select {
 	case <-nodeCtx.Done():
+		sc.stats.record(time.Since(start), nodeCtx.Err())
 		return nodeCtx.Err()
 	case resp = <-c:
 	}
@@ -371,8 +424,10 @@ func (sc *serverConn) request(nodeCtx context.Context, method string, args any,
 	}
 
 	if resp.Error != nil {
+		sc.stats.record(time.Since(start), resp.Error)
 		return resp.Error
 	}
+	sc.stats.record(time.Since(start), nil)
 
 	if result != nil {
 		return json.Unmarshal(resp.Result, result)
@@ -380,6 +435,77 @@ func (sc *serverConn) request(nodeCtx context.Context, method string, args any,
 	return nil
 }
 
+// batchRequest sends calls to the remote server as JSON-RPC batches of up to
+// maxBatchSize calls. Each call gets its own error and result as for request.
+// The returned error is only for a failure of a whole batch such as a send
+// error.
+func (sc *serverConn) batchRequest(nodeCtx context.Context, calls []*batchCall) error {
+	for start := 0; start < len(calls); start += maxBatchSize {
+		end := start + maxBatchSize
+		if end > len(calls) {
+			end = len(calls)
+		}
+		err := sc.sendBatch(nodeCtx, calls[start:end])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendBatch sends one JSON-RPC batch and waits for all the responses.
+func (sc *serverConn) sendBatch(nodeCtx context.Context, calls []*batchCall) error {
+	ids := make([]uint64, len(calls))
+	chans := make([]chan *response, len(calls))
+	for i := range calls {
+		ids[i] = sc.nextID()
+	}
+	reqMsg, err := prepareBatchRequest(ids, calls)
+	if err != nil {
+		return err
+	}
+	reqMsg = append(reqMsg, newline)
+
+	if err = sc.pace(nodeCtx); err != nil {
+		return err
+	}
+
+	for i, id := range ids {
+		chans[i] = sc.registerRequest(id)
+	}
+
+	start := time.Now()
+	if err = sc.send(reqMsg); err != nil {
+		sc.nodeCancel(errServerCanceled)
+		return err
+	}
+
+	for i, c := range chans {
+		var resp *response
+		select {
+		case <-nodeCtx.Done():
+			sc.stats.record(time.Since(start), nodeCtx.Err())
+			return nodeCtx.Err()
+		case resp = <-c:
+		}
+		call := calls[i]
+		if resp == nil {
+			call.err = errors.New("response channel closed")
+			continue
+		}
+		if resp.Error != nil {
+			sc.stats.record(time.Since(start), resp.Error)
+			call.err = resp.Error
+			continue
+		}
+		sc.stats.record(time.Since(start), nil)
+		if call.result != nil {
+			call.err = json.Unmarshal(resp.Result, call.result)
+		}
+	}
+	return nil
+}
+
 // ----------------------------------------------------------------------------
 // Server API
 // ----------------------------------------------------------------------------
@@ -389,11 +515,12 @@ func (sc *serverConn) ping(nodeCtx context.Context) error {
 	return sc.request(nodeCtx, "server.ping", nil, nil)
 }
 
-// serverVersion returns the server's software version and electrumx protocol
-// of the connected server
-func (sc *serverConn) serverVersion(nodeCtx context.Context, client, proto string) ([]string, error) {
+// serverVersion negotiates the electrumx protocol version within the range
+// protoMin to protoMax and returns the server's software version and the
+// protocol version the server chose.
+func (sc *serverConn) serverVersion(nodeCtx context.Context, client, protoMin, protoMax string) ([]string, error) {
 	var vers []string
-	err := sc.request(nodeCtx, "server.version", positional{client, proto}, &vers)
+	err := sc.request(nodeCtx, "server.version", positional{client, []string{protoMin, protoMax}}, &vers)
 	if err != nil {
 		return nil, err
 	}
@@ -567,6 +694,60 @@ func (sc *serverConn) getRawTransaction(nodeCtx context.Context, txid string) (s
 	return resp, nil
 }
 
+// RawTransactionBatchResult is the result for one txid of a batched
+// GetRawTransaction.
+type RawTransactionBatchResult struct {
+	Txid  string
+	RawTx string
+	Err   error
+	// the server which sent RawTx
+	Server string
+}
+
+// getRawTransactionBatch requests transactions as raw bytes in one or more
+// JSON-RPC batches. Results are in the same order as txids.
+func (sc *serverConn) getRawTransactionBatch(nodeCtx context.Context, txids []string) ([]*RawTransactionBatchResult, error) {
+	results := make([]*RawTransactionBatchResult, len(txids))
+	calls := make([]*batchCall, len(txids))
+	for i, txid := range txids {
+		results[i] = &RawTransactionBatchResult{Txid: txid}
+		calls[i] = &batchCall{
+			method: "blockchain.transaction.get",
+			args:   positional{txid, false},
+			result: &results[i].RawTx,
+		}
+	}
+	err := sc.batchRequest(nodeCtx, calls)
+	if err != nil {
+		return nil, err
+	}
+	for i, call := range calls {
+		results[i].Err = call.err
+	}
+	return results, nil
+}
+
+// GetMerkleResult is the merkle branch proving that a transaction is included
+// in the block at BlockHeight. Merkle hashes are hex strings in the same byte
+// order as txids. Pos is the 0-based position of the tx in the block.
+type GetMerkleResult struct {
+	Merkle      []string `json:"merkle"`
+	BlockHeight int64    `json:"block_height"`
+	Pos         int      `json:"pos"`
+}
+
+// getMerkle requests the merkle branch for a confirmed transaction at a given
+// block height. The server may lie so the branch must be checked against our
+// own stored block header merkle root.
+func (sc *serverConn) getMerkle(nodeCtx context.Context, txid string, height int64) (*GetMerkleResult, error) {
+	var resp GetMerkleResult
+	err := sc.request(nodeCtx, "blockchain.transaction.get_merkle", positional{txid, height}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // ////////////////////////////////////////////////////////////////////////////
 // block headers methods
 // /////////////////////
@@ -589,6 +770,20 @@ type getBlockHeadersResult struct {
 	Count     int    `json:"count"`
 	HexConcat string `json:"hex"`
 	Max       int64  `json:"max"`
+	// protocol 1.6 servers send a list of headers instead of HexConcat
+	Headers []string `json:"headers,omitempty"`
+	// only when requested with a cp_height; the merkle branch of the last
+	// header returned and the merkle root of all block hashes up to cp_height
+	Branch []string `json:"branch,omitempty"`
+	Root   string   `json:"root,omitempty"`
+}
+
+// concatHeaders fills in HexConcat from a protocol 1.6 headers list.
+func (r *getBlockHeadersResult) concatHeaders() {
+	if r.HexConcat == "" && len(r.Headers) > 0 {
+		r.HexConcat = strings.Join(r.Headers, "")
+		r.Headers = nil
+	}
 }
 
 // blockHeaders requests a batch of block headers beginning at the given height.
@@ -600,6 +795,20 @@ func (sc *serverConn) blockHeaders(nodeCtx context.Context, startHeight int64, c
 	if err != nil {
 		return nil, err
 	}
+	resp.concatHeaders()
+	return &resp, nil
+}
+
+// blockHeadersCp requests a batch of block headers beginning at the given
+// height with a merkle proof of the last header to the checkpoint cpHeight.
+// startHeight + count - 1 must not be above cpHeight.
+func (sc *serverConn) blockHeadersCp(nodeCtx context.Context, startHeight int64, count int, cpHeight int64) (*getBlockHeadersResult, error) {
+	var resp getBlockHeadersResult
+	err := sc.request(nodeCtx, "blockchain.block.headers", positional{startHeight, count, cpHeight}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	resp.concatHeaders()
 	return &resp, nil
 }
 
@@ -639,6 +848,9 @@ func (sc *serverConn) subscribeHeaders(nodeCtx context.Context) (*headersNotifyR
 type ScripthashStatusResult struct {
 	Scripthash string // 32 byte scripthash - the id of the watched address
 	Status     string // 32 byte sha256 hash of entire history to date or null
+	// Set when the status comes from resubscribing on a new leader. The last
+	// one of a resubscribe has no Scripthash and marks that it is complete.
+	Resubscribed bool
 }
 
 // GetScripthashNotify returns this connection owned recv channel for scripthash
@@ -698,6 +910,39 @@ func (sc *serverConn) GetHistory(nodeCtx context.Context, scripthash string) (Hi
 	return resp, nil
 }
 
+// HistoryBatchResult is the result for one scripthash of a batched
+// GetHistory.
+type HistoryBatchResult struct {
+	Scripthash string
+	History    HistoryResult
+	Err        error
+	// the server which sent History
+	Server string
+}
+
+// GetHistoryBatch gets the history for each scripthash in one or more JSON-RPC
+// batches. Results are in the same order as scripthashes.
+func (sc *serverConn) GetHistoryBatch(nodeCtx context.Context, scripthashes []string) ([]*HistoryBatchResult, error) {
+	results := make([]*HistoryBatchResult, len(scripthashes))
+	calls := make([]*batchCall, len(scripthashes))
+	for i, scripthash := range scripthashes {
+		results[i] = &HistoryBatchResult{Scripthash: scripthash}
+		calls[i] = &batchCall{
+			method: "blockchain.scripthash.get_history",
+			args:   positional{scripthash},
+			result: &results[i].History,
+		}
+	}
+	err := sc.batchRequest(nodeCtx, calls)
+	if err != nil {
+		return nil, err
+	}
+	for i, call := range calls {
+		results[i].Err = call.err
+	}
+	return results, nil
+}
+
 type ListUnspent struct {
 	Height int64  `json:"height"`
 	TxPos  int64  `json:"tx_pos"`
@@ -718,21 +963,146 @@ func (sc *serverConn) GetListUnspent(nodeCtx context.Context, scripthash string)
 	return resp, nil
 }
 
+// ListUnspentBatchResult is the result for one scripthash of a batched
+// GetListUnspent.
+type ListUnspentBatchResult struct {
+	Scripthash string
+	Unspent    ListUnspentResult
+	Err        error
+}
+
+// GetListUnspentBatch gets the unspent outputs for each scripthash in one or
+// more JSON-RPC batches. Results are in the same order as scripthashes.
+func (sc *serverConn) GetListUnspentBatch(nodeCtx context.Context, scripthashes []string) ([]*ListUnspentBatchResult, error) {
+	results := make([]*ListUnspentBatchResult, len(scripthashes))
+	calls := make([]*batchCall, len(scripthashes))
+	for i, scripthash := range scripthashes {
+		results[i] = &ListUnspentBatchResult{Scripthash: scripthash}
+		calls[i] = &batchCall{
+			method: "blockchain.scripthash.listunspent",
+			args:   positional{scripthash},
+			result: &results[i].Unspent,
+		}
+	}
+	err := sc.batchRequest(nodeCtx, calls)
+	if err != nil {
+		return nil, err
+	}
+	for i, call := range calls {
+		results[i].Err = call.err
+	}
+	return results, nil
+}
+
+// ScripthashStatusBatchResult is the result for one scripthash of a batched
+// SubscribeScripthash.
+type ScripthashStatusBatchResult struct {
+	Scripthash string
+	Status     string
+	Err        error
+}
+
+// SubscribeScripthashBatch subscribes for notifications of changes for each
+// scripthash in one or more JSON-RPC batches. Results are in the same order as
+// scripthashes.
+func (sc *serverConn) SubscribeScripthashBatch(nodeCtx context.Context, scripthashes []string) ([]*ScripthashStatusBatchResult, error) {
+	results := make([]*ScripthashStatusBatchResult, len(scripthashes))
+	calls := make([]*batchCall, len(scripthashes))
+	for i, scripthash := range scripthashes {
+		results[i] = &ScripthashStatusBatchResult{Scripthash: scripthash}
+		calls[i] = &batchCall{
+			method: "blockchain.scripthash.subscribe",
+			args:   positional{scripthash},
+			result: &results[i].Status,
+		}
+	}
+	err := sc.batchRequest(nodeCtx, calls)
+	if err != nil {
+		return nil, err
+	}
+	for i, call := range calls {
+		results[i].Err = call.err
+	}
+	return results, nil
+}
+
+type MempoolTx struct {
+	Height int64  `json:"height"` // 0 or -1 if it has unconfirmed inputs
+	TxHash string `json:"tx_hash"`
+	Fee    int64  `json:"fee"` // satoshis
+}
+
+type MempoolResult []MempoolTx
+
+// GetMempool gets a list of [{height, txid and fee},...] of the unconfirmed
+// txs involving the scripthash of an address.
+func (sc *serverConn) GetMempool(nodeCtx context.Context, scripthash string) (MempoolResult, error) {
+	var resp MempoolResult
+	err := sc.request(nodeCtx, "blockchain.scripthash.get_mempool", positional{scripthash}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+type BalanceResult struct {
+	Confirmed   int64 `json:"confirmed"`   // satoshis
+	Unconfirmed int64 `json:"unconfirmed"` // satoshis; may be negative
+}
+
+// GetBalance gets the confirmed and unconfirmed balances of the scripthash of
+// an address.
+func (sc *serverConn) GetBalance(nodeCtx context.Context, scripthash string) (*BalanceResult, error) {
+	var resp BalanceResult
+	err := sc.request(nodeCtx, "blockchain.scripthash.get_balance", positional{scripthash}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // ////////////////////////////////////////////////////////////////////////////
 // Other wallet methods (exported to Client)
 // /////////////////////////////////////////
 
 // Broadcast broadcasts a raw tx as a hexadecimal string to the network. The tx
-// hash is returned as a hexadecimal string.
+// hash is returned as a hexadecimal string. A tx rejected by the server returns
+// a *BroadcastError with the reason.
 func (sc *serverConn) Broadcast(nodeCtx context.Context, rawTx string) (string, error) {
 	var resp string
 	err := sc.request(nodeCtx, "blockchain.transaction.broadcast", positional{rawTx}, &resp)
 	if err != nil {
-		return "", err
+		return "", broadcastError(err)
 	}
 	return resp, nil
 }
 
+// BroadcastPackageError is the error for one tx of a rejected package.
+type BroadcastPackageError struct {
+	Txid  string `json:"txid"`
+	Error string `json:"error"`
+}
+
+// BroadcastPackageResult is the result of a package broadcast. If Success is
+// false Errors may say which txs were rejected.
+type BroadcastPackageResult struct {
+	Success bool                    `json:"success"`
+	Errors  []BroadcastPackageError `json:"errors,omitempty"`
+}
+
+// BroadcastPackage sends a package of related raw txs, such as a parent and a
+// CPFP child, to the server for broadcast as a whole. Protocol 1.6 only. We
+// ask for the non verbose result as the verbose one is bitcoind's
+// submitpackage result, which has no success field.
+func (sc *serverConn) BroadcastPackage(nodeCtx context.Context, rawTxs []string) (*BroadcastPackageResult, error) {
+	var resp BroadcastPackageResult
+	err := sc.request(nodeCtx, "blockchain.transaction.broadcast_package", positional{rawTxs, false}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // Estimated transaction fee in coin units per kilobyte, as a floating point number string.
 // If the daemon does not have enough information to make an estimate, the integer -1
 // is returned.
@@ -747,3 +1117,49 @@ func (sc *serverConn) EstimateFee(nodeCtx context.Context, confTarget int64) (in
 	}
 	return int64(resp * 1e8), nil
 }
+
+// FeeHistogramEntry is the virtual size of the mempool txs paying about
+// FeeRate.
+type FeeHistogramEntry struct {
+	FeeRate float64 // satoshis per vbyte
+	VSize   int64
+}
+
+// UnmarshalJSON reads the [fee_rate, vsize] pair sent by the server.
+func (e *FeeHistogramEntry) UnmarshalJSON(b []byte) error {
+	var pair []float64
+	err := json.Unmarshal(b, &pair)
+	if err != nil {
+		return err
+	}
+	if len(pair) != 2 {
+		return fmt.Errorf("bad fee histogram entry %s", string(b))
+	}
+	e.FeeRate = pair[0]
+	e.VSize = int64(pair[1])
+	return nil
+}
+
+// FeeHistogram is the mempool fee histogram from the highest fee rate down.
+type FeeHistogram []FeeHistogramEntry
+
+// GetFeeHistogram gets the fee histogram of the server's mempool.
+func (sc *serverConn) GetFeeHistogram(nodeCtx context.Context) (FeeHistogram, error) {
+	var resp FeeHistogram
+	err := sc.request(nodeCtx, "mempool.get_fee_histogram", nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// RelayFee gets the minimum fee rate in satoshis per kilobyte a tx must pay
+// to be accepted into the server's mempool.
+func (sc *serverConn) RelayFee(nodeCtx context.Context) (int64, error) {
+	var resp float64
+	err := sc.request(nodeCtx, "blockchain.relayfee", nil, &resp)
+	if err != nil {
+		return 0, err
+	}
+	return int64(resp * 1e8), nil
+}
@@ -0,0 +1,139 @@
+package electrumx
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestIsBatch(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want bool
+	}{
+		{`[{"id":1}]`, true},
+		{" \t[{\"id\":1}]", true},
+		{`{"id":1}`, false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if got := isBatch([]byte(test.msg)); got != test.want {
+			t.Errorf("isBatch(%q) = %v, want %v", test.msg, got, test.want)
+		}
+	}
+}
+
+// serveBatches answers each batch request on conn in reverse order. History
+// requests for the scripthash "bad" get an error response.
+func serveBatches(t *testing.T, conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	for {
+		msg, err := reader.ReadBytes(newline)
+		if err != nil {
+			return
+		}
+		var reqs []request
+		if err := json.Unmarshal(msg, &reqs); err != nil {
+			t.Errorf("server: not a batch request: %v", err)
+			return
+		}
+		if len(reqs) > maxBatchSize {
+			t.Errorf("server: batch of %d requests", len(reqs))
+		}
+		resps := make([]json.RawMessage, 0, len(reqs))
+		for i := len(reqs) - 1; i >= 0; i-- {
+			var params []string
+			if err := json.Unmarshal(reqs[i].Params, &params); err != nil {
+				t.Errorf("server: bad params: %v", err)
+				return
+			}
+			var resp string
+			if params[0] == "bad" {
+				resp = fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"error":{"code":1,"message":"bad scripthash"}}`, reqs[i].ID)
+			} else {
+				resp = fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":[{"height":%d,"tx_hash":"%s"}]}`,
+					reqs[i].ID, i+1, params[0])
+			}
+			resps = append(resps, json.RawMessage(resp))
+		}
+		b, _ := json.Marshal(resps)
+		if _, err := conn.Write(append(b, newline)); err != nil {
+			return
+		}
+	}
+}
+
+func TestGetHistoryBatch(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go serveBatches(t, server)
+
+	nodeCtx, nodeCancel := context.WithCancelCause(context.Background())
+	defer nodeCancel(nil)
+	sc := &serverConn{
+		conn:         client,
+		nodeCancel:   nodeCancel,
+		done:         make(chan struct{}),
+		debug:        func(string, ...any) {},
+		respHandlers: make(map[uint64]chan *response),
+
+		scripthashNotify: make(chan *ScripthashStatusResult, 1),
+		headersNotify:    make(chan *headersNotifyResult, 1),
+	}
+	go sc.listen(nodeCtx)
+
+	// more than one batch
+	scripthashes := make([]string, maxBatchSize+10)
+	for i := range scripthashes {
+		scripthashes[i] = fmt.Sprintf("sh%d", i)
+	}
+	scripthashes[3] = "bad"
+
+	results, err := sc.GetHistoryBatch(nodeCtx, scripthashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(scripthashes) {
+		t.Fatalf("got %d results for %d scripthashes", len(results), len(scripthashes))
+	}
+	for i, r := range results {
+		if r.Scripthash != scripthashes[i] {
+			t.Fatalf("result %d: scripthash %s, want %s", i, r.Scripthash, scripthashes[i])
+		}
+		if i == 3 {
+			if r.Err == nil {
+				t.Fatal("expected an error for the bad scripthash")
+			}
+			continue
+		}
+		if r.Err != nil {
+			t.Fatalf("result %d: %v", i, r.Err)
+		}
+		if len(r.History) != 1 || r.History[0].TxHash != scripthashes[i] {
+			t.Fatalf("result %d: wrong history %v", i, r.History)
+		}
+	}
+}
+
+func TestFeeHistogramUnmarshal(t *testing.T) {
+	var hist FeeHistogram
+	err := json.Unmarshal([]byte(`[[12.5, 90000], [5, 120000], [1, 250000]]`), &hist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := FeeHistogram{{12.5, 90000}, {5, 120000}, {1, 250000}}
+	if len(hist) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(hist), len(want))
+	}
+	for i := range want {
+		if hist[i] != want[i] {
+			t.Fatalf("entry %d: got %v, want %v", i, hist[i], want[i])
+		}
+	}
+	if err := json.Unmarshal([]byte(`[[12.5]]`), &hist); err == nil {
+		t.Fatal("expected an error for a short entry")
+	}
+}
@@ -0,0 +1,51 @@
+package electrumx
+
+// Scripthash status.
+//
+// The status ElectrumX sends for a subscribed scripthash is a hash of the
+// scripthash history. Clients can compute it from the history they already
+// have and only ask for the history when the status has changed. A server
+// whose status does not hash from the history it sends is inconsistent.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Number of status mismatches a leader may have before we fail over to
+// another server. History can change between sending the status and the
+// history so one mismatch is not proof of a bad server.
+const MAX_STATUS_MISMATCHES = 3
+
+// ScripthashStatus computes the electrum status of a scripthash history in
+// server order: the sha256 of the concatenated "tx_hash:height:" strings as
+// hex. An empty history has the empty (null) status.
+func ScripthashStatus(history HistoryResult) string {
+	if len(history) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	for _, h := range history {
+		sb.WriteString(h.TxHash)
+		sb.WriteByte(':')
+		sb.WriteString(strconv.FormatInt(h.Height, 10))
+		sb.WriteByte(':')
+	}
+	sum := sha256.Sum256([]byte(sb.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// flagStatusMismatch records that the node's server sent a status for
+// scripthash that does not match the history it sent. Returns true if the
+// server has now sent too many.
+func (n *Node) flagStatusMismatch(scripthash string) bool {
+	n.statusMismatchesMtx.Lock()
+	defer n.statusMismatchesMtx.Unlock()
+	n.statusMismatches++
+	fmt.Printf("server %s status for scripthash %s does not match its history (%d)\n",
+		n.serverAddr, scripthash, n.statusMismatches)
+	return n.statusMismatches >= MAX_STATUS_MISMATCHES
+}
@@ -0,0 +1,24 @@
+package electrumx
+
+import "testing"
+
+func TestScripthashStatus(t *testing.T) {
+	if status := ScripthashStatus(nil); status != "" {
+		t.Fatalf("expected null status for no history got %s", status)
+	}
+	history := HistoryResult{
+		{Height: 100, TxHash: "a1b2"},
+		{Height: 0, TxHash: "c3d4"},
+		{Height: -1, TxHash: "e5f6", Fee: 200},
+	}
+	// sha256("a1b2:100:c3d4:0:e5f6:-1:")
+	const want = "694476be35bc9c3bbe9c70d04cbf99b9f23a1cea6651360b55a28004041600ba"
+	if status := ScripthashStatus(history); status != want {
+		t.Fatalf("got status %s want %s", status, want)
+	}
+	// order matters
+	history[0], history[1] = history[1], history[0]
+	if status := ScripthashStatus(history); status == want {
+		t.Fatal("expected a different status for a different order")
+	}
+}
@@ -0,0 +1,272 @@
+package electrumx
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/decred/go-socks/socks"
+)
+
+// ErrTorMisconfigured is returned when the Tor settings cannot work. The
+// Network never falls back to clearnet in that case.
+var ErrTorMisconfigured = errors.New("tor misconfigured")
+
+// TorPolicy decides which servers are used and whether connections go through
+// the tor proxy.
+type TorPolicy uint8
+
+const (
+	// Clearnet connects directly to clearnet servers. Onion servers are only
+	// used for non-leader peers, up to MaxOnion of them, if a ProxyPort is
+	// set.
+	Clearnet TorPolicy = iota
+	// PreferTor connects to every server through the tor proxy and tries
+	// onion servers first, also for the leader.
+	PreferTor
+	// TorOnly connects only to onion servers through the tor proxy. The
+	// TrustedPeer must be an onion server.
+	TorOnly
+)
+
+func (p TorPolicy) String() string {
+	switch p {
+	case Clearnet:
+		return "Clearnet"
+	case PreferTor:
+		return "PreferTor"
+	case TorOnly:
+		return "TorOnly"
+	}
+	return fmt.Sprintf("TorPolicy(%d)", uint8(p))
+}
+
+// TorIsolation decides which connections through the tor proxy share a tor
+// circuit. Tor isolates streams by their socks5 credentials.
+type TorIsolation uint8
+
+const (
+	// IsolateConnection gives each connection its own circuit.
+	IsolateConnection TorIsolation = iota
+	// IsolateServer shares a circuit between the connections to one server
+	// and isolates it from other servers.
+	IsolateServer
+	// IsolateNone lets tor share circuits as it likes.
+	IsolateNone
+)
+
+// RequestCategory flags are categories of requests which are each sent on a
+// new connection with its own tor circuit so the server cannot link them to
+// the wallet's other requests.
+type RequestCategory uint8
+
+const (
+	// Broadcasts are transaction and package broadcasts.
+	Broadcasts RequestCategory = 1 << iota
+	// TxFetches are transaction and merkle proof fetches.
+	TxFetches
+)
+
+// isOnionAddr is true for onion servers and any address with an onion host.
+func isOnionAddr(netAddr *NodeServerAddr) bool {
+	if netAddr.IsOnion() {
+		return true
+	}
+	host, _, err := net.SplitHostPort(netAddr.String())
+	return err == nil && isOnionHost(host)
+}
+
+func isOnionHost(host string) bool {
+	return strings.HasSuffix(host, ".onion")
+}
+
+// proxyFor is the tor proxy to connect to the server through. It is an error
+// to connect to an onion server without a proxy or to a clearnet server with
+// the TorOnly policy.
+func (net *Network) proxyFor(netAddr *NodeServerAddr) (string, error) {
+	onion := isOnionAddr(netAddr)
+	switch net.config.TorPolicy {
+	case Clearnet:
+		if !onion {
+			return "", nil
+		}
+	case TorOnly:
+		if !onion {
+			return "", fmt.Errorf("%w: clearnet server %s with the %s policy",
+				ErrTorMisconfigured, netAddr, TorOnly)
+		}
+	}
+	if net.proxyAddr == "" {
+		return "", fmt.Errorf("%w: no ProxyPort to connect to %s", ErrTorMisconfigured, netAddr)
+	}
+	return net.proxyAddr, nil
+}
+
+// isolationFor is the configured stream isolation for the server.
+func (net *Network) isolationFor(netAddr *NodeServerAddr) TorIsolation {
+	if isolation, ok := net.config.TorServerIsolation[netAddr.String()]; ok {
+		return isolation
+	}
+	return net.config.TorIsolation
+}
+
+// numOnionPeers is the number of running onion peers - not locked
+func (net *Network) numOnionPeers() int {
+	n := 0
+	for _, peer := range net.peers {
+		if peer.nodeCtx.Err() == nil && isOnionAddr(peer.netAddr) {
+			n++
+		}
+	}
+	return n
+}
+
+// usableServer is true if the server can be started under the tor policy
+// - not locked
+func (net *Network) usableServer(server *serverAddr, forLeader bool) bool {
+	onion := server.IsOnion
+	switch net.config.TorPolicy {
+	case PreferTor:
+		return true
+	case TorOnly:
+		return onion
+	}
+	if !onion {
+		return true
+	}
+	if forLeader || net.proxyAddr == "" {
+		return false
+	}
+	return net.numOnionPeers() < net.config.MaxOnion
+}
+
+// onionsFirst moves the onion servers to the front keeping the order.
+func onionsFirst(servers []*serverAddr) []*serverAddr {
+	ordered := make([]*serverAddr, 0, len(servers))
+	for _, server := range servers {
+		if server.IsOnion {
+			ordered = append(ordered, server)
+		}
+	}
+	for _, server := range servers {
+		if !server.IsOnion {
+			ordered = append(ordered, server)
+		}
+	}
+	return ordered
+}
+
+// checkTor fails loudly if the tor settings cannot work rather than let the
+// network connect without tor.
+func (net *Network) checkTor(ctx context.Context) error {
+	err := net.checkTorConfig(ctx)
+	if err != nil {
+		fmt.Printf("ALERT: %v\n", err)
+	}
+	return err
+}
+
+func (net *Network) checkTorConfig(ctx context.Context) error {
+	cfg := net.config
+	if cfg.TorPolicy > TorOnly {
+		return fmt.Errorf("%w: unknown policy %s", ErrTorMisconfigured, cfg.TorPolicy)
+	}
+	if cfg.ProxyPort != "" {
+		port, err := strconv.Atoi(cfg.ProxyPort)
+		if err != nil || port <= 0 || port > 65535 {
+			return fmt.Errorf("%w: bad ProxyPort %q", ErrTorMisconfigured, cfg.ProxyPort)
+		}
+	}
+	if cfg.TrustedPeer != nil {
+		if _, err := net.proxyFor(cfg.TrustedPeer); err != nil {
+			return err
+		}
+	} else if cfg.TorPolicy != Clearnet && net.proxyAddr == "" {
+		return fmt.Errorf("%w: the %s policy needs a ProxyPort", ErrTorMisconfigured, cfg.TorPolicy)
+	}
+	if net.proxyAddr == "" || cfg.Transport != nil {
+		return nil
+	}
+	if err := probeSocksProxy(ctx, net.proxyAddr); err != nil {
+		return fmt.Errorf("%w: proxy %s: %v", ErrTorMisconfigured, net.proxyAddr, err)
+	}
+	if cfg.TorControlPort == "" {
+		return nil
+	}
+	status, err := CheckTorControl(ctx, net.torControlAddr(), cfg.TorControlPassword)
+	if err != nil {
+		return fmt.Errorf("%w: control port: %v", ErrTorMisconfigured, err)
+	}
+	if !status.CircuitEstablished {
+		return fmt.Errorf("%w: tor has no circuit - bootstrapped %d%%",
+			ErrTorMisconfigured, status.BootstrapProgress)
+	}
+	return nil
+}
+
+func (net *Network) torControlAddr() string {
+	return fmt.Sprintf("%s:%s", LOCALHOST, net.config.TorControlPort)
+}
+
+// TorStatus gets the status of tor from the configured TorControlPort.
+func (net *Network) TorStatus(ctx context.Context) (*TorStatus, error) {
+	if net.config.TorControlPort == "" {
+		return nil, errors.New("no tor control port configured")
+	}
+	return CheckTorControl(ctx, net.torControlAddr(), net.config.TorControlPassword)
+}
+
+// probeSocksProxy checks that a socks5 proxy listens at addr by offering it
+// the no auth and the username/password methods which tor accepts.
+func probeSocksProxy(ctx context.Context, addr string) error {
+	dialCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	conn, err := new(net.Dialer).DialContext(dialCtx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write([]byte{5, 2, 0, 2})
+	if err != nil {
+		return err
+	}
+	var reply [2]byte
+	_, err = io.ReadFull(conn, reply[:])
+	if err != nil {
+		return fmt.Errorf("no socks5 reply: %w", err)
+	}
+	if reply[0] != 5 {
+		return fmt.Errorf("not a socks5 proxy - version %d", reply[0])
+	}
+	if reply[1] == 0xff {
+		return errors.New("socks5 proxy accepts no auth method we offer")
+	}
+	return nil
+}
+
+// socksProxy is the proxy to dial addr through with the isolation
+// credentials.
+func socksProxy(proxyAddr, addr string, isolation TorIsolation) *socks.Proxy {
+	proxy := &socks.Proxy{Addr: proxyAddr}
+	switch isolation {
+	case IsolateServer:
+		sum := sha256.Sum256([]byte(addr))
+		proxy.Username = hex.EncodeToString(sum[:8])
+		proxy.Password = hex.EncodeToString(sum[8:16])
+	case IsolateNone:
+	default:
+		proxy.TorIsolation = true
+	}
+	return proxy
+}
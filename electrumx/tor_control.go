@@ -0,0 +1,216 @@
+package electrumx
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TorStatus is the health of a tor service from its control port.
+type TorStatus struct {
+	Version            string
+	BootstrapProgress  int
+	BootstrapSummary   string
+	CircuitEstablished bool
+}
+
+// CheckTorControl authenticates to the tor control port at addr and gets the
+// bootstrap and circuit status. The password is used if tor has a
+// HashedControlPassword, otherwise the cookie file or no auth is used as tor
+// offers.
+func CheckTorControl(ctx context.Context, addr, password string) (*TorStatus, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	conn, err := new(net.Dialer).DialContext(dialCtx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	err = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if err != nil {
+		return nil, err
+	}
+	tc := &torControl{conn: conn, r: bufio.NewReader(conn)}
+
+	lines, err := tc.command("PROTOCOLINFO 1")
+	if err != nil {
+		return nil, err
+	}
+	status := &TorStatus{}
+	var methods []string
+	var cookieFile string
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "AUTH "):
+			for _, field := range splitQuoted(line[len("AUTH "):]) {
+				k, v, _ := strings.Cut(field, "=")
+				switch k {
+				case "METHODS":
+					methods = strings.Split(v, ",")
+				case "COOKIEFILE":
+					cookieFile = unquote(v)
+				}
+			}
+		case strings.HasPrefix(line, "VERSION "):
+			for _, field := range splitQuoted(line[len("VERSION "):]) {
+				if k, v, _ := strings.Cut(field, "="); k == "Tor" {
+					status.Version = unquote(v)
+				}
+			}
+		}
+	}
+
+	auth, err := authCommand(methods, password, cookieFile)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = tc.command(auth); err != nil {
+		return nil, err
+	}
+
+	lines, err = tc.command("GETINFO status/bootstrap-phase status/circuit-established")
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		k, v, _ := strings.Cut(line, "=")
+		switch k {
+		case "status/circuit-established":
+			status.CircuitEstablished = v == "1"
+		case "status/bootstrap-phase":
+			for _, field := range splitQuoted(v) {
+				k, v, _ := strings.Cut(field, "=")
+				switch k {
+				case "PROGRESS":
+					status.BootstrapProgress, _ = strconv.Atoi(v)
+				case "SUMMARY":
+					status.BootstrapSummary = unquote(v)
+				}
+			}
+		}
+	}
+	tc.command("QUIT")
+	return status, nil
+}
+
+// authCommand picks the AUTHENTICATE command for the methods tor offers.
+func authCommand(methods []string, password, cookieFile string) (string, error) {
+	offered := func(method string) bool {
+		for _, m := range methods {
+			if m == method {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case password != "" && offered("HASHEDPASSWORD"):
+		return "AUTHENTICATE " + quote(password), nil
+	case offered("NULL"):
+		return "AUTHENTICATE", nil
+	case offered("COOKIE") && cookieFile != "":
+		cookie, err := os.ReadFile(cookieFile)
+		if err != nil {
+			return "", fmt.Errorf("tor control cookie: %w", err)
+		}
+		return "AUTHENTICATE " + hex.EncodeToString(cookie), nil
+	case offered("HASHEDPASSWORD"):
+		return "", fmt.Errorf("tor control port needs a password")
+	}
+	return "", fmt.Errorf("no supported tor control auth method in %v", methods)
+}
+
+type torControl struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// command sends a command and reads the reply lines without their status
+// codes. A reply other than 250 is an error.
+func (tc *torControl) command(cmd string) ([]string, error) {
+	_, err := tc.conn.Write([]byte(cmd + "\r\n"))
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for {
+		line, err := tc.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if len(line) < 4 {
+			return nil, fmt.Errorf("bad tor control reply %q", line)
+		}
+		code, sep, text := line[:3], line[3], line[4:]
+		if code != "250" {
+			return nil, fmt.Errorf("tor control %s: %s %s", strings.Fields(cmd)[0], code, text)
+		}
+		lines = append(lines, text)
+		switch sep {
+		case ' ':
+			return lines, nil
+		case '+':
+			// data lines up to a lone "."
+			for {
+				data, err := tc.r.ReadString('\n')
+				if err != nil {
+					return nil, err
+				}
+				data = strings.TrimRight(data, "\r\n")
+				if data == "." {
+					break
+				}
+				lines = append(lines, data)
+			}
+		}
+	}
+}
+
+// splitQuoted splits on spaces outside of quoted strings.
+func splitQuoted(s string) []string {
+	var fields []string
+	var field strings.Builder
+	quoted, escaped := false, false
+	for _, c := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\' && quoted:
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == ' ' && !quoted:
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+			continue
+		}
+		field.WriteRune(c)
+	}
+	if field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
+
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	s = s[1 : len(s)-1]
+	s = strings.ReplaceAll(s, `\"`, `"`)
+	return strings.ReplaceAll(s, `\\`, `\`)
+}
@@ -0,0 +1,408 @@
+package electrumx
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testOnion = "fakeonionfakeonionfakeonionfakeonionfakeonionfakeonionfake.onion:50002"
+
+// fakeSocks is a socks5 proxy which records the credentials and target of
+// each stream. Onion targets are routed to a fake server.
+type fakeSocks struct {
+	listener net.Listener
+	route    map[string]string
+	mtx      sync.Mutex
+	streams  []socksStream
+}
+
+type socksStream struct {
+	user   string
+	target string
+}
+
+func newFakeSocks(t *testing.T, route map[string]string) *fakeSocks {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	p := &fakeSocks{listener: listener, route: route}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go p.serve(conn)
+		}
+	}()
+	return p
+}
+
+func (p *fakeSocks) port() string {
+	return strconv.Itoa(p.listener.Addr().(*net.TCPAddr).Port)
+}
+
+func (p *fakeSocks) getStreams() []socksStream {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return append([]socksStream(nil), p.streams...)
+}
+
+func (p *fakeSocks) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	readN := func(n int) []byte {
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil
+		}
+		return b
+	}
+	hdr := readN(2)
+	if hdr == nil {
+		return
+	}
+	methods := readN(int(hdr[1]))
+	method := byte(0)
+	if strings.IndexByte(string(methods), 2) >= 0 {
+		method = 2
+	}
+	conn.Write([]byte{5, method})
+	var user string
+	if method == 2 {
+		auth := readN(2)
+		if auth == nil {
+			return
+		}
+		name := readN(int(auth[1]))
+		plen := readN(1)
+		if plen == nil {
+			return
+		}
+		user = string(name) + ":" + string(readN(int(plen[0])))
+		conn.Write([]byte{1, 0})
+	}
+	req := readN(4)
+	if req == nil {
+		return
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		host = net.IP(readN(4)).String()
+	case 3:
+		host = string(readN(int(readN(1)[0])))
+	case 4:
+		host = net.IP(readN(16)).String()
+	}
+	target := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(readN(2)))))
+	p.mtx.Lock()
+	p.streams = append(p.streams, socksStream{user: user, target: target})
+	p.mtx.Unlock()
+	if routed, ok := p.route[target]; ok {
+		target = routed
+	}
+	up, err := net.Dial("tcp", target)
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer up.Close()
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	go io.Copy(up, r)
+	io.Copy(conn, up)
+}
+
+// fakeTorControl serves the tor control protocol for one auth method.
+func fakeTorControl(t *testing.T, method, secret, circuit string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	cookieFile := filepath.Join(t.TempDir(), "control_auth_cookie")
+	want := "AUTHENTICATE"
+	switch method {
+	case "HASHEDPASSWORD":
+		want += " " + quote(secret)
+	case "COOKIE":
+		if err := os.WriteFile(cookieFile, []byte(secret), 0600); err != nil {
+			t.Fatal(err)
+		}
+		want += " " + hex.EncodeToString([]byte(secret))
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					line = strings.TrimRight(line, "\r\n")
+					var reply string
+					switch strings.Fields(line)[0] {
+					case "PROTOCOLINFO":
+						reply = fmt.Sprintf("250-PROTOCOLINFO 1\r\n250-AUTH METHODS=%s COOKIEFILE=%s\r\n"+
+							"250-VERSION Tor=\"0.4.8.9\"\r\n250 OK\r\n", method, quote(cookieFile))
+					case "AUTHENTICATE":
+						reply = "250 OK\r\n"
+						if line != want {
+							reply = "515 Authentication failed\r\n"
+						}
+					case "GETINFO":
+						reply = "250-status/bootstrap-phase=NOTICE BOOTSTRAP PROGRESS=100 TAG=done SUMMARY=\"Done\"\r\n" +
+							"250-status/circuit-established=" + circuit + "\r\n250 OK\r\n"
+					case "QUIT":
+						conn.Write([]byte("250 closing connection\r\n"))
+						return
+					}
+					conn.Write([]byte(reply))
+				}
+			}()
+		}
+	}()
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func setProxyPort(n *Network, port string) {
+	n.config.ProxyPort = port
+	n.proxyAddr = fmt.Sprintf("%s:%s", LOCALHOST, port)
+}
+
+func TestTorPolicy(t *testing.T) {
+	s := mkFakeServer(t, 1)
+	net := mkFakeNetwork(t, s)
+	onion := &NodeServerAddr{Net: "ssl", Addr: testOnion}
+	clear := &NodeServerAddr{Net: "ssl", Addr: "10.0.0.1:50002"}
+	net.knownServers = []*serverAddr{
+		{Net: "ssl", Address: testOnion, IsOnion: true},
+		{Net: "ssl", Address: "10.0.0.1:50002"},
+	}
+
+	tests := []struct {
+		policy    TorPolicy
+		proxyPort string
+		maxOnion  int
+		// proxy for the clearnet and the onion server or "err"
+		clearProxy, onionProxy string
+		// available servers for a peer and for the leader, onion first
+		peers, leaders string
+	}{
+		{Clearnet, "", 2, "", "err", "c", "c"},
+		{Clearnet, "9050", 0, "", "proxy", "c", "c"},
+		{Clearnet, "9050", 2, "", "proxy", "oc", "c"},
+		{PreferTor, "", 2, "err", "err", "oc", "oc"},
+		{PreferTor, "9050", 0, "proxy", "proxy", "oc", "oc"},
+		{TorOnly, "9050", 0, "err", "proxy", "o", "o"},
+	}
+	for i, test := range tests {
+		net.config.TorPolicy = test.policy
+		net.config.MaxOnion = test.maxOnion
+		net.proxyAddr = ""
+		if test.proxyPort != "" {
+			setProxyPort(net, test.proxyPort)
+		}
+		for _, c := range []struct {
+			addr *NodeServerAddr
+			want string
+		}{{clear, test.clearProxy}, {onion, test.onionProxy}} {
+			proxy, err := net.proxyFor(c.addr)
+			switch {
+			case c.want == "err":
+				if !errors.Is(err, ErrTorMisconfigured) {
+					t.Fatalf("%d: %s proxy %q: %v", i, c.addr, proxy, err)
+				}
+			case err != nil:
+				t.Fatalf("%d: %s: %v", i, c.addr, err)
+			case (c.want == "proxy") != (proxy == net.proxyAddr && proxy != ""):
+				t.Fatalf("%d: %s proxy %q", i, c.addr, proxy)
+			}
+		}
+		for _, forLeader := range []bool{false, true} {
+			got := ""
+			for _, server := range net.availableServers(forLeader) {
+				if server.IsOnion {
+					got += "o"
+				} else {
+					got += "c"
+				}
+			}
+			want := test.peers
+			if forLeader {
+				want = test.leaders
+			}
+			// only PreferTor orders onions first
+			if got != want && !(test.policy == Clearnet && got == "co" && want == "oc") {
+				t.Fatalf("%d: leader %v: servers %q, want %q", i, forLeader, got, want)
+			}
+		}
+	}
+}
+
+func TestTorMisconfigured(t *testing.T) {
+	s := mkFakeServer(t, 50)
+	socksPort := newFakeSocks(t, nil).port()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	downPort := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	listener.Close()
+	_, serverPort, _ := net.SplitHostPort(s.Addr())
+
+	tests := []struct {
+		name   string
+		config func(net *Network)
+	}{
+		{"tor policy without proxy", func(net *Network) {
+			net.config.TorPolicy = PreferTor
+		}},
+		{"clearnet trusted peer with TorOnly", func(net *Network) {
+			net.config.TorPolicy = TorOnly
+			setProxyPort(net, socksPort)
+		}},
+		{"onion trusted peer without proxy", func(net *Network) {
+			net.config.TrustedPeer = &NodeServerAddr{Net: "ssl", Addr: testOnion, Onion: true}
+		}},
+		{"bad proxy port", func(net *Network) {
+			setProxyPort(net, "90500")
+		}},
+		{"proxy down", func(net *Network) {
+			setProxyPort(net, downPort)
+		}},
+		{"not a socks5 proxy", func(net *Network) {
+			setProxyPort(net, serverPort)
+		}},
+		{"tor without a circuit", func(net *Network) {
+			setProxyPort(net, socksPort)
+			net.config.TorControlPort = fakeTorControl(t, "NULL", "", "0")
+		}},
+		{"wrong control password", func(net *Network) {
+			setProxyPort(net, socksPort)
+			net.config.TorControlPort = fakeTorControl(t, "HASHEDPASSWORD", "secret", "1")
+			net.config.TorControlPassword = "guess"
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			net := mkFakeNetwork(t, s)
+			test.config(net)
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+			defer cancel()
+			err := net.Start(ctx)
+			if !errors.Is(err, ErrTorMisconfigured) {
+				t.Fatalf("started: %v", err)
+			}
+			// never connected around the proxy
+			if n := s.Requests("server.version"); n != 0 {
+				t.Fatalf("%d connections to the server", n)
+			}
+		})
+	}
+}
+
+func TestTorProxy(t *testing.T) {
+	s := mkFakeServer(t, 50)
+	s.Chain().AddTx("ab", "0100")
+	proxy := newFakeSocks(t, map[string]string{testOnion: s.Addr()})
+
+	net := mkFakeNetwork(t, s)
+	net.config.TrustedPeer = &NodeServerAddr{Net: "ssl", Addr: testOnion, Onion: true}
+	net.config.TorPolicy = TorOnly
+	net.config.TorIsolation = IsolateServer
+	net.config.TorIsolateRequests = TxFetches
+	net.config.TorControlPort = fakeTorControl(t, "NULL", "", "1")
+	setProxyPort(net, proxy.port())
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	if err := net.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if tip, err := net.Tip(); err != nil || tip != 49 {
+		t.Fatalf("synced to %d: %v", tip, err)
+	}
+	streams := proxy.getStreams()
+	serverCreds := socksProxy(net.proxyAddr, testOnion, IsolateServer)
+	if len(streams) != 1 || streams[0].target != testOnion ||
+		streams[0].user != serverCreds.Username+":"+serverCreds.Password {
+		t.Fatalf("streams %v", streams)
+	}
+
+	// tx fetches each on a new circuit
+	for i := 0; i < 2; i++ {
+		if rawTx, err := net.GetRawTransaction(ctx, "ab"); err != nil || rawTx != "0100" {
+			t.Fatalf("raw tx %q: %v", rawTx, err)
+		}
+	}
+	streams = proxy.getStreams()
+	if len(streams) != 3 || streams[1].user == streams[0].user ||
+		streams[2].user == streams[1].user || streams[1].target != testOnion {
+		t.Fatalf("streams %v", streams)
+	}
+	// other requests stay on the server's connection
+	if _, err := net.GetHistory(ctx, "0123"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(proxy.getStreams()); n != 3 {
+		t.Fatalf("%d streams", n)
+	}
+}
+
+func TestTorControl(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	tests := []struct {
+		method, secret, password string
+		ok                       bool
+	}{
+		{"NULL", "", "", true},
+		{"HASHEDPASSWORD", `pass "word"`, `pass "word"`, true},
+		{"HASHEDPASSWORD", "secret", "", false},
+		{"HASHEDPASSWORD", "secret", "guess", false},
+		{"COOKIE", "0123456789abcdef0123456789abcdef", "", true},
+	}
+	for _, test := range tests {
+		port := fakeTorControl(t, test.method, test.secret, "1")
+		status, err := CheckTorControl(ctx, "127.0.0.1:"+port, test.password)
+		if !test.ok {
+			if err == nil {
+				t.Fatalf("%s %q: authenticated with %q", test.method, test.secret, test.password)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.method, err)
+		}
+		want := TorStatus{
+			Version:            "0.4.8.9",
+			BootstrapProgress:  100,
+			BootstrapSummary:   "Done",
+			CircuitEstablished: true,
+		}
+		if *status != want {
+			t.Fatalf("%s: status %+v", test.method, status)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package electrumx
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// Transport connects a serverConn to a server. The returned conn carries the
+// newline delimited JSON-RPC messages in the clear so any TLS is done in Dial.
+type Transport interface {
+	Dial(ctx context.Context, addr string) (net.Conn, error)
+}
+
+// streamTransport dials a tcp stream, through the tor socks5 proxy if set,
+// and wraps it in TLS for ssl servers. It is used when no other Transport is
+// configured.
+type streamTransport struct {
+	tlsConfig    *tls.Config
+	torProxy     string
+	torIsolation TorIsolation
+}
+
+func (t *streamTransport) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	var dial func(ctx context.Context, network, addr string) (net.Conn, error)
+	var dialCtx context.Context
+	var dialCancel context.CancelFunc
+
+	if t.torProxy != "" {
+		dial = socksProxy(t.torProxy, addr, t.torIsolation).DialContext
+		dialCtx, dialCancel = context.WithTimeout(ctx, 20*time.Second)
+		defer dialCancel()
+	} else {
+		dial = new(net.Dialer).DialContext
+		dialCtx, dialCancel = context.WithTimeout(ctx, 5*time.Second)
+		defer dialCancel()
+	}
+
+	conn, err := dial(dialCtx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.tlsConfig != nil {
+		conn = tls.Client(conn, t.tlsConfig)
+		err = conn.(*tls.Conn).HandshakeContext(ctx)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// transport is the configured Transport or the one for the server's protocol.
+func (opts *connectOpts) transport() Transport {
+	if opts.Transport != nil {
+		return opts.Transport
+	}
+	if opts.WebSocket {
+		return &wsTransport{
+			tlsConfig:    opts.TLSConfig,
+			torProxy:     opts.TorProxy,
+			torIsolation: opts.TorIsolation,
+		}
+	}
+	return &streamTransport{
+		tlsConfig:    opts.TLSConfig,
+		torProxy:     opts.TorProxy,
+		torIsolation: opts.TorIsolation,
+	}
+}
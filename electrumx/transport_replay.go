@@ -0,0 +1,506 @@
+package electrumx
+
+// Session recording and replay.
+//
+// A recorded session is a file of json lines. The first line has the server
+// address. Each line after it is a message sent to the server or received
+// from it, in the order seen. Pings and their responses are not recorded
+// since their number depends on how long the session ran.
+//
+// A Replayer serves recorded sessions as the server. Each request from the
+// client is matched to the next unmatched recorded request with the same
+// method and params and the ids in the recorded responses are changed to the
+// client's. Recorded responses and notifications are sent in their recorded
+// order once all the requests recorded before them have been made, so a
+// replay is the same each time. A request which is not in the recording gets
+// an error response and is kept as a divergence. Requests sent concurrently
+// may be made in either order.
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	recordOpen = "open"
+	recordSend = "send"
+	recordRecv = "recv"
+)
+
+// recordLine is one line of a recorded session file.
+type recordLine struct {
+	Dir  string          `json:"dir"`
+	Addr string          `json:"addr,omitempty"`
+	Msg  json.RawMessage `json:"msg,omitempty"`
+}
+
+// recorder is a conn which records the messages sent and received to a file.
+type recorder struct {
+	net.Conn
+	mtx       sync.Mutex
+	file      *os.File
+	closeOnce sync.Once
+	// partial messages
+	sent []byte
+	rcvd []byte
+	// ids of pings waiting for a response
+	pings map[uint64]bool
+}
+
+// recordConn records the session on conn with the server at addr to a new
+// file in dir.
+func recordConn(conn net.Conn, dir, addr string) (net.Conn, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%s-%d.jsonl", strings.NewReplacer(":", "_", "/", "_").Replace(addr), time.Now().UnixNano())
+	file, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	r := &recorder{
+		Conn:  conn,
+		file:  file,
+		pings: make(map[uint64]bool),
+	}
+	err = r.write(&recordLine{Dir: recordOpen, Addr: addr})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	n, err := r.Conn.Write(b)
+	r.mtx.Lock()
+	r.sent = r.record(append(r.sent, b[:n]...), recordSend)
+	r.mtx.Unlock()
+	return n, err
+}
+
+func (r *recorder) Read(b []byte) (int, error) {
+	n, err := r.Conn.Read(b)
+	r.mtx.Lock()
+	r.rcvd = r.record(append(r.rcvd, b[:n]...), recordRecv)
+	r.mtx.Unlock()
+	return n, err
+}
+
+func (r *recorder) Close() error {
+	err := r.Conn.Close()
+	r.closeOnce.Do(func() {
+		r.mtx.Lock()
+		r.file.Close()
+		r.mtx.Unlock()
+	})
+	return err
+}
+
+// record records each whole message in buf and returns the rest - locked
+func (r *recorder) record(buf []byte, dir string) []byte {
+	for {
+		i := bytes.IndexByte(buf, newline)
+		if i < 0 {
+			return buf
+		}
+		msg := bytes.TrimSpace(buf[:i])
+		buf = buf[i+1:]
+		if len(msg) == 0 || !json.Valid(msg) || r.isPing(msg, dir) {
+			continue
+		}
+		err := r.write(&recordLine{Dir: dir, Msg: msg})
+		if err != nil {
+			stderrPrinter("recording %s: %v", r.RemoteAddr(), err)
+		}
+	}
+}
+
+// isPing reports whether msg is a ping or the response to one - locked
+func (r *recorder) isPing(msg []byte, dir string) bool {
+	if isBatch(msg) {
+		return false
+	}
+	var m response
+	if json.Unmarshal(msg, &m) != nil {
+		return false
+	}
+	if dir == recordSend {
+		if m.Method == "server.ping" {
+			r.pings[m.ID] = true
+			return true
+		}
+		return false
+	}
+	if m.Method == "" && r.pings[m.ID] {
+		delete(r.pings, m.ID)
+		return true
+	}
+	return false
+}
+
+// write - locked
+func (r *recorder) write(line *recordLine) error {
+	b, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	_, err = r.file.Write(append(b, newline))
+	return err
+}
+
+// rpcCall is a request with its params decoded for comparison.
+type rpcCall struct {
+	ID     uint64 `json:"id"`
+	Method string `json:"method"`
+	Params any    `json:"params"`
+}
+
+// requestKey returns the method and params of a request or batch with the
+// ids removed so requests can be compared, and the ids.
+func requestKey(msg []byte) (string, []uint64, error) {
+	dec := json.NewDecoder(bytes.NewReader(msg))
+	dec.UseNumber()
+	var calls []*rpcCall
+	if isBatch(msg) {
+		err := dec.Decode(&calls)
+		if err != nil {
+			return "", nil, err
+		}
+	} else {
+		var call rpcCall
+		err := dec.Decode(&call)
+		if err != nil {
+			return "", nil, err
+		}
+		calls = append(calls, &call)
+	}
+	ids := make([]uint64, len(calls))
+	keys := make([]string, len(calls))
+	for i, call := range calls {
+		ids[i] = call.ID
+		params, err := json.Marshal(call.Params)
+		if err != nil {
+			return "", nil, err
+		}
+		keys[i] = call.Method + string(params)
+	}
+	return strings.Join(keys, " "), ids, nil
+}
+
+// replayEvent is a recorded request, or a response or notification.
+type replayEvent struct {
+	request bool
+	key     string
+	ids     []uint64
+	msg     json.RawMessage
+	matched bool
+}
+
+type replaySession struct {
+	addr   string
+	events []*replayEvent
+	used   bool
+	// events up to the cursor are sent or matched
+	cursor int
+	// recorded => live request ids
+	liveIDs map[uint64]uint64
+	// messages waiting to be written to the client
+	queueMtx sync.Mutex
+	queue    [][]byte
+	wake     chan struct{}
+}
+
+// Replayer is a Transport which serves recorded sessions. Each Dial replays
+// the next unused session recorded for the address.
+type Replayer struct {
+	mtx         sync.Mutex
+	sessions    []*replaySession
+	divergences []error
+}
+
+// NewReplayer loads the session files recorded with ElectrumXConfig.RecordDir
+// set.
+func NewReplayer(paths ...string) (*Replayer, error) {
+	r := &Replayer{}
+	for _, path := range paths {
+		s, err := loadSession(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		r.sessions = append(r.sessions, s)
+	}
+	return r, nil
+}
+
+func loadSession(path string) (*replaySession, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &replaySession{
+		liveIDs: make(map[uint64]uint64),
+		wake:    make(chan struct{}, 1),
+	}
+	for i, raw := range bytes.Split(b, []byte{newline}) {
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+		var line recordLine
+		err := json.Unmarshal(raw, &line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		switch line.Dir {
+		case recordOpen:
+			s.addr = line.Addr
+		case recordSend:
+			key, ids, err := requestKey(line.Msg)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			s.events = append(s.events, &replayEvent{request: true, key: key, ids: ids})
+		case recordRecv:
+			s.events = append(s.events, &replayEvent{msg: line.Msg})
+		default:
+			return nil, fmt.Errorf("line %d: unknown direction %q", i+1, line.Dir)
+		}
+	}
+	if s.addr == "" {
+		return nil, errors.New("no server address")
+	}
+	return s, nil
+}
+
+// Dial replays the next unused session recorded for addr.
+func (r *Replayer) Dial(_ context.Context, addr string) (net.Conn, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for _, s := range r.sessions {
+		if s.used || s.addr != addr {
+			continue
+		}
+		s.used = true
+		client, server := net.Pipe()
+		done := make(chan struct{})
+		go r.serve(s, server, done)
+		go s.writer(server, done)
+		s.advance()
+		return client, nil
+	}
+	return nil, fmt.Errorf("no recorded session for %s", addr)
+}
+
+// Err returns the first request not in the recordings if any.
+func (r *Replayer) Err() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if len(r.divergences) == 0 {
+		return nil
+	}
+	return r.divergences[0]
+}
+
+// Divergences returns all the requests made which were not in the
+// recordings.
+func (r *Replayer) Divergences() []error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return append([]error(nil), r.divergences...)
+}
+
+// Remaining is the number of recorded requests not made yet.
+func (r *Replayer) Remaining() int {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	n := 0
+	for _, s := range r.sessions {
+		for _, e := range s.events {
+			if e.request && !e.matched {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// serve reads the client's requests until the conn is closed.
+func (r *Replayer) serve(s *replaySession, conn net.Conn, done chan struct{}) {
+	defer close(done)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		msg, err := reader.ReadBytes(newline)
+		if err != nil {
+			return
+		}
+		msg = bytes.TrimSpace(msg)
+		if len(msg) == 0 {
+			continue
+		}
+		r.mtx.Lock()
+		r.request(s, msg)
+		r.mtx.Unlock()
+	}
+}
+
+// request matches a request from the client to the recording - locked
+func (r *Replayer) request(s *replaySession, msg []byte) {
+	key, ids, err := requestKey(msg)
+	if err != nil {
+		r.divergences = append(r.divergences, fmt.Errorf("replay %s: bad request: %w", s.addr, err))
+		return
+	}
+	batch := isBatch(msg)
+	if !batch && strings.HasPrefix(key, "server.ping[") {
+		s.send(replyMsg(ids, batch, json.RawMessage("null"), nil))
+		return
+	}
+	for _, e := range s.events[s.cursor:] {
+		if !e.request || e.matched || e.key != key {
+			continue
+		}
+		e.matched = true
+		for i, id := range e.ids {
+			s.liveIDs[id] = ids[i]
+		}
+		s.advance()
+		return
+	}
+	r.divergences = append(r.divergences, fmt.Errorf("replay %s: request not in recording: %s", s.addr, key))
+	s.send(replyMsg(ids, batch, nil, &RPCError{Code: -32600, Message: "replay: request not in recording"}))
+}
+
+// advance sends the recorded responses and notifications up to the next
+// request not made yet - locked
+func (s *replaySession) advance() {
+	for ; s.cursor < len(s.events); s.cursor++ {
+		e := s.events[s.cursor]
+		if e.request {
+			if !e.matched {
+				return
+			}
+			continue
+		}
+		msg, err := s.withLiveIDs(e.msg)
+		if err != nil {
+			stderrPrinter("replay %s: %v", s.addr, err)
+			continue
+		}
+		s.send(msg)
+	}
+}
+
+// withLiveIDs changes the recorded request ids in a response to the ids of
+// the client's requests. Notifications have no id.
+func (s *replaySession) withLiveIDs(msg json.RawMessage) ([]byte, error) {
+	if isBatch(msg) {
+		var resps []map[string]json.RawMessage
+		err := json.Unmarshal(msg, &resps)
+		if err != nil {
+			return nil, err
+		}
+		for _, resp := range resps {
+			err = s.liveID(resp)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return json.Marshal(resps)
+	}
+	var resp map[string]json.RawMessage
+	err := json.Unmarshal(msg, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := resp["method"]; ok {
+		return msg, nil
+	}
+	err = s.liveID(resp)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(resp)
+}
+
+func (s *replaySession) liveID(resp map[string]json.RawMessage) error {
+	var id uint64
+	err := json.Unmarshal(resp["id"], &id)
+	if err != nil {
+		return err
+	}
+	live, ok := s.liveIDs[id]
+	if !ok {
+		return fmt.Errorf("response to unknown request %d", id)
+	}
+	resp["id"], _ = json.Marshal(live)
+	return nil
+}
+
+// send queues msg for the writer.
+func (s *replaySession) send(msg []byte) {
+	s.queueMtx.Lock()
+	s.queue = append(s.queue, msg)
+	s.queueMtx.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// writer writes the queued messages to the client so the replayer is not
+// blocked while the client is busy.
+func (s *replaySession) writer(conn net.Conn, done chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-s.wake:
+		}
+		s.queueMtx.Lock()
+		queue := s.queue
+		s.queue = nil
+		s.queueMtx.Unlock()
+		for _, msg := range queue {
+			_, err := conn.Write(append(msg, newline))
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// replyResponse is a response made by the replayer.
+type replyResponse struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	ID      uint64          `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// replyMsg makes a response to a request, or responses to a batch, with the
+// ids.
+func replyMsg(ids []uint64, batch bool, result json.RawMessage, rpcErr *RPCError) []byte {
+	resps := make([]*replyResponse, len(ids))
+	for i, id := range ids {
+		resps[i] = &replyResponse{Jsonrpc: "2.0", ID: id, Result: result, Error: rpcErr}
+	}
+	var b []byte
+	if batch {
+		b, _ = json.Marshal(resps)
+	} else {
+		b, _ = json.Marshal(resps[0])
+	}
+	return b
+}
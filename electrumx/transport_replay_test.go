@@ -0,0 +1,94 @@
+package electrumx
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dev-warrior777/go-electrum-client/electrumx/electrumxtest"
+)
+
+// replaySessionRequests makes the same requests in a record or a replay.
+func replaySessionRequests(t *testing.T, ctx context.Context, net *Network) {
+	if err := net.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if tip, err := net.Tip(); err != nil || tip != 49 {
+		t.Fatalf("synced to %d: %v", tip, err)
+	}
+	history, err := net.GetHistory(ctx, "0123")
+	if err != nil || len(history) != 1 || history[0].TxHash != "ab" {
+		t.Fatalf("history %v: %v", history, err)
+	}
+	select {
+	case tip := <-net.GetTipChangeNotify():
+		if tip != 50 {
+			t.Fatalf("tip change to %d", tip)
+		}
+	case <-ctx.Done():
+		t.Fatal("no tip change")
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	s := mkFakeServer(t, 50)
+	chain := s.Chain()
+	chain.SetHistory("0123", []electrumxtest.HistoryItem{{TxHash: "ab", Height: 40}})
+	// the tip changes after the history is sent
+	next := mkTestChain(t, 51)[50*BTC_HEADER_SIZE:]
+	go func() {
+		for s.Requests("blockchain.scripthash.get_history") == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		time.Sleep(100 * time.Millisecond)
+		chain.AddHeaders(next)
+		s.NotifyTip()
+	}()
+
+	// record
+	dir := t.TempDir()
+	net := mkFakeNetwork(t, s)
+	net.config.RecordDir = dir
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	replaySessionRequests(t, ctx, net)
+	sc := net.getLeader().node.server.conn
+	cancel()
+	<-sc.Done()
+	s.Close()
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if len(paths) != 1 {
+		t.Fatalf("recorded %d sessions", len(paths))
+	}
+
+	// replay with the server gone
+	replayer, err := NewReplayer(paths...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	net = mkFakeNetwork(t, s)
+	net.config.Transport = replayer
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	replaySessionRequests(t, ctx, net)
+	if err := replayer.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a request not in the recording
+	_, err = net.GetHistory(ctx, "4567")
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || replayer.Err() == nil {
+		t.Fatalf("divergence not flagged: %v", err)
+	}
+	if n := len(replayer.Divergences()); n != 1 {
+		t.Fatalf("%d divergences", n)
+	}
+
+	// each session replays once
+	if _, err := replayer.Dial(ctx, s.Addr()); err == nil {
+		t.Fatal("session replayed twice")
+	}
+}
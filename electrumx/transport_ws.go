@@ -0,0 +1,109 @@
+package electrumx
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// wsTransport connects to ws and wss servers. The websocket handshake is done
+// over the same stream as for tcp and ssl servers so onion servers can be
+// reached through the tor proxy.
+type wsTransport struct {
+	tlsConfig    *tls.Config
+	torProxy     string
+	torIsolation TorIsolation
+}
+
+func (t *wsTransport) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	stream := &streamTransport{
+		tlsConfig:    t.tlsConfig,
+		torProxy:     t.torProxy,
+		torIsolation: t.torIsolation,
+	}
+	conn, err := stream.Dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := "ws"
+	if t.tlsConfig != nil {
+		scheme = "wss"
+	}
+	config, err := websocket.NewConfig(scheme+"://"+addr+"/", "http://"+addr)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) > 10*time.Second {
+		deadline = time.Now().Add(10 * time.Second)
+	}
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	ws, err := websocket.NewClient(config, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	err = conn.SetDeadline(time.Time{})
+	if err != nil {
+		ws.Close()
+		return nil, err
+	}
+	ws.PayloadType = websocket.TextFrame
+	return &wsConn{Conn: ws}, nil
+}
+
+// wsConn carries one JSON-RPC message per websocket message. Reads end each
+// message with a newline as on a tcp stream and writes send each line as a
+// message.
+type wsConn struct {
+	*websocket.Conn
+	// rest of the last message read
+	rbuf []byte
+	// partial line written
+	wmtx sync.Mutex
+	wbuf []byte
+}
+
+// Read is only called from the listen thread.
+func (c *wsConn) Read(b []byte) (int, error) {
+	if len(c.rbuf) == 0 {
+		var msg []byte
+		err := websocket.Message.Receive(c.Conn, &msg)
+		if err != nil {
+			return 0, err
+		}
+		c.rbuf = append(bytes.TrimRight(msg, "\r\n"), newline)
+	}
+	n := copy(b, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	return n, nil
+}
+
+func (c *wsConn) Write(b []byte) (int, error) {
+	c.wmtx.Lock()
+	defer c.wmtx.Unlock()
+	c.wbuf = append(c.wbuf, b...)
+	for {
+		i := bytes.IndexByte(c.wbuf, newline)
+		if i < 0 {
+			return len(b), nil
+		}
+		msg := string(c.wbuf[:i])
+		c.wbuf = c.wbuf[i+1:]
+		err := websocket.Message.Send(c.Conn, msg)
+		if err != nil {
+			return 0, err
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package electrumx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dev-warrior777/go-electrum-client/electrumx/electrumxtest"
+)
+
+func TestNetworkWebSocket(t *testing.T) {
+	for _, proto := range []string{"ws", "wss"} {
+		t.Run(proto, func(t *testing.T) {
+			s := mkFakeServerOpts(t, 50, &electrumxtest.Options{
+				TLS:       proto == "wss",
+				WebSocket: true,
+			})
+			net := mkFakeNetwork(t, s)
+			net.config.TrustedPeer = &NodeServerAddr{Net: proto, Addr: s.Addr()}
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+			defer cancel()
+			if err := net.Start(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if tip, err := net.Tip(); err != nil || tip != 49 {
+				t.Fatalf("synced to %d: %v", tip, err)
+			}
+
+			// batches and notifications
+			chain := s.Chain()
+			chain.SetHistory("0123", []electrumxtest.HistoryItem{{TxHash: "ab", Height: 40}})
+			results, err := net.SubscribeScripthashNotifyBatch(ctx, []string{"0123", "4567"})
+			if err != nil || len(results) != 2 || results[0].Status != chain.Status("0123") {
+				t.Fatalf("batch %v: %v", results, err)
+			}
+			chain.AddHeaders(mkTestChain(t, 51)[50*BTC_HEADER_SIZE:])
+			s.NotifyTip()
+			select {
+			case tip := <-net.GetTipChangeNotify():
+				if tip != 50 {
+					t.Fatalf("tip change to %d", tip)
+				}
+			case <-ctx.Done():
+				t.Fatal("no tip change")
+			}
+		})
+	}
+}
+
+func TestWebSocketPeerFeatures(t *testing.T) {
+	servers := makeIncomingServerAddrs([]*peersResult{
+		{Addr: "203.132.94.196", Host: "a.org", Feats: []string{"v1.4.2", "s50002", "w50003", "wss50004"}},
+		{Addr: "203.132.94.197", Host: "b.org", Feats: []string{"v1.4.2", "ws", "t50001"}},
+	})
+	want := []string{
+		"ssl 203.132.94.196:50002",
+		"ws 203.132.94.196:50003",
+		"wss 203.132.94.196:50004",
+		"tcp 203.132.94.197:50001",
+		"ws 203.132.94.197:51003",
+	}
+	if len(servers) != len(want) {
+		t.Fatalf("got %d servers", len(servers))
+	}
+	for i, server := range servers {
+		if got := server.Net + " " + server.Address; got != want[i] {
+			t.Fatalf("server %d: want %s got %s", i, want[i], got)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package bdb
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dev-warrior777/go-electrum-client/wallet"
+	bolt "go.etcd.io/bbolt"
+)
+
+var ErrBroadcastNotFound = errors.New("pending broadcast not found")
+
+type BroadcastsDB struct {
+	db   *bolt.DB
+	lock *sync.RWMutex
+}
+
+func (b *BroadcastsDB) Put(broadcast *wallet.PendingBroadcast) error {
+	brec := &broadcastRec{
+		Txid:        broadcast.Txid,
+		RawTx:       broadcast.RawTx,
+		Created:     broadcast.Created.Unix(),
+		Attempts:    broadcast.Attempts,
+		LastAttempt: broadcast.LastAttempt.Unix(),
+		LastError:   broadcast.LastError,
+	}
+	return b.put(brec)
+}
+
+func (b *BroadcastsDB) Get(txid string) (*wallet.PendingBroadcast, error) {
+	brec, err := b.get(txid)
+	if err != nil {
+		return nil, err
+	}
+	return brec.pendingBroadcast(), nil
+}
+
+func (b *BroadcastsDB) GetAll() ([]*wallet.PendingBroadcast, error) {
+	var broadcasts []*wallet.PendingBroadcast
+	brecList, err := b.getAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, brec := range brecList {
+		broadcasts = append(broadcasts, brec.pendingBroadcast())
+	}
+	return broadcasts, nil
+}
+
+func (b *BroadcastsDB) Delete(txid string) error {
+	return b.delete(txid)
+}
+
+// DB access record
+type broadcastRec struct {
+	// Unique key - Used as K & V[Txid]
+	Txid        string `json:"txid"`
+	RawTx       []byte `json:"tx"`
+	Created     int64  `json:"created"`
+	Attempts    int    `json:"attempts"`
+	LastAttempt int64  `json:"last_attempt"`
+	LastError   string `json:"last_error"`
+}
+
+func (brec *broadcastRec) pendingBroadcast() *wallet.PendingBroadcast {
+	return &wallet.PendingBroadcast{
+		Txid:        brec.Txid,
+		RawTx:       brec.RawTx,
+		Created:     time.Unix(brec.Created, 0),
+		Attempts:    brec.Attempts,
+		LastAttempt: time.Unix(brec.LastAttempt, 0),
+		LastError:   brec.LastError,
+	}
+}
+
+func (b *BroadcastsDB) put(brec *broadcastRec) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	key := []byte(brec.Txid)
+	value, err := json.Marshal(brec)
+	if err != nil {
+		return err
+	}
+
+	e := b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(broadcastsBkt)
+		if bkt == nil {
+			return ErrBucketNotFound
+		}
+		err := bkt.Put(key, value)
+		return err
+	})
+
+	return e
+}
+
+func (b *BroadcastsDB) get(txid string) (*broadcastRec, error) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	key := []byte(txid)
+
+	var brec broadcastRec
+	e := b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(broadcastsBkt)
+		if bkt == nil {
+			return ErrBucketNotFound
+		}
+		value := bkt.Get(key)
+		if value == nil {
+			return ErrBroadcastNotFound
+		}
+		err := json.Unmarshal(value, &brec)
+		return err
+	})
+
+	return &brec, e
+}
+
+func (b *BroadcastsDB) getAll() ([]broadcastRec, error) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	var brecList []broadcastRec
+	e := b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(broadcastsBkt)
+		if bkt == nil {
+			return ErrBucketNotFound
+		}
+		c := bkt.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var brec broadcastRec
+			err := json.Unmarshal(v, &brec)
+			if err != nil {
+				return err
+			}
+			brecList = append(brecList, brec)
+		}
+		return nil
+	})
+
+	return brecList, e
+}
+
+func (b *BroadcastsDB) delete(txid string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	key := []byte(txid)
+
+	e := b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(broadcastsBkt)
+		if bkt == nil {
+			return ErrBucketNotFound
+		}
+		err := bkt.Delete(key)
+		return err
+	})
+
+	return e
+}
@@ -0,0 +1,95 @@
+package bdb
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dev-warrior777/go-electrum-client/wallet"
+	bolt "go.etcd.io/bbolt"
+)
+
+var bcdb *BroadcastsDB
+
+func setupBcdb() error {
+	bdb, err := bolt.Open("test_broadcasts.bdb", 0600, nil)
+	if err != nil {
+		return err
+	}
+	err = initDatabaseBuckets(bdb)
+	if err != nil {
+		return err
+	}
+	bcdb = &BroadcastsDB{
+		db:   bdb,
+		lock: new(sync.RWMutex),
+	}
+	return nil
+}
+
+func teardownBcdb() {
+	if bcdb == nil {
+		return
+	}
+	bcdb.db.Close()
+	os.RemoveAll("test_broadcasts.bdb")
+}
+
+func TestBroadcastsDB_PutGet(t *testing.T) {
+	if err := setupBcdb(); err != nil {
+		t.Fatal(err)
+	}
+	defer teardownBcdb()
+
+	pb := &wallet.PendingBroadcast{
+		Txid:        "txid1",
+		RawTx:       []byte{0x01, 0x02, 0x03},
+		Created:     time.Unix(1700000000, 0),
+		Attempts:    1,
+		LastAttempt: time.Unix(1700000060, 0),
+		LastError:   "connection reset",
+	}
+	err := bcdb.Put(pb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := bcdb.Get("txid1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.RawTx, pb.RawTx) || !got.Created.Equal(pb.Created) ||
+		got.Attempts != 1 || !got.LastAttempt.Equal(pb.LastAttempt) || got.LastError != pb.LastError {
+		t.Errorf("got %+v, want %+v", got, pb)
+	}
+}
+
+func TestBroadcastsDB_GetAllDelete(t *testing.T) {
+	if err := setupBcdb(); err != nil {
+		t.Fatal(err)
+	}
+	defer teardownBcdb()
+
+	for _, txid := range []string{"txid2", "txid3"} {
+		err := bcdb.Put(&wallet.PendingBroadcast{Txid: txid, RawTx: []byte{0x01}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := bcdb.Delete("txid2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := bcdb.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].Txid != "txid3" {
+		t.Errorf("expected only txid3, got %d broadcasts", len(all))
+	}
+	_, err = bcdb.Get("txid2")
+	if err != ErrBroadcastNotFound {
+		t.Errorf("expected ErrBroadcastNotFound, got %v", err)
+	}
+}
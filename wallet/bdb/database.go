@@ -19,6 +19,7 @@ var (
 	stxosBkt         = []byte("stxos")
 	txnsBkt          = []byte("txns")
 	subscriptionsBkt = []byte("subscriptions")
+	broadcastsBkt    = []byte("broadcasts")
 	configBkt        = []byte("config")
 	encBkt           = []byte("enc")
 )
@@ -31,6 +32,7 @@ type BoltDatastore struct {
 	stxos         wallet.Stxos
 	txns          wallet.Txns
 	subscriptions wallet.Subscriptions
+	broadcasts    wallet.Broadcasts
 	cfg           wallet.Cfg
 	enc           wallet.Enc
 	db            *bolt.DB
@@ -85,6 +87,10 @@ func dbSetup(bdb *bolt.DB) (*BoltDatastore, error) {
 			db:   bdb,
 			lock: l,
 		},
+		broadcasts: &BroadcastsDB{
+			db:   bdb,
+			lock: l,
+		},
 		db:   bdb,
 		lock: l,
 	}
@@ -113,12 +119,16 @@ func (db *BoltDatastore) Txns() wallet.Txns {
 func (db *BoltDatastore) Subscriptions() wallet.Subscriptions {
 	return db.subscriptions
 }
+func (db *BoltDatastore) Broadcasts() wallet.Broadcasts {
+	return db.broadcasts
+}
 
 //		create table if not exists keys (scriptAddress text primary key not null, purpose integer, keyIndex integer, used integer);
 //		create table if not exists utxos (outpoint text primary key not null, value integer, height integer, scriptPubKey text, watchOnly integer, frozen integer);
 //		create table if not exists stxos (outpoint text primary key not null, value integer, height integer, scriptPubKey text, watchOnly integer, spendHeight integer, spendTxid text);
 //		create table if not exists txns (txid text primary key not null, value integer, height integer, timestamp integer, watchOnly integer, tx blob);
 //		create table if not exists subscriptions (scriptPubKey text primary key not null, electrumScripthash text, address text);
+//		create table if not exists broadcasts (txid text primary key not null, tx blob, created integer, attempts integer, lastAttempt integer, lastError text);
 //		create table if not exists config(key text primary key not null, value blob);
 //		create table if not exists enc(key text primary key not null, value blob);
 
@@ -158,6 +168,13 @@ func initDatabaseBuckets(db *bolt.DB) error {
 		}
 		return nil
 	})
+	db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(broadcastsBkt)
+		if err != nil {
+			return fmt.Errorf("create broadcasts bucket: %s", err)
+		}
+		return nil
+	})
 	db.Update(func(tx *bolt.Tx) error {
 		_, err := tx.CreateBucketIfNotExists(configBkt)
 		if err != nil {
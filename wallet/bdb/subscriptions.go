@@ -19,6 +19,7 @@ func (s *SubscriptionsDB) Put(subscription *wallet.Subscription) error {
 		ScriptPubKey:       subscription.PkScript,
 		ElectrumScripthash: subscription.ElectrumScripthash,
 		Address:            subscription.Address,
+		History:            subscription.History,
 	}
 	return s.put(srec)
 }
@@ -32,6 +33,7 @@ func (s *SubscriptionsDB) Get(scriptPubKey string) (*wallet.Subscription, error)
 		PkScript:           srec.ScriptPubKey,
 		ElectrumScripthash: srec.ElectrumScripthash,
 		Address:            srec.Address,
+		History:            srec.History,
 	}
 	return sub, nil
 }
@@ -47,6 +49,7 @@ func (s *SubscriptionsDB) GetElectrumScripthash(electrumScripthash string) (*wal
 				PkScript:           srec.ScriptPubKey,
 				ElectrumScripthash: srec.ElectrumScripthash,
 				Address:            srec.Address,
+				History:            srec.History,
 			}, nil
 		}
 	}
@@ -64,6 +67,7 @@ func (s *SubscriptionsDB) GetAll() ([]*wallet.Subscription, error) {
 			PkScript:           srec.ScriptPubKey,
 			ElectrumScripthash: srec.ElectrumScripthash,
 			Address:            srec.Address,
+			History:            srec.History,
 		}
 		subs = append(subs, sub)
 	}
@@ -80,6 +84,8 @@ type subRec struct {
 	ScriptPubKey       string `json:"pkscript"`
 	ElectrumScripthash string `json:"electrum_scripthash"`
 	Address            string `json:"address"`
+	// server order
+	History []wallet.ScripthashHistory `json:"history,omitempty"`
 }
 
 func (s *SubscriptionsDB) put(srec *subRec) error {
@@ -248,3 +248,31 @@ func TestSubscriptionsDB_Delete(t *testing.T) {
 		t.Error("wrong length after delete spk2")
 	}
 }
+
+func TestSubscriptionsDB_History(t *testing.T) {
+	if err := setupSsdb(); err != nil {
+		t.Fatal(err)
+	}
+	defer teardownSsdb()
+	sub := &wallet.Subscription{
+		PkScript:           "spk",
+		ElectrumScripthash: "esh",
+		Address:            "add",
+		History: []wallet.ScripthashHistory{
+			{TxHash: "bb", Height: 100},
+			{TxHash: "aa", Height: 100},
+			{TxHash: "cc", Height: -1},
+		},
+	}
+	err := ssdb.Put(sub)
+	if err != nil {
+		t.Error(err)
+	}
+	subOut, err := ssdb.GetElectrumScripthash("esh")
+	if err != nil {
+		t.Error(err)
+	}
+	if !sub.IsEqual(subOut) {
+		t.Error("history not stored in server order")
+	}
+}
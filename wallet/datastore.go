@@ -100,6 +100,7 @@ type Datastore interface {
 	Txns() Txns
 	Keys() Keys
 	Subscriptions() Subscriptions
+	Broadcasts() Broadcasts
 }
 
 type Cfg interface {
@@ -213,6 +214,38 @@ type Subscriptions interface {
 	Delete(scriptPubkey string) error
 }
 
+// Broadcasts is a persistent queue of txs which could not be broadcast because
+// of network errors. They are broadcast again until they show up in the wallet
+// history or are abandoned.
+type Broadcasts interface {
+	// Add or update a pending broadcast.
+	Put(broadcast *PendingBroadcast) error
+
+	// Return the pending broadcast for the txid
+	Get(txid string) (*PendingBroadcast, error)
+
+	// Return all pending broadcasts
+	GetAll() ([]*PendingBroadcast, error)
+
+	// Delete a pending broadcast
+	Delete(txid string) error
+}
+
+type PendingBroadcast struct {
+	// Transaction ID
+	Txid string
+	// The serialized transaction
+	RawTx []byte
+	// When first queued
+	Created time.Time
+	// Broadcast attempts so far
+	Attempts int
+	// When last attempted
+	LastAttempt time.Time
+	// Why the last attempt failed
+	LastError string
+}
+
 type Subscription struct {
 	// wallet subscribe watch list public key script; hex string
 	PkScript string
@@ -220,6 +253,17 @@ type Subscription struct {
 	ElectrumScripthash string
 	// address
 	Address string // encoded legacy or bech address
+	// history of the scripthash in server order as last got from ElectrumX.
+	// Its electrum status is our status for the scripthash.
+	History []ScripthashHistory
+}
+
+// ScripthashHistory is one tx of the ElectrumX history of a scripthash.
+type ScripthashHistory struct {
+	// Transaction ID
+	TxHash string `json:"tx_hash"`
+	// Block height or 0 in the mempool, -1 with an unconfirmed parent
+	Height int64 `json:"height"`
 }
 
 func (s *Subscription) IsEqual(alt *Subscription) bool {
@@ -235,6 +279,14 @@ func (s *Subscription) IsEqual(alt *Subscription) bool {
 	if alt.Address != s.Address {
 		return false
 	}
+	if len(alt.History) != len(s.History) {
+		return false
+	}
+	for i, h := range s.History {
+		if alt.History[i] != h {
+			return false
+		}
+	}
 	return true
 }
 
@@ -373,6 +425,9 @@ const (
 	StatusStuck       StatusCode = "STUCK"
 	StatusDead        StatusCode = "DEAD"
 	StatusError       StatusCode = "ERROR"
+	// The server claimed the tx was mined but the SPV merkle proof against our
+	// own block headers failed. The tx is kept unconfirmed.
+	StatusUnverified StatusCode = "UNVERIFIED"
 )
 
 type KeyPath struct {
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/dev-warrior777/go-electrum-client/wallet"
+)
+
+type BroadcastsDB struct {
+	db   *sql.DB
+	lock *sync.RWMutex
+}
+
+func (b *BroadcastsDB) Put(broadcast *wallet.PendingBroadcast) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	tx, _ := b.db.Begin()
+	stmt, err := tx.Prepare("insert or replace into broadcasts(txid, tx, created, attempts, lastAttempt, lastError) values(?,?,?,?,?,?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(
+		broadcast.Txid,
+		broadcast.RawTx,
+		broadcast.Created.Unix(),
+		broadcast.Attempts,
+		broadcast.LastAttempt.Unix(),
+		broadcast.LastError)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	tx.Commit()
+	return nil
+}
+
+func (b *BroadcastsDB) Get(txid string) (*wallet.PendingBroadcast, error) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	stmt, err := b.db.Prepare("select tx, created, attempts, lastAttempt, lastError from broadcasts where txid=?")
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	var rawTx []byte
+	var created int64
+	var attempts int
+	var lastAttempt int64
+	var lastError string
+	err = stmt.QueryRow(txid).Scan(&rawTx, &created, &attempts, &lastAttempt, &lastError)
+	if err != nil {
+		return nil, err
+	}
+	return &wallet.PendingBroadcast{
+		Txid:        txid,
+		RawTx:       rawTx,
+		Created:     time.Unix(created, 0),
+		Attempts:    attempts,
+		LastAttempt: time.Unix(lastAttempt, 0),
+		LastError:   lastError,
+	}, nil
+}
+
+func (b *BroadcastsDB) GetAll() ([]*wallet.PendingBroadcast, error) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	var broadcasts []*wallet.PendingBroadcast
+	stm := "select txid, tx, created, attempts, lastAttempt, lastError from broadcasts"
+	rows, err := b.db.Query(stm)
+	if err != nil {
+		return broadcasts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var txid string
+		var rawTx []byte
+		var created int64
+		var attempts int
+		var lastAttempt int64
+		var lastError string
+		if err := rows.Scan(&txid, &rawTx, &created, &attempts, &lastAttempt, &lastError); err != nil {
+			continue
+		}
+		broadcasts = append(broadcasts, &wallet.PendingBroadcast{
+			Txid:        txid,
+			RawTx:       rawTx,
+			Created:     time.Unix(created, 0),
+			Attempts:    attempts,
+			LastAttempt: time.Unix(lastAttempt, 0),
+			LastError:   lastError,
+		})
+	}
+	return broadcasts, nil
+}
+
+func (b *BroadcastsDB) Delete(txid string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	_, err := b.db.Exec("delete from broadcasts where txid=?", txid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
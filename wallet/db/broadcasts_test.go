@@ -0,0 +1,86 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dev-warrior777/go-electrum-client/wallet"
+)
+
+var bcdb BroadcastsDB
+
+func init() {
+	conn, _ := sql.Open("sqlite3", ":memory:")
+	initDatabaseTables(conn)
+	bcdb = BroadcastsDB{
+		db:   conn,
+		lock: new(sync.RWMutex),
+	}
+}
+
+func TestBroadcastsDB_PutGet(t *testing.T) {
+	pb := &wallet.PendingBroadcast{
+		Txid:        "txid1",
+		RawTx:       []byte{0x01, 0x02, 0x03},
+		Created:     time.Unix(1700000000, 0),
+		Attempts:    1,
+		LastAttempt: time.Unix(1700000060, 0),
+		LastError:   "connection reset",
+	}
+	err := bcdb.Put(pb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := bcdb.Get("txid1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.RawTx, pb.RawTx) || !got.Created.Equal(pb.Created) ||
+		got.Attempts != 1 || !got.LastAttempt.Equal(pb.LastAttempt) || got.LastError != pb.LastError {
+		t.Errorf("got %+v, want %+v", got, pb)
+	}
+
+	// update
+	pb.Attempts = 2
+	pb.LastError = "timeout"
+	err = bcdb.Put(pb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = bcdb.Get("txid1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Attempts != 2 || got.LastError != "timeout" {
+		t.Errorf("update not stored: %+v", got)
+	}
+}
+
+func TestBroadcastsDB_GetAllDelete(t *testing.T) {
+	for _, txid := range []string{"txid2", "txid3"} {
+		err := bcdb.Put(&wallet.PendingBroadcast{Txid: txid, RawTx: []byte{0x01}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := bcdb.Delete("txid2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := bcdb.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pb := range all {
+		if pb.Txid == "txid2" {
+			t.Error("deleted broadcast returned")
+		}
+	}
+	_, err = bcdb.Get("txid2")
+	if err == nil {
+		t.Error("expected error getting deleted broadcast")
+	}
+}
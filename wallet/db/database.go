@@ -19,6 +19,7 @@ type SQLiteDatastore struct {
 	stxos         wallet.Stxos
 	txns          wallet.Txns
 	subscriptions wallet.Subscriptions
+	broadcasts    wallet.Broadcasts
 	db            *sql.DB
 	lock          *sync.RWMutex
 }
@@ -60,6 +61,10 @@ func Create(repoPath string) (*SQLiteDatastore, error) {
 			db:   conn,
 			lock: l,
 		},
+		broadcasts: &BroadcastsDB{
+			db:   conn,
+			lock: l,
+		},
 		db:   conn,
 		lock: l,
 	}
@@ -88,6 +93,9 @@ func (db *SQLiteDatastore) Txns() wallet.Txns {
 func (db *SQLiteDatastore) Subscriptions() wallet.Subscriptions {
 	return db.subscriptions
 }
+func (db *SQLiteDatastore) Broadcasts() wallet.Broadcasts {
+	return db.broadcasts
+}
 
 func initDatabaseTables(db *sql.DB) error {
 	var sqlStmt string
@@ -96,7 +104,8 @@ func initDatabaseTables(db *sql.DB) error {
 	create table if not exists utxos (outpoint text primary key not null, value integer, height integer, scriptPubKey text, watchOnly integer, frozen integer);
 	create table if not exists stxos (outpoint text primary key not null, value integer, height integer, scriptPubKey text, watchOnly integer, spendHeight integer, spendTxid text);
 	create table if not exists txns (txid text primary key not null, value integer, height integer, timestamp integer, watchOnly integer, tx blob);
-	create table if not exists subscriptions (scriptPubKey text primary key not null, electrumScripthash text, address text);
+	create table if not exists subscriptions (scriptPubKey text primary key not null, electrumScripthash text, address text, history blob);
+	create table if not exists broadcasts (txid text primary key not null, tx blob, created integer, attempts integer, lastAttempt integer, lastError text);
 	create table if not exists config(key text primary key not null, value blob);
 	create table if not exists enc(key text primary key not null, value blob);
 	`
@@ -104,5 +113,30 @@ func initDatabaseTables(db *sql.DB) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	// columns added since the table was first created
+	return addColumnMaybe(db, "subscriptions", "history", "blob")
+}
+
+// addColumnMaybe adds a column to a table of a database created before the
+// column was.
+func addColumnMaybe(db *sql.DB, table, column, colType string) error {
+	rows, err := db.Query("select name from pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = db.Exec("alter table " + table + " add column " + column + " " + colType)
+	return err
 }
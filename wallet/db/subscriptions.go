@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"sync"
 
 	"github.com/dev-warrior777/go-electrum-client/wallet"
@@ -15,14 +16,18 @@ type SubscriptionsDB struct {
 func (s *SubscriptionsDB) Put(subscription *wallet.Subscription) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
+	history, err := json.Marshal(subscription.History)
+	if err != nil {
+		return err
+	}
 	tx, _ := s.db.Begin()
-	stmt, err := tx.Prepare("insert or replace into subscriptions(scriptPubKey, electrumScripthash, address) values(?,?,?)")
+	stmt, err := tx.Prepare("insert or replace into subscriptions(scriptPubKey, electrumScripthash, address, history) values(?,?,?,?)")
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
 	defer stmt.Close()
-	_, err = stmt.Exec(subscription.PkScript, subscription.ElectrumScripthash, subscription.Address)
+	_, err = stmt.Exec(subscription.PkScript, subscription.ElectrumScripthash, subscription.Address, history)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -35,14 +40,15 @@ func (s *SubscriptionsDB) Get(scriptPubKey string) (*wallet.Subscription, error)
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 	var sub *wallet.Subscription
-	stmt, err := s.db.Prepare("select electrumScripthash, address from subscriptions where scriptPubKey=?")
+	stmt, err := s.db.Prepare("select electrumScripthash, address, history from subscriptions where scriptPubKey=?")
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 	var electrumScripthash string
 	var address string
-	err = stmt.QueryRow(scriptPubKey).Scan(&electrumScripthash, &address)
+	var history []byte
+	err = stmt.QueryRow(scriptPubKey).Scan(&electrumScripthash, &address, &history)
 	if err != nil {
 		return nil, err
 	}
@@ -50,6 +56,7 @@ func (s *SubscriptionsDB) Get(scriptPubKey string) (*wallet.Subscription, error)
 		PkScript:           scriptPubKey,
 		ElectrumScripthash: electrumScripthash,
 		Address:            address,
+		History:            decodeHistory(history),
 	}
 	return sub, nil
 }
@@ -58,14 +65,15 @@ func (s *SubscriptionsDB) GetElectrumScripthash(electrumScripthash string) (*wal
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 	var sub *wallet.Subscription
-	stmt, err := s.db.Prepare("select scriptPubKey, address from subscriptions where electrumScripthash=?")
+	stmt, err := s.db.Prepare("select scriptPubKey, address, history from subscriptions where electrumScripthash=?")
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 	var scriptPubKey string
 	var address string
-	err = stmt.QueryRow(electrumScripthash).Scan(&scriptPubKey, &address)
+	var history []byte
+	err = stmt.QueryRow(electrumScripthash).Scan(&scriptPubKey, &address, &history)
 	if err != nil {
 		return nil, err
 	}
@@ -73,6 +81,7 @@ func (s *SubscriptionsDB) GetElectrumScripthash(electrumScripthash string) (*wal
 		PkScript:           scriptPubKey,
 		ElectrumScripthash: electrumScripthash,
 		Address:            address,
+		History:            decodeHistory(history),
 	}
 	return sub, nil
 }
@@ -81,7 +90,7 @@ func (s *SubscriptionsDB) GetAll() ([]*wallet.Subscription, error) {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 	var subs []*wallet.Subscription
-	stm := "select scriptPubKey, electrumScripthash, address from subscriptions"
+	stm := "select scriptPubKey, electrumScripthash, address, history from subscriptions"
 	rows, err := s.db.Query(stm)
 	if err != nil {
 		return subs, err
@@ -91,13 +100,15 @@ func (s *SubscriptionsDB) GetAll() ([]*wallet.Subscription, error) {
 		var scriptPubKey string
 		var electrumScripthash string
 		var address string
-		if err := rows.Scan(&scriptPubKey, &electrumScripthash, &address); err != nil {
+		var history []byte
+		if err := rows.Scan(&scriptPubKey, &electrumScripthash, &address, &history); err != nil {
 			continue
 		}
 		sub := &wallet.Subscription{
 			PkScript:           scriptPubKey,
 			ElectrumScripthash: electrumScripthash,
 			Address:            address,
+			History:            decodeHistory(history),
 		}
 		subs = append(subs, sub)
 	}
@@ -113,3 +124,13 @@ func (s *SubscriptionsDB) Delete(scriptPubKey string) error {
 	}
 	return nil
 }
+
+// decodeHistory decodes a stored scripthash history. A subscription stored
+// before its history was, or whose history does not decode, has none.
+func decodeHistory(b []byte) []wallet.ScripthashHistory {
+	var history []wallet.ScripthashHistory
+	if len(b) == 0 || json.Unmarshal(b, &history) != nil {
+		return nil
+	}
+	return history
+}
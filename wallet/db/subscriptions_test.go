@@ -211,3 +211,54 @@ func TestSubscriptionsDB_Delete(t *testing.T) {
 		t.Error("wrong length after delete spk2")
 	}
 }
+
+func TestSubscriptionsDB_History(t *testing.T) {
+	sub := &wallet.Subscription{
+		PkScript:           "spk",
+		ElectrumScripthash: "esh",
+		Address:            "add",
+		History: []wallet.ScripthashHistory{
+			{TxHash: "bb", Height: 100},
+			{TxHash: "aa", Height: 100},
+			{TxHash: "cc", Height: -1},
+		},
+	}
+	err := ssdb.Put(sub)
+	if err != nil {
+		t.Error(err)
+	}
+	subOut, err := ssdb.GetElectrumScripthash("esh")
+	if err != nil {
+		t.Error(err)
+	}
+	if !sub.IsEqual(subOut) {
+		t.Error("history not stored in server order")
+	}
+	ssdb.Delete("spk")
+}
+
+func TestSubscriptionsDB_AddHistoryColumn(t *testing.T) {
+	conn, _ := sql.Open("sqlite3", ":memory:")
+	defer conn.Close()
+	// as created before the history column
+	_, err := conn.Exec("create table subscriptions (scriptPubKey text primary key not null, electrumScripthash text, address text);" +
+		"insert into subscriptions(scriptPubKey, electrumScripthash, address) values('spk', 'esh', 'add');")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := initDatabaseTables(conn); err != nil {
+		t.Fatal(err)
+	}
+	// and again once added
+	if err := initDatabaseTables(conn); err != nil {
+		t.Fatal(err)
+	}
+	s := SubscriptionsDB{db: conn, lock: new(sync.RWMutex)}
+	sub, err := s.Get("spk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.ElectrumScripthash != "esh" || sub.History != nil {
+		t.Fatalf("got %+v", sub)
+	}
+}
@@ -24,6 +24,13 @@ type Fees struct {
 	Economic int64 `json:"economic"`
 }
 
+// FeeEstimator estimates the fee per byte for a fee level from current
+// network conditions. It should cache its results as FeeProvider consults it
+// for every fee.
+type FeeEstimator interface {
+	EstimateFeePerByte(feeLevel FeeLevel) (int64, error)
+}
+
 type FeeProvider struct {
 	MaxFee      int64
 	PriorityFee int64
@@ -33,6 +40,10 @@ type FeeProvider struct {
 
 	HttpClient HttpClient
 
+	// If set the estimator is consulted first. The FeeAPI or the defaults are
+	// used if it fails.
+	Estimator FeeEstimator
+
 	cache *feeCache
 }
 
@@ -56,6 +67,12 @@ func NewFeeProvider(maxFee, priorityFee, normalFee, economicFee int64, feeAPI st
 }
 
 func (fp *FeeProvider) GetFeePerByte(feeLevel FeeLevel) int64 {
+	if fp.Estimator != nil {
+		fee, err := fp.Estimator.EstimateFeePerByte(feeLevel)
+		if err == nil && fee > 0 {
+			return fp.selectFee(fee, feeLevel)
+		}
+	}
 	if fp.FeeAPI == "" {
 		return fp.defaultFee(feeLevel)
 	}
@@ -45,6 +45,9 @@ type WalletConfig struct {
 	// The highest allowable fee-per-byte
 	MaxFee int64
 
+	// Optional estimator for fee levels from current network conditions
+	FeeEstimator FeeEstimator
+
 	// If not testing do not overwrite existing wallet files
 	Testing bool
 }
@@ -121,6 +124,15 @@ type ElectrumWallet interface {
 	// Returns all the ElectrumX subscribed subscriptions in db.
 	ListSubscriptions() ([]*Subscription, error)
 
+	// Add or update a tx waiting to be broadcast again after a network error.
+	AddPendingBroadcast(broadcast *PendingBroadcast) error
+
+	// Remove a tx from the pending broadcasts once it is seen or abandoned.
+	RemovePendingBroadcast(txid string) error
+
+	// Returns all the txs waiting to be broadcast again.
+	ListPendingBroadcasts() ([]*PendingBroadcast, error)
+
 	// Returns if the wallet has the HD key for the given address
 	HasAddress(address btcutil.Address) bool
 
@@ -159,6 +171,16 @@ type ElectrumWallet interface {
 	// Add a transaction to the database
 	AddTransaction(tx *wire.MsgTx, height int64, timestamp time.Time) error
 
+	// Mark a transaction as having failed SPV merkle proof verification. The
+	// transaction is reported with StatusUnverified until it is added again
+	// with a verified, confirmed height.
+	MarkTxUnverified(txid string, reason error)
+
+	// Set transactions, utxos and stxos stored as mined above forkHeight back
+	// to unconfirmed after a blockchain reorg. Their heights are restored when
+	// the transaction history is fetched again.
+	RollbackToHeight(forkHeight int64) error
+
 	// List all unspent outputs in the wallet irrespective of status
 	ListUnspent() ([]Utxo, error)
 
@@ -184,6 +206,9 @@ type ElectrumWallet interface {
 	// Calculates the estimated size of the transaction and returns the total fee for the given feePerByte
 	EstimateFee(ins []InputInfo, outs []TransactionOutput, feePerByte int64) int64
 
+	// The highest fee per byte the wallet will pay
+	MaxFeePerByte() int64
+
 	// Build a transaction that sweeps all coins from a non-wallet private key
 	SweepCoins(coins []InputInfo, feeLevel FeeLevel, maxTxInputs int) ([]*wire.MsgTx, error)
 
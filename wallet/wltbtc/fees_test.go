@@ -2,6 +2,7 @@ package wltbtc
 
 import (
 	"bytes"
+	"errors"
 	"net/http"
 	"testing"
 
@@ -76,3 +77,34 @@ func TestFeeProvider_GetFeePerByte(t *testing.T) {
 		t.Error("Returned incorrect fee per byte")
 	}
 }
+
+type mockFeeEstimator struct {
+	fee int64
+	err error
+}
+
+func (m *mockFeeEstimator) EstimateFeePerByte(feeLevel wallet.FeeLevel) (int64, error) {
+	return m.fee, m.err
+}
+
+func TestFeeProvider_Estimator(t *testing.T) {
+	fp := wallet.NewFeeProvider(2000, 360, 320, 280, "", nil)
+	estimator := &mockFeeEstimator{fee: 42}
+	fp.Estimator = estimator
+
+	if fp.GetFeePerByte(wallet.NORMAL) != 42 {
+		t.Error("Returned incorrect fee per byte")
+	}
+
+	// Test clamp to max
+	estimator.fee = 5000
+	if fp.GetFeePerByte(wallet.PRIORITY) != 2000 {
+		t.Error("Returned incorrect fee per byte")
+	}
+
+	// Test fall back to defaults
+	estimator.err = errors.New("no estimate")
+	if fp.GetFeePerByte(wallet.ECONOMIC) != 280 {
+		t.Error("Returned incorrect fee per byte")
+	}
+}
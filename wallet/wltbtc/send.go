@@ -234,6 +234,10 @@ func (w *BtcElectrumWallet) GetFeePerByte(feeLevel wallet.FeeLevel) int64 {
 	return w.feeProvider.GetFeePerByte(feeLevel)
 }
 
+func (w *BtcElectrumWallet) MaxFeePerByte() int64 {
+	return w.feeProvider.MaxFee
+}
+
 func (w *BtcElectrumWallet) EstimateFee(
 	ins []wallet.InputInfo,
 	outs []wallet.TransactionOutput,
@@ -39,6 +39,7 @@ type BtcElectrumWallet struct {
 	txstore             *TxStore
 	keyManager          *KeyManager
 	subscriptionManager *SubscriptionManager
+	broadcasts          wallet.Broadcasts
 
 	mutex *sync.RWMutex
 
@@ -101,6 +102,7 @@ func makeBtcElectrumWallet(config *wallet.WalletConfig, pw string, seed []byte)
 		feeProvider:  wallet.DefaultFeeProvider(),
 		mutex:        new(sync.RWMutex),
 	}
+	w.feeProvider.Estimator = config.FeeEstimator
 
 	sm := NewStorageManager(config.DB.Enc(), config.Params)
 	sm.store.Version = "0.1"
@@ -129,6 +131,7 @@ func makeBtcElectrumWallet(config *wallet.WalletConfig, pw string, seed []byte)
 	}
 
 	w.subscriptionManager = NewSubscriptionManager(config.DB.Subscriptions(), w.params)
+	w.broadcasts = config.DB.Broadcasts()
 
 	err = config.DB.Cfg().PutCreationDate(w.creationDate)
 	if err != nil {
@@ -167,6 +170,7 @@ func loadBtcElectrumWallet(config *wallet.WalletConfig, pw string) (*BtcElectrum
 		feeProvider:    wallet.DefaultFeeProvider(),
 		mutex:          new(sync.RWMutex),
 	}
+	w.feeProvider.Estimator = config.FeeEstimator
 
 	w.keyManager, err = NewKeyManager(config.DB.Keys(), w.params, mPrivKey)
 	mPrivKey.Zero()
@@ -180,6 +184,7 @@ func loadBtcElectrumWallet(config *wallet.WalletConfig, pw string) (*BtcElectrum
 	}
 
 	w.subscriptionManager = NewSubscriptionManager(config.DB.Subscriptions(), w.params)
+	w.broadcasts = config.DB.Broadcasts()
 
 	w.creationDate, err = config.DB.Cfg().GetCreationDate()
 	if err != nil {
@@ -339,6 +344,18 @@ func (w *BtcElectrumWallet) ListSubscriptions() ([]*wallet.Subscription, error)
 	return w.subscriptionManager.GetAll()
 }
 
+func (w *BtcElectrumWallet) AddPendingBroadcast(broadcast *wallet.PendingBroadcast) error {
+	return w.broadcasts.Put(broadcast)
+}
+
+func (w *BtcElectrumWallet) RemovePendingBroadcast(txid string) error {
+	return w.broadcasts.Delete(txid)
+}
+
+func (w *BtcElectrumWallet) ListPendingBroadcasts() ([]*wallet.PendingBroadcast, error) {
+	return w.broadcasts.GetAll()
+}
+
 func (w *BtcElectrumWallet) HasAddress(address btcutil.Address) bool {
 	_, err := w.keyManager.GetKeyForScript(address.ScriptAddress())
 	return err == nil
@@ -419,7 +436,14 @@ func (w *BtcElectrumWallet) Balance() (int64, int64, int64, error) {
 }
 
 func (w *BtcElectrumWallet) ListTransactions() ([]wallet.Txn, error) {
-	return w.txstore.Txns().GetAll(false)
+	txns, err := w.txstore.Txns().GetAll(false)
+	if err != nil {
+		return nil, err
+	}
+	for i := range txns {
+		w.txstore.setTxnStatus(&txns[i], w.blockchainTip)
+	}
+	return txns, nil
 }
 
 func (w *BtcElectrumWallet) HasTransaction(txid string) (bool, *wallet.Txn) {
@@ -428,6 +452,7 @@ func (w *BtcElectrumWallet) HasTransaction(txid string) (bool, *wallet.Txn) {
 	if err != nil {
 		return false, nil
 	}
+	w.txstore.setTxnStatus(&txn, w.blockchainTip)
 	return true, &txn
 }
 
@@ -436,6 +461,7 @@ func (w *BtcElectrumWallet) GetTransaction(txid string) (*wallet.Txn, error) {
 	if err != nil {
 		return nil, fmt.Errorf("no such transaction")
 	}
+	w.txstore.setTxnStatus(&txn, w.blockchainTip)
 	return &txn, err
 }
 
@@ -453,6 +479,16 @@ func (w *BtcElectrumWallet) AddTransaction(tx *wire.MsgTx, height int64, timesta
 	return err
 }
 
+// Mark a transaction as failing SPV merkle proof verification
+func (w *BtcElectrumWallet) MarkTxUnverified(txid string, reason error) {
+	w.txstore.MarkUnverified(txid, reason)
+}
+
+// Unconfirm all wallet txs and outputs mined above a reorg fork height
+func (w *BtcElectrumWallet) RollbackToHeight(forkHeight int64) error {
+	return w.txstore.RollbackToHeight(forkHeight)
+}
+
 // List all unspent outputs in the wallet
 func (w *BtcElectrumWallet) ListUnspent() ([]wallet.Utxo, error) {
 	return w.txstore.Utxos().GetAll()
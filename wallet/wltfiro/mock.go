@@ -32,6 +32,7 @@ func createTxStore() (*TxStore, *StorageManager) {
 		&mockStxoStore{make(map[string]*wallet.Stxo)},
 		&mockTxnStore{make(map[string]*wallet.Txn)},
 		&mockSubscriptionsStore{make(map[string]*wallet.Subscription)},
+		&mockBroadcastsStore{make(map[string]*wallet.PendingBroadcast)},
 	}
 
 	seed := makeRegtestSeed()
@@ -57,6 +58,7 @@ func MockWallet(pw string) *FiroElectrumWallet {
 		storageManager: storageMgr,
 		params:         &chaincfg.RegressionNetParams,
 		feeProvider:    wallet.DefaultFeeProvider(),
+		broadcasts:     &mockBroadcastsStore{make(map[string]*wallet.PendingBroadcast)},
 	}
 
 	// fundWallet(wallet)
@@ -72,6 +74,7 @@ type MockDatastore struct {
 	stxos            wallet.Stxos
 	txns             wallet.Txns
 	subscribeScripts wallet.Subscriptions
+	broadcasts       wallet.Broadcasts
 }
 
 func (m *MockDatastore) Cfg() wallet.Cfg {
@@ -102,6 +105,10 @@ func (m *MockDatastore) Subscriptions() wallet.Subscriptions {
 	return m.subscribeScripts
 }
 
+func (m *MockDatastore) Broadcasts() wallet.Broadcasts {
+	return m.broadcasts
+}
+
 type mockConfig struct {
 	creationDate time.Time
 }
@@ -439,6 +446,39 @@ func (m *mockSubscriptionsStore) Delete(scriptPubKey string) error {
 	return nil
 }
 
+type mockBroadcastsStore struct {
+	broadcasts map[string]*wallet.PendingBroadcast
+}
+
+func (m *mockBroadcastsStore) Put(broadcast *wallet.PendingBroadcast) error {
+	if broadcast == nil {
+		return errors.New("nil broadcast")
+	}
+	m.broadcasts[broadcast.Txid] = broadcast
+	return nil
+}
+
+func (m *mockBroadcastsStore) Get(txid string) (*wallet.PendingBroadcast, error) {
+	broadcast, ok := m.broadcasts[txid]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return broadcast, nil
+}
+
+func (m *mockBroadcastsStore) GetAll() ([]*wallet.PendingBroadcast, error) {
+	var ret []*wallet.PendingBroadcast
+	for _, broadcast := range m.broadcasts {
+		ret = append(ret, broadcast)
+	}
+	return ret, nil
+}
+
+func (m *mockBroadcastsStore) Delete(txid string) error {
+	delete(m.broadcasts, txid)
+	return nil
+}
+
 func TestUtxo_IsEqual(t *testing.T) {
 	h, err := chainhash.NewHashFromStr("16bed6368b8b1542cd6eb87f5bc20dc830b41a2258dde40438a75fa701d24e9a")
 	if err != nil {
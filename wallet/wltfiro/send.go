@@ -234,6 +234,10 @@ func (w *FiroElectrumWallet) GetFeePerByte(feeLevel wallet.FeeLevel) int64 {
 	return w.feeProvider.GetFeePerByte(feeLevel)
 }
 
+func (w *FiroElectrumWallet) MaxFeePerByte() int64 {
+	return w.feeProvider.MaxFee
+}
+
 func (w *FiroElectrumWallet) EstimateFee(
 	ins []wallet.InputInfo,
 	outs []wallet.TransactionOutput,
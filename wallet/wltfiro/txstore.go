@@ -20,6 +20,9 @@ type TxStore struct {
 	adrs       []btcutil.Address
 	txids      map[string]int64 // txid => height
 	txidsMutex *sync.RWMutex
+	// txids of txs that failed SPV merkle proof => reason. Memory only as the
+	// tx is stored unconfirmed and will be proved again on the next sync.
+	unverified map[string]string
 	addrMutex  *sync.Mutex
 	cbMutex    *sync.Mutex
 
@@ -38,6 +41,7 @@ func NewTxStore(params *chaincfg.Params, db wallet.Datastore, keyManager *KeyMan
 		cbMutex:    new(sync.Mutex),
 		txidsMutex: new(sync.RWMutex),
 		txids:      make(map[string]int64),
+		unverified: make(map[string]string),
 		Datastore:  db,
 	}
 	txs.PopulateAdrs()
@@ -86,6 +90,13 @@ func (ts *TxStore) AddTransaction(tx *wire.MsgTx, height int64, timestamp time.T
 		return hits, err
 	}
 
+	// a confirmed height is only passed in after the merkle proof checks out
+	if height > 0 {
+		ts.txidsMutex.Lock()
+		delete(ts.unverified, tx.TxHash().String())
+		ts.txidsMutex.Unlock()
+	}
+
 	// check if we've already processed this tx up to confirmed state.
 	ts.txidsMutex.RLock()
 	sh, ok := ts.txids[tx.TxHash().String()]
@@ -123,6 +134,13 @@ func (ts *TxStore) AddTransaction(tx *wire.MsgTx, height int64, timestamp time.T
 	}
 	ts.addrMutex.Unlock()
 
+	// outputs already spent are in stxos. When a tx is added again with a new
+	// height, say after a reorg, they must not come back as utxos.
+	spent, err := ts.Stxos().GetAll()
+	if err != nil {
+		return hits, err
+	}
+
 	// look through all outputs of this tx to see if we increase balance
 	thisTxHash := tx.TxHash()
 	value := int64(0)
@@ -145,7 +163,18 @@ func (ts *TxStore) AddTransaction(tx *wire.MsgTx, height int64, timestamp time.T
 					WatchOnly:    false,
 				}
 				value += newu.Value
-				ts.Utxos().Put(newu)
+				isSpent := false
+				for _, s := range spent {
+					if outPointsEqual(s.Utxo.Op, newop) {
+						isSpent = true
+						s.Utxo.AtHeight = height
+						ts.Stxos().Put(s)
+						break
+					}
+				}
+				if !isSpent {
+					ts.Utxos().Put(newu)
+				}
 				hits++
 				break
 			}
@@ -229,6 +258,92 @@ func (ts *TxStore) AddTransaction(tx *wire.MsgTx, height int64, timestamp time.T
 	return hits, err
 }
 
+// MarkUnverified records that the server's claimed confirmation for a tx did
+// not pass SPV merkle proof verification.
+func (ts *TxStore) MarkUnverified(txid string, reason error) {
+	ts.txidsMutex.Lock()
+	defer ts.txidsMutex.Unlock()
+	msg := "merkle proof failed"
+	if reason != nil {
+		msg = reason.Error()
+	}
+	ts.unverified[txid] = msg
+}
+
+// setTxnStatus fills in the calculated Status and Confirmations for a txn
+// from the db given the current blockchain tip.
+func (ts *TxStore) setTxnStatus(txn *wallet.Txn, tip int64) {
+	switch {
+	case txn.Height < 0:
+		txn.Status = wallet.StatusDead
+	case txn.Height == 0:
+		ts.txidsMutex.RLock()
+		reason, unverified := ts.unverified[txn.Txid]
+		ts.txidsMutex.RUnlock()
+		if unverified {
+			txn.Status = wallet.StatusUnverified
+			txn.ErrorMessage = reason
+		} else {
+			txn.Status = wallet.StatusUnconfirmed
+		}
+	default:
+		txn.Status = wallet.StatusConfirmed
+		if tip >= txn.Height {
+			txn.Confirmations = tip - txn.Height + 1
+		}
+	}
+}
+
+// RollbackToHeight sets all txns, utxos and stxos above forkHeight back to
+// height 0 (unconfirmed). Dead txns are left as they are.
+func (ts *TxStore) RollbackToHeight(forkHeight int64) error {
+	ts.txidsMutex.Lock()
+	defer ts.txidsMutex.Unlock()
+	txns, err := ts.Txns().GetAll(true)
+	if err != nil {
+		return err
+	}
+	for _, txn := range txns {
+		if txn.Height > forkHeight {
+			err := ts.Txns().UpdateHeight(txn.Txid, 0, txn.Timestamp)
+			if err != nil {
+				return err
+			}
+			ts.txids[txn.Txid] = 0
+		}
+	}
+	utxos, err := ts.Utxos().GetAll()
+	if err != nil {
+		return err
+	}
+	for _, u := range utxos {
+		if u.AtHeight > forkHeight {
+			u.AtHeight = 0
+			if err := ts.Utxos().Put(u); err != nil {
+				return err
+			}
+		}
+	}
+	stxos, err := ts.Stxos().GetAll()
+	if err != nil {
+		return err
+	}
+	for _, s := range stxos {
+		if s.SpendHeight > forkHeight || s.Utxo.AtHeight > forkHeight {
+			if s.SpendHeight > forkHeight {
+				s.SpendHeight = 0
+			}
+			if s.Utxo.AtHeight > forkHeight {
+				s.Utxo.AtHeight = 0
+			}
+			if err := ts.Stxos().Put(s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (ts *TxStore) markAsDead(txid chainhash.Hash) error {
 	stxos, err := ts.Stxos().GetAll()
 	if err != nil {
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"testing"
 	"time"
+
+	"github.com/dev-warrior777/go-electrum-client/wallet"
 )
 
 type rawTx struct {
@@ -152,3 +154,51 @@ func TestBalance(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestRollbackToHeight(t *testing.T) {
+	w := MockWallet("abc")
+	err := fundWallet(w, 100, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// reorg forked below the txs
+	err = w.RollbackToHeight(99)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txns, err := w.ListTransactions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, txn := range txns {
+		if txn.Height != 0 || txn.Status != wallet.StatusUnconfirmed {
+			t.Fatalf("tx %s not rolled back: height %d status %s", txn.Txid, txn.Height, txn.Status)
+		}
+	}
+	c, u, _, err := w.Balance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != 0 || u != 588000000 {
+		t.Fatalf("bad balance after rollback: confirmed %d unconfirmed %d", c, u)
+	}
+
+	// mined again on the new chain
+	err = fundWallet(w, 101, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// reorg forked above the txs
+	err = w.RollbackToHeight(101)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, u, _, err = w.Balance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != 588000000 || u != 0 {
+		t.Fatalf("bad balance: confirmed %d unconfirmed %d", c, u)
+	}
+}